@@ -0,0 +1,44 @@
+package main
+
+import (
+        "encoding/json"
+        "os"
+        "path/filepath"
+)
+
+// amneziaSite запись списка сайтов раздельного туннелирования AmneziaVPN;
+// ip заполняет сам клиент при резолве hostname
+type amneziaSite struct {
+        Hostname string `json:"hostname"`
+        IP       string `json:"ip"`
+}
+
+func amneziaSites(list *generatedList) []amneziaSite {
+        sites := make([]amneziaSite, 0, len(list.Prefixes)+len(list.Domains))
+        for _, prefix := range list.Prefixes {
+                sites = append(sites, amneziaSite{Hostname: prefix.String()})
+        }
+        for _, domain := range list.Domains {
+                sites = append(sites, amneziaSite{Hostname: trimDomainDot(domain)})
+        }
+        return sites
+}
+
+// generateAmneziaSites пишет <list>.json для импорта в AmneziaVPN
+// (Раздельное туннелирование -> Импорт)
+func generateAmneziaSites(list *generatedList) error {
+        sites := amneziaSites(list)
+        if len(sites) == 0 {
+                return nil
+        }
+        data, err := json.MarshalIndent(sites, "", "    ")
+        if err != nil {
+                return err
+        }
+
+        dir := layoutDir("amnezia", list.Name, config.Amnezia.Dir)
+        if err := os.MkdirAll(dir, 0755); err != nil {
+                return err
+        }
+        return writeFileStaged(filepath.Join(dir, list.Name+".json"), append(data, '\n'))
+}
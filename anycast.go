@@ -0,0 +1,110 @@
+package main
+
+import (
+        "log"
+        "net/netip"
+        "strings"
+
+        "go4.org/netipx"
+)
+
+// AnycastConfig порог числа ASN-источников, после которого префикс считается
+// общим anycast/CDN-пространством
+type AnycastConfig struct {
+        MinOrigins int `yaml:"min_origins"`
+}
+
+// Режимы обработки anycast-префиксов в списке
+const (
+        anycastTag     = "tag"     // Отдельный файл <name>-anycast.lst рядом со списком
+        anycastExclude = "exclude" // Убрать из списка
+)
+
+// anycastPrefixes префиксы, анонсируемые не менее чем min_origins разными ASN
+var anycastPrefixes map[netip.Prefix]bool
+
+func detectAnycast(subnets []subnetAS) {
+        if config.Anycast.MinOrigins < 2 {
+                return
+        }
+
+        origins := make(map[netip.Prefix]map[string]bool)
+        for _, item := range subnets {
+                prefix, err := netip.ParsePrefix(item.subnet)
+                if err != nil {
+                        continue
+                }
+                prefix = prefix.Masked()
+                if origins[prefix] == nil {
+                        origins[prefix] = make(map[string]bool)
+                }
+                origins[prefix][normalizeASN(item.as)] = true
+        }
+
+        anycastPrefixes = make(map[netip.Prefix]bool)
+        for prefix, asns := range origins {
+                if len(asns) >= config.Anycast.MinOrigins {
+                        anycastPrefixes[prefix] = true
+                }
+        }
+        log.Printf("Detected %d anycast prefixes", len(anycastPrefixes))
+}
+
+// listAnycast anycast-префиксы IPv4, которые анонсирует хотя бы один из asns
+func listAnycast(subnets []subnetAS, asns []string) []netip.Prefix {
+        wanted := make(map[string]bool, len(asns))
+        for _, as := range asns {
+                wanted[normalizeASN(as)] = true
+        }
+
+        var builder netipx.IPSetBuilder
+        for _, item := range subnets {
+                if !wanted[normalizeASN(item.as)] {
+                        continue
+                }
+                prefix, err := netip.ParsePrefix(item.subnet)
+                if err != nil || !prefix.Addr().Is4() || !anycastPrefixes[prefix.Masked()] {
+                        continue
+                }
+                builder.AddPrefix(prefix.Masked())
+        }
+
+        set, _ := builder.IPSet()
+        return set.Prefixes()
+}
+
+// applyAnycastPolicy помечает или исключает anycast-префиксы ASN-списка
+func applyAnycastPolicy(file, mode string, prefixes []netip.Prefix, subnets []subnetAS, asns []string) []netip.Prefix {
+        if mode == "" || anycastPrefixes == nil {
+                return prefixes
+        }
+
+        anycast := listAnycast(subnets, asns)
+        switch mode {
+        case anycastTag:
+                name := strings.TrimSuffix(file, ".lst") + "-anycast.lst"
+                if err := writeSubnetsToFile(anycast, ipv4ListPath(name)); err != nil {
+                        log.Printf("Error writing %s: %v", name, err)
+                }
+                return prefixes
+        case anycastExclude:
+                var builder netipx.IPSetBuilder
+                for _, prefix := range prefixes {
+                        builder.AddPrefix(prefix)
+                }
+                for _, prefix := range anycast {
+                        builder.RemovePrefix(prefix)
+                }
+                set, err := builder.IPSet()
+                if err != nil {
+                        return prefixes
+                }
+                if len(anycast) > 0 {
+                        log.Printf("Excluded %d anycast prefixes from %s", len(anycast), file)
+                }
+                return set.Prefixes()
+        default:
+                log.Printf("Unknown anycast mode %q for %s", mode, file)
+                return prefixes
+        }
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "log"
+        "net/netip"
+        "path"
+        "strings"
+
+        "go4.org/netipx"
+)
+
+// AWSConfig список из ip-ranges.json Amazon с отбором по service и region
+type AWSConfig struct {
+        URL           string   `yaml:"url"`      // https://ip-ranges.amazonaws.com/ip-ranges.json
+        Services      []string `yaml:"services"` // Например CLOUDFRONT, EC2; пусто - все. AMAZON - это все сети Amazon
+        Regions       []string `yaml:"regions"`  // Например eu-central-1, eu-*, GLOBAL; пусто - все
+        File          string   `yaml:"file"`
+        ListName      string   `yaml:"list_name"`
+        Tags          []string `yaml:"tags"`
+        SourceOptions `yaml:",inline"`
+}
+
+type awsIPRanges struct {
+        Prefixes []struct {
+                IPPrefix string `json:"ip_prefix"`
+                Region   string `json:"region"`
+                Service  string `json:"service"`
+        } `json:"prefixes"`
+}
+
+// rangeMatches value подходит под один из шаблонов (path.Match, без учёта регистра);
+// фильтры опубликованных диапазонов AWS и Google
+func rangeMatches(patterns []string, value string) bool {
+        if len(patterns) == 0 {
+                return true
+        }
+        for _, pattern := range patterns {
+                if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(value)); ok {
+                        return true
+                }
+        }
+        return false
+}
+
+// downloadAWSSubnets IPv4-префиксы ip-ranges.json, прошедшие фильтры services и regions
+func downloadAWSSubnets(file string) ([]netip.Prefix, error) {
+        data, err := downloadCached(config.AWS.URL, config.AWS.SourceOptions)
+        if err != nil {
+                return nil, err
+        }
+        var ranges awsIPRanges
+        if err := json.Unmarshal([]byte(data), &ranges); err != nil {
+                return nil, fmt.Errorf("parsing %s: %w", config.AWS.URL, err)
+        }
+
+        var v4Set netipx.IPSetBuilder
+        for _, item := range ranges.Prefixes {
+                if !rangeMatches(config.AWS.Services, item.Service) || !rangeMatches(config.AWS.Regions, item.Region) {
+                        continue
+                }
+                prefix, err := netip.ParsePrefix(item.IPPrefix)
+                if err != nil {
+                        log.Printf("Invalid subnet: %s", item.IPPrefix)
+                        continue
+                }
+                if prefix.Addr().Is4() {
+                        v4Set.AddPrefix(prefix)
+                        noteOrigin(file, prefixOrigin{Prefix: prefix, Source: config.AWS.URL, Line: item.IPPrefix + " " + item.Region + " " + item.Service})
+                }
+        }
+
+        v4IPSet, _ := v4Set.IPSet()
+        if len(v4IPSet.Prefixes()) == 0 {
+                // Опечатка в services или regions дала бы пустой список вместо прежнего
+                return nil, fmt.Errorf("no prefixes match services %v and regions %v", config.AWS.Services, config.AWS.Regions)
+        }
+        return v4IPSet.Prefixes(), nil
+}
+
+func processAWS() {
+        if config.AWS.URL == "" || !sourceSelected("aws", config.AWS.File, config.AWS.ListName) {
+                return
+        }
+        runListStage("aws", "download", func() error {
+                reportProgress("aws", "download", "")
+                filename := config.AWS.File
+                if filename == "" {
+                        filename = "aws.lst"
+                }
+                listName := config.AWS.ListName
+                if listName == "" {
+                        listName = strings.TrimSuffix(filename, ".lst")
+                }
+
+                v4AWS, err := downloadAWSSubnets(filename)
+                if err != nil {
+                        log.Printf("Error downloading AWS subnets: %v", err)
+                        reportProgress("aws", "failed", err.Error())
+                        return err
+                }
+
+                v4AWS = stabilizePrefixes(filename, v4AWS)
+                if err := writeSubnetsToFile(v4AWS, ipv4ListPath(filename)); err != nil {
+                        log.Printf("Error writing AWS IPv4: %v", err)
+                }
+                if err := generateRouterOSConfig(listName, "AWS", v4AWS, layoutDir("routeros", filename, config.RouterOSDir)); err != nil {
+                        log.Printf("Error generating RouterOS config for AWS: %v", err)
+                }
+
+                addGeneratedList(generatedList{Name: filename, ListName: listName, Comment: "AWS", Prefixes: v4AWS, Sources: []string{config.AWS.URL}, Tags: config.AWS.Tags, Trust: config.AWS.Trust})
+                return nil
+        })
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+        "encoding/json"
+        "errors"
+        "fmt"
+        "log"
+        "net/http"
+        "net/netip"
+        "os"
+        "strconv"
+        "strings"
+        "sync"
+        "time"
+)
+
+// BGPToolsAPIConfig JSON API bgp.tools с токеном для as_numbers с source:
+// bgptools_api. Анонимная выгрузка таблицы ограничивается и иногда блокируется,
+// а API отдаёт только нужные ASN.
+type BGPToolsAPIConfig struct {
+        Token         string  `yaml:"token"`
+        ASURL         string  `yaml:"as_url"`     // {asn} - номер без AS; по умолчанию https://bgp.tools/api/v1/as/{asn}/prefixes
+        PrefixURL     string  `yaml:"prefix_url"` // {prefix}; origin префиксов для max_origins, по умолчанию https://bgp.tools/api/v1/prefix/{prefix}
+        Rate          float64 `yaml:"rate"`       // Запросов в секунду, по умолчанию 1
+        Retries       int     `yaml:"retries"`    // Повторы ответа 429, по умолчанию 3
+        SourceOptions `yaml:",inline"`
+}
+
+const asSourceBGPToolsAPI = "bgptools_api"
+
+type bgptoolsASPrefixes struct {
+        Prefixes []struct {
+                Prefix string `json:"prefix"`
+        } `json:"prefixes"`
+}
+
+type bgptoolsPrefixOrigins struct {
+        Origins []uint32 `json:"origins"`
+}
+
+var (
+        bgptoolsAPIMu   sync.Mutex
+        bgptoolsAPILast time.Time
+)
+
+// waitBGPToolsAPI выдерживает интервал между запросами к API (rate)
+func waitBGPToolsAPI() error {
+        bgptoolsAPIMu.Lock()
+        defer bgptoolsAPIMu.Unlock()
+        interval := time.Duration(float64(time.Second) / config.BGPToolsAPI.Rate)
+        if wait := time.Until(bgptoolsAPILast.Add(interval)); wait > 0 {
+                select {
+                case <-time.After(wait):
+                case <-runCtx.Done():
+                        return runCtx.Err()
+                }
+        }
+        bgptoolsAPILast = time.Now()
+        return nil
+}
+
+// bgptoolsAPIGet ответ API из кэша (ключ - URL без токена) или с сервера
+func bgptoolsAPIGet(url string) (string, error) {
+        opts := config.BGPToolsAPI.SourceOptions
+        ttl := opts.CacheTTL
+        if ttl <= 0 {
+                ttl = config.Cache.TTL
+        }
+        path := cachePath(url)
+        if info, err := os.Stat(path); err == nil && (offlineMode || ttl > 0 && time.Since(info.ModTime()) < ttl) {
+                data, err := os.ReadFile(path)
+                return string(data), err
+        } else if offlineMode {
+                return "", fmt.Errorf("offline mode: %s is not cached", url)
+        }
+
+        headers := map[string]string{"Authorization": "Bearer " + config.BGPToolsAPI.Token, "Accept": "application/json"}
+        var data string
+        var err error
+        for attempt := 0; ; attempt++ {
+                if err = waitBGPToolsAPI(); err != nil {
+                        return "", err
+                }
+                data, err = downloadURLHeaders(url, opts.MaxSize, headers)
+                var status *httpStatusError
+                if !errors.As(err, &status) || status.Code != http.StatusTooManyRequests || attempt >= config.BGPToolsAPI.Retries {
+                        break
+                }
+                backoff := time.Duration(5<<attempt) * time.Second
+                log.Printf("bgp.tools API rate limited, retrying in %s", backoff)
+                select {
+                case <-time.After(backoff):
+                case <-runCtx.Done():
+                        return "", runCtx.Err()
+                }
+        }
+        if err != nil {
+                return "", err
+        }
+        stageDownload(url, data)
+        if err := os.MkdirAll(config.Cache.Dir, 0755); err != nil {
+                log.Printf("Error creating cache dir: %v", err)
+        } else if err := writeFileStaged(path, []byte(data)); err != nil {
+                log.Printf("Error caching %s: %v", url, err)
+        }
+        return data, nil
+}
+
+// bgptoolsAPISubnets анонсы asns из API в виде строк таблицы. С withOrigins
+// для каждого префикса запрашиваются и чужие origin: без них max_origins не работает.
+func bgptoolsAPISubnets(asns []string, withOrigins bool) ([]subnetAS, []string, error) {
+        var subnets []subnetAS
+        var sources []string
+        for _, as := range asns {
+                n := normalizeASN(as)
+                source := strings.ReplaceAll(config.BGPToolsAPI.ASURL, "{asn}", n)
+                data, err := bgptoolsAPIGet(source)
+                if err != nil {
+                        return nil, nil, fmt.Errorf("bgp.tools API AS%s: %w", n, err)
+                }
+                var resp bgptoolsASPrefixes
+                if err := json.Unmarshal([]byte(data), &resp); err != nil {
+                        return nil, nil, fmt.Errorf("bgp.tools API AS%s: %w", n, err)
+                }
+                sources = append(sources, source)
+
+                for _, item := range resp.Prefixes {
+                        subnets = append(subnets, subnetAS{subnet: item.Prefix, as: n, source: source})
+                        if !withOrigins {
+                                continue
+                        }
+                        prefix, err := netip.ParsePrefix(item.Prefix)
+                        if err != nil || !prefix.Addr().Is4() {
+                                continue
+                        }
+                        url := strings.ReplaceAll(config.BGPToolsAPI.PrefixURL, "{prefix}", prefix.Masked().String())
+                        data, err := bgptoolsAPIGet(url)
+                        if err != nil {
+                                return nil, nil, fmt.Errorf("bgp.tools API %s: %w", prefix, err)
+                        }
+                        var origins bgptoolsPrefixOrigins
+                        if err := json.Unmarshal([]byte(data), &origins); err != nil {
+                                return nil, nil, fmt.Errorf("bgp.tools API %s: %w", prefix, err)
+                        }
+                        for _, origin := range origins.Origins {
+                                if other := strconv.FormatUint(uint64(origin), 10); other != n {
+                                        subnets = append(subnets, subnetAS{subnet: item.Prefix, as: other, source: url})
+                                }
+                        }
+                }
+        }
+        return subnets, sources, nil
+}
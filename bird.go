@@ -0,0 +1,78 @@
+package main
+
+import (
+        "fmt"
+        "net/netip"
+        "strings"
+)
+
+// BIRDConfig фрагменты BIRD 2: protocol static на каждый список и индекс include
+type BIRDConfig struct {
+        OutputConfig `yaml:",inline"`
+        Gateway      string `yaml:"gateway"`     // Адрес или интерфейс, по умолчанию общий gateway
+        GatewayV6    string `yaml:"gateway_v6"`  // Без него IPv6-маршруты не пишутся
+        IncludeDir   string `yaml:"include_dir"` // Каталог фрагментов на хосте с BIRD
+}
+
+// birdVia адрес шлюза пишется как есть, имя интерфейса - в кавычках
+func birdVia(gateway string) string {
+        if _, err := netip.ParseAddr(gateway); err == nil {
+                return gateway
+        }
+        return fmt.Sprintf("%q", gateway)
+}
+
+func birdProtocolName(list *generatedList) string {
+        return "allow_" + strings.Map(func(r rune) rune {
+                if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+                        return r
+                }
+                return '_'
+        }, list.Name)
+}
+
+func birdProtocol(name, channel, gateway string, prefixes []netip.Prefix) []string {
+        lines := []string{fmt.Sprintf("protocol static %s {", name), fmt.Sprintf("\t%s;", channel)}
+        for _, prefix := range prefixes {
+                lines = append(lines, fmt.Sprintf("\troute %s via %s;", prefix, birdVia(gateway)))
+        }
+        return append(lines, "}", "")
+}
+
+func generateBIRDStatic(list *generatedList) error {
+        var v4, v6 []netip.Prefix
+        for _, prefix := range list.Prefixes {
+                if prefix.Addr().Is4() {
+                        v4 = append(v4, prefix)
+                } else {
+                        v6 = append(v6, prefix)
+                }
+        }
+
+        name := birdProtocolName(list)
+        var lines []string
+        if len(v4) > 0 {
+                if config.BIRD.Gateway == "" {
+                        return fmt.Errorf("bird.gateway is required")
+                }
+                lines = append(lines, birdProtocol(name, "ipv4", config.BIRD.Gateway, v4)...)
+        }
+        if len(v6) > 0 && config.BIRD.GatewayV6 != "" {
+                lines = append(lines, birdProtocol(name+"_v6", "ipv6", config.BIRD.GatewayV6, v6)...)
+        }
+        if len(lines) == 0 {
+                return nil
+        }
+        return writeOutputLines(layoutDir("bird", list.Name, config.BIRD.Dir), list.Name+".conf", lines)
+}
+
+// generateBIRDIndex пишет index.conf с include всех фрагментов этого запуска
+func generateBIRDIndex(lists []*generatedList) error {
+        var includes []string
+        for _, list := range lists {
+                if len(list.Prefixes) > 0 {
+                        includes = append(includes, fmt.Sprintf("include %q;", config.BIRD.IncludeDir+"/"+layoutRelPath("bird", list.Name, config.BIRD.Dir, list.Name+".conf")))
+                }
+        }
+        return writeOutputLines(config.BIRD.Dir, "index.conf", includes)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+        "crypto/sha256"
+        "encoding/hex"
+        "fmt"
+        "log"
+        "os"
+        "path/filepath"
+        "strings"
+        "time"
+)
+
+// CacheConfig настройки кэша загруженных источников
+type CacheConfig struct {
+        Dir string        `yaml:"dir"`
+        TTL time.Duration `yaml:"ttl"` // TTL по умолчанию, если у источника не задан свой
+}
+
+// offlineMode запрещает сетевые запросы: все источники берутся только из кэша
+var offlineMode bool
+
+// stageDownload сохраняет сырой ответ в каталоге запуска (виден с --keep-workdir)
+func stageDownload(url, data string) {
+        if workspace == "" {
+                return
+        }
+        dir := filepath.Join(workspace, "downloads")
+        if err := os.MkdirAll(dir, 0755); err != nil {
+                return
+        }
+
+        name := strings.Map(func(r rune) rune {
+                if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+                        return r
+                }
+                return '_'
+        }, strings.TrimPrefix(strings.TrimPrefix(url, "https://"), "http://"))
+        if len(name) > 120 {
+                name = name[:120]
+        }
+        os.WriteFile(filepath.Join(dir, name), []byte(data), 0644)
+}
+
+func cachePath(url string) string {
+        sum := sha256.Sum256([]byte(url))
+        return filepath.Join(config.Cache.Dir, hex.EncodeToString(sum[:]))
+}
+
+// downloadCached возвращает содержимое url из кэша, если запись моложе TTL,
+// иначе скачивает источник, проверяет контрольную сумму и обновляет кэш.
+// Нулевой cache_ttl источника означает TTL из секции cache.
+func downloadCached(url string, opts SourceOptions) (string, error) {
+        ttl := opts.CacheTTL
+        if ttl <= 0 {
+                ttl = config.Cache.TTL
+        }
+        path := cachePath(url)
+
+        if info, err := os.Stat(path); err == nil {
+                if offlineMode || (ttl > 0 && time.Since(info.ModTime()) < ttl) {
+                        data, err := os.ReadFile(path)
+                        if err != nil {
+                                return "", err
+                        }
+                        // Сумма из checksum_url проверяется только при загрузке
+                        if err := verifyChecksum(url, string(data), SourceOptions{SHA256: opts.SHA256}); err != nil {
+                                return "", err
+                        }
+                        return string(data), nil
+                }
+        } else if offlineMode {
+                return "", fmt.Errorf("offline mode: %s is not cached", url)
+        }
+
+        data, err := downloadURL(url, opts.MaxSize)
+        if err != nil {
+                return "", err
+        }
+        stageDownload(url, data)
+        if err := verifyChecksum(url, data, opts); err != nil {
+                return "", err
+        }
+
+        if err := os.MkdirAll(config.Cache.Dir, 0755); err != nil {
+                log.Printf("Error creating cache dir: %v", err)
+        } else if err := writeFileStaged(path, []byte(data)); err != nil {
+                log.Printf("Error caching %s: %v", url, err)
+        }
+
+        return data, nil
+}
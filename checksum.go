@@ -0,0 +1,66 @@
+package main
+
+import (
+        "crypto/sha256"
+        "encoding/hex"
+        "fmt"
+        "net/url"
+        "path"
+        "strings"
+)
+
+// checksumFromFile извлекает сумму для sourceURL из файла формата sha256sum.
+// Файл из одной суммы без имени подходит для любого источника.
+func checksumFromFile(data, sourceURL string) (string, error) {
+        name := sourceURL
+        if u, err := url.Parse(sourceURL); err == nil {
+                name = path.Base(u.Path)
+        }
+
+        var single string
+        lines := 0
+        for _, line := range strings.Split(data, "\n") {
+                fields := strings.Fields(line)
+                if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+                        continue
+                }
+                lines++
+                if len(fields) == 1 {
+                        single = fields[0]
+                        continue
+                }
+                if strings.TrimPrefix(fields[1], "*") == name {
+                        return fields[0], nil
+                }
+        }
+
+        if lines == 1 && single != "" {
+                return single, nil
+        }
+        return "", fmt.Errorf("no checksum for %s", name)
+}
+
+// verifyChecksum сверяет содержимое источника с заданной или опубликованной суммой
+func verifyChecksum(sourceURL, data string, opts SourceOptions) error {
+        expected := opts.SHA256
+        if expected == "" && opts.ChecksumURL != "" {
+                sums, err := downloadURL(opts.ChecksumURL, 0)
+                if err != nil {
+                        return fmt.Errorf("downloading checksum: %w", err)
+                }
+                expected, err = checksumFromFile(sums, sourceURL)
+                if err != nil {
+                        return err
+                }
+        }
+        if expected == "" {
+                return nil
+        }
+
+        sum := sha256.Sum256([]byte(data))
+        actual := hex.EncodeToString(sum[:])
+        if !strings.EqualFold(actual, expected) {
+                return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", sourceURL, strings.ToLower(expected), actual)
+        }
+        return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+        "fmt"
+        "net"
+)
+
+// CiscoConfig prefix-list и статические маршруты в синтаксисе Cisco IOS
+type CiscoConfig struct {
+        OutputConfig `yaml:",inline"`
+        Routes       bool   `yaml:"routes"`      // Добавлять ip route / ipv6 route
+        NextHop      string `yaml:"next_hop"`    // Адрес или интерфейс для IPv4
+        NextHopV6    string `yaml:"next_hop_v6"` // Адрес или интерфейс для IPv6
+        SeqStep      int    `yaml:"seq_step"`
+}
+
+func ciscoCommands(list *generatedList) []string {
+        name := identifierName(list.ListName)
+        step := config.Cisco.SeqStep
+
+        var lines, routes []string
+        seq4, seq6 := step, step
+        for _, prefix := range list.Prefixes {
+                if prefix.Addr().Is4() {
+                        lines = append(lines, fmt.Sprintf("ip prefix-list %s seq %d permit %s", name, seq4, prefix))
+                        seq4 += step
+                        if config.Cisco.Routes && config.Cisco.NextHop != "" {
+                                mask := net.IP(net.CIDRMask(prefix.Bits(), 32)).String()
+                                routes = append(routes, fmt.Sprintf("ip route %s %s %s", prefix.Addr(), mask, config.Cisco.NextHop))
+                        }
+                } else {
+                        lines = append(lines, fmt.Sprintf("ipv6 prefix-list %s-v6 seq %d permit %s", name, seq6, prefix))
+                        seq6 += step
+                        if config.Cisco.Routes && config.Cisco.NextHopV6 != "" {
+                                routes = append(routes, fmt.Sprintf("ipv6 route %s %s", prefix, config.Cisco.NextHopV6))
+                        }
+                }
+        }
+        return append(lines, routes...)
+}
+
+func generateCiscoConfig(list *generatedList) error {
+        if len(list.Prefixes) == 0 {
+                return nil
+        }
+        return writeOutputLines(layoutDir("cisco", list.Name, config.Cisco.Dir), list.Name+".txt", ciscoCommands(list))
+}
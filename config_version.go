@@ -0,0 +1,142 @@
+package main
+
+import (
+        "bytes"
+        "fmt"
+        "log"
+        "strings"
+
+        "gopkg.in/yaml.v3"
+)
+
+// currentConfigVersion версия формата конфига, которую понимает эта сборка.
+// Конфиг с полем version читается строго: неизвестный ключ - ошибка, а не
+// молча пропущенная настройка. Конфиг без version читается как раньше, с
+// предупреждениями.
+const currentConfigVersion = 1
+
+// configMigration устаревший ключ (путь через точку): переименован или больше не используется
+type configMigration struct {
+        Key    string
+        Rename string
+        Note   string
+}
+
+var configMigrations = []configMigration{
+        {Key: "RouterOSDir", Rename: "routeros_dir"},
+        {Key: "ipv6_dir", Note: "IPv6 lists are not written separately"},
+        {Key: "discord.voice_v6", Note: "only IPv4 Discord subnets are used"},
+        {Key: "cloudflare.v6", Note: "only IPv4 Cloudflare subnets are used"},
+}
+
+// configMapping возвращает вложенную секцию по пути или nil
+func configMapping(root *yaml.Node, path []string) *yaml.Node {
+        node := root
+        for _, name := range path {
+                if node.Kind != yaml.MappingNode {
+                        return nil
+                }
+                var next *yaml.Node
+                for i := 0; i+1 < len(node.Content); i += 2 {
+                        if node.Content[i].Value == name {
+                                next = node.Content[i+1]
+                                break
+                        }
+                }
+                if next == nil {
+                        return nil
+                }
+                node = next
+        }
+        if node.Kind != yaml.MappingNode {
+                return nil
+        }
+        return node
+}
+
+// migrateConfigNode применяет миграции к документу и сообщает о каждой.
+// Возвращает true, если документ изменился.
+func migrateConfigNode(root *yaml.Node) bool {
+        changed := false
+        for _, migration := range configMigrations {
+                path := strings.Split(migration.Key, ".")
+                section := configMapping(root, path[:len(path)-1])
+                if section == nil {
+                        continue
+                }
+                for i := 0; i+1 < len(section.Content); i += 2 {
+                        key := section.Content[i]
+                        if key.Value != path[len(path)-1] {
+                                continue
+                        }
+                        changed = true
+                        if migration.Rename != "" {
+                                log.Printf("Warning: config key %s is deprecated, use %s (line %d)", migration.Key, migration.Rename, key.Line)
+                                key.Value = migration.Rename
+                        } else {
+                                log.Printf("Warning: config key %s is ignored: %s (line %d)", migration.Key, migration.Note, key.Line)
+                                section.Content = append(section.Content[:i], section.Content[i+2:]...)
+                        }
+                        break
+                }
+        }
+        return changed
+}
+
+func configNodeVersion(root *yaml.Node) (int, bool, error) {
+        for i := 0; i+1 < len(root.Content); i += 2 {
+                if root.Content[i].Value != "version" {
+                        continue
+                }
+                var version int
+                if err := root.Content[i+1].Decode(&version); err != nil {
+                        return 0, true, fmt.Errorf("config version: %w", err)
+                }
+                return version, true, nil
+        }
+        return 0, false, nil
+}
+
+// decodeConfig разбирает конфиг с учётом версии и миграций
+func decodeConfig(data []byte, cfg *Config) error {
+        var doc yaml.Node
+        if err := yaml.Unmarshal(data, &doc); err != nil {
+                return err
+        }
+        if len(doc.Content) == 0 {
+                return nil
+        }
+        root := doc.Content[0]
+
+        version, versioned, err := configNodeVersion(root)
+        if err != nil {
+                return err
+        }
+        if version > currentConfigVersion {
+                return fmt.Errorf("config version %d requires a newer get_subnets (supported: %d)", version, currentConfigVersion)
+        }
+
+        // Без миграций разбираем исходный текст, чтобы номера строк в ошибках совпадали
+        migrated := data
+        if migrateConfigNode(root) {
+                if migrated, err = yaml.Marshal(root); err != nil {
+                        return err
+                }
+        }
+
+        decoder := yaml.NewDecoder(bytes.NewReader(migrated))
+        decoder.KnownFields(true)
+        strictErr := decoder.Decode(cfg)
+        if strictErr == nil {
+                return nil
+        }
+        if versioned {
+                return strictErr
+        }
+
+        // Старый конфиг без version: неизвестные ключи не ломают запуск
+        log.Printf("Warning: config has no version, unknown keys are ignored: %v", strictErr)
+        log.Printf("Warning: add \"version: %d\" to the config to make such keys an error", currentConfigVersion)
+        *cfg = Config{}
+        return yaml.Unmarshal(migrated, cfg)
+}
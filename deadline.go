@@ -0,0 +1,59 @@
+package main
+
+import (
+        "context"
+        "fmt"
+        "log"
+        "time"
+)
+
+// runCtx контекст запуска: с run_timeout отменяется по дедлайну, и загрузки
+// прерываются, а оставшиеся этапы пропускаются
+var runCtx = context.Background()
+
+// skippedStages этапы, до которых запуск не дошёл до дедлайна
+var skippedStages []string
+
+// startRunDeadline запускает отсчёт run_timeout; возвращает функцию остановки.
+// Ошибка зависшего запуска уходит в aborted, без него (бинарник) процесс завершается.
+func startRunDeadline(aborted chan<- error) func() {
+        if config.RunTimeout <= 0 {
+                return func() {}
+        }
+        var cancel context.CancelFunc
+        runCtx, cancel = context.WithTimeout(context.Background(), config.RunTimeout)
+
+        // Разбор и запись не смотрят на контекст; если что-то зависло и там,
+        // через минуту после дедлайна запуск прерывается. Таймер работает в
+        // своей горутине: паника fatal здесь не дошла бы до recover в Run,
+        // а состояние запуска читать отсюда нельзя.
+        timeout := config.RunTimeout
+        watchdog := time.AfterFunc(timeout+time.Minute, func() {
+                msg := fmt.Sprintf("Run deadline %s exceeded; aborting", timeout)
+                if aborted == nil {
+                        fatal(msg)
+                }
+                log.Print(msg)
+                aborted <- fatalError{msg}
+        })
+        return func() {
+                watchdog.Stop()
+                cancel()
+        }
+}
+
+// runExpired истёк ли дедлайн запуска
+func runExpired() bool {
+        return runCtx.Err() != nil
+}
+
+// skipExpiredStage отмечает этап пропущенным, если дедлайн уже прошёл
+func skipExpiredStage(source, stage string) bool {
+        if !runExpired() {
+                return false
+        }
+        log.Printf("Skipping %s (%s): run deadline %s exceeded", source, stage, config.RunTimeout)
+        reportProgress(source, "failed", "run deadline exceeded")
+        skippedStages = append(skippedStages, source+" ("+stage+")")
+        return true
+}
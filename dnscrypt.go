@@ -0,0 +1,50 @@
+package main
+
+import (
+        "strings"
+)
+
+// DNSCryptConfig фрагменты forwarding-rules.txt и cloaking-rules.txt для
+// dnscrypt-proxy: домены списка резолвятся через отдельные серверы или
+// подменяются фиксированным адресом
+type DNSCryptConfig struct {
+        OutputConfig `yaml:",inline"`
+        Forwarders   []string `yaml:"forwarders"` // Серверы для forwarding-rules, можно с :порт
+        CloakIP      string   `yaml:"cloak_ip"`   // Адрес для cloaking-rules; пусто - без cloaking
+}
+
+func generateDNSCryptRules(list *generatedList) error {
+        if len(list.Domains) == 0 {
+                return nil
+        }
+
+        var forwarding, cloaking []string
+        forwarders := strings.Join(config.DNSCrypt.Forwarders, ",")
+        seen := make(map[string]bool)
+        for _, domain := range list.Domains {
+                // Правило без = действует и на поддомены
+                domain = trimDomainDot(domain)
+                if seen[domain] {
+                        continue
+                }
+                seen[domain] = true
+                if forwarders != "" {
+                        forwarding = append(forwarding, domain+" "+forwarders)
+                }
+                if config.DNSCrypt.CloakIP != "" {
+                        cloaking = append(cloaking, domain+" "+config.DNSCrypt.CloakIP)
+                }
+        }
+
+        dir := layoutDir("dnscrypt", list.Name, config.DNSCrypt.Dir)
+        header := "# " + list.Comment
+        if len(forwarding) > 0 {
+                if err := writeOutputLines(dir, list.Name+"-forwarding-rules.txt", append([]string{header}, forwarding...)); err != nil {
+                        return err
+                }
+        }
+        if len(cloaking) > 0 {
+                return writeOutputLines(dir, list.Name+"-cloaking-rules.txt", append([]string{header}, cloaking...))
+        }
+        return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+        "bufio"
+        "fmt"
+        "log"
+        "os"
+        "sort"
+        "strings"
+)
+
+// DomainConfig описывает доменный список сервиса
+type DomainConfig struct {
+        Sources       []string `yaml:"sources"` // Локальные файлы или URL со списками доменов
+        SetName       string   `yaml:"set_name"`
+        Tags          []string `yaml:"tags"` // Метки для списков tagged
+        SourceOptions `yaml:",inline"`
+}
+
+// DnsmasqConfig настройки генерации конфигов dnsmasq
+type DnsmasqConfig struct {
+        Dir     string `yaml:"dir"`
+        Family  string `yaml:"family"`
+        Table   string `yaml:"table"`
+        SetName string `yaml:"set_name"`
+}
+
+func isURL(source string) bool {
+        return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") ||
+                strings.HasPrefix(source, "ftp://") || strings.HasPrefix(source, "rsync://")
+}
+
+func readSource(source string, opts SourceOptions) (string, error) {
+        if isURL(source) {
+                return downloadCached(source, opts)
+        }
+
+        data, err := os.ReadFile(source)
+        if err != nil {
+                return "", err
+        }
+        return stripBOM(string(data)), nil
+}
+
+// normalizeDomain приводит строку списка к имени домена или возвращает пустую строку
+func normalizeDomain(line string) string {
+        if i := strings.IndexByte(line, '#'); i >= 0 {
+                line = line[:i]
+        }
+        domain := strings.ToLower(strings.TrimSpace(line))
+        domain = strings.TrimPrefix(domain, "*")
+        domain = strings.TrimSuffix(domain, ".")
+        if domain == "" || domain == "." || strings.ContainsAny(domain, " \t/") {
+                return ""
+        }
+        return domain
+}
+
+// trimDomainDot убирает ведущую точку у суффиксов вида ".ua" для форматов,
+// где суффикс задаётся самим правилом
+func trimDomainDot(domain string) string {
+        return strings.TrimPrefix(domain, ".")
+}
+
+func loadDomains(sources []string, opts SourceOptions) ([]string, error) {
+        seen := make(map[string]struct{})
+
+        for _, source := range sources {
+                data, err := readSource(source, opts)
+                if err != nil {
+                        return nil, fmt.Errorf("%s: %w", source, err)
+                }
+
+                scanner := bufio.NewScanner(strings.NewReader(data))
+                for scanner.Scan() {
+                        domain := normalizeDomain(scanner.Text())
+                        if domain == "" {
+                                continue
+                        }
+                        seen[domain] = struct{}{}
+                }
+
+                if err := scanner.Err(); err != nil {
+                        return nil, fmt.Errorf("%s: %w", source, err)
+                }
+        }
+
+        domains := make([]string, 0, len(seen))
+        for domain := range seen {
+                domains = append(domains, domain)
+        }
+        sort.Strings(domains)
+
+        return domains, nil
+}
+
+func writeLinesToFile(lines []string, filename string) error {
+        file, err := createStaged(filename)
+        if err != nil {
+                return err
+        }
+        defer file.Abort()
+
+        writer := bufio.NewWriter(file)
+        for _, line := range lines {
+                if _, err := writer.WriteString(line + "\n"); err != nil {
+                        return err
+                }
+        }
+        if err := writer.Flush(); err != nil {
+                return err
+        }
+        return file.Commit()
+}
+
+func generateDnsmasqConfig(name, setName string, domains []string) error {
+        nftset := make([]string, 0, len(domains))
+        ipset := make([]string, 0, len(domains))
+        for _, domain := range domains {
+                nftset = append(nftset, fmt.Sprintf("nftset=/%s/4#%s#%s#%s", domain, config.Dnsmasq.Family, config.Dnsmasq.Table, setName))
+                ipset = append(ipset, fmt.Sprintf("ipset=/%s/%s", domain, setName))
+        }
+
+        dir := layoutDir("dnsmasq", name, config.Dnsmasq.Dir)
+        if err := writeOutputLines(dir, name+"-dnsmasq-nfset.lst", nftset); err != nil {
+                return err
+        }
+        return writeOutputLines(dir, name+"-dnsmasq-ipset.lst", ipset)
+}
+
+func processDomainLists() {
+        for name, domainConfig := range config.Domains {
+                if !sourceSelected(name, "domains") {
+                        continue
+                }
+                // Замыкание может выполниться повторно после цикла
+                name, domainConfig := name, domainConfig
+                runListStage(name, "domains", func() error {
+                        reportProgress(name, "download", "domains")
+                        domains, err := loadDomains(domainConfig.Sources, domainConfig.SourceOptions)
+                        if err != nil {
+                                log.Printf("Error loading domains for %s: %v", name, err)
+                                reportProgress(name, "failed", err.Error())
+                                return err
+                        }
+
+                        setName := domainConfig.SetName
+                        if setName == "" {
+                                setName = config.Dnsmasq.SetName
+                        }
+
+                        if err := generateDnsmasqConfig(name, setName, domains); err != nil {
+                                log.Printf("Error generating dnsmasq config for %s: %v", name, err)
+                        }
+
+                        addGeneratedList(generatedList{Name: name, ListName: strings.ToUpper(name), Comment: name, Domains: domains, Sources: domainConfig.Sources, Tags: domainConfig.Tags, Trust: domainConfig.Trust})
+                        return nil
+                })
+        }
+}
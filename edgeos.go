@@ -0,0 +1,42 @@
+package main
+
+import (
+        "fmt"
+)
+
+// EdgeOSConfig network-group и статические маршруты для Ubiquiti EdgeRouter
+type EdgeOSConfig struct {
+        OutputConfig `yaml:",inline"`
+        Routes       bool   `yaml:"routes"`   // Добавлять set protocols static route
+        NextHop      string `yaml:"next_hop"` // По умолчанию общий gateway
+}
+
+func edgeOSCommands(list *generatedList) []string {
+        name := identifierName(list.ListName)
+        var groups, routes []string
+        for _, prefix := range list.Prefixes {
+                if !prefix.Addr().Is4() {
+                        continue
+                }
+                groups = append(groups, fmt.Sprintf("set firewall group network-group %s network %s", name, prefix))
+                if config.EdgeOS.Routes {
+                        routes = append(routes, fmt.Sprintf("set protocols static route %s next-hop %s", prefix, config.EdgeOS.NextHop))
+                }
+        }
+        if len(groups) == 0 {
+                return nil
+        }
+
+        commands := []string{fmt.Sprintf("delete firewall group network-group %s", name)}
+        commands = append(commands, groups...)
+        commands = append(commands, fmt.Sprintf("set firewall group network-group %s description %q", name, list.Comment))
+        return append(commands, routes...)
+}
+
+func generateEdgeOSScript(list *generatedList) error {
+        commands := edgeOSCommands(list)
+        if len(commands) == 0 {
+                return nil
+        }
+        return writeVbashScript(layoutDir("edgeos", list.Name, config.EdgeOS.Dir), list.Name, commands)
+}
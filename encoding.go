@@ -0,0 +1,102 @@
+package main
+
+import (
+        "fmt"
+        "strings"
+        "unicode/utf8"
+)
+
+// Безопасные для RouterOS комментарии и имена. Все файлы пишутся в UTF-8 без
+// BOM, но разные версии RouterOS по-разному импортируют кириллицу в
+// комментариях, поэтому не-ASCII байты экранируются как \XX или, с
+// routeros_comments: translit, заменяются латиницей.
+
+const utf8BOM = "\uFEFF"
+
+// stripBOM убирает BOM в начале источника, чтобы он не попал в первую запись
+func stripBOM(data string) string {
+        return strings.TrimPrefix(data, utf8BOM)
+}
+
+var cyrillicTranslit = map[rune]string{
+        'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+        'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+        'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+        'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+        'я': "ya", 'є': "ye", 'і': "i", 'ї': "yi", 'ґ': "g",
+}
+
+// transliterate переводит кириллицу в латиницу; прочие не-ASCII символы заменяются на '?'
+func transliterate(s string) string {
+        var b strings.Builder
+        for _, r := range s {
+                if r < utf8.RuneSelf {
+                        b.WriteRune(r)
+                        continue
+                }
+                lower := []rune(strings.ToLower(string(r)))[0]
+                latin, ok := cyrillicTranslit[lower]
+                if !ok {
+                        b.WriteByte('?')
+                        continue
+                }
+                if lower != r && latin != "" {
+                        latin = strings.ToUpper(latin[:1]) + latin[1:]
+                }
+                b.WriteString(latin)
+        }
+        return b.String()
+}
+
+func routerOSBareWord(s string) bool {
+        if s == "" {
+                return false
+        }
+        for i := 0; i < len(s); i++ {
+                c := s[i]
+                if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.') {
+                        return false
+                }
+        }
+        return true
+}
+
+// routerOSText приводит строку к валидному UTF-8 и, в режиме translit, к ASCII
+func routerOSText(s string) string {
+        s = strings.ToValidUTF8(s, "?")
+        if config.RouterOSComments == "translit" {
+                s = transliterate(s)
+        }
+        return s
+}
+
+// routerOSQuote строка в синтаксисе скриптов RouterOS. Простые слова
+// остаются без кавычек; в кавычках экранируются спецсимволы, а не-ASCII
+// байты записываются как \XX, если не выбран режим raw.
+func routerOSQuote(s string) string {
+        s = routerOSText(s)
+        if routerOSBareWord(s) {
+                return s
+        }
+
+        var b strings.Builder
+        b.WriteByte('"')
+        for i := 0; i < len(s); i++ {
+                c := s[i]
+                switch {
+                case c == '"' || c == '\\' || c == '$' || c == '?':
+                        b.WriteByte('\\')
+                        b.WriteByte(c)
+                case c == '\n':
+                        b.WriteString(`\n`)
+                case c == '\r' || c == '\t':
+                        b.WriteByte(' ')
+                case c >= utf8.RuneSelf && config.RouterOSComments != "raw":
+                        fmt.Fprintf(&b, `\%02X`, c)
+                default:
+                        b.WriteByte(c)
+                }
+        }
+        b.WriteByte('"')
+        return b.String()
+}
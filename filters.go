@@ -0,0 +1,360 @@
+package main
+
+import (
+        "bufio"
+        "fmt"
+        "log"
+        "net/netip"
+        "strconv"
+        "strings"
+
+        "go4.org/netipx"
+)
+
+// RegistryConfig источники привязки адресов к странам (delegated-статистика RIR)
+type RegistryConfig struct {
+        URLs          []string `yaml:"urls"`
+        SourceOptions `yaml:",inline"`
+}
+
+// FilterListConfig список, собранный из ASN и стран: пересечение включающих
+// условий минус исключения
+type FilterListConfig struct {
+        File             string   `yaml:"file"`
+        ListName         string   `yaml:"list_name"`
+        Comment          string   `yaml:"comment"`
+        ASNs             []string `yaml:"asns"`
+        Countries        []string `yaml:"countries"` // Коды ISO или группы вроде EU
+        ExcludeASNs      []string `yaml:"exclude_asns"`
+        ExcludeCountries []string `yaml:"exclude_countries"`
+        Anycast          string   `yaml:"anycast"`       // tag или exclude
+        Orgs             []string `yaml:"orgs"`          // Искать ASN организаций по имени AS
+        AutoAddASNs      bool     `yaml:"auto_add_asns"` // Сразу включать найденные ASN, а не только предупреждать
+        Gateway          string   `yaml:"gateway"`       // Шлюз или интерфейс этого списка вместо общего
+        GatewayV6        string   `yaml:"gateway_v6"`
+        Tags             []string `yaml:"tags"`  // Метки для списков tagged
+        Trust            string   `yaml:"trust"` // trusted (по умолчанию) или untrusted
+}
+
+var defaultRegistryURLs = []string{
+        "https://ftp.arin.net/pub/stats/arin/delegated-arin-extended-latest",
+        "https://ftp.ripe.net/pub/stats/ripencc/delegated-ripencc-extended-latest",
+        "https://ftp.apnic.net/stats/apnic/delegated-apnic-extended-latest",
+        "https://ftp.lacnic.net/pub/stats/lacnic/delegated-lacnic-extended-latest",
+        "https://ftp.afrinic.net/pub/stats/afrinic/delegated-afrinic-extended-latest",
+}
+
+// countryGroups раскрывает региональные коды в списки стран
+var countryGroups = map[string][]string{
+        "EU": {
+                "EU", "AT", "BE", "BG", "HR", "CY", "CZ", "DK", "EE", "FI", "FR", "DE", "GR", "HU",
+                "IE", "IT", "LV", "LT", "LU", "MT", "NL", "PL", "PT", "RO", "SK", "SI", "ES", "SE",
+        },
+}
+
+func normalizeASN(as string) string {
+        return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(as)), "AS")
+}
+
+func expandCountries(codes []string) []string {
+        var out []string
+        for _, code := range codes {
+                code = strings.ToUpper(strings.TrimSpace(code))
+                if group, ok := countryGroups[code]; ok {
+                        out = append(out, group...)
+                } else {
+                        out = append(out, code)
+                }
+        }
+        return out
+}
+
+// parseDelegatedStats разбирает строки вида registry|cc|ipv4|start|count|date|status
+func parseDelegatedStats(data string, countries map[string]*netipx.IPSetBuilder) error {
+        scanner := bufio.NewScanner(strings.NewReader(data))
+        for scanner.Scan() {
+                line := strings.TrimSpace(scanner.Text())
+                if line == "" || strings.HasPrefix(line, "#") {
+                        continue
+                }
+
+                parts := strings.Split(line, "|")
+                if len(parts) < 7 || parts[1] == "" || parts[1] == "*" {
+                        continue
+                }
+                cc := strings.ToUpper(parts[1])
+
+                var r netipx.IPRange
+                switch parts[2] {
+                case "ipv4":
+                        start, err := netip.ParseAddr(parts[3])
+                        if err != nil || !start.Is4() {
+                                continue
+                        }
+                        count, err := strconv.ParseUint(parts[4], 10, 32)
+                        if err != nil || count == 0 {
+                                continue
+                        }
+                        b := start.As4()
+                        last := uint64(b[0])<<24 | uint64(b[1])<<16 | uint64(b[2])<<8 | uint64(b[3])
+                        last += count - 1
+                        if last > 0xFFFFFFFF {
+                                continue
+                        }
+                        end := netip.AddrFrom4([4]byte{byte(last >> 24), byte(last >> 16), byte(last >> 8), byte(last)})
+                        r = netipx.IPRangeFrom(start, end)
+                case "ipv6":
+                        prefix, err := netip.ParsePrefix(parts[3] + "/" + parts[4])
+                        if err != nil {
+                                continue
+                        }
+                        r = netipx.RangeOfPrefix(prefix)
+                default:
+                        continue
+                }
+
+                builder, ok := countries[cc]
+                if !ok {
+                        builder = &netipx.IPSetBuilder{}
+                        countries[cc] = builder
+                }
+                builder.AddRange(r)
+        }
+        return scanner.Err()
+}
+
+func registryURLs() []string {
+        if len(config.Registry.URLs) > 0 {
+                return config.Registry.URLs
+        }
+        return defaultRegistryURLs
+}
+
+// loadCountryRanges скачивает статистику всех реестров и группирует диапазоны по странам
+func loadCountryRanges() (map[string]*netipx.IPSet, error) {
+        urls := registryURLs()
+
+        builders := make(map[string]*netipx.IPSetBuilder)
+        for _, url := range urls {
+                data, err := downloadCached(url, config.Registry.SourceOptions)
+                if err != nil {
+                        return nil, fmt.Errorf("%s: %w", url, err)
+                }
+                if err := parseDelegatedStats(data, builders); err != nil {
+                        return nil, fmt.Errorf("%s: %w", url, err)
+                }
+        }
+
+        sets := make(map[string]*netipx.IPSet, len(builders))
+        for cc, builder := range builders {
+                set, err := builder.IPSet()
+                if err != nil {
+                        return nil, err
+                }
+                sets[cc] = set
+        }
+        return sets, nil
+}
+
+func addASNs(builder *netipx.IPSetBuilder, subnets []subnetAS, asns []string, remove bool) {
+        wanted := make(map[string]bool, len(asns))
+        for _, as := range asns {
+                wanted[normalizeASN(as)] = true
+        }
+
+        for _, item := range subnets {
+                if !wanted[normalizeASN(item.as)] {
+                        continue
+                }
+                prefix, err := netip.ParsePrefix(item.subnet)
+                if err != nil || !prefix.Addr().Is4() {
+                        continue
+                }
+                if remove {
+                        builder.RemovePrefix(prefix)
+                } else {
+                        builder.AddPrefix(prefix)
+                }
+        }
+}
+
+func countrySet(countries map[string]*netipx.IPSet, codes []string) (*netipx.IPSet, error) {
+        var builder netipx.IPSetBuilder
+        for _, cc := range expandCountries(codes) {
+                if set, ok := countries[cc]; ok {
+                        builder.AddSet(set)
+                }
+        }
+        return builder.IPSet()
+}
+
+func buildFilteredList(subnets []subnetAS, countries map[string]*netipx.IPSet, filter FilterListConfig) ([]netip.Prefix, error) {
+        var builder netipx.IPSetBuilder
+
+        switch {
+        case len(filter.ASNs) > 0:
+                addASNs(&builder, subnets, filter.ASNs, false)
+                if ixpSet != nil {
+                        builder.RemoveSet(ixpSet)
+                }
+                if len(filter.Countries) > 0 {
+                        set, err := countrySet(countries, filter.Countries)
+                        if err != nil {
+                                return nil, err
+                        }
+                        builder.Intersect(set)
+                }
+        case len(filter.Countries) > 0:
+                set, err := countrySet(countries, filter.Countries)
+                if err != nil {
+                        return nil, err
+                }
+                builder.AddSet(set)
+        default:
+                return nil, fmt.Errorf("filter needs asns or countries")
+        }
+
+        if len(filter.ExcludeASNs) > 0 {
+                addASNs(&builder, subnets, filter.ExcludeASNs, true)
+        }
+        if len(filter.ExcludeCountries) > 0 {
+                set, err := countrySet(countries, filter.ExcludeCountries)
+                if err != nil {
+                        return nil, err
+                }
+                builder.RemoveSet(set)
+        }
+
+        // Только IPv4, как и в остальных списках
+        builder.RemovePrefix(netip.MustParsePrefix("::/0"))
+
+        set, err := builder.IPSet()
+        if err != nil {
+                return nil, err
+        }
+        return set.Prefixes(), nil
+}
+
+// noteFilterRules записывает провенанс списка-фильтра: анонсы включённых ASN и
+// условия, применённые ко всему списку
+func noteFilterRules(file string, subnets []subnetAS, filter FilterListConfig) {
+        noteASNOrigins(file, subnets, filter.ASNs)
+        if len(filter.ASNs) > 0 && ixpSet != nil {
+                noteRule(file, "ixp peering LANs", "exclude", nil)
+        }
+        if len(filter.Countries) > 0 {
+                action := "include"
+                if len(filter.ASNs) > 0 {
+                        action = "intersect"
+                }
+                noteRule(file, "countries "+strings.Join(filter.Countries, ",")+" (registry)", action, nil)
+        }
+        if len(filter.ExcludeASNs) > 0 {
+                var excluded []netip.Prefix
+                wanted := make(map[string]bool, len(filter.ExcludeASNs))
+                for _, as := range filter.ExcludeASNs {
+                        wanted[normalizeASN(as)] = true
+                }
+                for _, item := range subnets {
+                        if prefix, err := netip.ParsePrefix(item.subnet); err == nil && prefix.Addr().Is4() && wanted[normalizeASN(item.as)] {
+                                excluded = append(excluded, prefix)
+                        }
+                }
+                if len(excluded) > 0 {
+                        noteRule(file, "exclude_asns "+strings.Join(filter.ExcludeASNs, ","), "exclude", excluded)
+                }
+        }
+        if len(filter.ExcludeCountries) > 0 {
+                noteRule(file, "exclude_countries "+strings.Join(filter.ExcludeCountries, ",")+" (registry)", "exclude", nil)
+        }
+}
+
+// publishPrefixList записывает .lst и RouterOS-скрипты и регистрирует список для остальных форматов
+func publishPrefixList(file string, list generatedList) {
+        list.Prefixes = stabilizePrefixes(file, list.Prefixes)
+        list.Name = file
+        writePrefixList(&list)
+        addGeneratedList(list)
+}
+
+func needsCountryData() bool {
+        for name, filter := range config.Filters {
+                if !filterSelected(name) {
+                        continue
+                }
+                if len(filter.Countries) > 0 || len(filter.ExcludeCountries) > 0 {
+                        return true
+                }
+        }
+        return false
+}
+
+func processFilteredLists(subnets []subnetAS) {
+        if len(config.Filters) == 0 {
+                return
+        }
+
+        runStage("orgs", "discover", func() { resolveOrgASNs(config.Filters) })
+
+        var countries map[string]*netipx.IPSet
+        if needsCountryData() {
+                loaded := false
+                var err error
+                runStage("registry", "download", func() {
+                        countries, err = loadCountryRanges()
+                        loaded = true
+                })
+                if !loaded {
+                        return
+                }
+                if err != nil {
+                        log.Printf("Error loading registry data: %v", err)
+                        return
+                }
+        }
+
+        for name, filter := range config.Filters {
+                if !filterSelected(name) {
+                        continue
+                }
+                runStage(name, "aggregate", func() {
+                        reportProgress(name, "aggregate", "filter")
+                        prefixes, err := buildFilteredList(subnets, countries, filter)
+                        if err != nil {
+                                log.Printf("Error building filtered list %s: %v", name, err)
+                                reportProgress(name, "failed", err.Error())
+                                return
+                        }
+
+                        file := filter.File
+                        if file == "" {
+                                file = name + ".lst"
+                        }
+                        listName := filter.ListName
+                        if listName == "" {
+                                listName = strings.TrimSuffix(file, ".lst")
+                        }
+                        comment := filter.Comment
+                        if comment == "" {
+                                comment = name
+                        }
+
+                        noteFilterRules(file, subnets, filter)
+                        if len(filter.ASNs) > 0 {
+                                before := prefixes
+                                prefixes = applyAnycastPolicy(file, filter.Anycast, prefixes, subnets, filter.ASNs)
+                                noteChange(file, "anycast "+filter.Anycast, before, prefixes)
+                        }
+
+                        list := generatedList{ListName: listName, Comment: comment, Prefixes: prefixes, Sources: bgpTableSources, Tags: filter.Tags, Trust: filter.Trust}
+                        if len(filter.Countries) > 0 || len(filter.ExcludeCountries) > 0 {
+                                // Копия: bgpTableSources общий для всех фильтров
+                                list.Sources = append(append([]string(nil), list.Sources...), registryURLs()...)
+                        }
+                        for _, as := range filter.ASNs {
+                                list.ASNs = append(list.ASNs, "AS"+normalizeASN(as))
+                        }
+                        publishPrefixList(file, list)
+                })
+        }
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+        "bufio"
+        "flag"
+        "fmt"
+        "log"
+        "math/rand"
+        "net/netip"
+        "os"
+        "path/filepath"
+)
+
+// Скрытая команда gen-fixture: синтетические таблица BGP, списки подсетей и
+// доменов заданного размера и конфиг к ним - для замеров на 1M+ префиксов.
+// Каталог раздаётся любым HTTP-сервером, например python3 -m http.server.
+
+type fixtureOptions struct {
+        Dir      string
+        BaseURL  string
+        Prefixes int
+        ASNs     int
+        V6Share  float64
+        Anycast  float64 // Доля префиксов со вторым origin
+        Lists    int
+        ListSize int
+        Domains  int
+        Seed     int64
+}
+
+func fixturePrefix(rng *rand.Rand, v6 bool) netip.Prefix {
+        if v6 {
+                var b [16]byte
+                b[0], b[1] = 0x20, byte(rng.Intn(0x10))
+                for i := 2; i < 8; i++ {
+                        b[i] = byte(rng.Intn(256))
+                }
+                return netip.PrefixFrom(netip.AddrFrom16(b), 32+rng.Intn(17)).Masked()
+        }
+        b := [4]byte{byte(1 + rng.Intn(222)), byte(rng.Intn(256)), byte(rng.Intn(256)), byte(rng.Intn(256))}
+        return netip.PrefixFrom(netip.AddrFrom4(b), 16+rng.Intn(9)).Masked()
+}
+
+func writeFixtureFile(path string, write func(w *bufio.Writer) error) error {
+        file, err := os.Create(path)
+        if err != nil {
+                return err
+        }
+        defer file.Close()
+
+        w := bufio.NewWriterSize(file, 1<<20)
+        if err := write(w); err != nil {
+                return err
+        }
+        if err := w.Flush(); err != nil {
+                return err
+        }
+        return file.Close()
+}
+
+func generateFixture(opts fixtureOptions) error {
+        rng := rand.New(rand.NewSource(opts.Seed))
+        if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+                return err
+        }
+
+        // AS 64512+ из диапазона private use, чтобы не путать с реальными
+        asn := func() int { return 64512 + rng.Intn(opts.ASNs) }
+
+        err := writeFixtureFile(filepath.Join(opts.Dir, "table.txt"), func(w *bufio.Writer) error {
+                for i := 0; i < opts.Prefixes; i++ {
+                        prefix := fixturePrefix(rng, rng.Float64() < opts.V6Share)
+                        if _, err := fmt.Fprintf(w, "%s %d\n", prefix, asn()); err != nil {
+                                return err
+                        }
+                        if rng.Float64() < opts.Anycast {
+                                if _, err := fmt.Fprintf(w, "%s %d\n", prefix, asn()); err != nil {
+                                        return err
+                                }
+                        }
+                }
+                return nil
+        })
+        if err != nil {
+                return err
+        }
+
+        for i := 0; i < opts.Lists; i++ {
+                err := writeFixtureFile(filepath.Join(opts.Dir, fmt.Sprintf("list%d.txt", i)), func(w *bufio.Writer) error {
+                        for j := 0; j < opts.ListSize; j++ {
+                                if _, err := fmt.Fprintln(w, fixturePrefix(rng, false)); err != nil {
+                                        return err
+                                }
+                        }
+                        return nil
+                })
+                if err != nil {
+                        return err
+                }
+        }
+
+        err = writeFixtureFile(filepath.Join(opts.Dir, "domains.lst"), func(w *bufio.Writer) error {
+                for i := 0; i < opts.Domains; i++ {
+                        if _, err := fmt.Fprintf(w, "host%d.example%d.test\n", i, rng.Intn(1000)); err != nil {
+                                return err
+                        }
+                }
+                return nil
+        })
+        if err != nil {
+                return err
+        }
+
+        return writeFixtureFile(filepath.Join(opts.Dir, "config.yaml"), func(w *bufio.Writer) error {
+                fmt.Fprintf(w, "version: %d\n", currentConfigVersion)
+                fmt.Fprintf(w, "bgp_tools_url: %q\n", opts.BaseURL+"/table.txt")
+                fmt.Fprintf(w, "ipv4_dir: \"ipv4\"\nrouteros_dir: \"RouterOS\"\ngateway: \"10.0.0.1\"\n")
+                fmt.Fprintf(w, "cache:\n  dir: \"cache\"\n")
+                fmt.Fprintf(w, "as_numbers:\n")
+                for i := 0; i < 10 && i < opts.ASNs; i++ {
+                        fmt.Fprintf(w, "  \"%d\":\n    file: \"as%d.lst\"\n", 64512+i, 64512+i)
+                }
+                if opts.Lists > 0 {
+                        fmt.Fprintf(w, "telegram:\n  cidr_url: %q\n", opts.BaseURL+"/list0.txt")
+                }
+                if opts.Lists > 1 {
+                        fmt.Fprintf(w, "cloudflare:\n  v4: %q\n", opts.BaseURL+"/list1.txt")
+                }
+                fmt.Fprintf(w, "domains:\n  fixture:\n    sources: [%q]\n", filepath.Join(opts.Dir, "domains.lst"))
+                fmt.Fprintf(w, "singbox:\n  enabled: true\n")
+                return nil
+        })
+}
+
+func genFixtureCommand(args []string) {
+        flags := flag.NewFlagSet("gen-fixture", flag.ExitOnError)
+        opts := fixtureOptions{}
+        flags.StringVar(&opts.Dir, "dir", "fixture", "output directory")
+        flags.StringVar(&opts.BaseURL, "base-url", "http://127.0.0.1:8000", "URL the directory will be served from")
+        flags.IntVar(&opts.Prefixes, "prefixes", 1000000, "BGP table size")
+        flags.IntVar(&opts.ASNs, "asns", 5000, "number of origin ASNs")
+        flags.Float64Var(&opts.V6Share, "v6", 0.2, "share of IPv6 prefixes")
+        flags.Float64Var(&opts.Anycast, "anycast", 0.01, "share of prefixes with a second origin")
+        flags.IntVar(&opts.Lists, "lists", 2, "number of plain subnet lists")
+        flags.IntVar(&opts.ListSize, "list-size", 10000, "prefixes per subnet list")
+        flags.IntVar(&opts.Domains, "domains", 50000, "domains in domains.lst")
+        flags.Int64Var(&opts.Seed, "seed", 1, "random seed, same seed gives the same data")
+        flags.Parse(args)
+
+        if opts.ASNs < 1 {
+                log.Fatal("--asns must be positive")
+        }
+        if err := generateFixture(opts); err != nil {
+                log.Fatal("Error generating fixture:", err)
+        }
+        log.Printf("Fixture written to %s", opts.Dir)
+}
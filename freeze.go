@@ -0,0 +1,117 @@
+package main
+
+import (
+        "fmt"
+        "log"
+        "strings"
+)
+
+// FreezeConfig списки, которые не обновляются из источников: замороженный
+// остаётся с последним опубликованным содержимым, закреплённый берётся из
+// указанного снимка (файл snapshot.go, путь или URL). Нужно, когда источник
+// заведомо сломан, а роутерам нужны старые данные.
+type FreezeConfig struct {
+        Lists []string          `yaml:"lists"` // Имена списков (файл без .lst или list_name)
+        Pin   map[string]string `yaml:"pin"`   // Список -> снимок
+}
+
+// heldLists замороженные и закреплённые списки в нижнем регистре: sourceSelected их пропускает
+var heldLists map[string]bool
+
+func buildHeldLists() error {
+        heldLists = make(map[string]bool)
+        for _, name := range config.Freeze.Lists {
+                heldLists[strings.ToLower(strings.TrimSuffix(name, ".lst"))] = true
+        }
+        for name, source := range config.Freeze.Pin {
+                key := strings.ToLower(strings.TrimSuffix(name, ".lst"))
+                if heldLists[key] {
+                        return fmt.Errorf("freeze: list %s is both frozen and pinned", name)
+                }
+                if source == "" {
+                        return fmt.Errorf("freeze.pin %s: snapshot is required", name)
+                }
+                heldLists[key] = true
+        }
+        return nil
+}
+
+// applyFreezeFlags добавляет к конфигу --freeze a,b и --pin list=snapshot,...
+func applyFreezeFlags(freeze, pin string) error {
+        for _, name := range strings.Split(freeze, ",") {
+                if name = strings.TrimSpace(name); name != "" {
+                        config.Freeze.Lists = append(config.Freeze.Lists, name)
+                }
+        }
+        for _, item := range strings.Split(pin, ",") {
+                if item = strings.TrimSpace(item); item == "" {
+                        continue
+                }
+                name, source, ok := strings.Cut(item, "=")
+                if !ok {
+                        return fmt.Errorf("--pin %q: expected list=snapshot", item)
+                }
+                if config.Freeze.Pin == nil {
+                        config.Freeze.Pin = make(map[string]string)
+                }
+                config.Freeze.Pin[name] = source
+        }
+        return buildHeldLists()
+}
+
+func heldListMatches(name string, list *generatedList) bool {
+        name = strings.TrimSuffix(name, ".lst")
+        return strings.EqualFold(name, list.Name) || strings.EqualFold(name, list.ListName)
+}
+
+// restoreHeldLists публикует замороженные и закреплённые списки так же, как
+// собранные: форматы вывода и отправка получают их вместе с остальными
+func restoreHeldLists() {
+        if len(config.Freeze.Lists) > 0 {
+                published, err := loadPublishedLists()
+                if err != nil {
+                        log.Printf("Error reading published lists for freeze: %v", err)
+                }
+                for _, name := range config.Freeze.Lists {
+                        var found *generatedList
+                        for _, list := range published {
+                                if heldListMatches(name, list) {
+                                        found = list
+                                        break
+                                }
+                        }
+                        if found == nil {
+                                log.Printf("Error: frozen list %s has no published content in %s", name, config.IPv4Dir)
+                                continue
+                        }
+                        list := *found
+                        runStage(list.Name, "frozen", func() {
+                                log.Printf("List %s is frozen: keeping %d published prefixes", list.Name, len(list.Prefixes))
+                                publishPrefixList(list.Name+".lst", list)
+                        })
+                }
+        }
+
+        snapshots := make(map[string][]generatedList)
+        for name, source := range config.Freeze.Pin {
+                runStage(name, "pinned", func() {
+                        lists, ok := snapshots[source]
+                        if !ok {
+                                var err error
+                                if lists, err = readSnapshotFrom(source, SourceOptions{}); err != nil {
+                                        log.Printf("Error reading pinned snapshot %s for %s: %v", source, name, err)
+                                        return
+                                }
+                                snapshots[source] = lists
+                        }
+                        for i := range lists {
+                                if heldListMatches(name, &lists[i]) {
+                                        log.Printf("List %s is pinned to %s: %d prefixes, %d domains", name, source, len(lists[i].Prefixes), len(lists[i].Domains))
+                                        publishSnapshotList(lists[i])
+                                        return
+                                }
+                        }
+                        log.Printf("Error: pinned list %s not found in snapshot %s", name, source)
+                })
+        }
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+        "fmt"
+        "os"
+        "path/filepath"
+        "strings"
+)
+
+// FRRConfig скрипты vtysh для FRRouting: prefix-list, route-map и статические маршруты
+type FRRConfig struct {
+        OutputConfig `yaml:",inline"`
+        Routes       bool   `yaml:"routes"`      // Добавлять ip route / ipv6 route
+        RouteMap     bool   `yaml:"route_map"`   // route-map с match по prefix-list
+        NextHop      string `yaml:"next_hop"`    // По умолчанию общий gateway
+        NextHopV6    string `yaml:"next_hop_v6"` // Без него IPv6-маршруты не пишутся
+}
+
+func frrCommands(list *generatedList) []string {
+        name := identifierName(list.ListName)
+        commands := []string{"configure terminal"}
+
+        var routes []string
+        seq4, seq6 := 5, 5
+        hasV4, hasV6 := false, false
+        for _, prefix := range list.Prefixes {
+                if prefix.Addr().Is4() {
+                        hasV4 = true
+                        commands = append(commands, fmt.Sprintf("ip prefix-list %s seq %d permit %s", name, seq4, prefix))
+                        seq4 += 5
+                        if config.FRR.Routes && config.FRR.NextHop != "" {
+                                routes = append(routes, fmt.Sprintf("ip route %s %s", prefix, config.FRR.NextHop))
+                        }
+                } else {
+                        hasV6 = true
+                        commands = append(commands, fmt.Sprintf("ipv6 prefix-list %s_V6 seq %d permit %s", name, seq6, prefix))
+                        seq6 += 5
+                        if config.FRR.Routes && config.FRR.NextHopV6 != "" {
+                                routes = append(routes, fmt.Sprintf("ipv6 route %s %s", prefix, config.FRR.NextHopV6))
+                        }
+                }
+        }
+
+        if config.FRR.RouteMap {
+                commands = append(commands, fmt.Sprintf("route-map %s_RM permit 10", name))
+                if hasV4 {
+                        commands = append(commands, "match ip address prefix-list "+name)
+                }
+                if hasV6 {
+                        commands = append(commands, "match ipv6 address prefix-list "+name+"_V6")
+                }
+                commands = append(commands, "exit")
+        }
+        return append(append(commands, routes...), "end", "write memory")
+}
+
+// frrScript собирает команды в один вызов vtysh -c ... -c ...
+func frrScript(commands []string) string {
+        var b strings.Builder
+        b.WriteString("#!/bin/sh\nvtysh")
+        for _, command := range commands {
+                fmt.Fprintf(&b, " \\\n  -c '%s'", strings.ReplaceAll(command, "'", `'\''`))
+        }
+        b.WriteString("\n")
+        return b.String()
+}
+
+func generateFRRScript(list *generatedList) error {
+        if len(list.Prefixes) == 0 {
+                return nil
+        }
+        dir := layoutDir("frr", list.Name, config.FRR.Dir)
+        if err := os.MkdirAll(dir, 0755); err != nil {
+                return err
+        }
+        path := filepath.Join(dir, list.Name+".sh")
+        if err := writeFileStaged(path, []byte(frrScript(frrCommands(list)))); err != nil {
+                return err
+        }
+        return os.Chmod(path, 0755)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+        "strings"
+)
+
+// routeGateways шлюзы IPv4 и IPv6 для маршрутов списка: из as_numbers или
+// filters, если там заданы, иначе общие gateway и gateway_v6. Шлюзом может
+// быть и имя интерфейса, например wg0.
+func routeGateways(listName string) (string, string) {
+        gateway, gatewayV6 := config.Gateway, config.GatewayV6
+
+        override := func(file, name, gw, gwV6 string) {
+                if name == "" {
+                        name = strings.TrimSuffix(file, ".lst")
+                }
+                if name != listName {
+                        return
+                }
+                if gw != "" {
+                        gateway = gw
+                }
+                if gwV6 != "" {
+                        gatewayV6 = gwV6
+                }
+        }
+        for _, as := range config.ASNumbers {
+                override(as.File, as.ListName, as.Gateway, as.GatewayV6)
+        }
+        for name, filter := range config.Filters {
+                file := filter.File
+                if file == "" {
+                        file = name + ".lst"
+                }
+                override(file, filter.ListName, filter.Gateway, filter.GatewayV6)
+        }
+        return gateway, gatewayV6
+}
@@ -2,22 +2,27 @@ package main
 
 import (
         "bufio"
+        "flag"
         "fmt"
         "io"
         "log"
+        "net"
         "net/http"
         "net/netip"
         "os"
         "path/filepath"
+        "strconv"
         "strings"
+        "time"
 
-        "gopkg.in/yaml.v3"
         "go4.org/netipx"
 )
 
 // Config структура для конфигурации YAML
 type Config struct {
+        Version        int                 `yaml:"version"` // Версия формата конфига
         BGPToolsURL    string              `yaml:"bgp_tools_url"`
+        BGPTools       SourceOptions       `yaml:"bgp_tools"`
         UserAgent      string              `yaml:"user_agent"`
         IPv4Dir        string              `yaml:"ipv4_dir"`
         RouterOSDir    string              `yaml:"routeros_dir"`
@@ -25,39 +30,148 @@ type Config struct {
         Discord        DiscordConfig       `yaml:"discord"`
         Telegram       TelegramConfig      `yaml:"telegram"`
         Cloudflare     CloudflareConfig    `yaml:"cloudflare"`
+        AWS            AWSConfig           `yaml:"aws"`
+        Google         GoogleConfig        `yaml:"google"`
         AdditionalAS   map[string]ASConfig `yaml:"additional_as"`
         GenerateV6     bool                `yaml:"generate_v6"`
         GenerateV7     bool                `yaml:"generate_v7"`
+        RouterOSListOnly bool              `yaml:"routeros_list_only"` // Только address-list, без mangle и маршрута
+        RouterOSLink   string              `yaml:"routeros_link"`      // hardlink или symlink для одинаковых v6/v7
+        RouterOSDelta  bool                `yaml:"routeros_delta"`     // <list>-delta.rsc с изменениями с прошлого запуска
+        ConflictPolicy string              `yaml:"conflict_policy"`    // union, prefer-trusted или intersect для источников одного списка
+        Role           string              `yaml:"role"`               // all (по умолчанию), fetch или render, см. snapshot.go
+        Snapshot       SnapshotConfig      `yaml:"snapshot"`
+        Freeze         FreezeConfig        `yaml:"freeze"`             // Списки без обновления из источников, см. freeze.go
+        Quarantine     QuarantineConfig    `yaml:"quarantine"`         // Задержка публикации новых префиксов
+        RemovalGrace   RemovalGraceConfig  `yaml:"removal_grace"`      // Задержка удаления пропавших префиксов
+        Aggregation    map[string]AggregationConfig `yaml:"aggregation"` // По имени формата вывода, см. granularity.go
+        RouterOSRouting string             `yaml:"routeros_routing"`   // mark (по умолчанию) или table: /routing/table и /routing/rule в v7
+        RouterOSComments string            `yaml:"routeros_comments"` // escape (по умолчанию), translit или raw
         Gateway        string              `yaml:"gateway"` // Единый шлюз для всех маршрутов
+        GatewayV6      string              `yaml:"gateway_v6"` // Шлюз IPv6-маршрутов; без него они не пишутся
+        Domains        map[string]DomainConfig `yaml:"domains"`
+        Dnsmasq        DnsmasqConfig       `yaml:"dnsmasq"`
+        Cache          CacheConfig         `yaml:"cache"`
+        MaxBodySize    ByteSize            `yaml:"max_body_size"` // Предел размера ответа для всех источников
+        WorkDir        string              `yaml:"work_dir"`      // Где создавать каталог запуска, по умолчанию системный temp
+        WriteStrategy  string              `yaml:"write_strategy"` // rename, copy или inplace (см. place.go)
+        WriteRetries   int                 `yaml:"write_retries"`  // Повторы при EBUSY и т.п. на сетевых ФС
+        RunTimeout     time.Duration       `yaml:"run_timeout"`    // Дедлайн всего запуска; 0 - без ограничения
+        RetryFailed    int                 `yaml:"retry_failed"`   // Повторы списков, упавших на временной ошибке; -1 - без повторов
+        RetryDelay     time.Duration       `yaml:"retry_delay"`    // Пауза перед повтором
+        SingBox        SingBoxConfig       `yaml:"singbox"`
+        Xray           XrayConfig          `yaml:"xray"`
+        Registry       RegistryConfig      `yaml:"registry"`
+        MMDB           MMDBConfig          `yaml:"mmdb"`
+        IXP            IXPConfig           `yaml:"ixp"`
+        IRR            IRRConfig           `yaml:"irr"`
+        RIPEstat       RIPEstatConfig      `yaml:"ripestat"`
+        BGPToolsAPI    BGPToolsAPIConfig   `yaml:"bgptools_api"`
+        MRT            MRTConfig           `yaml:"mrt"`
+        HTTPSources    HTTPSourcesConfig   `yaml:"http_sources"`
+        Rsync          RsyncConfig         `yaml:"rsync"`
+        Provenance     ProvenanceConfig    `yaml:"provenance"`
+        Surge          OutputConfig        `yaml:"surge"`
+        QuantumultX    QuantumultXConfig   `yaml:"quantumultx"`
+        Keenetic       KeeneticConfig      `yaml:"keenetic"`
+        Anycast        AnycastConfig       `yaml:"anycast"`
+        Filters        map[string]FilterListConfig `yaml:"filters"`
+        OrgDiscovery   OrgDiscoveryConfig  `yaml:"org_discovery"`
+        OpenWrtPBR     OpenWrtPBRConfig    `yaml:"openwrt_pbr"`
+        OpenWrtIPSet   OpenWrtIPSetConfig  `yaml:"openwrt_ipset"`
+        RouterOSPush   RouterOSPushConfig  `yaml:"routeros_push"`
+        SSHPush        SSHPushConfig       `yaml:"ssh_push"`
+        NFTables       NFTablesConfig      `yaml:"nftables"`
+        IPSet          IPSetConfig         `yaml:"ipset"`
+        GoBGP          GoBGPConfig         `yaml:"gobgp"`
+        RouterOSFile   RouterOSFileConfig  `yaml:"routeros_file"`
+        RouterOSBootstrap RouterOSBootstrapConfig `yaml:"routeros_bootstrap"`
+        RouterOSDNS    RouterOSDNSConfig   `yaml:"routeros_dns"`
+        PfSense        PfSenseConfig       `yaml:"pfsense"`
+        OPNsense       OutputConfig        `yaml:"opnsense"`
+        Cisco          CiscoConfig         `yaml:"cisco"`
+        Juniper        OutputConfig        `yaml:"juniper"`
+        BIRD           BIRDConfig          `yaml:"bird"`
+        FRR            FRRConfig           `yaml:"frr"`
+        VyOS           VyOSConfig          `yaml:"vyos"`
+        EdgeOS         EdgeOSConfig        `yaml:"edgeos"`
+        OpenVPN        OpenVPNConfig       `yaml:"openvpn"`
+        WireGuard      WireGuardConfig     `yaml:"wireguard"`
+        Amnezia        OutputConfig        `yaml:"amnezia"`
+        Index          IndexConfig         `yaml:"index"`
+        Server         ServerConfig        `yaml:"server"`
+        Windows        WindowsConfig       `yaml:"windows"`
+        Linux          LinuxRouteConfig    `yaml:"linux"`
+        Networkd       NetworkdConfig      `yaml:"networkd"`
+        Merlin         MerlinConfig        `yaml:"merlin"`
+        Unbound        UnboundConfig       `yaml:"unbound"`
+        RPZ            RPZConfig           `yaml:"rpz"`
+        SmartDNS       SmartDNSConfig      `yaml:"smartdns"`
+        PushQueue      PushQueueConfig     `yaml:"push_queue"`
+        DNSCrypt       DNSCryptConfig      `yaml:"dnscrypt"`
+        Squid          SquidConfig         `yaml:"squid"`
+        HAProxy        OutputConfig        `yaml:"haproxy"`
+        JSON           OutputConfig        `yaml:"json"`
+        Raw            OutputConfig        `yaml:"raw"` // Префиксы как в источнике, без объединения (raw.go)
+        Tagged         map[string]TaggedListConfig `yaml:"tagged"`
+        RoutedSpace    RoutedSpaceConfig   `yaml:"routed_space"`
+        Static         map[string]StaticListConfig `yaml:"static"`
+        Layout         []LayoutRule        `yaml:"layout"` // Раскладка файлов по каталогам публикации
+}
+
+// SourceOptions общие настройки загрузки для любого источника
+type SourceOptions struct {
+        CacheTTL    time.Duration `yaml:"cache_ttl"`
+        SHA256      string        `yaml:"sha256"`       // Ожидаемая контрольная сумма содержимого
+        ChecksumURL string        `yaml:"checksum_url"` // Файл с суммой (формат sha256sum)
+        MaxSize     ByteSize      `yaml:"max_size"`     // Предел размера ответа, по умолчанию max_body_size
+        Trust       string        `yaml:"trust"`        // trusted (по умолчанию) или untrusted
 }
 
 type ASConfig struct {
-        File     string `yaml:"file"`
-        ListName string `yaml:"list_name"`
-        Comment  string `yaml:"comment"`
+        File       string   `yaml:"file"`
+        ListName   string   `yaml:"list_name"`
+        Comment    string   `yaml:"comment"`
+        Anycast    string   `yaml:"anycast"`     // tag или exclude
+        PrefixMode string   `yaml:"prefix_mode"` // aggregate, covering или most_specific
+        MaxOrigins int      `yaml:"max_origins"` // Пропускать анонсы с большим числом origin ASN
+        Gateway    string   `yaml:"gateway"`     // Шлюз или интерфейс этого списка вместо общего
+        GatewayV6  string   `yaml:"gateway_v6"`
+        Tags       []string `yaml:"tags"`  // Метки для списков tagged
+        Trust      string   `yaml:"trust"` // trusted (по умолчанию) или untrusted
+        ASNs       []string `yaml:"asns"`    // Ещё ASN этого же сервиса, объединяются в один список
+        ASSets     []string `yaml:"as_sets"` // AS-SET из IRR, например AS-GOOGLE (см. irr)
+        Source     string   `yaml:"source"`  // bgp_tools (по умолчанию), ripestat или bgptools_api
 }
 
 type DiscordConfig struct {
-        VoiceV4  string `yaml:"voice_v4"`
-        File     string `yaml:"file"`
-        ListName string `yaml:"list_name"`
+        VoiceV4       string   `yaml:"voice_v4"`
+        File          string   `yaml:"file"`
+        ListName      string   `yaml:"list_name"`
+        Tags          []string `yaml:"tags"`
+        SourceOptions `yaml:",inline"`
 }
 
 type TelegramConfig struct {
-        CIDRURL  string `yaml:"cidr_url"`
-        File     string `yaml:"file"`
-        ListName string `yaml:"list_name"`
+        CIDRURL       string   `yaml:"cidr_url"`
+        File          string   `yaml:"file"`
+        ListName      string   `yaml:"list_name"`
+        Tags          []string `yaml:"tags"`
+        SourceOptions `yaml:",inline"`
 }
 
 type CloudflareConfig struct {
-        V4       string `yaml:"v4"`
-        File     string `yaml:"file"`
-        ListName string `yaml:"list_name"`
+        V4            string   `yaml:"v4"`
+        File          string   `yaml:"file"`
+        ListName      string   `yaml:"list_name"`
+        Tags          []string `yaml:"tags"`
+        SourceOptions `yaml:",inline"`
 }
 
 type subnetAS struct {
         subnet string
         as     string
+        source string // URL, если строка не из таблицы bgp.tools
 }
 
 var config Config
@@ -68,7 +182,7 @@ func loadConfig(configPath string) error {
                 return err
         }
 
-        err = yaml.Unmarshal(data, &config)
+        err = decodeConfig(data, &config)
         if err != nil {
                 return err
         }
@@ -84,6 +198,462 @@ func loadConfig(configPath string) error {
                 config.GenerateV7 = true
         }
 
+        if config.MaxBodySize == 0 {
+                config.MaxBodySize = 512 << 20
+        }
+
+        if config.Cache.Dir == "" {
+                config.Cache.Dir = "cache"
+        }
+
+        if config.SingBox.Dir == "" {
+                config.SingBox.Dir = "JSON"
+        }
+        if config.SingBox.Version == 0 {
+                config.SingBox.Version = 3
+        }
+        if config.SingBox.SRSDir == "" {
+                config.SingBox.SRSDir = "SRS"
+        }
+
+        if config.Xray.Dir == "" {
+                config.Xray.Dir = "DAT"
+        }
+        if config.Xray.GeoIPFile == "" {
+                config.Xray.GeoIPFile = "geoip.dat"
+        }
+        if config.Xray.GeoSiteFile == "" {
+                config.Xray.GeoSiteFile = "geosite.dat"
+        }
+
+        if config.MMDB.File == "" {
+                config.MMDB.File = "MMDB/allow-domains.mmdb"
+        }
+        if config.MMDB.DatabaseType == "" {
+                config.MMDB.DatabaseType = "maxmind"
+        }
+
+        if config.Surge.Dir == "" {
+                config.Surge.Dir = "Surge"
+        }
+        if config.QuantumultX.Dir == "" {
+                config.QuantumultX.Dir = "QuantumultX"
+        }
+        if config.QuantumultX.Policy == "" {
+                config.QuantumultX.Policy = "proxy"
+        }
+        if config.Keenetic.Dir == "" {
+                config.Keenetic.Dir = "Keenetic"
+        }
+        if config.OpenWrtPBR.Dir == "" {
+                config.OpenWrtPBR.Dir = "OpenWrt"
+        }
+        if config.OpenWrtIPSet.Dir == "" {
+                config.OpenWrtIPSet.Dir = "OpenWrt/ipset"
+        }
+        if config.RouterOSFile.Dir == "" {
+                config.RouterOSFile.Dir = filepath.Join(config.RouterOSDir, "file")
+        }
+        if config.RouterOSDNS.Dir == "" {
+                config.RouterOSDNS.Dir = filepath.Join(config.RouterOSDir, "dns")
+        }
+        if config.RouterOSDNS.ForwardTo == "" {
+                config.RouterOSDNS.ForwardTo = "1.1.1.1"
+        }
+        if config.RouterOSBootstrap.Enabled && config.RouterOSBootstrap.BaseURL == "" {
+                return fmt.Errorf("routeros_bootstrap needs base_url")
+        }
+        if config.RouterOSBootstrap.File == "" {
+                config.RouterOSBootstrap.File = "bootstrap.rsc"
+        }
+        if config.RouterOSBootstrap.Name == "" {
+                config.RouterOSBootstrap.Name = "allow-domains"
+        }
+        if config.RouterOSBootstrap.Interval == "" {
+                config.RouterOSBootstrap.Interval = "1d"
+        }
+        if config.RouterOSBootstrap.StartTime == "" {
+                config.RouterOSBootstrap.StartTime = "04:00:00"
+        }
+        if config.PfSense.Dir == "" {
+                config.PfSense.Dir = "pfSense"
+        }
+        if config.OPNsense.Dir == "" {
+                config.OPNsense.Dir = "OPNsense"
+        }
+        if config.Cisco.Dir == "" {
+                config.Cisco.Dir = "Cisco"
+        }
+        if config.Juniper.Dir == "" {
+                config.Juniper.Dir = "Juniper"
+        }
+        if config.BIRD.Dir == "" {
+                config.BIRD.Dir = "BIRD"
+        }
+        if config.BIRD.Gateway == "" {
+                config.BIRD.Gateway = config.Gateway
+        }
+        if config.BIRD.GatewayV6 == "" {
+                config.BIRD.GatewayV6 = config.GatewayV6
+        }
+        if config.BIRD.IncludeDir == "" {
+                config.BIRD.IncludeDir = "/etc/bird/allow-domains"
+        }
+        if config.FRR.Dir == "" {
+                config.FRR.Dir = "FRR"
+        }
+        if config.FRR.NextHop == "" {
+                config.FRR.NextHop = config.Gateway
+        }
+        if config.VyOS.Dir == "" {
+                config.VyOS.Dir = "VyOS"
+        }
+        if config.VyOS.NextHop == "" {
+                config.VyOS.NextHop = config.Gateway
+        }
+        if config.EdgeOS.Dir == "" {
+                config.EdgeOS.Dir = "EdgeOS"
+        }
+        if config.EdgeOS.NextHop == "" {
+                config.EdgeOS.NextHop = config.Gateway
+        }
+        if config.OpenVPN.Dir == "" {
+                config.OpenVPN.Dir = "OpenVPN"
+        }
+        if config.WireGuard.Dir == "" {
+                config.WireGuard.Dir = "WireGuard"
+        }
+        if config.Amnezia.Dir == "" {
+                config.Amnezia.Dir = "Amnezia"
+        }
+        if config.Index.File == "" {
+                config.Index.File = "index.json"
+        }
+        if config.Server.Listen == "" {
+                config.Server.Listen = ":8080"
+        }
+        if config.Server.UI.Enabled && (config.Server.UI.User == "" || config.Server.UI.Password == "") {
+                return fmt.Errorf("server.ui needs user and password")
+        }
+        if config.Windows.Dir == "" {
+                config.Windows.Dir = "Windows"
+        }
+        if config.Windows.Gateway == "" {
+                config.Windows.Gateway = config.Gateway
+        }
+        if config.Windows.Metric == 0 {
+                config.Windows.Metric = 5
+        }
+        if config.Linux.Dir == "" {
+                config.Linux.Dir = "Linux"
+        }
+        if config.Linux.Gateway == "" && config.Linux.Device == "" {
+                config.Linux.Gateway = config.Gateway
+        }
+        if config.Linux.GatewayV6 == "" && config.Linux.Device == "" {
+                config.Linux.GatewayV6 = config.GatewayV6
+        }
+        if config.Linux.Table == 0 {
+                config.Linux.Table = 100
+        }
+        if config.Linux.Priority == 0 {
+                config.Linux.Priority = 1000
+        }
+        if config.Networkd.Dir == "" {
+                config.Networkd.Dir = "networkd"
+        }
+        if config.Networkd.Network == "" {
+                config.Networkd.Network = "50-vpn"
+        }
+        if config.Networkd.Gateway == "" {
+                config.Networkd.Gateway = config.Gateway
+        }
+        if config.Networkd.GatewayV6 == "" {
+                config.Networkd.GatewayV6 = config.GatewayV6
+        }
+        if config.Merlin.Dir == "" {
+                config.Merlin.Dir = "Merlin"
+        }
+        if config.Merlin.Interface == "" {
+                config.Merlin.Interface = "OVPN1"
+        }
+        if config.Merlin.IPSetDir == "" {
+                config.Merlin.IPSetDir = "/opt/tmp"
+        }
+        if config.Unbound.Dir == "" {
+                config.Unbound.Dir = "unbound"
+        }
+        if config.RPZ.Dir == "" {
+                config.RPZ.Dir = "RPZ"
+        }
+        if config.RPZ.ZoneSuffix == "" {
+                config.RPZ.ZoneSuffix = "rpz"
+        }
+        if config.RPZ.NameServer == "" {
+                config.RPZ.NameServer = "localhost"
+        }
+        if config.SmartDNS.Dir == "" {
+                config.SmartDNS.Dir = "smartdns"
+        }
+        if config.SmartDNS.SetDir == "" {
+                config.SmartDNS.SetDir = "/etc/smartdns/domain-set"
+        }
+        if config.SmartDNS.Family == "" {
+                config.SmartDNS.Family = "inet"
+        }
+        if config.SmartDNS.Table == "" {
+                config.SmartDNS.Table = "fw4"
+        }
+        if config.DNSCrypt.Dir == "" {
+                config.DNSCrypt.Dir = "dnscrypt-proxy"
+        }
+        if config.Squid.Dir == "" {
+                config.Squid.Dir = "Squid"
+        }
+        if config.Squid.ACLDir == "" {
+                config.Squid.ACLDir = "/etc/squid/acl"
+        }
+        if config.HAProxy.Dir == "" {
+                config.HAProxy.Dir = "HAProxy"
+        }
+        if config.JSON.Dir == "" {
+                config.JSON.Dir = "Lists"
+        }
+        if config.Raw.Dir == "" {
+                config.Raw.Dir = "Raw"
+        }
+        if config.PushQueue.Backoff == 0 {
+                config.PushQueue.Backoff = 5 * time.Minute
+        }
+        if config.PushQueue.MaxBackoff == 0 {
+                config.PushQueue.MaxBackoff = 6 * time.Hour
+        }
+        if config.PushQueue.MaxAge == 0 {
+                config.PushQueue.MaxAge = 7 * 24 * time.Hour
+        }
+        if config.Cisco.SeqStep == 0 {
+                config.Cisco.SeqStep = 5
+        }
+        if config.PfSense.UpdateFreq == 0 {
+                config.PfSense.UpdateFreq = 1
+        }
+        if config.OpenWrtIPSet.LoadDir == "" {
+                config.OpenWrtIPSet.LoadDir = "/etc/firewall/ipsets"
+        }
+        switch config.WriteStrategy {
+        case "":
+                config.WriteStrategy = "rename"
+        case "rename", "copy", "inplace":
+        default:
+                return fmt.Errorf("unknown write_strategy %q (rename, copy or inplace)", config.WriteStrategy)
+        }
+        if config.WriteRetries == 0 {
+                config.WriteRetries = 5
+        }
+        switch config.RouterOSRouting {
+        case "":
+                config.RouterOSRouting = "mark"
+        case "mark", "table":
+        default:
+                return fmt.Errorf("unknown routeros_routing %q (mark or table)", config.RouterOSRouting)
+        }
+        switch config.Role {
+        case "":
+                config.Role = "all"
+        case "all", "fetch", "render":
+        default:
+                return fmt.Errorf("unknown role %q (all, fetch or render)", config.Role)
+        }
+        if config.NFTables.Family == "" {
+                config.NFTables.Family = "inet"
+        }
+        if config.NFTables.Table == "" {
+                config.NFTables.Table = "fw4"
+        }
+        if config.IPSet.MaxElem == 0 {
+                config.IPSet.MaxElem = 65536
+        }
+        if config.IRR.CacheTTL == 0 {
+                config.IRR.CacheTTL = 24 * time.Hour
+        }
+        if config.IRR.Timeout == 0 {
+                config.IRR.Timeout = 30 * time.Second
+        }
+        if config.IRR.MaxDepth == 0 {
+                config.IRR.MaxDepth = 10
+        }
+        if config.RIPEstat.URL == "" {
+                config.RIPEstat.URL = "https://stat.ripe.net/data/announced-prefixes/data.json"
+        }
+        if config.RIPEstat.MaxAge == 0 {
+                config.RIPEstat.MaxAge = 24 * time.Hour
+        }
+        if config.BGPToolsAPI.ASURL == "" {
+                config.BGPToolsAPI.ASURL = "https://bgp.tools/api/v1/as/{asn}/prefixes"
+        }
+        if config.BGPToolsAPI.PrefixURL == "" {
+                config.BGPToolsAPI.PrefixURL = "https://bgp.tools/api/v1/prefix/{prefix}"
+        }
+        if config.BGPToolsAPI.Rate <= 0 {
+                config.BGPToolsAPI.Rate = 1
+        }
+        if config.BGPToolsAPI.Retries == 0 {
+                config.BGPToolsAPI.Retries = 3
+        }
+        if config.MRT.Mode == "" {
+                config.MRT.Mode = "fallback"
+        }
+        if len(config.HTTPSources.Headless.Status) == 0 {
+                config.HTTPSources.Headless.Status = []int{http.StatusForbidden, http.StatusServiceUnavailable}
+        }
+        if config.HTTPSources.Headless.Timeout <= 0 {
+                config.HTTPSources.Headless.Timeout = 2 * time.Minute
+        }
+        if config.Rsync.Command == "" {
+                config.Rsync.Command = "rsync"
+        }
+        if config.Rsync.Timeout <= 0 {
+                config.Rsync.Timeout = 60 * time.Second
+        }
+        if config.MRT.MaxSize == 0 {
+                // Полный RIB-дамп коллектора - сотни мегабайт
+                config.MRT.MaxSize = 2 << 30
+        }
+        if config.GoBGP.Command == "" {
+                config.GoBGP.Command = "gobgp"
+        }
+        if config.GoBGP.NextHop == "" {
+                config.GoBGP.NextHop = config.Gateway
+        }
+        if config.GoBGP.NextHopV6 == "" {
+                config.GoBGP.NextHopV6 = config.GatewayV6
+        }
+        if config.GoBGP.Enabled {
+                for name, settings := range config.GoBGP.Lists {
+                        for _, hop := range []string{settings.NextHop, settings.NextHopV6} {
+                                if _, err := netip.ParseAddr(hop); hop != "" && err != nil {
+                                        return fmt.Errorf("gobgp.lists %s: next hop %q is not an IP address", name, hop)
+                                }
+                        }
+                }
+                for _, hop := range []string{config.GoBGP.NextHop, config.GoBGP.NextHopV6} {
+                        if _, err := netip.ParseAddr(hop); hop != "" && err != nil {
+                                return fmt.Errorf("gobgp: next hop %q is not an IP address, set gobgp.next_hop", hop)
+                        }
+                }
+        }
+        if err := validateSSHTargets(); err != nil {
+                return err
+        }
+        if err := buildHeldLists(); err != nil {
+                return err
+        }
+        if err := validateAggregation(); err != nil {
+                return err
+        }
+        if config.Snapshot.File == "" {
+                config.Snapshot.File = "snapshot.json"
+        }
+        if config.Snapshot.Source == "" {
+                config.Snapshot.Source = config.Snapshot.File
+        }
+        switch config.ConflictPolicy {
+        case "":
+                config.ConflictPolicy = "union"
+        case "union", "prefer-trusted", "intersect":
+        default:
+                return fmt.Errorf("unknown conflict_policy %q (union, prefer-trusted or intersect)", config.ConflictPolicy)
+        }
+        for as, asConfig := range config.ASNumbers {
+                if err := validateTrust("as_numbers "+as, asConfig.Trust); err != nil {
+                        return err
+                }
+                for _, value := range asConfig.ASNs {
+                        if _, err := strconv.ParseUint(normalizeASN(value), 10, 32); err != nil {
+                                return fmt.Errorf("as_numbers %s: invalid ASN %q in asns", as, value)
+                        }
+                }
+                if len(listASNs(as, asConfig)) == 0 && len(listASSets(as, asConfig)) == 0 {
+                        return fmt.Errorf("as_numbers %s: key is not an ASN or AS-SET, list them in asns or as_sets", as)
+                }
+                switch asConfig.Source {
+                case "", asSourceBGPTools, asSourceRIPEstat:
+                case asSourceBGPToolsAPI:
+                        if config.BGPToolsAPI.Token == "" {
+                                return fmt.Errorf("as_numbers %s: source bgptools_api needs bgptools_api.token", as)
+                        }
+                default:
+                        return fmt.Errorf("as_numbers %s: unknown source %q (bgp_tools, ripestat or bgptools_api)", as, asConfig.Source)
+                }
+                for _, set := range asConfig.ASSets {
+                        if !isASSet(set) {
+                                return fmt.Errorf("as_numbers %s: %q in as_sets is not an AS-SET name", as, set)
+                        }
+                }
+        }
+        if config.MRT.Mode != "fallback" && config.MRT.Mode != "cross_check" {
+                return fmt.Errorf("mrt.mode: unknown mode %q (fallback or cross_check)", config.MRT.Mode)
+        }
+        for name, filter := range config.Filters {
+                if err := validateTrust("filters "+name, filter.Trust); err != nil {
+                        return err
+                }
+        }
+        for name, domain := range config.Domains {
+                if err := validateTrust("domains "+name, domain.Trust); err != nil {
+                        return err
+                }
+        }
+        for name, static := range config.Static {
+                if err := validateTrust("static "+name, static.Trust); err != nil {
+                        return err
+                }
+        }
+        for name, trust := range map[string]string{"discord": config.Discord.Trust, "telegram": config.Telegram.Trust, "cloudflare": config.Cloudflare.Trust, "aws": config.AWS.Trust, "google": config.Google.Trust} {
+                if err := validateTrust(name, trust); err != nil {
+                        return err
+                }
+        }
+        for name, tagged := range config.Tagged {
+                if _, err := parseTagExpr(tagged.Match); err != nil {
+                        return fmt.Errorf("tagged %s: match %q: %w", name, tagged.Match, err)
+                }
+        }
+        if config.RoutedSpace.Cap == 0 {
+                config.RoutedSpace.Cap = 10
+        }
+        if config.RetryFailed == 0 {
+                config.RetryFailed = 1
+        }
+        if config.RetryDelay == 0 {
+                config.RetryDelay = 30 * time.Second
+        }
+        switch config.RouterOSLink {
+        case "", "hardlink", "symlink":
+        default:
+                return fmt.Errorf("unknown routeros_link %q (hardlink or symlink)", config.RouterOSLink)
+        }
+        switch config.RouterOSComments {
+        case "":
+                config.RouterOSComments = "escape"
+        case "escape", "translit", "raw":
+        default:
+                return fmt.Errorf("unknown routeros_comments %q (escape, translit or raw)", config.RouterOSComments)
+        }
+
+        if config.Dnsmasq.Dir == "" {
+                config.Dnsmasq.Dir = "dnsmasq"
+        }
+        if config.Dnsmasq.Family == "" {
+                config.Dnsmasq.Family = "inet"
+        }
+        if config.Dnsmasq.Table == "" {
+                config.Dnsmasq.Table = "fw4"
+        }
+        if config.Dnsmasq.SetName == "" {
+                config.Dnsmasq.SetName = "vpn_domains"
+        }
+
         return nil
 }
 
@@ -103,38 +673,96 @@ func createDirs() error {
                         return err
                 }
         }
+        if len(config.Domains) > 0 {
+                if err := os.MkdirAll(config.Dnsmasq.Dir, 0755); err != nil {
+                        return err
+                }
+        }
 
         return nil
 }
 
-func downloadURL(url string) (string, error) {
-        client := &http.Client{}
-        req, err := http.NewRequest("GET", url, nil)
+// httpClient общий для всех загрузок: соединения к одному хосту переиспользуются,
+// HTTP/2 включается для TLS-источников
+var httpClient = &http.Client{
+        Transport: &http.Transport{
+                Proxy: http.ProxyFromEnvironment,
+                DialContext: (&net.Dialer{
+                        Timeout:   30 * time.Second,
+                        KeepAlive: 30 * time.Second,
+                }).DialContext,
+                ForceAttemptHTTP2:     true,
+                MaxIdleConns:          100,
+                MaxIdleConnsPerHost:   16,
+                IdleConnTimeout:       90 * time.Second,
+                TLSHandshakeTimeout:   10 * time.Second,
+                ResponseHeaderTimeout: 60 * time.Second,
+                ExpectContinueTimeout: 1 * time.Second,
+        },
+}
+
+// downloadURL скачивает url целиком, но не больше maxSize байт
+func downloadURL(url string, maxSize ByteSize) (string, error) {
+        if maxSize <= 0 {
+                maxSize = config.MaxBodySize
+        }
+        switch urlScheme(url) {
+        case "ftp":
+                return downloadFTP(url, maxSize)
+        case "rsync":
+                return downloadRsync(url, maxSize)
+        }
+        return downloadURLHeaders(url, maxSize, nil)
+}
+
+// downloadURLHeaders как downloadURL, с дополнительными заголовками (например Authorization)
+func downloadURLHeaders(url string, maxSize ByteSize, headers map[string]string) (string, error) {
+        if maxSize <= 0 {
+                maxSize = config.MaxBodySize
+        }
+
+        req, err := http.NewRequestWithContext(runCtx, "GET", url, nil)
         if err != nil {
                 return "", err
         }
         req.Header.Set("User-Agent", config.UserAgent)
+        for name, value := range headers {
+                req.Header.Set(name, value)
+        }
+        addSourceCookies(req)
 
-        resp, err := client.Do(req)
+        resp, err := httpClient.Do(req)
         if err != nil {
                 return "", err
         }
         defer resp.Body.Close()
 
         if resp.StatusCode != http.StatusOK {
-                return "", fmt.Errorf("HTTP error: %s", resp.Status)
+                // Дочитываем тело, чтобы соединение вернулось в пул
+                io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+                if headlessFallback(url, resp.StatusCode) {
+                        log.Printf("%s: %s, fetching with headless command", url, resp.Status)
+                        return headlessFetch(url, maxSize)
+                }
+                return "", &httpStatusError{Code: resp.StatusCode, Status: resp.Status}
+        }
+        if resp.ContentLength > int64(maxSize) {
+                return "", fmt.Errorf("response size %d exceeds limit of %d bytes", resp.ContentLength, maxSize)
         }
 
-        body, err := io.ReadAll(resp.Body)
+        body, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxSize)+1))
         if err != nil {
                 return "", err
         }
+        if int64(len(body)) > int64(maxSize) {
+                return "", fmt.Errorf("response exceeds limit of %d bytes", maxSize)
+        }
 
-        return string(body), nil
+        return stripBOM(string(body)), nil
 }
 
 func downloadBGPTable() ([]subnetAS, error) {
-        data, err := downloadURL(config.BGPToolsURL)
+        data, err := downloadCached(config.BGPToolsURL, config.BGPTools)
         if err != nil {
                 return nil, err
         }
@@ -159,11 +787,35 @@ func downloadBGPTable() ([]subnetAS, error) {
         return subnets, nil
 }
 
-func processSubnets(subnets []subnetAS, targetAS string) ([]netip.Prefix, error) {
+// listASNs ASN списка: ключ as_numbers, если это номер, asns и участники
+// раскрытых AS-SET. Прочий ключ (например "telegram") - только имя записи.
+func listASNs(as string, asConfig ASConfig) []string {
+        var asns []string
+        seen := make(map[string]bool)
+        values := append([]string{as}, asConfig.ASNs...)
+        for _, set := range listASSets(as, asConfig) {
+                values = append(values, asSetASNs[set]...)
+        }
+        for _, value := range values {
+                n := normalizeASN(value)
+                if _, err := strconv.ParseUint(n, 10, 32); err != nil || seen[n] {
+                        continue
+                }
+                seen[n] = true
+                asns = append(asns, n)
+        }
+        return asns
+}
+
+func processSubnets(subnets []subnetAS, targetASNs []string) ([]netip.Prefix, error) {
         var v4Set netipx.IPSetBuilder
 
+        wanted := make(map[string]bool, len(targetASNs))
+        for _, as := range targetASNs {
+                wanted[normalizeASN(as)] = true
+        }
         for _, item := range subnets {
-                if item.as == targetAS {
+                if wanted[normalizeASN(item.as)] {
                         prefix, err := netip.ParsePrefix(item.subnet)
                         if err != nil {
                                 log.Printf("Invalid subnet: %s", item.subnet)
@@ -180,10 +832,10 @@ func processSubnets(subnets []subnetAS, targetAS string) ([]netip.Prefix, error)
         return v4IPSet.Prefixes(), nil
 }
 
-func downloadReadySubnets(urlV4 string) ([]netip.Prefix, error) {
+func downloadReadySubnets(file, urlV4 string, opts SourceOptions) ([]netip.Prefix, error) {
         var v4Set netipx.IPSetBuilder
 
-        data, err := downloadURL(urlV4)
+        data, err := downloadCached(urlV4, opts)
         if err != nil {
                 return nil, err
         }
@@ -203,6 +855,7 @@ func downloadReadySubnets(urlV4 string) ([]netip.Prefix, error) {
 
                 if prefix.Addr().Is4() {
                         v4Set.AddPrefix(prefix)
+                        noteOrigin(file, prefixOrigin{Prefix: prefix, Source: urlV4, Line: line})
                 }
         }
 
@@ -210,8 +863,8 @@ func downloadReadySubnets(urlV4 string) ([]netip.Prefix, error) {
         return v4IPSet.Prefixes(), nil
 }
 
-func downloadReadySplitSubnets(url string) ([]netip.Prefix, error) {
-        data, err := downloadURL(url)
+func downloadReadySplitSubnets(file, url string, opts SourceOptions) ([]netip.Prefix, error) {
+        data, err := downloadCached(url, opts)
         if err != nil {
                 return nil, err
         }
@@ -232,6 +885,7 @@ func downloadReadySplitSubnets(url string) ([]netip.Prefix, error) {
 
                 if prefix.Addr().Is4() {
                         v4Set.AddPrefix(prefix)
+                        noteOrigin(file, prefixOrigin{Prefix: prefix, Source: url, Line: line})
                 }
         }
 
@@ -244,20 +898,55 @@ func downloadReadySplitSubnets(url string) ([]netip.Prefix, error) {
 }
 
 func writeSubnetsToFile(prefixes []netip.Prefix, filename string) error {
-        file, err := os.Create(filename)
+        // Каталог может задать правило layout, а не createDirs
+        if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+                return err
+        }
+        file, err := createStaged(filename)
         if err != nil {
                 return err
         }
-        defer file.Close()
+        defer file.Abort()
 
+        var p *listProvenance
+        if config.Provenance.Comments {
+                p = provenance[strings.TrimSuffix(filepath.Base(filename), ".lst")]
+        }
         writer := bufio.NewWriter(file)
         for _, prefix := range prefixes {
-                _, err := writer.WriteString(prefix.String() + "\n")
+                line := prefix.String()
+                if p != nil {
+                        if comment := p.entryComment(prefix); comment != "" {
+                                line += " # " + comment
+                        }
+                }
+                _, err := writer.WriteString(line + "\n")
                 if err != nil {
                         return err
                 }
         }
-        return writer.Flush()
+        if err := writer.Flush(); err != nil {
+                return err
+        }
+        return file.Commit()
+}
+
+// writePrefixList пишет .lst и RouterOS-скрипты списка, с LegacyCopy - и
+// копию с заглавной буквы. Через неё же идёт перезапись после слияния
+// источников, чтобы все файлы списка были одной версии.
+func writePrefixList(list *generatedList) {
+        file := strings.TrimSuffix(list.Name, ".lst") + ".lst"
+        if err := writeSubnetsToFile(list.Prefixes, ipv4ListPath(file)); err != nil {
+                log.Printf("Error writing %s IPv4: %v", file, err)
+        }
+        if err := generateRouterOSConfig(list.ListName, list.Comment, list.Prefixes, layoutDir("routeros", file, config.RouterOSDir)); err != nil {
+                log.Printf("Error generating RouterOS config for %s: %v", list.ListName, err)
+        }
+        if list.LegacyCopy {
+                if err := copyFileLegacy(ipv4ListPath(file)); err != nil {
+                        log.Printf("Error creating legacy copy for %s IPv4: %v", file, err)
+                }
+        }
 }
 
 func copyFileLegacy(srcFilename string) error {
@@ -270,14 +959,16 @@ func copyFileLegacy(srcFilename string) error {
         }
         defer srcFile.Close()
 
-        destFile, err := os.Create(destFilename)
+        destFile, err := createStaged(destFilename)
         if err != nil {
                 return err
         }
-        defer destFile.Close()
+        defer destFile.Abort()
 
-        _, err = io.Copy(destFile, srcFile)
-        return err
+        if _, err := io.Copy(destFile, srcFile); err != nil {
+                return err
+        }
+        return destFile.Commit()
 }
 
 func generateRouterOSVersionedConfig(listName, comment string, prefixes []netip.Prefix, outputDir, version string) error {
@@ -289,41 +980,92 @@ func generateRouterOSVersionedConfig(listName, comment string, prefixes []netip.
         // Формируем имя файла
         filename := filepath.Join(outputDir, listName+".rsc")
 
-        file, err := os.Create(filename)
+        file, err := createStaged(filename)
         if err != nil {
                 return err
         }
-        defer file.Close()
+        defer file.Abort()
 
         writer := bufio.NewWriter(file)
+        if err := writeRouterOSScript(writer, listName, comment, prefixes, version); err != nil {
+                return err
+        }
+        if err := writer.Flush(); err != nil {
+                return err
+        }
+        return file.Commit()
+}
 
+// writeRouterOSScript пишет скрипт address-list с mangle и маршрутом в синтаксисе v6 или v7.
+// IPv6-префиксы идут в /ipv6 firewall address-list; маршрут для них пишется
+// только в v7 (в RouterOS 6 нет policy routing для IPv6) и при заданном gateway_v6.
+func writeRouterOSScript(writer *bufio.Writer, listName, comment string, prefixes []netip.Prefix, version string) error {
         // Определяем путь в зависимости от версии RouterOS
-        var path string
-        if version == "v6" {
-                path = "/ip firewall address-list"
+        var path, pathV6 string
+        if version == "v6" || config.RouterOSListOnly {
+                // Синтаксис v6 понимают обе версии, поэтому в list-only скрипты совпадают
+                path, pathV6 = "/ip firewall address-list", "/ipv6 firewall address-list"
         } else { // v7
-                path = "/ip/firewall/address-list"
+                path, pathV6 = "/ip/firewall/address-list", "/ipv6/firewall/address-list"
         }
 
         // Записываем команды для каждой подсети
+        var hasV4, hasV6 bool
         for _, prefix := range prefixes {
+                listPath := path
+                if prefix.Addr().Is4() {
+                        hasV4 = true
+                } else {
+                        hasV6 = true
+                        listPath = pathV6
+                }
                 cmd := fmt.Sprintf("do {%s add address=%s comment=%s list=%s } on-error={}\n",
-                        path, prefix.String(), comment, listName)
+                        listPath, prefix.String(), routerOSQuote(comment), routerOSQuote(listName))
                 _, err := writer.WriteString(cmd)
                 if err != nil {
                         return err
                 }
         }
+        return writeRouterOSRouting(writer, listName, version, hasV4, hasV6)
+}
+
+// writeRouterOSRouting правила mangle и маршруты списка без самих адресов
+func writeRouterOSRouting(writer *bufio.Writer, listName, version string, hasV4, hasV6 bool) error {
+        if config.RouterOSListOnly {
+                return nil
+        }
+        gateway, gatewayV6 := routeGateways(listName)
 
         // Добавляем правила mangle и route
-        manglePath := "/ip firewall mangle"
-        routePath := "/ip route"
-        if version == "v7" {
-                manglePath = "/ip/firewall/mangle"
-                routePath = "/ip/route"
+        if hasV4 {
+                manglePath := "/ip firewall mangle"
+                routePath := "/ip route"
+                if version == "v7" {
+                        manglePath = "/ip/firewall/mangle"
+                        routePath = "/ip/route"
+                }
+                script := routerOSRouteScript(manglePath, routePath, listName, gateway)
+                if version == "v7" && config.RouterOSRouting == "table" {
+                        script = routerOSTableScript("ip", listName, gateway)
+                }
+                if _, err := writer.WriteString(script); err != nil {
+                        return err
+                }
         }
+        if hasV6 && version == "v7" && gatewayV6 != "" {
+                script := routerOSRouteScript("/ipv6/firewall/mangle", "/ipv6/route", listName, gatewayV6)
+                if config.RouterOSRouting == "table" {
+                        script = routerOSTableScript("ipv6", listName, gatewayV6)
+                }
+                if _, err := writer.WriteString(script); err != nil {
+                        return err
+                }
+        }
+        return nil
+}
 
-        script := fmt.Sprintf(`
+func routerOSRouteScript(manglePath, routePath, listName, gateway string) string {
+        return fmt.Sprintf(`
 {
    :local rrule [ %[1]s find dst-address-list="%[2]s" ]
    :if ([:len $rrule ] = 0 ) do={
@@ -337,16 +1079,11 @@ func generateRouterOSVersionedConfig(listName, comment string, prefixes []netip.
 `, manglePath,
    listName,
    routePath,
-   config.Gateway,)
-
-        _, err = writer.WriteString(script)
-        if err != nil {
-                return err
-        }
-        return writer.Flush()
+   gateway,)
 }
 
 func generateRouterOSConfig(listName, comment string, v4Prefixes []netip.Prefix, outputDir string) error {
+        v4Prefixes = aggregateForFormat("routeros", v4Prefixes)
         // Генерируем конфиги для разных версий RouterOS
         if config.GenerateV6 {
                 v6Dir := filepath.Join(outputDir, "v6")
@@ -360,9 +1097,21 @@ func generateRouterOSConfig(listName, comment string, v4Prefixes []netip.Prefix,
         if config.GenerateV7 {
                 v7Dir := filepath.Join(outputDir, "v7")
                 if len(v4Prefixes) > 0 {
+                        v7File := filepath.Join(v7Dir, listName+".rsc")
+                        if config.RouterOSLink != "" {
+                                if err := unlinkRouterOSScript(v7File); err != nil {
+                                        return err
+                                }
+                        }
                         if err := generateRouterOSVersionedConfig(listName, comment, v4Prefixes, v7Dir, "v7"); err != nil {
                                 return err
                         }
+                        if config.RouterOSLink != "" && config.GenerateV6 {
+                                v6File := filepath.Join(outputDir, "v6", listName+".rsc")
+                                if err := linkIdenticalRouterOSScript(v6File, v7File); err != nil {
+                                        return err
+                                }
+                        }
                 }
         }
 
@@ -370,132 +1119,372 @@ func generateRouterOSConfig(listName, comment string, v4Prefixes []netip.Prefix,
 }
 
 func main() {
+        if len(os.Args) > 1 {
+                switch os.Args[1] {
+                case "init":
+                        initCommand(os.Args[2:])
+                        return
+                case "presets":
+                        presetsCommand(os.Args[2:])
+                        return
+                case "serve":
+                        serveCommand(os.Args[2:])
+                        return
+                case "push":
+                        pushCommand(os.Args[2:])
+                        return
+                case "push-queue":
+                        pushQueueCommand(os.Args[2:])
+                        return
+                case "import-from-router":
+                        importFromRouterCommand(os.Args[2:])
+                        return
+                case "state":
+                        stateCommand(os.Args[2:])
+                        return
+                case "why":
+                        whyCommand(os.Args[2:])
+                        return
+                case "audit":
+                        auditCommand(os.Args[2:])
+                        return
+                case "gen-fixture":
+                        genFixtureCommand(os.Args[2:])
+                        return
+                }
+        }
+
+        flag.BoolVar(&offlineMode, "offline", false, "use cached sources only, never download")
+        flag.BoolVar(&keepWorkdir, "keep-workdir", false, "keep the per-run work dir for debugging")
+        flag.BoolVar(&tuiMode, "tui", false, "show interactive progress instead of plain logs (terminal only)")
+        only := flag.String("only", "", "comma-separated sources or lists to process (bgp, filters, discord, telegram, cloudflare, aws, google, static, domains, list names)")
+        skip := flag.String("skip", "", "comma-separated sources or lists to skip")
+        role := flag.String("role", "", "override config role: all, fetch (write snapshot only) or render (from snapshot)")
+        release := flag.String("release", "", "comma-separated prefixes or lists to publish now, bypassing quarantine")
+        freeze := flag.String("freeze", "", "comma-separated lists to keep with their last published content")
+        pin := flag.String("pin", "", "comma-separated list=snapshot pairs: take these lists from the given snapshot")
+        apply := flag.String("apply", "", "comma-separated live targets on this host: nftables (atomic nft -f -), ipset (netlink swap)")
+        flag.Parse()
+        onlySources = parseSourceList(*only)
+        skipSources = parseSourceList(*skip)
+        for _, value := range strings.Split(*release, ",") {
+                if value = strings.TrimSpace(value); value != "" {
+                        releasedPrefixes = append(releasedPrefixes, value)
+                }
+        }
+
         // Загрузка конфигурации
-        if len(os.Args) < 2 {
-                log.Fatal("Usage: get_subnets <config-file>")
+        if flag.NArg() < 1 {
+                log.Fatal("Usage: get_subnets [--offline] [--keep-workdir] [--only list,...] [--skip list,...] [--role fetch|render] [--release prefix|list,...] [--freeze list,...] [--pin list=snapshot,...] [--apply nftables,ipset] [--tui] <config-file>\n       get_subnets init [--gateway ip] [--routeros v6|v7|both] [--presets list] [--force] [config-file]\n       get_subnets presets list | presets show <name>\n       get_subnets serve [--listen addr] [config-file]\n       get_subnets push [--target name] [--lists a,b] [config-file]\n       get_subnets push-queue [config-file]\n       get_subnets import-from-router (--rsc file | --address host | --target name) [--out dir] [config-file]\n       get_subnets state export [--out file] [config-file] | state import [--force] <archive> [config-file]\n       get_subnets why <list> <prefix|address> [config-file]\n       get_subnets audit [--lists a,b] [config-file]")
         }
 
-        if err := loadConfig(os.Args[1]); err != nil {
+        if err := loadConfig(flag.Arg(0)); err != nil {
                 log.Fatal("Error loading config:", err)
         }
+        switch *role {
+        case "":
+        case "all", "fetch", "render":
+                config.Role = *role
+        default:
+                log.Fatalf("unknown --role %q (all, fetch or render)", *role)
+        }
+        if err := applyFreezeFlags(*freeze, *pin); err != nil {
+                log.Fatal(err)
+        }
+        for target := range parseSourceList(*apply) {
+                switch target {
+                case "nftables":
+                        applyNFTables = true
+                case "ipset":
+                        applyIPSet = true
+                default:
+                        log.Fatalf("unknown --apply %q (nftables or ipset)", target)
+                }
+        }
+
+        if err := initWorkspace(); err != nil {
+                log.Fatal("Error creating work dir:", err)
+        }
+        defer cleanupWorkspace()
+        stopDeadline := startRunDeadline(nil)
+        defer stopDeadline()
+
+        if tuiMode && isTerminal(os.Stdout) {
+                runWithTUI(run)
+        } else {
+                run()
+                logListDiffs(generatedListDiffs())
+        }
+
+        reportStageFailures()
+        log.Println("Done!")
+}
+
+// run основной цикл: загрузка источников, сборка списков, вывод и отправка
+func run() {
+        snapshotPreviousLists()
+        defer saveQuarantine()
+        defer saveGrace()
+        defer saveProvenance()
+        loadCookieJar()
+        defer saveCookieJar()
 
         if err := createDirs(); err != nil {
-                log.Fatal(err)
+                fatal(err)
+        }
+
+        // Замороженные и закреплённые списки не собираются из источников
+        restoreHeldLists()
+
+        // Роль render: списки приходят готовыми с fetch-машины
+        if config.Role == "render" {
+                loadSnapshotLists()
+                renderAndPush()
+                return
         }
 
         // Download BGP table
-        subnets, err := downloadBGPTable()
-        if err != nil {
-                log.Fatal("Error downloading BGP table:", err)
+        var subnets []subnetAS
+        if bgpTableNeeded() {
+                reportProgress("bgp", "download", "")
+                var err error
+                subnets, err = downloadBGPTable()
+                bgpTableSources = []string{config.BGPToolsURL}
+                switch {
+                case err != nil && len(config.MRT.URLs) > 0:
+                        log.Printf("Error downloading BGP table: %v, using MRT dumps", err)
+                        subnets, err = loadMRTTable()
+                        if err != nil {
+                                fatal("Error loading MRT dumps:", err)
+                        }
+                        bgpTableSources = config.MRT.URLs
+                case err != nil:
+                        fatal("Error downloading BGP table:", err)
+                case config.MRT.Mode == "cross_check" && len(config.MRT.URLs) > 0:
+                        crossCheckMRT(subnets)
+                }
+                reportProgress("bgp", "done", fmt.Sprintf("%d routes", len(subnets)))
         }
 
+        // Пиринговые сети IXP для исключения из ASN-списков
+        initIXPExclusion()
+        detectAnycast(subnets)
+
+        // AS-SET раскрываются в ASN до сборки списков
+        runStage("irr", "expand", expandASSets)
+
         // Process predefined AS numbers
         for as, asConfig := range config.ASNumbers {
-                v4Merged, err := processSubnets(subnets, as)
-                if err != nil {
-                        log.Printf("Error processing subnets for AS %s: %v", as, err)
+                if !asListSelected(as, asConfig) {
                         continue
                 }
-
-                listName := asConfig.ListName
-                if listName == "" {
-                        listName = strings.TrimSuffix(asConfig.File, ".lst")
-                }
-                comment := asConfig.Comment
-                if comment == "" {
-                        comment = as
-                }
-
-                // Записываем подсети в файлы
-                if err := writeSubnetsToFile(v4Merged, filepath.Join(config.IPv4Dir, asConfig.File)); err != nil {
-                        log.Printf("Error writing %s IPv4: %v", asConfig.File, err)
-                }
-
-                // Создаем файлы const.rsc для MikroTik
-                if err := generateRouterOSConfig(listName, comment, v4Merged, config.RouterOSDir); err != nil {
-                        log.Printf("Error generating RouterOS config for %s: %v", listName, err)
+                // Замыкание может выполниться повторно после цикла
+                as, asConfig := as, asConfig
+                asns := listASNs(as, asConfig)
+                labels := make([]string, len(asns))
+                for i, n := range asns {
+                        labels[i] = "AS" + n
                 }
+                runListStage(strings.TrimSuffix(asConfig.File, ".lst"), "aggregate", func() error {
+                        reportProgress(strings.TrimSuffix(asConfig.File, ".lst"), "aggregate", strings.Join(labels, ","))
+                        for _, set := range listASSets(as, asConfig) {
+                                if _, ok := asSetASNs[set]; !ok {
+                                        // Список из нераскрытого AS-SET вышел бы пустым или неполным
+                                        log.Printf("Error processing subnets for AS %s: AS-SET %s is not expanded", as, set)
+                                        reportProgress(strings.TrimSuffix(asConfig.File, ".lst"), "failed", "AS-SET "+set+" is not expanded")
+                                        return fmt.Errorf("AS-SET %s is not expanded", set)
+                                }
+                        }
+                        announced, sources := subnets, bgpTableSources
+                        if asConfig.Source == asSourceRIPEstat || asConfig.Source == asSourceBGPToolsAPI {
+                                var err error
+                                if asConfig.Source == asSourceRIPEstat {
+                                        announced, sources, err = ripestatSubnets(asns)
+                                } else {
+                                        announced, sources, err = bgptoolsAPISubnets(asns, asConfig.MaxOrigins > 0)
+                                }
+                                if err != nil {
+                                        log.Printf("Error downloading announcements for AS %s: %v", as, err)
+                                        reportProgress(strings.TrimSuffix(asConfig.File, ".lst"), "failed", err.Error())
+                                        return err
+                                }
+                        }
+                        // Правила провенанса - после загрузки: при повторе списка они не задваиваются
+                        for _, set := range listASSets(as, asConfig) {
+                                noteRule(asConfig.File, fmt.Sprintf("as-set %s (%d ASNs)", set, len(asSetASNs[set])), "include", nil)
+                        }
+                        v4Merged, err := processSubnets(announced, asns)
+                        if err == nil && (asConfig.PrefixMode != "" || asConfig.MaxOrigins > 0) {
+                                all := v4Merged
+                                v4Merged, err = selectASPrefixes(announced, asns, asConfig.PrefixMode, asConfig.MaxOrigins)
+                                noteChange(asConfig.File, fmt.Sprintf("prefix_mode %q, max_origins %d", asConfig.PrefixMode, asConfig.MaxOrigins), all, v4Merged)
+                        }
+                        if err != nil {
+                                log.Printf("Error processing subnets for AS %s: %v", as, err)
+                                reportProgress(strings.TrimSuffix(asConfig.File, ".lst"), "failed", err.Error())
+                                return err
+                        }
+                        noteASNOrigins(asConfig.File, announced, asns)
+                        before := v4Merged
+                        v4Merged = excludeIXP(v4Merged)
+                        noteChange(asConfig.File, "ixp peering LANs", before, v4Merged)
+                        before = v4Merged
+                        v4Merged = applyAnycastPolicy(asConfig.File, asConfig.Anycast, v4Merged, subnets, asns)
+                        noteChange(asConfig.File, "anycast "+asConfig.Anycast, before, v4Merged)
+                        v4Merged = stabilizePrefixes(asConfig.File, v4Merged)
+
+                        listName := asConfig.ListName
+                        if listName == "" {
+                                listName = strings.TrimSuffix(asConfig.File, ".lst")
+                        }
+                        comment := asConfig.Comment
+                        if comment == "" {
+                                comment = as
+                        }
 
-                if err := copyFileLegacy(filepath.Join(config.IPv4Dir, asConfig.File)); err != nil {
-                        log.Printf("Error creating legacy copy for %s IPv4: %v", asConfig.File, err)
-                }
+                        // .lst, const.rsc для MikroTik и копия с заглавной буквы
+                        list := generatedList{Name: asConfig.File, ListName: listName, Comment: comment, Prefixes: v4Merged,
+                                Sources: sources, ASNs: labels, Tags: asConfig.Tags, Trust: asConfig.Trust, LegacyCopy: true}
+                        writePrefixList(&list)
+                        addGeneratedList(list)
+                        return nil
+                })
         }
 
-        // Process Discord
-        v4Discord, err := downloadReadySubnets(config.Discord.VoiceV4)
-        if err != nil {
-                log.Printf("Error downloading Discord subnets: %v", err)
-        } else {
-                filename := config.Discord.File
-                if filename == "" {
-                        filename = "discord.lst"
-                }
-                listName := config.Discord.ListName
-                if listName == "" {
-                        listName = strings.TrimSuffix(filename, ".lst")
-                }
+        // Списки из сочетания ASN и стран
+        processFilteredLists(subnets)
 
-                if err := writeSubnetsToFile(v4Discord, filepath.Join(config.IPv4Dir, filename)); err != nil {
-                        log.Printf("Error writing Discord IPv4: %v", err)
-                }
+        // Process Discord
+        if config.Discord.VoiceV4 != "" && sourceSelected("discord", config.Discord.File, config.Discord.ListName) {
+                runListStage("discord", "download", func() error {
+                        reportProgress("discord", "download", "")
+                        filename := config.Discord.File
+                        if filename == "" {
+                                filename = "discord.lst"
+                        }
+                        listName := config.Discord.ListName
+                        if listName == "" {
+                                listName = strings.TrimSuffix(filename, ".lst")
+                        }
 
-                // Создаем файлы const.rsc для Discord
-                if err := generateRouterOSConfig(listName, "DISCORD", v4Discord, config.RouterOSDir); err != nil {
-                        log.Printf("Error generating RouterOS config for Discord: %v", err)
-                }
+                        v4Discord, err := downloadReadySubnets(filename, config.Discord.VoiceV4, config.Discord.SourceOptions)
+                        if err != nil {
+                                log.Printf("Error downloading Discord subnets: %v", err)
+                                reportProgress("discord", "failed", err.Error())
+                                return err
+                        }
 
-                if err := copyFileLegacy(filepath.Join(config.IPv4Dir, filename)); err != nil {
-                        log.Printf("Error creating legacy copy for Discord IPv4: %v", err)
-                }
+                        v4Discord = stabilizePrefixes(filename, v4Discord)
+                        list := generatedList{Name: filename, ListName: listName, Comment: "DISCORD", Prefixes: v4Discord, Sources: []string{config.Discord.VoiceV4}, Tags: config.Discord.Tags, Trust: config.Discord.Trust, LegacyCopy: true}
+                        writePrefixList(&list)
+                        addGeneratedList(list)
+                        return nil
+                })
         }
 
         // Process Telegram
-        v4Telegram, err := downloadReadySplitSubnets(config.Telegram.CIDRURL)
-        if err != nil {
-                log.Printf("Error downloading Telegram subnets: %v", err)
-        } else {
-                filename := config.Telegram.File
-                if filename == "" {
-                        filename = "telegram.lst"
-                }
-                listName := config.Telegram.ListName
-                if listName == "" {
-                        listName = strings.TrimSuffix(filename, ".lst")
-                }
+        if config.Telegram.CIDRURL != "" && sourceSelected("telegram", config.Telegram.File, config.Telegram.ListName) {
+                runListStage("telegram", "download", func() error {
+                        reportProgress("telegram", "download", "")
+                        filename := config.Telegram.File
+                        if filename == "" {
+                                filename = "telegram.lst"
+                        }
+                        listName := config.Telegram.ListName
+                        if listName == "" {
+                                listName = strings.TrimSuffix(filename, ".lst")
+                        }
 
-                if err := writeSubnetsToFile(v4Telegram, filepath.Join(config.IPv4Dir, filename)); err != nil {
-                        log.Printf("Error writing Telegram IPv4: %v", err)
-                }
+                        v4Telegram, err := downloadReadySplitSubnets(filename, config.Telegram.CIDRURL, config.Telegram.SourceOptions)
+                        if err != nil {
+                                log.Printf("Error downloading Telegram subnets: %v", err)
+                                reportProgress("telegram", "failed", err.Error())
+                                return err
+                        }
 
-                // Создаем файлы const.rsc для Telegram
-                if err := generateRouterOSConfig(listName, "TELEGRAM", v4Telegram, config.RouterOSDir); err != nil {
-                        log.Printf("Error generating RouterOS config for Telegram: %v", err)
-                }
+                        v4Telegram = stabilizePrefixes(filename, v4Telegram)
+                        if err := writeSubnetsToFile(v4Telegram, ipv4ListPath(filename)); err != nil {
+                                log.Printf("Error writing Telegram IPv4: %v", err)
+                        }
+
+                        // Создаем файлы const.rsc для Telegram
+                        if err := generateRouterOSConfig(listName, "TELEGRAM", v4Telegram, layoutDir("routeros", filename, config.RouterOSDir)); err != nil {
+                                log.Printf("Error generating RouterOS config for Telegram: %v", err)
+                        }
+
+                        addGeneratedList(generatedList{Name: filename, ListName: listName, Comment: "TELEGRAM", Prefixes: v4Telegram, Sources: []string{config.Telegram.CIDRURL}, Tags: config.Telegram.Tags, Trust: config.Telegram.Trust})
+                        return nil
+                })
         }
 
         // Process Cloudflare
-        v4Cloudflare, err := downloadReadySubnets(config.Cloudflare.V4)
-        if err != nil {
-                log.Printf("Error downloading Cloudflare subnets: %v", err)
-        } else {
-                filename := config.Cloudflare.File
-                if filename == "" {
-                        filename = "cloudflare.lst"
-                }
-                listName := config.Cloudflare.ListName
-                if listName == "" {
-                        listName = strings.TrimSuffix(filename, ".lst")
-                }
+        if config.Cloudflare.V4 != "" && sourceSelected("cloudflare", config.Cloudflare.File, config.Cloudflare.ListName) {
+                runListStage("cloudflare", "download", func() error {
+                        reportProgress("cloudflare", "download", "")
+                        filename := config.Cloudflare.File
+                        if filename == "" {
+                                filename = "cloudflare.lst"
+                        }
+                        listName := config.Cloudflare.ListName
+                        if listName == "" {
+                                listName = strings.TrimSuffix(filename, ".lst")
+                        }
 
-                if err := writeSubnetsToFile(v4Cloudflare, filepath.Join(config.IPv4Dir, filename)); err != nil {
-                        log.Printf("Error writing Cloudflare IPv4: %v", err)
-                }
+                        v4Cloudflare, err := downloadReadySubnets(filename, config.Cloudflare.V4, config.Cloudflare.SourceOptions)
+                        if err != nil {
+                                log.Printf("Error downloading Cloudflare subnets: %v", err)
+                                reportProgress("cloudflare", "failed", err.Error())
+                                return err
+                        }
+
+                        v4Cloudflare = stabilizePrefixes(filename, v4Cloudflare)
+                        if err := writeSubnetsToFile(v4Cloudflare, ipv4ListPath(filename)); err != nil {
+                                log.Printf("Error writing Cloudflare IPv4: %v", err)
+                        }
+
+                        // Создаем файлы const.rsc для Cloudflare
+                        if err := generateRouterOSConfig(listName, "CLOUDFLARE", v4Cloudflare, layoutDir("routeros", filename, config.RouterOSDir)); err != nil {
+                                log.Printf("Error generating RouterOS config for Cloudflare: %v", err)
+                        }
+
+                        addGeneratedList(generatedList{Name: filename, ListName: listName, Comment: "CLOUDFLARE", Prefixes: v4Cloudflare, Sources: []string{config.Cloudflare.V4}, Tags: config.Cloudflare.Tags, Trust: config.Cloudflare.Trust})
+                        return nil
+                })
+        }
+
+        // AWS ip-ranges.json и диапазоны Google
+        processAWS()
+        processGoogle()
+
+        // Статические списки префиксов
+        processStaticLists()
+
+        // Process domain lists
+        processDomainLists()
+
+        // Ещё одна попытка для списков, упавших на временных ошибках источников
+        retryFailedLists()
 
-                // Создаем файлы const.rsc для Cloudflare
-                if err := generateRouterOSConfig(listName, "CLOUDFLARE", v4Cloudflare, config.RouterOSDir); err != nil {
-                        log.Printf("Error generating RouterOS config for Cloudflare: %v", err)
+        // Списки по выражениям над тегами готовых списков
+        processTaggedLists()
+
+        // Роль fetch: форматы и отправку делают машины с role render
+        if config.Role == "fetch" {
+                if err := writeSnapshot(generatedLists); err != nil {
+                        fatal("Error writing snapshot: ", err)
                 }
+                return
         }
+        renderAndPush()
+}
 
-        log.Println("Done!")
+func renderAndPush() {
+        // Сколько всего адресного пространства уходит в туннель
+        reportRoutedSpace(generatedLists)
+
+        // Форматы вывода для всех собранных списков
+        renderOutputs()
+
+        // Отправка на устройства
+        pushOutputs()
 }
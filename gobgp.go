@@ -0,0 +1,260 @@
+package main
+
+import (
+        "encoding/json"
+        "errors"
+        "fmt"
+        "log"
+        "net"
+        "os"
+        "os/exec"
+        "path/filepath"
+        "sort"
+        "strings"
+        "sync"
+)
+
+// GoBGPConfig анонс префиксов списков в локальный gobgpd через команду gobgp:
+// роутеры получают списки по BGP вместо импорта скриптов. Между запусками
+// меняется только разница с тем, что уже анонсировано.
+type GoBGPConfig struct {
+        Enabled   bool                       `yaml:"enabled"`
+        Command   string                     `yaml:"command"`     // По умолчанию gobgp из PATH
+        API       string                     `yaml:"api"`         // host:port gRPC gobgpd, по умолчанию его 127.0.0.1:50051
+        NextHop   string                     `yaml:"next_hop"`    // По умолчанию общий gateway
+        NextHopV6 string                     `yaml:"next_hop_v6"` // Без него IPv6 не анонсируется
+        Community string                     `yaml:"community"`   // Например 65000:100; несколько через запятую
+        Lists     map[string]GoBGPListConfig `yaml:"lists"`       // Настройки отдельных списков по имени
+        State     string                     `yaml:"state"`       // По умолчанию gobgp.json в каталоге кэша
+        Parallel  int                        `yaml:"parallel"`    // Одновременных вызовов gobgp, по умолчанию 8
+}
+
+type GoBGPListConfig struct {
+        NextHop   string `yaml:"next_hop"`
+        NextHopV6 string `yaml:"next_hop_v6"`
+        Community string `yaml:"community"`
+        Disabled  bool   `yaml:"disabled"` // Не анонсировать этот список
+}
+
+// gobgpRoute анонсированный префикс и его атрибуты
+type gobgpRoute struct {
+        List      string `json:"list"`
+        NextHop   string `json:"next_hop"`
+        Community string `json:"community,omitempty"`
+}
+
+func gobgpStatePath() string {
+        if config.GoBGP.State != "" {
+                return config.GoBGP.State
+        }
+        return filepath.Join(config.Cache.Dir, "gobgp.json")
+}
+
+func gobgpListConfig(list *generatedList) GoBGPListConfig {
+        settings, ok := config.GoBGP.Lists[list.Name]
+        if !ok {
+                settings = config.GoBGP.Lists[list.ListName]
+        }
+        if settings.NextHop == "" {
+                settings.NextHop = config.GoBGP.NextHop
+        }
+        if settings.NextHopV6 == "" {
+                settings.NextHopV6 = config.GoBGP.NextHopV6
+        }
+        if settings.Community == "" {
+                settings.Community = config.GoBGP.Community
+        }
+        return settings
+}
+
+// gobgp выполняет команду gobgp с адресом API
+func gobgp(args ...string) ([]byte, error) {
+        if config.GoBGP.API != "" {
+                host, port, err := net.SplitHostPort(config.GoBGP.API)
+                if err != nil {
+                        return nil, fmt.Errorf("gobgp.api: %w", err)
+                }
+                args = append([]string{"-u", host, "-p", port}, args...)
+        }
+        cmd := exec.CommandContext(runCtx, config.GoBGP.Command, args...)
+        out, err := cmd.Output()
+        if err != nil {
+                var exitErr *exec.ExitError
+                if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+                        return nil, fmt.Errorf("gobgp %s: %s", strings.Join(args, " "), strings.TrimSpace(string(exitErr.Stderr)))
+                }
+                return nil, fmt.Errorf("gobgp %s: %w", strings.Join(args, " "), err)
+        }
+        return out, nil
+}
+
+// gobgpRIB префиксы, которые сейчас есть в глобальном RIB: после перезапуска
+// gobgpd он пуст, и всё из состояния нужно анонсировать заново
+func gobgpRIB(family string) (map[string]bool, error) {
+        out, err := gobgp("global", "rib", "-a", family, "-j")
+        if err != nil {
+                return nil, err
+        }
+        var rib map[string]json.RawMessage
+        if err := json.Unmarshal(out, &rib); err != nil {
+                return nil, fmt.Errorf("parsing gobgp rib: %w", err)
+        }
+        present := make(map[string]bool, len(rib))
+        for prefix := range rib {
+                present[prefix] = true
+        }
+        return present, nil
+}
+
+func gobgpFamily(prefix string) string {
+        if strings.Contains(prefix, ":") {
+                return "ipv6"
+        }
+        return "ipv4"
+}
+
+// announceGoBGP приводит анонсы gobgpd к собранным спискам
+func announceGoBGP(lists []*generatedList) error {
+        lists = listsForFormat("gobgp", lists)
+        announced := make(map[string]gobgpRoute)
+        if data, err := os.ReadFile(gobgpStatePath()); err == nil {
+                if err := json.Unmarshal(data, &announced); err != nil {
+                        log.Printf("Error reading %s: %v", gobgpStatePath(), err)
+                }
+        }
+
+        desired := make(map[string]gobgpRoute)
+        processed := make(map[string]bool)
+        for _, list := range lists {
+                processed[list.Name] = true
+                settings := gobgpListConfig(list)
+                if settings.Disabled {
+                        continue
+                }
+                for _, prefix := range list.Prefixes {
+                        route := gobgpRoute{List: list.Name, NextHop: settings.NextHop, Community: settings.Community}
+                        if !prefix.Addr().Is4() {
+                                route.NextHop = settings.NextHopV6
+                        }
+                        if route.NextHop == "" {
+                                continue
+                        }
+                        key := prefix.Masked().String()
+                        if existing, ok := desired[key]; ok && existing.List != list.Name {
+                                log.Printf("gobgp: %s is in %s and %s, announcing it for %s", key, existing.List, list.Name, existing.List)
+                                continue
+                        }
+                        desired[key] = route
+                }
+        }
+
+        // Неизвестные теперь списки снимаются только в полном запуске без ошибок
+        known := configuredListMeta()
+        for name := range config.Tagged {
+                known[name] = listMeta{}
+        }
+        withdrawUnknown := !partialRun() && len(stageFailures) == 0
+
+        ribs := make(map[string]map[string]bool)
+        for _, family := range []string{"ipv4", "ipv6"} {
+                rib, err := gobgpRIB(family)
+                if err != nil {
+                        return err
+                }
+                ribs[family] = rib
+        }
+
+        type change struct {
+                prefix string
+                route  gobgpRoute
+                add    bool
+        }
+        var changes []change
+        for prefix, route := range desired {
+                if old, ok := announced[prefix]; ok && old == route && ribs[gobgpFamily(prefix)][prefix] {
+                        continue
+                }
+                changes = append(changes, change{prefix, route, true})
+        }
+        for prefix, route := range announced {
+                if _, ok := desired[prefix]; ok {
+                        continue
+                }
+                _, configured := known[route.List]
+                if !processed[route.List] && (configured || !withdrawUnknown) {
+                        // Список не собирался в этом запуске: оставляем как есть
+                        desired[prefix] = route
+                        continue
+                }
+                changes = append(changes, change{prefix, route, false})
+        }
+        sort.Slice(changes, func(i, j int) bool { return changes[i].prefix < changes[j].prefix })
+
+        parallel := config.GoBGP.Parallel
+        if parallel <= 0 {
+                parallel = 8
+        }
+        errs := make([]error, len(changes))
+        sem := make(chan struct{}, parallel)
+        var wg sync.WaitGroup
+        for i, c := range changes {
+                wg.Add(1)
+                sem <- struct{}{}
+                go func(i int, c change) {
+                        defer wg.Done()
+                        defer func() { <-sem }()
+                        args := []string{"global", "rib", "-a", gobgpFamily(c.prefix)}
+                        if !c.add {
+                                _, errs[i] = gobgp(append(args, "del", c.prefix)...)
+                                return
+                        }
+                        args = append(args, "add", c.prefix, "nexthop", c.route.NextHop)
+                        if c.route.Community != "" {
+                                args = append(args, "community", c.route.Community)
+                        }
+                        _, errs[i] = gobgp(args...)
+                }(i, c)
+        }
+        wg.Wait()
+
+        // В состоянии остаётся то, что действительно анонсировано
+        var failed []error
+        var added, withdrawn int
+        for i, c := range changes {
+                switch {
+                case errs[i] != nil:
+                        failed = append(failed, errs[i])
+                        if old, ok := announced[c.prefix]; ok {
+                                desired[c.prefix] = old
+                        } else {
+                                delete(desired, c.prefix)
+                        }
+                case c.add:
+                        added++
+                default:
+                        withdrawn++
+                }
+        }
+        if added+withdrawn > 0 {
+                log.Printf("gobgp: announced %d, withdrawn %d, total %d", added, withdrawn, len(desired))
+        }
+
+        data, err := json.MarshalIndent(desired, "", "    ")
+        if err == nil {
+                if err = os.MkdirAll(filepath.Dir(gobgpStatePath()), 0755); err == nil {
+                        err = writeFileStaged(gobgpStatePath(), append(data, '\n'))
+                }
+        }
+        if err != nil {
+                log.Printf("Error writing %s: %v", gobgpStatePath(), err)
+        }
+
+        if len(failed) == 0 {
+                return nil
+        }
+        shown := failed
+        if len(shown) > 5 {
+                shown = shown[:5]
+        }
+        return fmt.Errorf("%d of %d gobgp updates failed: %w", len(failed), len(changes), errors.Join(shown...))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "log"
+        "net/netip"
+        "strings"
+
+        "go4.org/netipx"
+)
+
+// GoogleConfig список из опубликованных диапазонов Google: goog.json - все сети
+// Google, cloud.json - Google Cloud с scope (регион). goog.json минус cloud.json -
+// адреса сервисов Google без клиентских ВМ.
+type GoogleConfig struct {
+        URLs          []string `yaml:"urls"`    // https://www.gstatic.com/ipranges/goog.json и/или cloud.json
+        Scopes        []string `yaml:"scopes"`  // Например europe-west3, europe-*; пусто - все. Записи без scope (goog.json) проходят всегда
+        Exclude       []string `yaml:"exclude"` // Диапазоны этих файлов вычитаются, например cloud.json из goog.json
+        File          string   `yaml:"file"`
+        ListName      string   `yaml:"list_name"`
+        Tags          []string `yaml:"tags"`
+        SourceOptions `yaml:",inline"`
+}
+
+type googleIPRanges struct {
+        Prefixes []struct {
+                IPv4Prefix string `json:"ipv4Prefix"`
+                Scope      string `json:"scope"`
+        } `json:"prefixes"`
+}
+
+func downloadGoogleRanges(url string) (*googleIPRanges, error) {
+        data, err := downloadCached(url, config.Google.SourceOptions)
+        if err != nil {
+                return nil, err
+        }
+        var ranges googleIPRanges
+        if err := json.Unmarshal([]byte(data), &ranges); err != nil {
+                return nil, fmt.Errorf("parsing %s: %w", url, err)
+        }
+        return &ranges, nil
+}
+
+// downloadGoogleSubnets IPv4-префиксы urls с фильтром scopes за вычетом exclude
+func downloadGoogleSubnets(file string) ([]netip.Prefix, error) {
+        var v4Set netipx.IPSetBuilder
+        for _, url := range config.Google.URLs {
+                ranges, err := downloadGoogleRanges(url)
+                if err != nil {
+                        return nil, err
+                }
+                for _, item := range ranges.Prefixes {
+                        if item.IPv4Prefix == "" || item.Scope != "" && !rangeMatches(config.Google.Scopes, item.Scope) {
+                                continue
+                        }
+                        prefix, err := netip.ParsePrefix(item.IPv4Prefix)
+                        if err != nil {
+                                log.Printf("Invalid subnet: %s", item.IPv4Prefix)
+                                continue
+                        }
+                        v4Set.AddPrefix(prefix)
+                        noteOrigin(file, prefixOrigin{Prefix: prefix, Source: url, Line: strings.TrimSpace(item.IPv4Prefix + " " + item.Scope)})
+                }
+        }
+        for _, url := range config.Google.Exclude {
+                ranges, err := downloadGoogleRanges(url)
+                if err != nil {
+                        return nil, err
+                }
+                before, _ := v4Set.IPSet()
+                for _, item := range ranges.Prefixes {
+                        if prefix, err := netip.ParsePrefix(item.IPv4Prefix); err == nil {
+                                v4Set.RemovePrefix(prefix)
+                        }
+                }
+                after, _ := v4Set.IPSet()
+                noteChange(file, "exclude "+url, before.Prefixes(), after.Prefixes())
+        }
+
+        v4IPSet, _ := v4Set.IPSet()
+        if len(v4IPSet.Prefixes()) == 0 {
+                return nil, fmt.Errorf("no prefixes match scopes %v", config.Google.Scopes)
+        }
+        return v4IPSet.Prefixes(), nil
+}
+
+func processGoogle() {
+        if len(config.Google.URLs) == 0 || !sourceSelected("google", config.Google.File, config.Google.ListName) {
+                return
+        }
+        runListStage("google", "download", func() error {
+                reportProgress("google", "download", "")
+                filename := config.Google.File
+                if filename == "" {
+                        filename = "google.lst"
+                }
+                listName := config.Google.ListName
+                if listName == "" {
+                        listName = strings.TrimSuffix(filename, ".lst")
+                }
+
+                v4Google, err := downloadGoogleSubnets(filename)
+                if err != nil {
+                        log.Printf("Error downloading Google subnets: %v", err)
+                        reportProgress("google", "failed", err.Error())
+                        return err
+                }
+
+                v4Google = stabilizePrefixes(filename, v4Google)
+                if err := writeSubnetsToFile(v4Google, ipv4ListPath(filename)); err != nil {
+                        log.Printf("Error writing Google IPv4: %v", err)
+                }
+                if err := generateRouterOSConfig(listName, "GOOGLE", v4Google, layoutDir("routeros", filename, config.RouterOSDir)); err != nil {
+                        log.Printf("Error generating RouterOS config for Google: %v", err)
+                }
+
+                sources := append(append([]string{}, config.Google.URLs...), config.Google.Exclude...)
+                addGeneratedList(generatedList{Name: filename, ListName: listName, Comment: "GOOGLE", Prefixes: v4Google, Sources: sources, Tags: config.Google.Tags, Trust: config.Google.Trust})
+                return nil
+        })
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+        "encoding/json"
+        "log"
+        "net/netip"
+        "os"
+        "path/filepath"
+        "sort"
+        "strings"
+        "time"
+
+        "go4.org/netipx"
+)
+
+// RemovalGraceConfig префикс, пропавший из источника, ещё period остаётся в
+// выводе: мигающий анонс не заставляет роутеры удалять и добавлять его каждый запуск
+type RemovalGraceConfig struct {
+        Period time.Duration `yaml:"period"` // 0 - выключено
+        File   string        `yaml:"file"`   // По умолчанию removal-grace.json в каталоге кэша
+        Lists  []string      `yaml:"lists"`  // Пусто - все списки
+}
+
+var (
+        // graceState когда префикс опубликованного списка впервые пропал из источника
+        graceState   map[string]map[netip.Prefix]time.Time
+        gracePresent map[string]map[netip.Prefix]bool // Префиксы, которые источники отдали в этом запуске
+)
+
+func gracePath() string {
+        if config.RemovalGrace.File != "" {
+                return config.RemovalGrace.File
+        }
+        return filepath.Join(config.Cache.Dir, "removal-grace.json")
+}
+
+func loadGrace() {
+        if graceState != nil {
+                return
+        }
+        graceState = make(map[string]map[netip.Prefix]time.Time)
+        gracePresent = make(map[string]map[netip.Prefix]bool)
+        data, err := os.ReadFile(gracePath())
+        if err != nil {
+                return
+        }
+        if err := json.Unmarshal(data, &graceState); err != nil {
+                log.Printf("Error reading %s: %v", gracePath(), err)
+        }
+}
+
+// saveGrace у обработанных в этом запуске списков забывает вернувшиеся префиксы
+// и те, что уже не опубликованы
+func saveGrace() {
+        if graceState == nil {
+                return
+        }
+        for name, entries := range graceState {
+                present, processed := gracePresent[name]
+                if !processed {
+                        continue
+                }
+                for prefix, since := range entries {
+                        if present[prefix] || time.Since(since) > config.RemovalGrace.Period {
+                                delete(entries, prefix)
+                        }
+                }
+                if len(entries) == 0 {
+                        delete(graceState, name)
+                }
+        }
+
+        var err error
+        if len(graceState) == 0 {
+                if err = os.Remove(gracePath()); os.IsNotExist(err) {
+                        err = nil
+                }
+        } else {
+                var data []byte
+                if data, err = json.MarshalIndent(graceState, "", "    "); err == nil {
+                        if err = os.MkdirAll(filepath.Dir(gracePath()), 0755); err == nil {
+                                err = writeFileStaged(gracePath(), append(data, '\n'))
+                        }
+                }
+        }
+        if err != nil {
+                log.Printf("Error writing %s: %v", gracePath(), err)
+        }
+}
+
+// gracePrefixes возвращает в список опубликованные префиксы, которых нет в
+// источнике меньше period. Префикс считается пропавшим, если новые префиксы
+// его не покрывают.
+func gracePrefixes(file string, prefixes []netip.Prefix) []netip.Prefix {
+        name := strings.TrimSuffix(file, ".lst")
+        if config.RemovalGrace.Period <= 0 || heldLists[strings.ToLower(name)] {
+                return prefixes
+        }
+        if len(config.RemovalGrace.Lists) > 0 && !listSelectedByName(config.RemovalGrace.Lists, &generatedList{Name: name}) {
+                return prefixes
+        }
+        previous, ok := previousLists[name]
+        if !ok {
+                return prefixes
+        }
+
+        loadGrace()
+        present := gracePresent[name]
+        if present == nil {
+                present = make(map[netip.Prefix]bool)
+                gracePresent[name] = present
+        }
+        entries := graceState[name]
+        if entries == nil {
+                entries = make(map[netip.Prefix]time.Time)
+                graceState[name] = entries
+        }
+
+        var builder netipx.IPSetBuilder
+        for _, prefix := range prefixes {
+                builder.AddPrefix(prefix.Masked())
+        }
+        set, err := builder.IPSet()
+        if err != nil {
+                log.Printf("Error building prefix set of %s: %v", name, err)
+                return prefixes
+        }
+
+        now := time.Now()
+        prefixes = prefixes[:len(prefixes):len(prefixes)] // append не должен менять массив вызывающего
+        var kept, dropped []string
+        for prefix := range previous {
+                if set.ContainsPrefix(prefix) {
+                        present[prefix] = true
+                        continue
+                }
+                since, ok := entries[prefix]
+                if !ok {
+                        since = now
+                        entries[prefix] = since
+                }
+                if now.Sub(since) > config.RemovalGrace.Period {
+                        dropped = append(dropped, prefix.String())
+                        continue
+                }
+                prefixes = append(prefixes, prefix)
+                kept = append(kept, prefix.String())
+        }
+
+        if len(kept) > 0 {
+                sort.Strings(kept)
+                sort.Slice(prefixes, func(i, j int) bool {
+                        if prefixes[i].Addr() != prefixes[j].Addr() {
+                                return prefixes[i].Addr().Less(prefixes[j].Addr())
+                        }
+                        return prefixes[i].Bits() < prefixes[j].Bits()
+                })
+                log.Printf("Removal grace %s: keeping %d vanished prefixes: %s", name, len(kept), strings.Join(shortList(kept), ", "))
+        }
+        if len(dropped) > 0 {
+                sort.Strings(dropped)
+                log.Printf("Removal grace %s: removing %d prefixes after %s: %s", name, len(dropped), config.RemovalGrace.Period, strings.Join(shortList(dropped), ", "))
+        }
+        return prefixes
+}
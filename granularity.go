@@ -0,0 +1,203 @@
+package main
+
+import (
+        "fmt"
+        "net/netip"
+        "sort"
+
+        "go4.org/netipx"
+)
+
+// Режимы гранулярности ASN-списка
+const (
+        prefixModeAggregate    = "aggregate"     // Объединение в минимальный набор (по умолчанию)
+        prefixModeCovering     = "covering"      // Анонсы как есть без более специфичных под покрывающим
+        prefixModeMostSpecific = "most_specific" // Только самые специфичные анонсы
+)
+
+// announcedPrefixes анонсы IPv4 заданных ASN без повторов с учётом max_origins.
+// Origin из самих targetASNs чужими не считаются.
+func announcedPrefixes(subnets []subnetAS, targetASNs []string, maxOrigins int) []netip.Prefix {
+        targets := make(map[string]bool, len(targetASNs))
+        for _, as := range targetASNs {
+                targets[normalizeASN(as)] = true
+        }
+        own := make(map[netip.Prefix]bool)
+        for _, item := range subnets {
+                if !targets[normalizeASN(item.as)] {
+                        continue
+                }
+                prefix, err := netip.ParsePrefix(item.subnet)
+                if err != nil || !prefix.Addr().Is4() {
+                        continue
+                }
+                own[prefix.Masked()] = true
+        }
+
+        if maxOrigins > 0 {
+                origins := make(map[netip.Prefix]map[string]bool, len(own))
+                for _, item := range subnets {
+                        prefix, err := netip.ParsePrefix(item.subnet)
+                        if err != nil || !own[prefix.Masked()] {
+                                continue
+                        }
+                        prefix = prefix.Masked()
+                        if origins[prefix] == nil {
+                                origins[prefix] = make(map[string]bool)
+                        }
+                        origin := normalizeASN(item.as)
+                        if targets[origin] {
+                                origin = "" // Все ASN списка - один origin
+                        }
+                        origins[prefix][origin] = true
+                }
+                for prefix, asns := range origins {
+                        if len(asns) > maxOrigins {
+                                delete(own, prefix)
+                        }
+                }
+        }
+
+        prefixes := make([]netip.Prefix, 0, len(own))
+        for prefix := range own {
+                prefixes = append(prefixes, prefix)
+        }
+        sort.Slice(prefixes, func(i, j int) bool {
+                if c := prefixes[i].Addr().Compare(prefixes[j].Addr()); c != 0 {
+                        return c < 0
+                }
+                return prefixes[i].Bits() < prefixes[j].Bits()
+        })
+        return prefixes
+}
+
+// selectASPrefixes строит ASN-список с учётом режима гранулярности и max_origins
+func selectASPrefixes(subnets []subnetAS, targetASNs []string, mode string, maxOrigins int) ([]netip.Prefix, error) {
+        prefixes := announcedPrefixes(subnets, targetASNs, maxOrigins)
+
+        switch mode {
+        case "", prefixModeAggregate:
+                var builder netipx.IPSetBuilder
+                for _, prefix := range prefixes {
+                        builder.AddPrefix(prefix)
+                }
+                set, err := builder.IPSet()
+                if err != nil {
+                        return nil, err
+                }
+                return set.Prefixes(), nil
+
+        case prefixModeCovering:
+                // После сортировки по адресу покрывающий префикс идёт раньше покрытых
+                var kept []netip.Prefix
+                for _, prefix := range prefixes {
+                        if n := len(kept); n > 0 && kept[n-1].Contains(prefix.Addr()) {
+                                continue
+                        }
+                        kept = append(kept, prefix)
+                }
+                return kept, nil
+
+        case prefixModeMostSpecific:
+                // Префикс не самый специфичный, если следующий за ним лежит внутри
+                var kept []netip.Prefix
+                for i, prefix := range prefixes {
+                        if i+1 < len(prefixes) && prefix.Contains(prefixes[i+1].Addr()) {
+                                continue
+                        }
+                        kept = append(kept, prefix)
+                }
+                return kept, nil
+
+        default:
+                return nil, fmt.Errorf("unknown prefix_mode %q", mode)
+        }
+}
+
+// AggregationConfig доводка префиксов под возможности одного формата вывода:
+// RouterOS удобнее короткий список не длиннее /24, nftables и BGP берут точные
+// префиксы. Применяется к уже собранному списку, .lst остаётся как есть.
+type AggregationConfig struct {
+        MaxPrefixLen   int  `yaml:"max_prefix_len"`    // IPv4 длиннее расширяются до этой длины
+        MaxPrefixLenV6 int  `yaml:"max_prefix_len_v6"` // То же для IPv6
+        Aggregate      bool `yaml:"aggregate"`         // Объединить в минимальный набор
+}
+
+func validateAggregation() error {
+        for format, agg := range config.Aggregation {
+                if agg.MaxPrefixLen < 0 || agg.MaxPrefixLen > 32 {
+                        return fmt.Errorf("aggregation.%s.max_prefix_len must be 0..32", format)
+                }
+                if agg.MaxPrefixLenV6 < 0 || agg.MaxPrefixLenV6 > 128 {
+                        return fmt.Errorf("aggregation.%s.max_prefix_len_v6 must be 0..128", format)
+                }
+        }
+        return nil
+}
+
+// aggregateForFormat префиксы списка для формата по настройкам aggregation
+func aggregateForFormat(format string, prefixes []netip.Prefix) []netip.Prefix {
+        agg, ok := config.Aggregation[format]
+        if !ok || len(prefixes) == 0 {
+                return prefixes
+        }
+
+        out := make([]netip.Prefix, 0, len(prefixes))
+        for _, prefix := range prefixes {
+                limit := agg.MaxPrefixLen
+                if !prefix.Addr().Is4() {
+                        limit = agg.MaxPrefixLenV6
+                }
+                if limit > 0 && prefix.Bits() > limit {
+                        prefix = netip.PrefixFrom(prefix.Addr(), limit)
+                }
+                out = append(out, prefix.Masked())
+        }
+
+        if agg.Aggregate {
+                var builder netipx.IPSetBuilder
+                for _, prefix := range out {
+                        builder.AddPrefix(prefix)
+                }
+                if set, err := builder.IPSet(); err == nil {
+                        return set.Prefixes()
+                }
+        }
+
+        // Расширенные префиксы могут совпасть или оказаться внутри других
+        sort.Slice(out, func(i, j int) bool {
+                if c := out[i].Addr().Compare(out[j].Addr()); c != 0 {
+                        return c < 0
+                }
+                return out[i].Bits() < out[j].Bits()
+        })
+        kept := out[:0]
+        for _, prefix := range out {
+                if n := len(kept); n > 0 && kept[n-1].Contains(prefix.Addr()) && kept[n-1].Bits() <= prefix.Bits() {
+                        continue
+                }
+                kept = append(kept, prefix)
+        }
+        return kept
+}
+
+// listForFormat список с префиксами для формата; без настроек - тот же список
+func listForFormat(format string, list *generatedList) *generatedList {
+        if _, ok := config.Aggregation[format]; !ok {
+                return list
+        }
+        formatted := *list
+        formatted.Prefixes = aggregateForFormat(format, list.Prefixes)
+        return &formatted
+}
+
+func listsForFormat(format string, lists []*generatedList) []*generatedList {
+        if _, ok := config.Aggregation[format]; !ok {
+                return lists
+        }
+        out := make([]*generatedList, len(lists))
+        for i, list := range lists {
+                out[i] = listForFormat(format, list)
+        }
+        return out
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+        "context"
+        "encoding/json"
+        "errors"
+        "fmt"
+        "log"
+        "net/http"
+        "net/http/cookiejar"
+        "net/url"
+        "os"
+        "os/exec"
+        "path/filepath"
+        "strings"
+        "sync"
+        "time"
+)
+
+// HTTPSourcesConfig загрузка источников за анти-бот защитой (Cloudflare и т.п.):
+// без cookie они отвечают 403, и список пропадает
+type HTTPSourcesConfig struct {
+        CookieJar bool                         `yaml:"cookie_jar"` // Запоминать cookie ответов, в том числе между запусками
+        Cookies   map[string]map[string]string `yaml:"cookies"`    // Хост (и поддомены) -> имя -> значение, например cf_clearance
+        Headless  HeadlessConfig               `yaml:"headless"`
+}
+
+// HeadlessConfig внешняя команда (headless-браузер, curl-impersonate...), которой
+// источник скачивается, когда обычный запрос упёрся в проверку
+type HeadlessConfig struct {
+        Command []string      `yaml:"command"` // {url} в аргументах заменяется адресом; тело ответа - stdout
+        Hosts   []string      `yaml:"hosts"`   // Только для этих хостов (и поддоменов); пусто - для всех
+        Status  []int         `yaml:"status"`  // Коды ответа для повтора командой, по умолчанию 403 и 503
+        Timeout time.Duration `yaml:"timeout"` // По умолчанию 2m
+}
+
+// cookieJar cookie источников этого запуска, сохраняются в cookies.json каталога кэша
+var cookieJar *persistentJar
+
+// persistentJar cookiejar, который помнит полученные cookie по хостам для сохранения
+type persistentJar struct {
+        *cookiejar.Jar
+        mu    sync.Mutex
+        hosts map[string][]*http.Cookie
+}
+
+func (j *persistentJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+        j.Jar.SetCookies(u, cookies)
+        j.mu.Lock()
+        defer j.mu.Unlock()
+        for _, cookie := range cookies {
+                saved := *cookie
+                if saved.MaxAge > 0 {
+                        saved.Expires = time.Now().Add(time.Duration(saved.MaxAge) * time.Second)
+                        saved.MaxAge = 0
+                }
+                list := j.hosts[u.Host]
+                for i := 0; i < len(list); i++ {
+                        if list[i].Name == saved.Name && list[i].Path == saved.Path {
+                                list = append(list[:i], list[i+1:]...)
+                                i--
+                        }
+                }
+                if saved.MaxAge == 0 && (saved.Expires.IsZero() || saved.Expires.After(time.Now())) {
+                        list = append(list, &saved)
+                }
+                j.hosts[u.Host] = list
+        }
+}
+
+func cookieJarPath() string {
+        return filepath.Join(config.Cache.Dir, "cookies.json")
+}
+
+// loadCookieJar включает cookie_jar для общего HTTP-клиента
+func loadCookieJar() {
+        httpClient.Jar = nil
+        if !config.HTTPSources.CookieJar {
+                return
+        }
+        jar, _ := cookiejar.New(nil)
+        cookieJar = &persistentJar{Jar: jar, hosts: make(map[string][]*http.Cookie)}
+        httpClient.Jar = cookieJar
+
+        data, err := os.ReadFile(cookieJarPath())
+        if err != nil {
+                return
+        }
+        var saved map[string][]*http.Cookie
+        if err := json.Unmarshal(data, &saved); err != nil {
+                log.Printf("Error reading %s: %v", cookieJarPath(), err)
+                return
+        }
+        for host, cookies := range saved {
+                // Протокол не сохраняется: Secure-cookie нужен https
+                cookieJar.SetCookies(&url.URL{Scheme: "https", Host: host, Path: "/"}, cookies)
+        }
+}
+
+func saveCookieJar() {
+        if cookieJar == nil {
+                return
+        }
+        cookieJar.mu.Lock()
+        data, err := json.MarshalIndent(cookieJar.hosts, "", "    ")
+        cookieJar.mu.Unlock()
+        if err == nil {
+                if err = os.MkdirAll(config.Cache.Dir, 0755); err == nil {
+                        err = writeFileStaged(cookieJarPath(), append(data, '\n'))
+                }
+        }
+        if err != nil {
+                log.Printf("Error writing %s: %v", cookieJarPath(), err)
+        }
+}
+
+// hostMatches host совпадает с domain или является его поддоменом
+func hostMatches(host, domain string) bool {
+        host, domain = strings.ToLower(host), strings.ToLower(strings.TrimPrefix(domain, "."))
+        return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// addSourceCookies статические cookie из http_sources.cookies для хоста запроса
+func addSourceCookies(req *http.Request) {
+        for domain, cookies := range config.HTTPSources.Cookies {
+                if !hostMatches(req.URL.Hostname(), domain) {
+                        continue
+                }
+                for name, value := range cookies {
+                        req.AddCookie(&http.Cookie{Name: name, Value: value})
+                }
+        }
+}
+
+// headlessFallback нужно ли повторить запрос внешней командой после ответа status
+func headlessFallback(rawURL string, status int) bool {
+        h := config.HTTPSources.Headless
+        if len(h.Command) == 0 {
+                return false
+        }
+        matched := false
+        for _, code := range h.Status {
+                matched = matched || code == status
+        }
+        if !matched {
+                return false
+        }
+        if len(h.Hosts) == 0 {
+                return true
+        }
+        u, err := url.Parse(rawURL)
+        if err != nil {
+                return false
+        }
+        for _, host := range h.Hosts {
+                if hostMatches(u.Hostname(), host) {
+                        return true
+                }
+        }
+        return false
+}
+
+// headlessFetch скачивает url командой headless.command; URL и User-Agent
+// передаются и в окружении (FETCH_URL, FETCH_USER_AGENT)
+func headlessFetch(rawURL string, maxSize ByteSize) (string, error) {
+        h := config.HTTPSources.Headless
+        args := make([]string, len(h.Command)-1)
+        for i, arg := range h.Command[1:] {
+                args[i] = strings.ReplaceAll(arg, "{url}", rawURL)
+        }
+        ctx, cancel := context.WithTimeout(runCtx, h.Timeout)
+        defer cancel()
+        cmd := exec.CommandContext(ctx, h.Command[0], args...)
+        cmd.Env = append(os.Environ(), "FETCH_URL="+rawURL, "FETCH_USER_AGENT="+config.UserAgent)
+        out, err := cmd.Output()
+        if err != nil {
+                var exitErr *exec.ExitError
+                if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+                        return "", fmt.Errorf("headless %s: %s", h.Command[0], strings.TrimSpace(string(exitErr.Stderr)))
+                }
+                return "", fmt.Errorf("headless %s: %w", h.Command[0], err)
+        }
+        if int64(len(out)) > int64(maxSize) {
+                return "", fmt.Errorf("response exceeds limit of %d bytes", maxSize)
+        }
+        if len(strings.TrimSpace(string(out))) == 0 {
+                return "", fmt.Errorf("headless %s: empty output", h.Command[0])
+        }
+        return stripBOM(string(out)), nil
+}
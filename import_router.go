@@ -0,0 +1,291 @@
+package main
+
+import (
+        "flag"
+        "fmt"
+        "log"
+        "os"
+        "path/filepath"
+        "sort"
+        "strings"
+
+        "go4.org/netipx"
+)
+
+// routerOSListEntry запись address-list, найденная на роутере или в экспорте
+type routerOSListEntry struct {
+        List    string
+        Address string
+        Comment string
+}
+
+// splitRouterOSWords делит строку команды на слова с учётом кавычек и \-экранирования
+func splitRouterOSWords(line string) []string {
+        var words []string
+        var word strings.Builder
+        inQuotes, escaped, started := false, false, false
+        for i := 0; i < len(line); i++ {
+                c := line[i]
+                switch {
+                case escaped:
+                        // \XX - байт в hex, как пишет export для не-ASCII
+                        if i+1 < len(line) && isHexDigit(c) && isHexDigit(line[i+1]) {
+                                var b byte
+                                fmt.Sscanf(line[i:i+2], "%02X", &b)
+                                word.WriteByte(b)
+                                i++
+                        } else {
+                                word.WriteByte(c)
+                        }
+                        escaped = false
+                case c == '\\':
+                        escaped, started = true, true
+                case c == '"':
+                        inQuotes, started = !inQuotes, true
+                case (c == ' ' || c == '\t') && !inQuotes:
+                        if started {
+                                words = append(words, word.String())
+                                word.Reset()
+                                started = false
+                        }
+                default:
+                        word.WriteByte(c)
+                        started = true
+                }
+        }
+        if started {
+                words = append(words, word.String())
+        }
+        return words
+}
+
+func isHexDigit(c byte) bool {
+        return c >= '0' && c <= '9' || c >= 'A' && c <= 'F' || c >= 'a' && c <= 'f'
+}
+
+// parseRouterOSExport достаёт записи address-list из /export или из скриптов
+// вида do {/ip firewall address-list add ...} on-error={}
+func parseRouterOSExport(data string) []routerOSListEntry {
+        // Склеиваем строки, перенесённые через \ в конце
+        data = strings.ReplaceAll(strings.ReplaceAll(data, "\r\n", "\n"), "\\\n", "")
+
+        var entries []routerOSListEntry
+        section := ""
+        for _, line := range strings.Split(data, "\n") {
+                line = strings.TrimSpace(line)
+                if line == "" || strings.HasPrefix(line, "#") {
+                        continue
+                }
+                // Команды в блоке do {...}: путь внутри
+                line = strings.TrimPrefix(strings.TrimPrefix(line, ":do {"), "do {")
+                if i := strings.LastIndex(line, "} on-error"); i >= 0 {
+                        line = line[:i]
+                }
+
+                words := splitRouterOSWords(line)
+                if len(words) == 0 {
+                        continue
+                }
+                // Путь меню: "/ip firewall address-list add" или "/ip/firewall/address-list/add"
+                if strings.HasPrefix(words[0], "/") {
+                        var path []string
+                        for len(words) > 0 && !strings.Contains(words[0], "=") && words[0] != "add" {
+                                path = append(path, strings.Split(strings.Trim(words[0], "/"), "/")...)
+                                words = words[1:]
+                        }
+                        if len(path) > 0 && path[len(path)-1] == "add" {
+                                path = path[:len(path)-1]
+                                words = append([]string{"add"}, words...)
+                        }
+                        section = strings.Join(path, "/")
+                }
+                if section != "ip/firewall/address-list" || len(words) == 0 || words[0] != "add" {
+                        continue
+                }
+
+                entry := routerOSListEntry{}
+                disabled := false
+                for _, word := range words[1:] {
+                        key, value, _ := strings.Cut(word, "=")
+                        switch key {
+                        case "list":
+                                entry.List = value
+                        case "address":
+                                entry.Address = value
+                        case "comment":
+                                entry.Comment = value
+                        case "disabled":
+                                disabled = value == "yes"
+                        }
+                }
+                if entry.List != "" && entry.Address != "" && !disabled {
+                        entries = append(entries, entry)
+                }
+        }
+        return entries
+}
+
+// fetchRouterOSAddressLists читает статические записи address-list через API
+func fetchRouterOSAddressLists(target RouterOSTarget) ([]routerOSListEntry, error) {
+        client, err := dialRouterOS(target)
+        if err != nil {
+                return nil, err
+        }
+        defer client.Close()
+        if err := client.Login(target.User, target.Password); err != nil {
+                return nil, err
+        }
+
+        replies, _, err := client.Run("/ip/firewall/address-list/print", "=.proplist=list,address,comment,dynamic,disabled")
+        if err != nil {
+                return nil, err
+        }
+        var entries []routerOSListEntry
+        for _, reply := range replies {
+                // Динамические записи живут по timeout и переносить их не нужно
+                if reply["dynamic"] == "true" || reply["disabled"] == "true" {
+                        continue
+                }
+                entries = append(entries, routerOSListEntry{List: reply["list"], Address: reply["address"], Comment: reply["comment"]})
+        }
+        return entries, nil
+}
+
+// importedListFile имя файла для списка роутера: только безопасные символы
+func importedListFile(list string) string {
+        name := strings.Map(func(r rune) rune {
+                switch {
+                case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+                        return r
+                case r >= 'A' && r <= 'Z':
+                        return r + 'a' - 'A'
+                default:
+                        return '_'
+                }
+        }, list)
+        return name + ".lst"
+}
+
+// writeImportedLists пишет по .lst на каждый address-list и возвращает
+// секцию static для config.yaml
+func writeImportedLists(entries []routerOSListEntry, outDir string, only map[string]bool) ([]string, error) {
+        builders := make(map[string]*netipx.IPSetBuilder)
+        comments := make(map[string]string)
+        for _, entry := range entries {
+                if len(only) > 0 && !only[strings.ToLower(entry.List)] {
+                        continue
+                }
+                prefix, err := parsePrefixOrAddr(entry.Address)
+                if err != nil || !prefix.Addr().Is4() {
+                        // Имена хостов и IPv6 в статических списках не поддерживаются
+                        log.Printf("Skipping %s in %s: not an IPv4 address", entry.Address, entry.List)
+                        continue
+                }
+                if builders[entry.List] == nil {
+                        builders[entry.List] = &netipx.IPSetBuilder{}
+                }
+                builders[entry.List].AddPrefix(prefix.Masked())
+                if comments[entry.List] == "" {
+                        comments[entry.List] = entry.Comment
+                }
+        }
+        if len(builders) == 0 {
+                return nil, fmt.Errorf("no address-list entries found")
+        }
+
+        var names []string
+        for name := range builders {
+                names = append(names, name)
+        }
+        sort.Strings(names)
+
+        if err := os.MkdirAll(outDir, 0755); err != nil {
+                return nil, err
+        }
+        yaml := []string{"static:"}
+        for _, name := range names {
+                set, err := builders[name].IPSet()
+                if err != nil {
+                        return nil, err
+                }
+                file := importedListFile(name)
+                if err := writeSubnetsToFile(set.Prefixes(), filepath.Join(outDir, file)); err != nil {
+                        return nil, err
+                }
+                log.Printf("%s: %d prefixes -> %s", name, len(set.Prefixes()), filepath.Join(outDir, file))
+
+                comment := comments[name]
+                if comment == "" {
+                        comment = name
+                }
+                yaml = append(yaml,
+                        fmt.Sprintf("  %s:", strings.TrimSuffix(file, ".lst")),
+                        fmt.Sprintf("    file: %q", file),
+                        fmt.Sprintf("    list_name: %q", name),
+                        fmt.Sprintf("    comment: %q", comment),
+                        fmt.Sprintf("    sources: [%q]", filepath.ToSlash(filepath.Join(outDir, file))),
+                )
+        }
+        return yaml, nil
+}
+
+// importFromRouterCommand переносит вручную заведённые address-list с роутера
+// (через API или из файла /export) в статические списки
+func importFromRouterCommand(args []string) {
+        flags := flag.NewFlagSet("import-from-router", flag.ExitOnError)
+        var target RouterOSTarget
+        rsc := flags.String("rsc", "", "read an exported .rsc instead of connecting to the router")
+        flags.StringVar(&target.Address, "address", "", "router address for the API (host or host:port)")
+        flags.StringVar(&target.User, "user", "admin", "API user")
+        flags.StringVar(&target.Password, "password", "", "API password")
+        flags.BoolVar(&target.TLS, "tls", false, "use api-ssl")
+        flags.BoolVar(&target.InsecureSkipVerify, "insecure", false, "do not verify the router certificate")
+        name := flags.String("target", "", "take address and credentials from routeros_push target with this name")
+        outDir := flags.String("out", "Subnets/IPv4/imported", "directory for the imported .lst files")
+        lists := flags.String("lists", "", "comma-separated address-lists to import (default all)")
+        flags.Parse(args)
+
+        if *name != "" {
+                configPath := "config.yaml"
+                if flags.NArg() > 0 {
+                        configPath = flags.Arg(0)
+                }
+                if err := loadConfig(configPath); err != nil {
+                        log.Fatal("Error loading config:", err)
+                }
+                found := false
+                for _, t := range config.RouterOSPush.Targets {
+                        if routerOSTargetName(t) == *name {
+                                target, found = t, true
+                        }
+                }
+                if !found {
+                        log.Fatalf("No routeros_push target named %q", *name)
+                }
+        }
+
+        var entries []routerOSListEntry
+        switch {
+        case *rsc != "":
+                data, err := os.ReadFile(*rsc)
+                if err != nil {
+                        log.Fatal("Error reading export:", err)
+                }
+                entries = parseRouterOSExport(stripBOM(string(data)))
+        case target.Address != "":
+                var err error
+                entries, err = fetchRouterOSAddressLists(target)
+                if err != nil {
+                        log.Fatal("Error reading address-lists from router:", err)
+                }
+        default:
+                log.Fatal("Usage: get_subnets import-from-router (--rsc export.rsc | --address host [--user u] [--password p] [--tls] | --target name [config-file]) [--out dir] [--lists a,b]")
+        }
+
+        yaml, err := writeImportedLists(entries, *outDir, parseSourceList(*lists))
+        if err != nil {
+                log.Fatal("Error importing address-lists:", err)
+        }
+        log.Println("Add to config.yaml:")
+        fmt.Println(strings.Join(yaml, "\n"))
+}
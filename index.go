@@ -0,0 +1,118 @@
+package main
+
+import (
+        "encoding/json"
+        "net/url"
+        "os"
+        "path/filepath"
+        "sort"
+        "strings"
+        "time"
+)
+
+// indexSchemaVersion меняется при несовместимых изменениях index.json
+const indexSchemaVersion = 1
+
+// IndexConfig index.json: какие списки и в каких форматах опубликованы, чтобы
+// клиентские скрипты находили файлы сами, а не держали пути в коде
+type IndexConfig struct {
+        Enabled bool   `yaml:"enabled"`
+        File    string `yaml:"file"`
+        BaseURL string `yaml:"base_url"` // Адрес, по которому опубликован рабочий каталог; без него только пути
+}
+
+type indexFile struct {
+        Format string `json:"format"`
+        Path   string `json:"path"`
+        URL    string `json:"url,omitempty"`
+}
+
+type indexList struct {
+        Name     string      `json:"name"`
+        ListName string      `json:"list_name"`
+        Comment  string      `json:"comment"`
+        Prefixes int         `json:"prefixes"`
+        Domains  int         `json:"domains"`
+        Files    []indexFile `json:"files"`
+}
+
+type indexDocument struct {
+        SchemaVersion int         `json:"schema_version"`
+        Generated     string      `json:"generated"`
+        Lists         []indexList `json:"lists"`
+}
+
+// renderTarget список и формат, которые сейчас рендерит renderOutputs;
+// Commit записывает под ними путь готового файла
+var renderTarget struct {
+        list, format string
+}
+
+// renderedFiles пути файлов по спискам и форматам за этот запуск
+var renderedFiles = make(map[string][]indexFile)
+
+func recordRenderedFile(path string) {
+        if renderTarget.list == "" {
+                return
+        }
+        renderedFiles[renderTarget.list] = append(renderedFiles[renderTarget.list], indexFile{Format: renderTarget.format, Path: path})
+}
+
+// indexListFiles файлы списка: .lst и RouterOS-скрипты пишутся до рендеринга,
+// их пути известны заранее, остальные записаны при рендеринге
+func indexListFiles(list *generatedList) []indexFile {
+        var files []indexFile
+        candidates := []indexFile{{Format: "ipv4", Path: ipv4ListPath(list.Name + ".lst")}}
+        routerOSDir := layoutDir("routeros", list.Name, config.RouterOSDir)
+        if config.GenerateV6 {
+                candidates = append(candidates, indexFile{Format: "routeros_v6", Path: filepath.Join(routerOSDir, "v6", list.ListName+".rsc")})
+        }
+        if config.GenerateV7 {
+                candidates = append(candidates, indexFile{Format: "routeros_v7", Path: filepath.Join(routerOSDir, "v7", list.ListName+".rsc")})
+        }
+        for _, file := range candidates {
+                if _, err := os.Stat(file.Path); err == nil {
+                        files = append(files, file)
+                }
+        }
+        return append(files, renderedFiles[list.Name]...)
+}
+
+func generateIndex(lists []*generatedList) error {
+        doc := indexDocument{
+                SchemaVersion: indexSchemaVersion,
+                Generated:     time.Now().UTC().Format(time.RFC3339),
+                Lists:         make([]indexList, 0, len(lists)),
+        }
+        for _, list := range lists {
+                entry := indexList{
+                        Name:     list.Name,
+                        ListName: list.ListName,
+                        Comment:  list.Comment,
+                        Prefixes: len(list.Prefixes),
+                        Domains:  len(list.Domains),
+                }
+                for _, file := range indexListFiles(list) {
+                        file.Path = filepath.ToSlash(file.Path)
+                        if config.Index.BaseURL != "" && !filepath.IsAbs(file.Path) {
+                                file.URL, _ = url.JoinPath(config.Index.BaseURL, file.Path)
+                        }
+                        entry.Files = append(entry.Files, file)
+                }
+                doc.Lists = append(doc.Lists, entry)
+        }
+        sort.Slice(doc.Lists, func(i, j int) bool {
+                return strings.ToLower(doc.Lists[i].Name) < strings.ToLower(doc.Lists[j].Name)
+        })
+
+        data, err := json.MarshalIndent(doc, "", "    ")
+        if err != nil {
+                return err
+        }
+        if dir := filepath.Dir(config.Index.File); dir != "." {
+                if err := os.MkdirAll(dir, 0755); err != nil {
+                        return err
+                }
+        }
+        return writeFileStaged(config.Index.File, append(data, '\n'))
+}
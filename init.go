@@ -0,0 +1,140 @@
+package main
+
+import (
+        "bufio"
+        "flag"
+        "fmt"
+        "log"
+        "os"
+        "strings"
+
+        "gopkg.in/yaml.v3"
+)
+
+// Команда init: собирает рабочий конфиг из ответов на вопросы или флагов
+
+type initOptions struct {
+        Gateway  string
+        RouterOS string // v6, v7 или both
+        Presets  []string
+}
+
+func promptValue(reader *bufio.Reader, question, current string) string {
+        fmt.Printf("%s [%s]: ", question, current)
+        line, err := reader.ReadString('\n')
+        if err != nil {
+                return current
+        }
+        if line = strings.TrimSpace(line); line != "" {
+                return line
+        }
+        return current
+}
+
+func splitList(value string) []string {
+        var items []string
+        for _, item := range strings.Split(value, ",") {
+                if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+                        items = append(items, item)
+                }
+        }
+        return items
+}
+
+// renderInitConfig собирает YAML: общие настройки и секции выбранных пресетов
+func renderInitConfig(opts initOptions) (string, error) {
+        var b strings.Builder
+        b.WriteString("# Конфигурация создана командой get_subnets init\n")
+        fmt.Fprintf(&b, "version: %d\n", currentConfigVersion)
+        b.WriteString("bgp_tools_url: \"https://bgp.tools/table.txt\"\n")
+        b.WriteString("bgp_tools:\n  cache_ttl: \"12h\"\n")
+        b.WriteString("user_agent: \"Mozilla/5.0 (compatible; SubnetFetcher/1.0)\"\n\n")
+        b.WriteString("ipv4_dir: \"ipv4\"\nrouteros_dir: \"RouterOS\"\n\n")
+
+        switch opts.RouterOS {
+        case "v6":
+                b.WriteString("generate_v6: true\ngenerate_v7: false\n")
+        case "v7":
+                b.WriteString("generate_v6: false\ngenerate_v7: true\n")
+        case "both":
+                b.WriteString("generate_v6: true\ngenerate_v7: true\n")
+        default:
+                return "", fmt.Errorf("unknown RouterOS version %q (v6, v7 or both)", opts.RouterOS)
+        }
+        fmt.Fprintf(&b, "\n# Единый шлюз для всех маршрутов\ngateway: %q\n", opts.Gateway)
+
+        sections := make(map[string][]string)
+        for _, name := range opts.Presets {
+                p, ok := presets[name]
+                if !ok {
+                        return "", fmt.Errorf("unknown preset %q (available: %s)", name, strings.Join(presetNames(), ", "))
+                }
+                for section, body := range p.Sections {
+                        sections[section] = append(sections[section], body)
+                }
+        }
+        for _, section := range presetSectionOrder {
+                if bodies, ok := sections[section]; ok {
+                        fmt.Fprintf(&b, "\n%s:\n%s", section, strings.Join(bodies, ""))
+                }
+        }
+
+        // Проверяем, что получился конфиг, который читает loadConfig
+        var check Config
+        if err := yaml.Unmarshal([]byte(b.String()), &check); err != nil {
+                return "", fmt.Errorf("generated config is invalid: %w", err)
+        }
+        return b.String(), nil
+}
+
+func initCommand(args []string) {
+        flags := flag.NewFlagSet("init", flag.ExitOnError)
+        gateway := flags.String("gateway", "", "gateway for generated routes")
+        routerOS := flags.String("routeros", "", "RouterOS syntax: v6, v7 or both")
+        presetList := flags.String("presets", "", "comma-separated presets: "+strings.Join(presetNames(), ", "))
+        force := flags.Bool("force", false, "overwrite an existing config")
+        flags.Parse(args)
+
+        path := "config.yaml"
+        if flags.NArg() > 0 {
+                path = flags.Arg(0)
+        }
+        if _, err := os.Stat(path); err == nil && !*force {
+                log.Fatalf("%s already exists, use --force to overwrite", path)
+        }
+
+        opts := initOptions{Gateway: *gateway, RouterOS: *routerOS, Presets: splitList(*presetList)}
+        presetsAnswer := *presetList
+
+        // Спрашиваем только то, что не задано флагами, и только в терминале
+        if isTerminal(os.Stdin) {
+                reader := bufio.NewReader(os.Stdin)
+                if opts.Gateway == "" {
+                        opts.Gateway = promptValue(reader, "Gateway for routes", "10.8.0.1")
+                }
+                if opts.RouterOS == "" {
+                        opts.RouterOS = promptValue(reader, "RouterOS version (v6, v7, both)", "v7")
+                }
+                if presetsAnswer == "" {
+                        opts.Presets = splitList(promptValue(reader, "Presets ("+strings.Join(presetNames(), ", ")+")", strings.Join(presetNames(), ",")))
+                }
+        }
+        if opts.Gateway == "" {
+                opts.Gateway = "10.8.0.1"
+        }
+        if opts.RouterOS == "" {
+                opts.RouterOS = "v7"
+        }
+        if presetsAnswer == "" && len(opts.Presets) == 0 {
+                opts.Presets = presetNames()
+        }
+
+        data, err := renderInitConfig(opts)
+        if err != nil {
+                log.Fatal(err)
+        }
+        if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+                log.Fatal("Error writing config:", err)
+        }
+        log.Printf("Config written to %s", path)
+}
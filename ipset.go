@@ -0,0 +1,65 @@
+package main
+
+import (
+        "fmt"
+        "log"
+        "net/netip"
+)
+
+// IPSetConfig наполнение ipset на Linux-шлюзе (--apply ipset) напрямую через
+// netlink: список заливается во временный set и меняется местами с рабочим
+// (ipset swap), так что правила iptables не видят наполовину пустой set
+type IPSetConfig struct {
+        Lists   []string `yaml:"lists"`   // Пусто - все списки
+        MaxElem int      `yaml:"maxelem"` // Для новых set'ов; по умолчанию 65536 или больше, если список крупнее
+}
+
+// applyIPSet включается флагом --apply ipset
+var applyIPSet bool
+
+// ipsetTempName временный set для подмены; списки заливаются по очереди
+const ipsetTempName = "allow_domains_tmp"
+
+// ipsetSetName set списка: как в nftables, list_name и list_name_v6
+func ipsetSetName(list *generatedList, v6 bool) (string, error) {
+        name := nftablesSetName(list, v6)
+        if len(name) > 31 {
+                return "", fmt.Errorf("ipset name %q is longer than 31 characters", name)
+        }
+        return name, nil
+}
+
+func applyIPSetSets(lists []*generatedList) error {
+        lists = listsForFormat("ipset", lists)
+        var sets int
+        for _, list := range lists {
+                if len(config.IPSet.Lists) > 0 && !listSelectedByName(config.IPSet.Lists, list) {
+                        continue
+                }
+                v4, v6, err := prefixFamilies(list)
+                if err != nil {
+                        return fmt.Errorf("%s: %w", list.ListName, err)
+                }
+                for _, set := range []struct {
+                        v6       bool
+                        prefixes []netip.Prefix
+                }{{false, v4}, {true, v6}} {
+                        // Пустой IPv6 не трогаем: такого set'а может не быть
+                        if len(set.prefixes) == 0 && set.v6 {
+                                continue
+                        }
+                        name, err := ipsetSetName(list, set.v6)
+                        if err != nil {
+                                return err
+                        }
+                        if err := replaceIPSet(name, set.v6, set.prefixes); err != nil {
+                                return fmt.Errorf("%s: %w", name, err)
+                        }
+                        sets++
+                }
+        }
+        if sets > 0 {
+                log.Printf("ipset: replaced %d sets", sets)
+        }
+        return nil
+}
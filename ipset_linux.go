@@ -0,0 +1,333 @@
+//go:build linux
+
+package main
+
+import (
+        "encoding/binary"
+        "fmt"
+        "net/netip"
+        "strings"
+        "syscall"
+        "unsafe"
+)
+
+// Протокол ipset поверх nfnetlink (include/uapi/linux/netfilter/ipset/ip_set.h)
+const (
+        nfnlSubsysIPSet = 6
+        ipsetProtocol   = 6 // IPSET_PROTOCOL_MIN: его принимают и старые, и новые ядра
+
+        ipsetCmdCreate  = 2
+        ipsetCmdDestroy = 3
+        ipsetCmdSwap    = 6
+        ipsetCmdAdd     = 9
+        ipsetCmdHeader  = 12
+        ipsetCmdType    = 13
+
+        ipsetAttrProtocol = 1
+        ipsetAttrSetName  = 2
+        ipsetAttrTypeName = 3
+        ipsetAttrSetName2 = ipsetAttrTypeName
+        ipsetAttrRevision = 4
+        ipsetAttrFamily   = 5
+        ipsetAttrData     = 7
+
+        ipsetAttrIP      = 1
+        ipsetAttrCIDR    = 3
+        ipsetAttrMaxElem = 19
+        ipsetAttrIPv4    = 1
+        ipsetAttrIPv6    = 2
+
+        nlaFNested    = 0x8000
+        nlaFNetOrder  = 0x4000
+        nfprotoIPv4   = 2
+        nfprotoIPv6   = 10
+        ipsetErrBase  = 4096
+        ipsetMsgBatch = 512 // ADD в одном sendto
+)
+
+var ipsetErrors = map[int]string{
+        4097: "kernel does not support ipset protocol",
+        4098: "set type is not supported by kernel",
+        4099: "too many sets",
+        4100: "set is busy",
+        4101: "second set already exists",
+        4102: "set type or family mismatch",
+        4103: "set already exists",
+        4104: "invalid CIDR",
+        4106: "invalid family",
+        4108: "set is referenced",
+        4352: "set is full, raise ipset.maxelem",
+}
+
+// Заголовки netlink в порядке байтов хоста, атрибуты с NLA_F_NET_BYTEORDER - в сетевом
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+        x := uint16(1)
+        if *(*byte)(unsafe.Pointer(&x)) == 1 {
+                return binary.LittleEndian
+        }
+        return binary.BigEndian
+}()
+
+func nlAttr(typ uint16, data []byte) []byte {
+        b := make([]byte, (4+len(data)+3)&^3)
+        nativeEndian.PutUint16(b[0:], uint16(4+len(data)))
+        nativeEndian.PutUint16(b[2:], typ)
+        copy(b[4:], data)
+        return b
+}
+
+func nlAttrString(typ uint16, value string) []byte {
+        return nlAttr(typ, append([]byte(value), 0))
+}
+
+func nlAttrNested(typ uint16, attrs ...[]byte) []byte {
+        var data []byte
+        for _, attr := range attrs {
+                data = append(data, attr...)
+        }
+        return nlAttr(typ|nlaFNested, data)
+}
+
+func nlAttrBE32(typ uint16, value uint32) []byte {
+        b := make([]byte, 4)
+        binary.BigEndian.PutUint32(b, value)
+        return nlAttr(typ|nlaFNetOrder, b)
+}
+
+// nlAttrs разбирает атрибуты ответа по типу без флагов
+func nlAttrs(data []byte) map[uint16][]byte {
+        attrs := make(map[uint16][]byte)
+        for len(data) >= 4 {
+                length := int(nativeEndian.Uint16(data[0:]))
+                if length < 4 || length > len(data) {
+                        break
+                }
+                attrs[nativeEndian.Uint16(data[2:])&^(nlaFNested|nlaFNetOrder)] = data[4:length]
+                data = data[(length+3)&^3:]
+        }
+        return attrs
+}
+
+type ipsetConn struct {
+        fd  int
+        seq uint32
+}
+
+func dialIPSet() (*ipsetConn, error) {
+        fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_NETFILTER)
+        if err != nil {
+                return nil, err
+        }
+        if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+                syscall.Close(fd)
+                return nil, err
+        }
+        return &ipsetConn{fd: fd}, nil
+}
+
+func (c *ipsetConn) Close() error {
+        return syscall.Close(c.fd)
+}
+
+// message сообщение ipset: nlmsghdr, nfgenmsg и атрибуты с версией протокола
+func (c *ipsetConn) message(cmd uint16, flags uint16, attrs ...[]byte) []byte {
+        c.seq++
+        body := []byte{syscall.AF_INET, 0, 0, 0} // nfgenmsg: family, NFNETLINK_V0, res_id
+        body = append(body, nlAttr(ipsetAttrProtocol, []byte{ipsetProtocol})...)
+        for _, attr := range attrs {
+                body = append(body, attr...)
+        }
+        msg := make([]byte, syscall.NLMSG_HDRLEN, syscall.NLMSG_HDRLEN+len(body))
+        nativeEndian.PutUint32(msg[0:], uint32(syscall.NLMSG_HDRLEN+len(body)))
+        nativeEndian.PutUint16(msg[4:], nfnlSubsysIPSet<<8|cmd)
+        nativeEndian.PutUint16(msg[6:], syscall.NLM_F_REQUEST|flags)
+        nativeEndian.PutUint32(msg[8:], c.seq)
+        return append(msg, body...)
+}
+
+// exchange отправляет сообщения с номерами first..c.seq, подтверждение
+// запрошено только у последнего: ядро всё равно сообщит об ошибке любого из
+// них. Ответы на прошлые, прерванные ошибкой обмены пропускаются.
+func (c *ipsetConn) exchange(msgs []byte, first uint32) ([]map[uint16][]byte, error) {
+        if err := syscall.Sendto(c.fd, msgs, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+                return nil, err
+        }
+        var replies []map[uint16][]byte
+        buf := make([]byte, 1<<16)
+        for {
+                n, _, err := syscall.Recvfrom(c.fd, buf, 0)
+                if err != nil {
+                        return nil, err
+                }
+                messages, err := syscall.ParseNetlinkMessage(buf[:n])
+                if err != nil {
+                        return nil, err
+                }
+                for _, m := range messages {
+                        if m.Header.Seq < first {
+                                continue
+                        }
+                        if m.Header.Type != syscall.NLMSG_ERROR {
+                                if len(m.Data) >= 4 {
+                                        replies = append(replies, nlAttrs(m.Data[4:]))
+                                }
+                                continue
+                        }
+                        if len(m.Data) < 4 {
+                                return nil, fmt.Errorf("short netlink error message")
+                        }
+                        if errno := -int32(nativeEndian.Uint32(m.Data)); errno != 0 {
+                                return nil, ipsetError(int(errno))
+                        }
+                        if m.Header.Seq == c.seq {
+                                return replies, nil
+                        }
+                }
+        }
+}
+
+func ipsetError(errno int) error {
+        if text, ok := ipsetErrors[errno]; ok {
+                return fmt.Errorf("%s", text)
+        }
+        if errno >= ipsetErrBase {
+                return fmt.Errorf("ipset error %d", errno)
+        }
+        return syscall.Errno(errno)
+}
+
+func (c *ipsetConn) request(cmd uint16, flags uint16, attrs ...[]byte) ([]map[uint16][]byte, error) {
+        msg := c.message(cmd, flags|syscall.NLM_F_ACK, attrs...)
+        return c.exchange(msg, c.seq)
+}
+
+// header тип, ревизия и семейство существующего set'а
+func (c *ipsetConn) header(name string) (typeName string, revision, family byte, err error) {
+        replies, err := c.request(ipsetCmdHeader, 0, nlAttrString(ipsetAttrSetName, name))
+        if err != nil {
+                return "", 0, 0, err
+        }
+        for _, attrs := range replies {
+                if t, ok := attrs[ipsetAttrTypeName]; ok && len(attrs[ipsetAttrRevision]) > 0 && len(attrs[ipsetAttrFamily]) > 0 {
+                        return strings.TrimRight(string(t), "\x00"), attrs[ipsetAttrRevision][0], attrs[ipsetAttrFamily][0], nil
+                }
+        }
+        return "", 0, 0, fmt.Errorf("empty header reply")
+}
+
+// hashNetRevision наибольшая ревизия hash:net, которую знает ядро
+func (c *ipsetConn) hashNetRevision(family byte) (byte, error) {
+        replies, err := c.request(ipsetCmdType, 0, nlAttrString(ipsetAttrTypeName, "hash:net"), nlAttr(ipsetAttrFamily, []byte{family}))
+        if err != nil {
+                return 0, err
+        }
+        for _, attrs := range replies {
+                if revision := attrs[ipsetAttrRevision]; len(revision) > 0 {
+                        return revision[0], nil
+                }
+        }
+        return 0, fmt.Errorf("empty type reply")
+}
+
+func (c *ipsetConn) create(name string, revision, family byte, maxElem int) error {
+        _, err := c.request(ipsetCmdCreate, syscall.NLM_F_EXCL,
+                nlAttrString(ipsetAttrSetName, name),
+                nlAttrString(ipsetAttrTypeName, "hash:net"),
+                nlAttr(ipsetAttrRevision, []byte{revision}),
+                nlAttr(ipsetAttrFamily, []byte{family}),
+                nlAttrNested(ipsetAttrData, nlAttrBE32(ipsetAttrMaxElem, uint32(maxElem))))
+        return err
+}
+
+func (c *ipsetConn) destroy(name string) error {
+        _, err := c.request(ipsetCmdDestroy, 0, nlAttrString(ipsetAttrSetName, name))
+        return err
+}
+
+// addMessage ADD одного префикса: адрес и длина маски в IPSET_ATTR_DATA
+func (c *ipsetConn) addMessage(name string, prefix netip.Prefix, flags uint16) []byte {
+        addrType := uint16(ipsetAttrIPv4)
+        if prefix.Addr().Is6() {
+                addrType = ipsetAttrIPv6
+        }
+        return c.message(ipsetCmdAdd, flags,
+                nlAttrString(ipsetAttrSetName, name),
+                nlAttrNested(ipsetAttrData,
+                        nlAttrNested(ipsetAttrIP, nlAttr(addrType|nlaFNetOrder, prefix.Addr().AsSlice())),
+                        nlAttr(ipsetAttrCIDR, []byte{byte(prefix.Bits())})))
+}
+
+func (c *ipsetConn) add(name string, prefixes []netip.Prefix) error {
+        for start := 0; start < len(prefixes); start += ipsetMsgBatch {
+                end := start + ipsetMsgBatch
+                if end > len(prefixes) {
+                        end = len(prefixes)
+                }
+                var msgs []byte
+                first := c.seq + 1
+                for i, prefix := range prefixes[start:end] {
+                        var flags uint16
+                        if start+i == end-1 {
+                                flags = syscall.NLM_F_ACK
+                        }
+                        msgs = append(msgs, c.addMessage(name, prefix, flags)...)
+                }
+                if _, err := c.exchange(msgs, first); err != nil {
+                        return fmt.Errorf("adding %d prefixes: %w", end-start, err)
+                }
+        }
+        return nil
+}
+
+func (c *ipsetConn) swap(from, to string) error {
+        _, err := c.request(ipsetCmdSwap, 0, nlAttrString(ipsetAttrSetName, from), nlAttrString(ipsetAttrSetName2, to))
+        return err
+}
+
+// replaceIPSet заливает префиксы во временный set того же типа и меняет его
+// местами с рабочим. Рабочий set создаётся, если его ещё нет.
+func replaceIPSet(name string, v6 bool, prefixes []netip.Prefix) error {
+        c, err := dialIPSet()
+        if err != nil {
+                return err
+        }
+        defer c.Close()
+
+        family := byte(nfprotoIPv4)
+        if v6 {
+                family = nfprotoIPv6
+        }
+        maxElem := config.IPSet.MaxElem
+        if maxElem < 2*len(prefixes) {
+                maxElem = 2 * len(prefixes)
+        }
+
+        typeName, revision, existingFamily, err := c.header(name)
+        switch {
+        case err == syscall.ENOENT:
+                if revision, err = c.hashNetRevision(family); err != nil {
+                        return fmt.Errorf("hash:net type: %w", err)
+                }
+                if err := c.create(name, revision, family, maxElem); err != nil {
+                        return fmt.Errorf("creating set: %w", err)
+                }
+        case err != nil:
+                return err
+        case typeName != "hash:net" || existingFamily != family:
+                return fmt.Errorf("existing set is %s family %d, want hash:net family %d", typeName, existingFamily, family)
+        }
+
+        // Остаток упавшего запуска
+        if err := c.destroy(ipsetTempName); err != nil && err != syscall.ENOENT {
+                return fmt.Errorf("removing %s: %w", ipsetTempName, err)
+        }
+        if err := c.create(ipsetTempName, revision, family, maxElem); err != nil {
+                return fmt.Errorf("creating %s: %w", ipsetTempName, err)
+        }
+        defer c.destroy(ipsetTempName)
+
+        if err := c.add(ipsetTempName, prefixes); err != nil {
+                return err
+        }
+        return c.swap(ipsetTempName, name)
+}
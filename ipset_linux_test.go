@@ -0,0 +1,105 @@
+//go:build linux
+
+package main
+
+import (
+        "bytes"
+        "net/netip"
+        "syscall"
+        "testing"
+)
+
+func TestNlAttr(t *testing.T) {
+        tests := []struct {
+                name   string
+                attr   []byte
+                typ    uint16
+                length int // nla_len без выравнивания
+                data   []byte
+        }{
+                {"padded", nlAttr(ipsetAttrCIDR, []byte{24}), ipsetAttrCIDR, 5, []byte{24, 0, 0, 0}},
+                {"aligned", nlAttr(ipsetAttrIP, []byte{1, 2, 3, 4}), ipsetAttrIP, 8, []byte{1, 2, 3, 4}},
+                {"string", nlAttrString(ipsetAttrSetName, "ru"), ipsetAttrSetName, 7, []byte{'r', 'u', 0, 0}},
+                {"big endian", nlAttrBE32(ipsetAttrMaxElem, 65536), ipsetAttrMaxElem | nlaFNetOrder, 8, []byte{0, 1, 0, 0}},
+                {"nested", nlAttrNested(ipsetAttrData, nlAttr(ipsetAttrCIDR, []byte{8})), ipsetAttrData | nlaFNested, 12, nlAttr(ipsetAttrCIDR, []byte{8})},
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        if length := int(nativeEndian.Uint16(tt.attr[0:])); length != tt.length {
+                                t.Errorf("nla_len = %d, want %d", length, tt.length)
+                        }
+                        if typ := nativeEndian.Uint16(tt.attr[2:]); typ != tt.typ {
+                                t.Errorf("nla_type = %#x, want %#x", typ, tt.typ)
+                        }
+                        if !bytes.Equal(tt.attr[4:], tt.data) {
+                                t.Errorf("data = %v, want %v", tt.attr[4:], tt.data)
+                        }
+                })
+        }
+}
+
+func TestIPSetAddMessage(t *testing.T) {
+        tests := []struct {
+                prefix   string
+                addrType uint16
+                flags    uint16
+        }{
+                {"91.108.4.0/22", ipsetAttrIPv4, 0},
+                {"2001:67c:4e8::/48", ipsetAttrIPv6, syscall.NLM_F_ACK},
+        }
+        c := &ipsetConn{seq: 41}
+        for _, tt := range tests {
+                t.Run(tt.prefix, func(t *testing.T) {
+                        prefix := netip.MustParsePrefix(tt.prefix)
+                        msg := c.addMessage("telegram", prefix, tt.flags)
+
+                        if length := nativeEndian.Uint32(msg[0:]); int(length) != len(msg) {
+                                t.Errorf("nlmsg_len = %d, message is %d bytes", length, len(msg))
+                        }
+                        if typ := nativeEndian.Uint16(msg[4:]); typ != nfnlSubsysIPSet<<8|ipsetCmdAdd {
+                                t.Errorf("nlmsg_type = %#x", typ)
+                        }
+                        if flags := nativeEndian.Uint16(msg[6:]); flags != syscall.NLM_F_REQUEST|tt.flags {
+                                t.Errorf("nlmsg_flags = %#x", flags)
+                        }
+                        if seq := nativeEndian.Uint32(msg[8:]); seq != c.seq {
+                                t.Errorf("nlmsg_seq = %d, want %d", seq, c.seq)
+                        }
+
+                        attrs := nlAttrs(msg[syscall.NLMSG_HDRLEN+4:])
+                        if !bytes.Equal(attrs[ipsetAttrProtocol], []byte{ipsetProtocol}) {
+                                t.Errorf("protocol = %v", attrs[ipsetAttrProtocol])
+                        }
+                        if string(attrs[ipsetAttrSetName]) != "telegram\x00" {
+                                t.Errorf("set name = %q", attrs[ipsetAttrSetName])
+                        }
+                        data := nlAttrs(attrs[ipsetAttrData])
+                        ip := nlAttrs(data[ipsetAttrIP])
+                        if !bytes.Equal(ip[tt.addrType], prefix.Addr().AsSlice()) {
+                                t.Errorf("address = %v, want %v", ip[tt.addrType], prefix.Addr())
+                        }
+                        if !bytes.Equal(data[ipsetAttrCIDR], []byte{byte(prefix.Bits())}) {
+                                t.Errorf("cidr = %v, want %d", data[ipsetAttrCIDR], prefix.Bits())
+                        }
+                })
+        }
+        if c.seq != 43 {
+                t.Errorf("seq = %d after two messages, want 43", c.seq)
+        }
+}
+
+func TestIPSetError(t *testing.T) {
+        tests := []struct {
+                errno int
+                want  string
+        }{
+                {4103, "set already exists"},
+                {4200, "ipset error 4200"},
+                {int(syscall.EPERM), syscall.EPERM.Error()},
+        }
+        for _, tt := range tests {
+                if got := ipsetError(tt.errno).Error(); got != tt.want {
+                        t.Errorf("ipsetError(%d) = %q, want %q", tt.errno, got, tt.want)
+                }
+        }
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+        "fmt"
+        "net/netip"
+)
+
+func replaceIPSet(name string, v6 bool, prefixes []netip.Prefix) error {
+        return fmt.Errorf("ipset is only available on Linux")
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+        "bufio"
+        "fmt"
+        "io"
+        "log"
+        "net"
+        "os"
+        "sort"
+        "strings"
+        "time"
+)
+
+// IRRConfig раскрытие AS-SET (например AS-GOOGLE) в ASN через whois реестров
+// маршрутизации: вложенные AS-SET обходятся рекурсивно
+type IRRConfig struct {
+        Servers  []string      `yaml:"servers"`   // host[:port], по умолчанию whois.radb.net и whois.ripe.net
+        CacheTTL time.Duration `yaml:"cache_ttl"` // По умолчанию 24h
+        Timeout  time.Duration `yaml:"timeout"`   // На один запрос, по умолчанию 30s
+        MaxDepth int           `yaml:"max_depth"` // Вложенность AS-SET, по умолчанию 10
+}
+
+var defaultIRRServers = []string{"whois.radb.net", "whois.ripe.net"}
+
+// asSetASNs раскрытые в этом запуске AS-SET: имя в верхнем регистре -> ASN без AS
+var asSetASNs map[string][]string
+
+// isASSet имя AS-SET: AS-NAME или иерархическое AS15169:AS-GOOGLE
+func isASSet(name string) bool {
+        for _, part := range strings.Split(strings.ToUpper(strings.TrimSpace(name)), ":") {
+                if strings.HasPrefix(part, "AS-") {
+                        return true
+                }
+        }
+        return false
+}
+
+// listASSets AS-SET записи as_numbers: ключ, если это AS-SET, и as_sets
+func listASSets(as string, asConfig ASConfig) []string {
+        var sets []string
+        for _, name := range append([]string{as}, asConfig.ASSets...) {
+                if isASSet(name) {
+                        sets = append(sets, strings.ToUpper(strings.TrimSpace(name)))
+                }
+        }
+        return sets
+}
+
+func irrServers() []string {
+        if len(config.IRR.Servers) > 0 {
+                return config.IRR.Servers
+        }
+        return defaultIRRServers
+}
+
+// whoisQuery отправляет запрос на whois-сервер (порт 43 по умолчанию) и читает ответ до закрытия
+func whoisQuery(server, query string) (string, error) {
+        if _, _, err := net.SplitHostPort(server); err != nil {
+                server = net.JoinHostPort(server, "43")
+        }
+        dialer := net.Dialer{Timeout: config.IRR.Timeout}
+        conn, err := dialer.DialContext(runCtx, "tcp", server)
+        if err != nil {
+                return "", err
+        }
+        defer conn.Close()
+        conn.SetDeadline(time.Now().Add(config.IRR.Timeout))
+        if _, err := io.WriteString(conn, query+"\r\n"); err != nil {
+                return "", err
+        }
+        data, err := io.ReadAll(io.LimitReader(conn, 4<<20))
+        if err != nil {
+                return "", err
+        }
+        return string(data), nil
+}
+
+// whoisCached ответ whois из кэша, пока он моложе irr.cache_ttl
+func whoisCached(server, query string) (string, error) {
+        key := "whois://" + server + "/" + query
+        path := cachePath(key)
+        if info, err := os.Stat(path); err == nil && (offlineMode || time.Since(info.ModTime()) < config.IRR.CacheTTL) {
+                data, err := os.ReadFile(path)
+                return string(data), err
+        } else if offlineMode {
+                return "", fmt.Errorf("offline mode: %s is not cached", key)
+        }
+
+        data, err := whoisQuery(server, query)
+        if err != nil {
+                return "", fmt.Errorf("whois %s: %w", server, err)
+        }
+        stageDownload(key, data)
+        if err := os.MkdirAll(config.Cache.Dir, 0755); err != nil {
+                log.Printf("Error creating cache dir: %v", err)
+        } else if err := writeFileStaged(path, []byte(data)); err != nil {
+                log.Printf("Error caching %s: %v", key, err)
+        }
+        return data, nil
+}
+
+// parseASSetMembers members: объекта as-set name из ответа в формате RPSL.
+// found - объект есть в ответе (пустой AS-SET тоже найден).
+func parseASSetMembers(data, name string) (members []string, found bool) {
+        var inSet bool
+        var key string
+        scanner := bufio.NewScanner(strings.NewReader(data))
+        for scanner.Scan() {
+                line := scanner.Text()
+                if strings.HasPrefix(line, "#") {
+                        continue
+                }
+                if i := strings.IndexByte(line, '#'); i >= 0 {
+                        line = line[:i]
+                }
+                switch {
+                case strings.TrimSpace(line) == "":
+                        inSet = false
+                        continue
+                case strings.HasPrefix(line, "%"):
+                        continue
+                case line[0] == ' ' || line[0] == '\t' || line[0] == '+':
+                        // Продолжение предыдущего атрибута
+                        line = strings.TrimLeft(line, "+")
+                default:
+                        i := strings.IndexByte(line, ':')
+                        if i < 0 {
+                                continue
+                        }
+                        key = strings.ToLower(strings.TrimSpace(line[:i]))
+                        line = line[i+1:]
+                        if key == "as-set" {
+                                inSet = strings.EqualFold(strings.TrimSpace(line), name)
+                                found = found || inSet
+                        }
+                }
+                if !inSet || key != "members" {
+                        continue
+                }
+                for _, member := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+                        members = append(members, strings.ToUpper(member))
+                }
+        }
+        return members, found
+}
+
+// lookupASSet ищет объект as-set на серверах по очереди
+func lookupASSet(name string) ([]string, error) {
+        var errs []string
+        for _, server := range irrServers() {
+                query := "-T as-set " + name
+                if strings.Contains(server, "ripe.net") {
+                        // Без -r RIPE отдаёт и контакты, а их число в сутки ограничено
+                        query = "-r " + query
+                }
+                data, err := whoisCached(server, query)
+                if err != nil {
+                        errs = append(errs, err.Error())
+                        continue
+                }
+                if members, found := parseASSetMembers(data, name); found {
+                        return members, nil
+                }
+        }
+        if len(errs) > 0 {
+                return nil, fmt.Errorf("%s: %s", name, strings.Join(errs, "; "))
+        }
+        return nil, fmt.Errorf("%s: not found in %s", name, strings.Join(irrServers(), ", "))
+}
+
+// expandASSet раскрывает AS-SET рекурсивно в ASN без AS
+func expandASSet(name string) ([]string, error) {
+        seen := map[string]bool{name: true}
+        asns := make(map[string]bool)
+        level := []string{name}
+        for depth := 0; len(level) > 0; depth++ {
+                if depth > config.IRR.MaxDepth {
+                        return nil, fmt.Errorf("%s: nested deeper than %d sets", name, config.IRR.MaxDepth)
+                }
+                var next []string
+                for _, set := range level {
+                        members, err := lookupASSet(set)
+                        if err != nil {
+                                if set == name {
+                                        return nil, err
+                                }
+                                // Битая ссылка на вложенный набор не должна ронять весь список
+                                log.Printf("Error expanding %s: %v", name, err)
+                                continue
+                        }
+                        for _, member := range members {
+                                switch {
+                                case isASSet(member):
+                                        if !seen[member] {
+                                                seen[member] = true
+                                                next = append(next, member)
+                                        }
+                                case strings.HasPrefix(member, "AS"):
+                                        if n := normalizeASN(member); n != "" && strings.Trim(n, "0123456789") == "" {
+                                                asns[n] = true
+                                        }
+                                }
+                        }
+                }
+                level = next
+        }
+
+        out := make([]string, 0, len(asns))
+        for as := range asns {
+                out = append(out, as)
+        }
+        sort.Strings(out)
+        return out, nil
+}
+
+// expandASSets раскрывает AS-SET выбранных ASN-списков до сборки
+func expandASSets() {
+        asSetASNs = make(map[string][]string)
+        for as, asConfig := range config.ASNumbers {
+                if !asListSelected(as, asConfig) {
+                        continue
+                }
+                for _, set := range listASSets(as, asConfig) {
+                        if _, ok := asSetASNs[set]; ok {
+                                continue
+                        }
+                        asns, err := expandASSet(set)
+                        if err != nil {
+                                log.Printf("Error expanding AS-SET %v", err)
+                                continue
+                        }
+                        log.Printf("AS-SET %s: %d ASNs", set, len(asns))
+                        asSetASNs[set] = asns
+                }
+        }
+}
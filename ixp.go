@@ -0,0 +1,118 @@
+package main
+
+import (
+        "bufio"
+        "encoding/json"
+        "fmt"
+        "log"
+        "net/netip"
+        "strings"
+
+        "go4.org/netipx"
+)
+
+// IXPConfig исключение пиринговых сетей точек обмена трафиком из ASN-списков
+type IXPConfig struct {
+        Exclude       bool     `yaml:"exclude"`
+        URLs          []string `yaml:"urls"`  // PeeringDB ixpfx JSON или текст с префиксами
+        Extra         []string `yaml:"extra"` // Дополнительные префиксы вручную
+        SourceOptions `yaml:",inline"`
+}
+
+var defaultIXPURLs = []string{"https://www.peeringdb.com/api/ixpfx"}
+
+// ixpSet загружается один раз за запуск, если включено исключение
+var ixpSet *netipx.IPSet
+
+type peeringDBPrefixes struct {
+        Data []struct {
+                Prefix string `json:"prefix"`
+        } `json:"data"`
+}
+
+func parseIXPPrefixes(data string, builder *netipx.IPSetBuilder) error {
+        if strings.HasPrefix(strings.TrimSpace(data), "{") {
+                var resp peeringDBPrefixes
+                if err := json.Unmarshal([]byte(data), &resp); err != nil {
+                        return err
+                }
+                for _, item := range resp.Data {
+                        if prefix, err := netip.ParsePrefix(item.Prefix); err == nil {
+                                builder.AddPrefix(prefix.Masked())
+                        }
+                }
+                return nil
+        }
+
+        scanner := bufio.NewScanner(strings.NewReader(data))
+        for scanner.Scan() {
+                fields := strings.Fields(scanner.Text())
+                if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+                        continue
+                }
+                if prefix, err := netip.ParsePrefix(fields[0]); err == nil {
+                        builder.AddPrefix(prefix.Masked())
+                }
+        }
+        return scanner.Err()
+}
+
+func loadIXPPrefixes() (*netipx.IPSet, error) {
+        urls := config.IXP.URLs
+        if len(urls) == 0 {
+                urls = defaultIXPURLs
+        }
+
+        var builder netipx.IPSetBuilder
+        for _, url := range urls {
+                data, err := downloadCached(url, config.IXP.SourceOptions)
+                if err != nil {
+                        return nil, fmt.Errorf("%s: %w", url, err)
+                }
+                if err := parseIXPPrefixes(data, &builder); err != nil {
+                        return nil, fmt.Errorf("%s: %w", url, err)
+                }
+        }
+        for _, extra := range config.IXP.Extra {
+                prefix, err := netip.ParsePrefix(extra)
+                if err != nil {
+                        return nil, err
+                }
+                builder.AddPrefix(prefix.Masked())
+        }
+
+        return builder.IPSet()
+}
+
+func initIXPExclusion() {
+        if !config.IXP.Exclude {
+                return
+        }
+
+        set, err := loadIXPPrefixes()
+        if err != nil {
+                // Без данных об IXP списки всё равно нужны, просто без исключения
+                log.Printf("Error loading IXP prefixes: %v", err)
+                return
+        }
+        ixpSet = set
+}
+
+// excludeIXP убирает пиринговые сети IXP из префиксов ASN-списка
+func excludeIXP(prefixes []netip.Prefix) []netip.Prefix {
+        if ixpSet == nil {
+                return prefixes
+        }
+
+        var builder netipx.IPSetBuilder
+        for _, prefix := range prefixes {
+                builder.AddPrefix(prefix)
+        }
+        builder.RemoveSet(ixpSet)
+
+        set, err := builder.IPSet()
+        if err != nil {
+                return prefixes
+        }
+        return set.Prefixes()
+}
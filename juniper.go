@@ -0,0 +1,23 @@
+package main
+
+import (
+        "fmt"
+)
+
+// Команды Junos для `load set`: prefix-list на каждый список, IPv4 и IPv6 вместе
+
+func juniperCommands(list *generatedList) []string {
+        name := identifierName(list.ListName)
+        commands := make([]string, 0, len(list.Prefixes))
+        for _, prefix := range list.Prefixes {
+                commands = append(commands, fmt.Sprintf("set policy-options prefix-list %s %s", name, prefix))
+        }
+        return commands
+}
+
+func generateJuniperPrefixList(list *generatedList) error {
+        if len(list.Prefixes) == 0 {
+                return nil
+        }
+        return writeOutputLines(layoutDir("juniper", list.Name, config.Juniper.Dir), list.Name+".set", juniperCommands(list))
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+        "fmt"
+        "strings"
+)
+
+// KeeneticConfig команды статических маршрутов для CLI Keenetic
+type KeeneticConfig struct {
+        OutputConfig `yaml:",inline"`
+        Interface    string             `yaml:"interface"` // Например Wireguard0
+        Gateway      string             `yaml:"gateway"`   // Необязателен, маршрут может идти через интерфейс
+        Push         KeeneticPushConfig `yaml:"push"`
+}
+
+func keeneticRoutes(list *generatedList) []string {
+        target := config.Keenetic.Interface
+        if config.Keenetic.Gateway != "" {
+                target = strings.TrimSpace(config.Keenetic.Gateway + " " + target)
+        }
+
+        routes := make([]string, 0, len(list.Prefixes))
+        for _, prefix := range list.Prefixes {
+                if prefix.Addr().Is4() {
+                        routes = append(routes, fmt.Sprintf("ip route %s %s auto", prefix, target))
+                } else {
+                        routes = append(routes, fmt.Sprintf("ipv6 route %s %s auto", prefix, target))
+                }
+        }
+        return routes
+}
+
+func generateKeeneticRoutes(list *generatedList) error {
+        if len(list.Prefixes) == 0 {
+                return nil
+        }
+        if config.Keenetic.Interface == "" && config.Keenetic.Gateway == "" {
+                return fmt.Errorf("keenetic.interface or keenetic.gateway is required")
+        }
+        return writeOutputLines(layoutDir("keenetic", list.Name, config.Keenetic.Dir), list.Name+".txt", keeneticRoutes(list))
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+        "bytes"
+        "crypto/md5"
+        "crypto/sha256"
+        "encoding/hex"
+        "encoding/json"
+        "fmt"
+        "io"
+        "log"
+        "net"
+        "net/http"
+        "net/http/cookiejar"
+        "net/netip"
+        "strings"
+)
+
+// KeeneticPushConfig установка маршрутов прямо на роутер через RCI (веб-API Keenetic)
+type KeeneticPushConfig struct {
+        Enabled  bool   `yaml:"enabled"`
+        Address  string `yaml:"address"` // Например http://192.168.1.1
+        Login    string `yaml:"login"`
+        Password string `yaml:"password"`
+}
+
+type keeneticClient struct {
+        base   string
+        client *http.Client
+}
+
+// keeneticRoute маршрут в представлении RCI (/rci/ip/route)
+type keeneticRoute struct {
+        Network   string `json:"network,omitempty"`
+        Host      string `json:"host,omitempty"`
+        Mask      string `json:"mask,omitempty"`
+        Interface string `json:"interface,omitempty"`
+        Gateway   string `json:"gateway,omitempty"`
+        Auto      bool   `json:"auto,omitempty"`
+        Comment   string `json:"comment,omitempty"`
+        No        bool   `json:"no,omitempty"`
+}
+
+func (r keeneticRoute) prefix() (netip.Prefix, bool) {
+        if r.Host != "" {
+                addr, err := netip.ParseAddr(r.Host)
+                if err != nil {
+                        return netip.Prefix{}, false
+                }
+                return netip.PrefixFrom(addr, 32), true
+        }
+        addr, err := netip.ParseAddr(r.Network)
+        mask := net.ParseIP(r.Mask).To4()
+        if err != nil || mask == nil {
+                return netip.Prefix{}, false
+        }
+        bits, _ := net.IPMask(mask).Size()
+        return netip.PrefixFrom(addr, bits), true
+}
+
+func keeneticRouteFor(prefix netip.Prefix, comment string) keeneticRoute {
+        mask := net.CIDRMask(prefix.Bits(), 32)
+        return keeneticRoute{
+                Network:   prefix.Masked().Addr().String(),
+                Mask:      net.IP(mask).String(),
+                Interface: config.Keenetic.Interface,
+                Gateway:   config.Keenetic.Gateway,
+                Auto:      true,
+                Comment:   comment,
+        }
+}
+
+func newKeeneticClient(address string) (*keeneticClient, error) {
+        jar, err := cookiejar.New(nil)
+        if err != nil {
+                return nil, err
+        }
+        return &keeneticClient{
+                base:   strings.TrimSuffix(address, "/"),
+                client: &http.Client{Transport: httpClient.Transport, Jar: jar},
+        }, nil
+}
+
+func md5Hex(s string) string {
+        sum := md5.Sum([]byte(s))
+        return hex.EncodeToString(sum[:])
+}
+
+func sha256Hex(s string) string {
+        sum := sha256.Sum256([]byte(s))
+        return hex.EncodeToString(sum[:])
+}
+
+// login проходит challenge-авторизацию RCI: sha256(challenge + md5(login:realm:password))
+func (k *keeneticClient) login(login, password string) error {
+        resp, err := k.client.Get(k.base + "/auth")
+        if err != nil {
+                return err
+        }
+        io.Copy(io.Discard, resp.Body)
+        resp.Body.Close()
+        if resp.StatusCode == http.StatusOK {
+                return nil
+        }
+        if resp.StatusCode != http.StatusUnauthorized {
+                return fmt.Errorf("auth: unexpected status %s", resp.Status)
+        }
+
+        realm := resp.Header.Get("X-NDM-Realm")
+        challenge := resp.Header.Get("X-NDM-Challenge")
+        body, _ := json.Marshal(map[string]string{
+                "login":    login,
+                "password": sha256Hex(challenge + md5Hex(login+":"+realm+":"+password)),
+        })
+
+        resp, err = k.client.Post(k.base+"/auth", "application/json", bytes.NewReader(body))
+        if err != nil {
+                return err
+        }
+        io.Copy(io.Discard, resp.Body)
+        resp.Body.Close()
+        if resp.StatusCode != http.StatusOK {
+                return fmt.Errorf("auth failed: %s", resp.Status)
+        }
+        return nil
+}
+
+func (k *keeneticClient) do(method, path string, payload, out any) error {
+        var body io.Reader
+        if payload != nil {
+                data, err := json.Marshal(payload)
+                if err != nil {
+                        return err
+                }
+                body = bytes.NewReader(data)
+        }
+
+        req, err := http.NewRequest(method, k.base+path, body)
+        if err != nil {
+                return err
+        }
+        req.Header.Set("Content-Type", "application/json")
+
+        resp, err := k.client.Do(req)
+        if err != nil {
+                return err
+        }
+        defer resp.Body.Close()
+
+        if resp.StatusCode != http.StatusOK {
+                io.Copy(io.Discard, resp.Body)
+                return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+        }
+        if out == nil {
+                io.Copy(io.Discard, resp.Body)
+                return nil
+        }
+        return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// keeneticDiff команды RCI, приводящие маршруты списка к желаемым. Чужие
+// маршруты (с другим комментарием) не трогаются.
+func keeneticDiff(current []keeneticRoute, list *generatedList) []any {
+        desired := make(map[netip.Prefix]bool)
+        for _, prefix := range list.Prefixes {
+                if prefix.Addr().Is4() {
+                        desired[prefix.Masked()] = true
+                }
+        }
+
+        present := make(map[netip.Prefix]bool)
+        var commands []any
+        for _, route := range current {
+                if route.Comment != list.ListName {
+                        continue
+                }
+                prefix, ok := route.prefix()
+                if !ok {
+                        continue
+                }
+                if desired[prefix] {
+                        present[prefix] = true
+                        continue
+                }
+                route.No = true
+                commands = append(commands, map[string]any{"ip": map[string]any{"route": route}})
+        }
+
+        for _, prefix := range list.Prefixes {
+                if !prefix.Addr().Is4() || present[prefix.Masked()] {
+                        continue
+                }
+                route := keeneticRouteFor(prefix, list.ListName)
+                commands = append(commands, map[string]any{"ip": map[string]any{"route": route}})
+        }
+        return commands
+}
+
+func pushKeenetic(lists []*generatedList) error {
+        lists = listsForFormat("keenetic", lists)
+        push := config.Keenetic.Push
+        client, err := newKeeneticClient(push.Address)
+        if err != nil {
+                return err
+        }
+        if err := client.login(push.Login, push.Password); err != nil {
+                return err
+        }
+
+        var current []keeneticRoute
+        if err := client.do(http.MethodGet, "/rci/ip/route", nil, &current); err != nil {
+                return err
+        }
+
+        var commands []any
+        for _, list := range lists {
+                diff := keeneticDiff(current, list)
+                if len(diff) > 0 {
+                        log.Printf("Keenetic: %d route changes for %s", len(diff), list.ListName)
+                }
+                commands = append(commands, diff...)
+        }
+        if len(commands) == 0 {
+                log.Println("Keenetic: routes are up to date")
+                return nil
+        }
+
+        commands = append(commands, map[string]any{"system": map[string]any{"configuration": map[string]any{"save": map[string]any{}}}})
+        return client.do(http.MethodPost, "/rci/", commands, nil)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+        "net/url"
+        "path"
+        "path/filepath"
+        "strings"
+)
+
+// LayoutRule переносит файлы части списков в другой каталог публикации,
+// чтобы повторить структуру репозитория, с которого переезжают
+// (Subnets/IPv4, Russia/, Categories/ и т.п.)
+type LayoutRule struct {
+        Lists   []string `yaml:"lists"`   // Шаблоны имён файлов списков без .lst (path.Match); пусто - все
+        Formats []string `yaml:"formats"` // Имена секций форматов: ipv4, routeros, dnsmasq, singbox...; пусто - все
+        Dir     string   `yaml:"dir"`     // Каталог; {dir} заменяется на каталог формата по умолчанию
+}
+
+func layoutMatches(patterns []string, value string) bool {
+        if len(patterns) == 0 {
+                return true
+        }
+        for _, pattern := range patterns {
+                if ok, _ := path.Match(pattern, value); ok {
+                        return true
+                }
+        }
+        return false
+}
+
+// layoutDir каталог для файлов списка name в формате format по первому
+// подходящему правилу layout; без правил возвращает dir
+func layoutDir(format, name, dir string) string {
+        name = strings.TrimSuffix(name, ".lst")
+        for _, rule := range config.Layout {
+                if layoutMatches(rule.Formats, format) && layoutMatches(rule.Lists, name) {
+                        return filepath.Clean(strings.ReplaceAll(rule.Dir, "{dir}", dir))
+                }
+        }
+        return dir
+}
+
+// layoutRelPath путь файла относительно каталога формата для ссылок в
+// индексах и URL; со слешами в любой ОС
+func layoutRelPath(format, name, dir, file string) string {
+        rel, err := filepath.Rel(dir, filepath.Join(layoutDir(format, name, dir), file))
+        if err != nil {
+                return file
+        }
+        return filepath.ToSlash(rel)
+}
+
+// ipv4ListPath путь .lst с подсетями списка
+func ipv4ListPath(file string) string {
+        return filepath.Join(layoutDir("ipv4", file, config.IPv4Dir), file)
+}
+
+// layoutDirs каталоги, куда правила могут положить файлы формата, вместе с каталогом по умолчанию
+func layoutDirs(format, dir string) []string {
+        dirs := []string{dir}
+        for _, rule := range config.Layout {
+                if layoutMatches(rule.Formats, format) {
+                        dirs = append(dirs, filepath.Clean(strings.ReplaceAll(rule.Dir, "{dir}", dir)))
+                }
+        }
+        return dirs
+}
+
+// layoutURL URL файла, опубликованного вместе с каталогом формата по адресу base
+func layoutURL(base, format, name, dir, file string) string {
+        rel := layoutRelPath(format, name, dir, file)
+        if u, err := url.JoinPath(base, rel); err == nil {
+                return u
+        }
+        return strings.TrimSuffix(base, "/") + "/" + rel
+}
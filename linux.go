@@ -0,0 +1,81 @@
+package main
+
+import (
+        "fmt"
+        "os"
+        "path/filepath"
+        "strings"
+)
+
+// LinuxRouteConfig shell-скрипт с ip route replace в отдельной таблице и
+// правилом ip rule для шлюзов на обычном Linux
+type LinuxRouteConfig struct {
+        OutputConfig `yaml:",inline"`
+        Gateway      string `yaml:"gateway"`    // По умолчанию общий gateway, если не задан device
+        GatewayV6    string `yaml:"gateway_v6"` // Без него (и без device) IPv6-маршруты не пишутся
+        Device       string `yaml:"device"`     // Интерфейс туннеля, например wg0
+        Table        int    `yaml:"table"`      // Таблица маршрутов списка
+        Priority     int    `yaml:"priority"`   // pref правила ip rule
+        From         string `yaml:"from"`       // Только для трафика из этой сети; пусто - для всего
+}
+
+func linuxRouteTarget(via string) string {
+        var parts []string
+        if via != "" {
+                parts = append(parts, "via "+via)
+        }
+        if config.Linux.Device != "" {
+                parts = append(parts, "dev "+config.Linux.Device)
+        }
+        return strings.Join(parts, " ")
+}
+
+func linuxRouteScript(list *generatedList) string {
+        var v4, v6 []string
+        for _, prefix := range list.Prefixes {
+                if prefix.Addr().Is4() {
+                        v4 = append(v4, fmt.Sprintf("route replace %s %s table %d", prefix, linuxRouteTarget(config.Linux.Gateway), config.Linux.Table))
+                } else if config.Linux.GatewayV6 != "" || config.Linux.Device != "" {
+                        v6 = append(v6, fmt.Sprintf("route replace %s %s table %d", prefix, linuxRouteTarget(config.Linux.GatewayV6), config.Linux.Table))
+                }
+        }
+        if len(v4) == 0 && len(v6) == 0 {
+                return ""
+        }
+
+        selector := ""
+        if config.Linux.From != "" {
+                selector = " from " + config.Linux.From
+        }
+
+        var b strings.Builder
+        fmt.Fprintf(&b, "#!/bin/sh\n# %s\n# Повторный запуск безопасен: маршруты заменяются, правило добавляется один раз\n", list.Comment)
+        for _, family := range []struct {
+                flag   string
+                routes []string
+        }{{"-4", v4}, {"-6", v6}} {
+                if len(family.routes) == 0 {
+                        continue
+                }
+                fmt.Fprintf(&b, "\nip %[1]s rule show pref %[2]d | grep -q . || ip %[1]s rule add pref %[2]d%[3]s table %[4]d\n",
+                        family.flag, config.Linux.Priority, selector, config.Linux.Table)
+                fmt.Fprintf(&b, "ip %s -force -batch - <<'EOF'\n%s\nEOF\n", family.flag, strings.Join(family.routes, "\n"))
+        }
+        return b.String()
+}
+
+func generateLinuxRouteScript(list *generatedList) error {
+        script := linuxRouteScript(list)
+        if script == "" {
+                return nil
+        }
+        dir := layoutDir("linux", list.Name, config.Linux.Dir)
+        if err := os.MkdirAll(dir, 0755); err != nil {
+                return err
+        }
+        path := filepath.Join(dir, list.Name+".sh")
+        if err := writeFileStaged(path, []byte(script)); err != nil {
+                return err
+        }
+        return os.Chmod(path, 0755)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+        "encoding/json"
+        "os"
+        "path/filepath"
+        "sort"
+        "time"
+)
+
+// listJSONSchemaVersion меняется при несовместимых изменениях формата
+const listJSONSchemaVersion = 1
+
+// listJSONCounts число записей по типам, чтобы не считать их на клиенте
+type listJSONCounts struct {
+        IPv4    int `json:"ipv4"`
+        IPv6    int `json:"ipv6"`
+        Domains int `json:"domains"`
+}
+
+// listJSON список целиком с метаданными для автоматизации: не нужно
+// разбирать текстовые форматы
+type listJSON struct {
+        SchemaVersion int            `json:"schema_version"`
+        Name          string         `json:"name"`
+        ListName      string         `json:"list_name"`
+        Comment       string         `json:"comment"`
+        Generated     string         `json:"generated"`
+        Sources       []string       `json:"sources"`
+        ASNs          []string       `json:"asns"`
+        Counts        listJSONCounts `json:"counts"`
+        Prefixes      []string       `json:"prefixes"`
+        Domains       []string       `json:"domains"`
+}
+
+func uniqueSorted(values []string) []string {
+        out := []string{}
+        seen := make(map[string]bool, len(values))
+        for _, value := range values {
+                if value != "" && !seen[value] {
+                        seen[value] = true
+                        out = append(out, value)
+                }
+        }
+        sort.Strings(out)
+        return out
+}
+
+func listJSONFor(list *generatedList) listJSON {
+        doc := listJSON{
+                SchemaVersion: listJSONSchemaVersion,
+                Name:          list.Name,
+                ListName:      list.ListName,
+                Comment:       list.Comment,
+                Generated:     time.Now().UTC().Format(time.RFC3339),
+                Sources:       uniqueSorted(list.Sources),
+                ASNs:          uniqueSorted(list.ASNs),
+                Prefixes:      []string{},
+                Domains:       []string{},
+        }
+        for _, prefix := range list.Prefixes {
+                if prefix.Addr().Is4() {
+                        doc.Counts.IPv4++
+                } else {
+                        doc.Counts.IPv6++
+                }
+                doc.Prefixes = append(doc.Prefixes, prefix.String())
+        }
+        for _, domain := range list.Domains {
+                doc.Domains = append(doc.Domains, trimDomainDot(domain))
+        }
+        doc.Counts.Domains = len(doc.Domains)
+        return doc
+}
+
+func generateListJSON(list *generatedList) error {
+        data, err := json.MarshalIndent(listJSONFor(list), "", "    ")
+        if err != nil {
+                return err
+        }
+
+        dir := layoutDir("json", list.Name, config.JSON.Dir)
+        if err := os.MkdirAll(dir, 0755); err != nil {
+                return err
+        }
+        return writeFileStaged(filepath.Join(dir, list.Name+".json"), append(data, '\n'))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+        "fmt"
+        "log"
+        "os"
+        "path/filepath"
+        "strings"
+)
+
+// merlinVPNDirectorLimit предел правил VPN Director в прошивке
+const merlinVPNDirectorLimit = 199
+
+// MerlinConfig правила VPN Director для ASUSWRT-Merlin и скрипт ipset в
+// формате, который подхватывает x3mRouting
+type MerlinConfig struct {
+        OutputConfig `yaml:",inline"`
+        Interface    string `yaml:"interface"` // Клиент VPN в VPN Director: OVPN1..OVPN5, WGC1..WGC5
+        LocalIP      string `yaml:"local_ip"`  // Источник в правиле; пусто - все устройства
+        IPSetDir     string `yaml:"ipset_dir"` // Куда x3mRouting сохраняет ipset
+}
+
+// merlinVPNDirectorRules строка vpndirector_rulelist: <1>описание>источник>назначение>интерфейс
+func merlinVPNDirectorRules(list *generatedList) string {
+        var b strings.Builder
+        desc := strings.NewReplacer("<", "", ">", "").Replace(identifierName(list.ListName))
+        for _, prefix := range list.Prefixes {
+                if prefix.Addr().Is4() {
+                        fmt.Fprintf(&b, "<1>%s>%s>%s>%s", desc, config.Merlin.LocalIP, prefix, config.Merlin.Interface)
+                }
+        }
+        return b.String()
+}
+
+func merlinIPSetScript(list *generatedList) string {
+        name := identifierName(list.ListName)
+        saved := config.Merlin.IPSetDir + "/" + name
+        var b strings.Builder
+        fmt.Fprintf(&b, "#!/bin/sh\n# %s\n# Наполняет ipset %s и сохраняет его в %s для x3mRouting\n", list.Comment, name, saved)
+        fmt.Fprintf(&b, "ipset create %[1]s hash:net family inet -exist\nipset flush %[1]s\nipset restore -! <<'EOF'\n", name)
+        for _, prefix := range list.Prefixes {
+                if prefix.Addr().Is4() {
+                        fmt.Fprintf(&b, "add %s %s\n", name, prefix)
+                }
+        }
+        fmt.Fprintf(&b, "EOF\nmkdir -p %s\nipset save %s > %s\n", config.Merlin.IPSetDir, name, saved)
+        return b.String()
+}
+
+func generateMerlinRules(list *generatedList) error {
+        rules := merlinVPNDirectorRules(list)
+        if rules == "" {
+                return nil
+        }
+        if count := strings.Count(rules, "<1>"); count > merlinVPNDirectorLimit {
+                log.Printf("Warning: %s has %d VPN Director rules, firmware accepts %d; use the x3mRouting ipset script", list.Name, count, merlinVPNDirectorLimit)
+        }
+
+        dir := layoutDir("merlin", list.Name, config.Merlin.Dir)
+        if err := writeOutputLines(dir, list.Name+".vpndirector", []string{rules}); err != nil {
+                return err
+        }
+        path := filepath.Join(dir, list.Name+"-ipset.sh")
+        if err := writeFileStaged(path, []byte(merlinIPSetScript(list))); err != nil {
+                return err
+        }
+        return os.Chmod(path, 0755)
+}
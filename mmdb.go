@@ -0,0 +1,299 @@
+package main
+
+import (
+        "bytes"
+        "encoding/binary"
+        "fmt"
+        "os"
+        "path/filepath"
+        "sort"
+        "strings"
+        "time"
+)
+
+// MMDBConfig настройки вывода базы MaxMind DB со всеми списками
+type MMDBConfig struct {
+        Enabled bool   `yaml:"enabled"`
+        File    string `yaml:"file"`
+        // Формат записей: "maxmind" (country.iso_code + lists) или
+        // "sing-geoip" (строка с именем списка)
+        DatabaseType string `yaml:"database_type"`
+}
+
+// mmdbNode узел префиксного дерева; данные хранятся только в листьях после pushDown
+type mmdbNode struct {
+        children [2]*mmdbNode
+        labels   []string
+        index    int
+}
+
+func (n *mmdbNode) insert(addr [16]byte, bits int, label string) {
+        node := n
+        for i := 0; i < bits; i++ {
+                bit := (addr[i/8] >> (7 - uint(i%8))) & 1
+                if node.children[bit] == nil {
+                        node.children[bit] = &mmdbNode{}
+                }
+                node = node.children[bit]
+        }
+        node.labels = append(node.labels, label)
+}
+
+func mergeLabels(a, b []string) []string {
+        seen := make(map[string]bool, len(a)+len(b))
+        var out []string
+        for _, label := range append(append([]string{}, a...), b...) {
+                if !seen[label] {
+                        seen[label] = true
+                        out = append(out, label)
+                }
+        }
+        sort.Strings(out)
+        return out
+}
+
+// pushDown переносит метки вниз до листьев, чтобы более специфичные префиксы
+// получали объединение своих меток и меток покрывающих префиксов
+func (n *mmdbNode) pushDown(inherited []string) {
+        labels := mergeLabels(inherited, n.labels)
+        if n.children[0] == nil && n.children[1] == nil {
+                n.labels = labels
+                return
+        }
+        n.labels = nil
+        for i := range n.children {
+                if n.children[i] == nil {
+                        n.children[i] = &mmdbNode{}
+                }
+                n.children[i].pushDown(labels)
+        }
+}
+
+func (n *mmdbNode) isLeaf() bool {
+        return n.children[0] == nil && n.children[1] == nil
+}
+
+// mmdbEncoder пишет значения в формате секции данных MaxMind DB
+type mmdbEncoder struct {
+        buf bytes.Buffer
+}
+
+const (
+        mmdbTypeString = 2
+        mmdbTypeUint16 = 5
+        mmdbTypeUint32 = 6
+        mmdbTypeMap    = 7
+        mmdbTypeUint64 = 9
+        mmdbTypeArray  = 11
+)
+
+func (e *mmdbEncoder) control(typ int, size int) {
+        var sizeBits byte
+        var extra []byte
+        switch {
+        case size < 29:
+                sizeBits = byte(size)
+        case size < 29+256:
+                sizeBits = 29
+                extra = []byte{byte(size - 29)}
+        case size < 285+65536:
+                sizeBits = 30
+                s := size - 285
+                extra = []byte{byte(s >> 8), byte(s)}
+        default:
+                sizeBits = 31
+                s := size - 65821
+                extra = []byte{byte(s >> 16), byte(s >> 8), byte(s)}
+        }
+
+        if typ <= 7 {
+                e.buf.WriteByte(byte(typ)<<5 | sizeBits)
+        } else {
+                e.buf.WriteByte(sizeBits)
+                e.buf.WriteByte(byte(typ - 7))
+        }
+        e.buf.Write(extra)
+}
+
+func (e *mmdbEncoder) string(s string) {
+        e.control(mmdbTypeString, len(s))
+        e.buf.WriteString(s)
+}
+
+func (e *mmdbEncoder) uint(typ int, v uint64) {
+        var raw [8]byte
+        binary.BigEndian.PutUint64(raw[:], v)
+        trimmed := bytes.TrimLeft(raw[:], "\x00")
+        e.control(typ, len(trimmed))
+        e.buf.Write(trimmed)
+}
+
+func (e *mmdbEncoder) stringArray(values []string) {
+        e.control(mmdbTypeArray, len(values))
+        for _, v := range values {
+                e.string(v)
+        }
+}
+
+func (e *mmdbEncoder) record(labels []string) {
+        if config.MMDB.DatabaseType == "sing-geoip" {
+                e.string(labels[0])
+                return
+        }
+        // {"country": {"iso_code": ...}, "lists": [...]}
+        e.control(mmdbTypeMap, 2)
+        e.string("country")
+        e.control(mmdbTypeMap, 1)
+        e.string("iso_code")
+        e.string(labels[0])
+        e.string("lists")
+        e.stringArray(labels)
+}
+
+func encodeMMDB(lists []*generatedList, buildTime time.Time) ([]byte, error) {
+        root := &mmdbNode{}
+        for _, list := range lists {
+                label := strings.ToLower(list.Name)
+                for _, prefix := range list.Prefixes {
+                        prefix = prefix.Masked()
+                        bits := prefix.Bits()
+                        var addr [16]byte
+                        if prefix.Addr().Is4() {
+                                // IPv4 в дереве IPv6 живёт под ::/96
+                                v4 := prefix.Addr().As4()
+                                copy(addr[12:], v4[:])
+                                bits += 96
+                        } else {
+                                addr = prefix.Addr().As16()
+                        }
+                        root.insert(addr, bits, label)
+                }
+        }
+        if root.isLeaf() {
+                root.children = [2]*mmdbNode{{}, {}}
+        }
+        root.pushDown(nil)
+
+        // Нумеруем внутренние узлы в порядке обхода в ширину
+        var nodes []*mmdbNode
+        queue := []*mmdbNode{root}
+        for len(queue) > 0 {
+                node := queue[0]
+                queue = queue[1:]
+                node.index = len(nodes)
+                nodes = append(nodes, node)
+                for _, child := range node.children {
+                        if !child.isLeaf() {
+                                queue = append(queue, child)
+                        }
+                }
+        }
+        nodeCount := len(nodes)
+
+        // Секция данных с дедупликацией одинаковых наборов меток
+        var data mmdbEncoder
+        offsets := make(map[string]int)
+        recordValue := func(child *mmdbNode) uint64 {
+                if !child.isLeaf() {
+                        return uint64(child.index)
+                }
+                if len(child.labels) == 0 {
+                        return uint64(nodeCount)
+                }
+                key := strings.Join(child.labels, "\x00")
+                offset, ok := offsets[key]
+                if !ok {
+                        offset = data.buf.Len()
+                        offsets[key] = offset
+                        data.record(child.labels)
+                }
+                return uint64(nodeCount + 16 + offset)
+        }
+
+        records := make([][2]uint64, nodeCount)
+        var maxRecord uint64
+        for i, node := range nodes {
+                for side, child := range node.children {
+                        records[i][side] = recordValue(child)
+                        if records[i][side] > maxRecord {
+                                maxRecord = records[i][side]
+                        }
+                }
+        }
+
+        if maxRecord > 0xFFFFFFFF {
+                return nil, fmt.Errorf("database too large")
+        }
+        recordSize := 24
+        switch {
+        case maxRecord >= 1<<28:
+                recordSize = 32
+        case maxRecord >= 1<<24:
+                recordSize = 28
+        }
+
+        var out bytes.Buffer
+        for _, rec := range records {
+                left, right := rec[0], rec[1]
+                switch recordSize {
+                case 24:
+                        out.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left),
+                                byte(right >> 16), byte(right >> 8), byte(right)})
+                case 28:
+                        out.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left),
+                                byte((left>>24)&0x0F)<<4 | byte((right>>24)&0x0F),
+                                byte(right >> 16), byte(right >> 8), byte(right)})
+                case 32:
+                        var raw [8]byte
+                        binary.BigEndian.PutUint32(raw[:4], uint32(left))
+                        binary.BigEndian.PutUint32(raw[4:], uint32(right))
+                        out.Write(raw[:])
+                }
+        }
+        out.Write(make([]byte, 16))
+        out.Write(data.buf.Bytes())
+
+        databaseType := config.MMDB.DatabaseType
+        if databaseType == "maxmind" {
+                databaseType = "allow-domains"
+        }
+
+        var meta mmdbEncoder
+        meta.control(mmdbTypeMap, 9)
+        meta.string("binary_format_major_version")
+        meta.uint(mmdbTypeUint16, 2)
+        meta.string("binary_format_minor_version")
+        meta.uint(mmdbTypeUint16, 0)
+        meta.string("build_epoch")
+        meta.uint(mmdbTypeUint64, uint64(buildTime.Unix()))
+        meta.string("database_type")
+        meta.string(databaseType)
+        meta.string("description")
+        meta.control(mmdbTypeMap, 1)
+        meta.string("en")
+        meta.string("allow-domains prefix lists")
+        meta.string("ip_version")
+        meta.uint(mmdbTypeUint16, 6)
+        meta.string("languages")
+        meta.stringArray([]string{"en"})
+        meta.string("node_count")
+        meta.uint(mmdbTypeUint32, uint64(nodeCount))
+        meta.string("record_size")
+        meta.uint(mmdbTypeUint16, uint64(recordSize))
+
+        out.WriteString("\xAB\xCD\xEFMaxMind.com")
+        out.Write(meta.buf.Bytes())
+
+        return out.Bytes(), nil
+}
+
+func generateMMDB(lists []*generatedList) error {
+        data, err := encodeMMDB(lists, time.Now())
+        if err != nil {
+                return err
+        }
+        if err := os.MkdirAll(filepath.Dir(config.MMDB.File), 0755); err != nil {
+                return err
+        }
+        return writeFileStaged(config.MMDB.File, data)
+}
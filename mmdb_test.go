@@ -0,0 +1,157 @@
+package main
+
+import (
+        "bytes"
+        "net/netip"
+        "reflect"
+        "testing"
+        "time"
+)
+
+// decodeMMDBValue минимальный декодер секции данных: только типы, которые пишет mmdbEncoder
+func decodeMMDBValue(t *testing.T, data []byte, off int) (any, int) {
+        t.Helper()
+        ctrl := data[off]
+        off++
+        typ := int(ctrl >> 5)
+        if typ == 0 {
+                typ = 7 + int(data[off])
+                off++
+        }
+        size := int(ctrl & 0x1f)
+        switch size {
+        case 29:
+                size = 29 + int(data[off])
+                off++
+        case 30:
+                size = 285 + (int(data[off])<<8 | int(data[off+1]))
+                off += 2
+        case 31:
+                size = 65821 + (int(data[off])<<16 | int(data[off+1])<<8 | int(data[off+2]))
+                off += 3
+        }
+        switch typ {
+        case mmdbTypeString:
+                return string(data[off : off+size]), off + size
+        case mmdbTypeUint16, mmdbTypeUint32, mmdbTypeUint64:
+                var v uint64
+                for _, b := range data[off : off+size] {
+                        v = v<<8 | uint64(b)
+                }
+                return v, off + size
+        case mmdbTypeMap:
+                m := make(map[string]any, size)
+                for i := 0; i < size; i++ {
+                        var key, value any
+                        key, off = decodeMMDBValue(t, data, off)
+                        value, off = decodeMMDBValue(t, data, off)
+                        m[key.(string)] = value
+                }
+                return m, off
+        case mmdbTypeArray:
+                values := make([]any, size)
+                for i := range values {
+                        values[i], off = decodeMMDBValue(t, data, off)
+                }
+                return values, off
+        }
+        t.Fatalf("unexpected type %d at %d", typ, off)
+        return nil, off
+}
+
+// lookupMMDB запись для addr или nil, если адреса нет в базе
+func lookupMMDB(t *testing.T, db []byte, addr netip.Addr) any {
+        t.Helper()
+        marker := []byte("\xAB\xCD\xEFMaxMind.com")
+        start := bytes.LastIndex(db, marker)
+        if start < 0 {
+                t.Fatal("no metadata marker")
+        }
+        meta, _ := decodeMMDBValue(t, db, start+len(marker))
+        nodeCount := int(meta.(map[string]any)["node_count"].(uint64))
+        if size := meta.(map[string]any)["record_size"].(uint64); size != 24 {
+                t.Fatalf("record_size = %d, test reader supports 24", size)
+        }
+
+        ip := addr.As16()
+        if addr.Is4() {
+                ip = [16]byte{}
+                v4 := addr.As4()
+                copy(ip[12:], v4[:])
+        }
+        node := 0
+        for i := 0; i < 128 && node < nodeCount; i++ {
+                bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+                rec := db[node*6+bit*3 : node*6+bit*3+3]
+                node = int(rec[0])<<16 | int(rec[1])<<8 | int(rec[2])
+        }
+        if node == nodeCount {
+                return nil
+        }
+        // Секция данных после дерева и 16 нулевых байт; ссылки на неё смещены на nodeCount+16
+        dataStart := nodeCount*6 + 16
+        value, _ := decodeMMDBValue(t, db, dataStart+node-nodeCount-16)
+        return value
+}
+
+func TestMMDBControl(t *testing.T) {
+        tests := []struct {
+                typ, size int
+                want      []byte
+        }{
+                {mmdbTypeString, 3, []byte{0x43}},
+                {mmdbTypeString, 29, []byte{0x5d, 0}},
+                {mmdbTypeString, 300, []byte{0x5e, 0, 15}},
+                {mmdbTypeArray, 2, []byte{0x02, 0x04}},
+                {mmdbTypeUint64, 8, []byte{0x08, 0x02}},
+        }
+        for _, tt := range tests {
+                var e mmdbEncoder
+                e.control(tt.typ, tt.size)
+                if !bytes.Equal(e.buf.Bytes(), tt.want) {
+                        t.Errorf("control(%d, %d) = %x, want %x", tt.typ, tt.size, e.buf.Bytes(), tt.want)
+                }
+        }
+}
+
+func TestEncodeMMDB(t *testing.T) {
+        saved := config.MMDB.DatabaseType
+        defer func() { config.MMDB.DatabaseType = saved }()
+
+        lists := []*generatedList{
+                {Name: "Wide", Prefixes: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}},
+                {Name: "narrow", Prefixes: []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}},
+        }
+        tests := []struct {
+                databaseType string
+                addr         string
+                want         any
+        }{
+                {"maxmind", "10.1.2.3", map[string]any{"country": map[string]any{"iso_code": "narrow"}, "lists": []any{"narrow", "wide"}}},
+                {"maxmind", "10.2.0.1", map[string]any{"country": map[string]any{"iso_code": "wide"}, "lists": []any{"wide"}}},
+                {"maxmind", "11.0.0.1", nil},
+                {"sing-geoip", "10.2.0.1", "wide"},
+        }
+        for _, tt := range tests {
+                t.Run(tt.databaseType+" "+tt.addr, func(t *testing.T) {
+                        config.MMDB.DatabaseType = tt.databaseType
+                        db, err := encodeMMDB(lists, time.Unix(0, 0))
+                        if err != nil {
+                                t.Fatal(err)
+                        }
+                        if got := lookupMMDB(t, db, netip.MustParseAddr(tt.addr)); !reflect.DeepEqual(got, tt.want) {
+                                t.Errorf("lookup = %v, want %v", got, tt.want)
+                        }
+                })
+        }
+}
+
+func TestEncodeMMDBEmpty(t *testing.T) {
+        db, err := encodeMMDB(nil, time.Unix(0, 0))
+        if err != nil {
+                t.Fatal(err)
+        }
+        if got := lookupMMDB(t, db, netip.MustParseAddr("10.0.0.1")); got != nil {
+                t.Errorf("lookup in empty database = %v", got)
+        }
+}
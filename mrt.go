@@ -0,0 +1,329 @@
+package main
+
+import (
+        "bufio"
+        "bytes"
+        "compress/bzip2"
+        "compress/gzip"
+        "encoding/binary"
+        "errors"
+        "fmt"
+        "io"
+        "log"
+        "net/netip"
+        "sort"
+        "strconv"
+        "strings"
+)
+
+// MRTConfig таблица origin ASN из MRT RIB-дампов коллекторов RouteViews или
+// RIPE RIS: запасной источник, когда bgp.tools недоступен, или сверка с ним
+type MRTConfig struct {
+        URLs          []string `yaml:"urls"` // Например https://data.ris.ripe.net/rrc00/latest-bview.gz
+        Mode          string   `yaml:"mode"` // fallback (по умолчанию) или cross_check
+        SourceOptions `yaml:",inline"`
+}
+
+// Типы записей MRT (RFC 6396, RFC 8050)
+const (
+        mrtTableDump   = 12
+        mrtTableDumpV2 = 13
+
+        mrtRIBIPv4Unicast        = 2
+        mrtRIBIPv6Unicast        = 4
+        mrtRIBIPv4UnicastAddPath = 8
+        mrtRIBIPv6UnicastAddPath = 10
+)
+
+// Атрибуты BGP с путём AS
+const (
+        bgpAttrASPath  = 2
+        bgpAttrAS4Path = 17
+        asPathSet      = 1
+        asPathSequence = 2
+)
+
+// bgpTableSources откуда взята таблица этого запуска: bgp.tools или MRT-дампы
+var bgpTableSources []string
+
+type mrtOrigin struct {
+        prefix netip.Prefix
+        as     uint32
+}
+
+// pathOrigin origin ASN из значения AS_PATH: последний AS последнего AS_SEQUENCE.
+// AS_SET в конце (агрегаты) origin не даёт.
+func pathOrigin(path []byte, asSize int) (uint32, bool) {
+        var origin uint32
+        var ok bool
+        for len(path) >= 2 {
+                segType, count := path[0], int(path[1])
+                size := 2 + count*asSize
+                if len(path) < size {
+                        return 0, false
+                }
+                switch {
+                case segType == asPathSequence && count > 0:
+                        last := path[size-asSize : size]
+                        if asSize == 4 {
+                                origin = binary.BigEndian.Uint32(last)
+                        } else {
+                                origin = uint32(binary.BigEndian.Uint16(last))
+                        }
+                        ok = true
+                case segType == asPathSet:
+                        ok = false
+                }
+                path = path[size:]
+        }
+        return origin, ok
+}
+
+// attrsOrigin origin из атрибутов BGP; as4 - AS_PATH с 4-байтными ASN (TABLE_DUMP_V2)
+func attrsOrigin(attrs []byte, as4 bool) (uint32, bool) {
+        var asPath, as4Path []byte
+        for len(attrs) >= 3 {
+                flags, typ := attrs[0], attrs[1]
+                var length, header int
+                if flags&0x10 != 0 {
+                        if len(attrs) < 4 {
+                                return 0, false
+                        }
+                        length, header = int(binary.BigEndian.Uint16(attrs[2:4])), 4
+                } else {
+                        length, header = int(attrs[2]), 3
+                }
+                if len(attrs) < header+length {
+                        return 0, false
+                }
+                value := attrs[header : header+length]
+                switch typ {
+                case bgpAttrASPath:
+                        asPath = value
+                case bgpAttrAS4Path:
+                        as4Path = value
+                }
+                attrs = attrs[header+length:]
+        }
+        if as4 {
+                return pathOrigin(asPath, 4)
+        }
+        // В старом TABLE_DUMP 4-байтные ASN есть только в AS4_PATH
+        if as4Path != nil {
+                if origin, ok := pathOrigin(as4Path, 4); ok {
+                        return origin, true
+                }
+        }
+        return pathOrigin(asPath, 2)
+}
+
+func mrtPrefix(data []byte, bits int, v6 bool) (netip.Prefix, int, error) {
+        n := (bits + 7) / 8
+        size := 4
+        if v6 {
+                size = 16
+        }
+        if bits > size*8 || len(data) < n {
+                return netip.Prefix{}, 0, errors.New("bad prefix")
+        }
+        var raw [16]byte
+        copy(raw[:], data[:n])
+        addr := netip.AddrFrom16(raw)
+        if !v6 {
+                addr = netip.AddrFrom4([4]byte(raw[:4]))
+        }
+        return netip.PrefixFrom(addr, bits).Masked(), n, nil
+}
+
+// parseTableDumpV2RIB запись RIB_*_UNICAST: префикс и пути всех пиров
+func parseTableDumpV2RIB(msg []byte, v6, addPath bool, origins map[mrtOrigin]bool) error {
+        if len(msg) < 5 {
+                return errors.New("short RIB entry")
+        }
+        prefix, n, err := mrtPrefix(msg[5:], int(msg[4]), v6)
+        if err != nil {
+                return err
+        }
+        msg = msg[5+n:]
+        if len(msg) < 2 {
+                return errors.New("short RIB entry")
+        }
+        count := int(binary.BigEndian.Uint16(msg))
+        msg = msg[2:]
+        for i := 0; i < count; i++ {
+                header := 8 // peer index, originated time, attribute length
+                if addPath {
+                        header += 4
+                }
+                if len(msg) < header {
+                        return errors.New("short RIB entry")
+                }
+                attrLen := int(binary.BigEndian.Uint16(msg[header-2:]))
+                if len(msg) < header+attrLen {
+                        return errors.New("short RIB entry")
+                }
+                if as, ok := attrsOrigin(msg[header:header+attrLen], true); ok {
+                        origins[mrtOrigin{prefix, as}] = true
+                }
+                msg = msg[header+attrLen:]
+        }
+        return nil
+}
+
+// parseTableDump запись старого формата TABLE_DUMP: один путь на запись
+func parseTableDump(msg []byte, v6 bool, origins map[mrtOrigin]bool) error {
+        size := 4
+        if v6 {
+                size = 16
+        }
+        // view, seq, prefix, length, status, time, peer ip, peer as, attr length
+        header := 2 + 2 + size + 1 + 1 + 4 + size + 2 + 2
+        if len(msg) < header {
+                return errors.New("short TABLE_DUMP entry")
+        }
+        prefix, _, err := mrtPrefix(msg[4:4+size], int(msg[4+size]), v6)
+        if err != nil {
+                return err
+        }
+        attrLen := int(binary.BigEndian.Uint16(msg[header-2:]))
+        if len(msg) < header+attrLen {
+                return errors.New("short TABLE_DUMP entry")
+        }
+        if as, ok := attrsOrigin(msg[header:header+attrLen], false); ok {
+                origins[mrtOrigin{prefix, as}] = true
+        }
+        return nil
+}
+
+// parseMRT собирает пары префикс - origin ASN из RIB-дампа; прочие записи пропускаются
+func parseMRT(r io.Reader, origins map[mrtOrigin]bool) error {
+        reader := bufio.NewReaderSize(r, 1<<20)
+        header := make([]byte, 12)
+        var msg []byte
+        for {
+                if _, err := io.ReadFull(reader, header); err != nil {
+                        if err == io.EOF {
+                                return nil
+                        }
+                        return err
+                }
+                typ := binary.BigEndian.Uint16(header[4:6])
+                subtype := binary.BigEndian.Uint16(header[6:8])
+                length := binary.BigEndian.Uint32(header[8:12])
+                if length > 16<<20 {
+                        return fmt.Errorf("MRT record of %d bytes", length)
+                }
+                if uint32(cap(msg)) < length {
+                        msg = make([]byte, length)
+                }
+                msg = msg[:length]
+                if _, err := io.ReadFull(reader, msg); err != nil {
+                        return err
+                }
+
+                var err error
+                switch typ {
+                case mrtTableDumpV2:
+                        switch subtype {
+                        case mrtRIBIPv4Unicast, mrtRIBIPv6Unicast:
+                                err = parseTableDumpV2RIB(msg, subtype == mrtRIBIPv6Unicast, false, origins)
+                        case mrtRIBIPv4UnicastAddPath, mrtRIBIPv6UnicastAddPath:
+                                err = parseTableDumpV2RIB(msg, subtype == mrtRIBIPv6UnicastAddPath, true, origins)
+                        }
+                case mrtTableDump:
+                        err = parseTableDump(msg, subtype == 2, origins)
+                }
+                if err != nil {
+                        return fmt.Errorf("MRT type %d/%d: %w", typ, subtype, err)
+                }
+        }
+}
+
+// mrtReader распаковывает дамп по сигнатуре: RIS - gzip, RouteViews - bzip2
+func mrtReader(data string) (io.Reader, error) {
+        switch {
+        case strings.HasPrefix(data, "\x1f\x8b"):
+                return gzip.NewReader(strings.NewReader(data))
+        case strings.HasPrefix(data, "BZh"):
+                return bzip2.NewReader(strings.NewReader(data)), nil
+        }
+        return bytes.NewReader([]byte(data)), nil
+}
+
+// loadMRTTable таблица в виде строк bgp.tools из всех дампов mrt.urls
+func loadMRTTable() ([]subnetAS, error) {
+        if len(config.MRT.URLs) == 0 {
+                return nil, errors.New("mrt.urls is empty")
+        }
+        var subnets []subnetAS
+        for _, url := range config.MRT.URLs {
+                data, err := downloadCached(url, config.MRT.SourceOptions)
+                if err != nil {
+                        return nil, fmt.Errorf("%s: %w", url, err)
+                }
+                r, err := mrtReader(data)
+                if err != nil {
+                        return nil, fmt.Errorf("%s: %w", url, err)
+                }
+                origins := make(map[mrtOrigin]bool)
+                if err := parseMRT(r, origins); err != nil {
+                        return nil, fmt.Errorf("%s: %w", url, err)
+                }
+                for origin := range origins {
+                        subnets = append(subnets, subnetAS{subnet: origin.prefix.String(), as: strconv.FormatUint(uint64(origin.as), 10), source: url})
+                }
+                log.Printf("MRT %s: %d prefix origins", url, len(origins))
+        }
+        return subnets, nil
+}
+
+// crossCheckMRT сверяет ASN-списки по таблице bgp.tools с MRT-дампами и
+// предупреждает о расхождениях; списки собираются по bgp.tools
+func crossCheckMRT(subnets []subnetAS) {
+        mrt, err := loadMRTTable()
+        if err != nil {
+                log.Printf("Error loading MRT dumps for cross-check: %v", err)
+                return
+        }
+        names := make([]string, 0, len(config.ASNumbers))
+        for as := range config.ASNumbers {
+                names = append(names, as)
+        }
+        sort.Strings(names)
+        for _, as := range names {
+                asConfig := config.ASNumbers[as]
+                if !asListSelected(as, asConfig) || asConfig.Source != "" && asConfig.Source != asSourceBGPTools {
+                        continue
+                }
+                asns := listASNs(as, asConfig)
+                table, err := processSubnets(subnets, asns)
+                if err != nil {
+                        continue
+                }
+                dump, err := processSubnets(mrt, asns)
+                if err != nil {
+                        continue
+                }
+                a, errA := prefixSet(table)
+                b, errB := prefixSet(dump)
+                if errA != nil || errB != nil {
+                        continue
+                }
+                var onlyTable, onlyDump []string
+                for _, prefix := range table {
+                        if !b.ContainsPrefix(prefix) {
+                                onlyTable = append(onlyTable, prefix.String())
+                        }
+                }
+                for _, prefix := range dump {
+                        if !a.ContainsPrefix(prefix) {
+                                onlyDump = append(onlyDump, prefix.String())
+                        }
+                }
+                if len(onlyTable) > 0 || len(onlyDump) > 0 {
+                        log.Printf("MRT cross-check %s: %d prefixes only in bgp.tools (%s), %d only in MRT (%s)",
+                                strings.TrimSuffix(asConfig.File, ".lst"), len(onlyTable), strings.Join(shortList(onlyTable), ", "),
+                                len(onlyDump), strings.Join(shortList(onlyDump), ", "))
+                }
+        }
+}
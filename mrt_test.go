@@ -0,0 +1,146 @@
+package main
+
+import (
+        "bytes"
+        "encoding/binary"
+        "net/netip"
+        "testing"
+)
+
+// asSegment сегмент AS_PATH из ASN размера asSize
+func asSegment(segType byte, asSize int, asns ...uint32) []byte {
+        seg := []byte{segType, byte(len(asns))}
+        for _, as := range asns {
+                if asSize == 4 {
+                        seg = binary.BigEndian.AppendUint32(seg, as)
+                } else {
+                        seg = binary.BigEndian.AppendUint16(seg, uint16(as))
+                }
+        }
+        return seg
+}
+
+func bgpAttr(typ byte, value []byte) []byte {
+        return append([]byte{0x40, typ, byte(len(value))}, value...)
+}
+
+func mrtRecord(typ, subtype uint16, body []byte) []byte {
+        record := make([]byte, 12)
+        binary.BigEndian.PutUint16(record[4:], typ)
+        binary.BigEndian.PutUint16(record[6:], subtype)
+        binary.BigEndian.PutUint32(record[8:], uint32(len(body)))
+        return append(record, body...)
+}
+
+// ribEntry запись RIB_IPV4_UNICAST с одним путём на каждый набор атрибутов
+func ribEntry(prefix netip.Prefix, attrs ...[]byte) []byte {
+        body := []byte{0, 0, 0, 1, byte(prefix.Bits())}
+        body = append(body, prefix.Addr().AsSlice()[:(prefix.Bits()+7)/8]...)
+        body = binary.BigEndian.AppendUint16(body, uint16(len(attrs)))
+        for _, attr := range attrs {
+                body = append(body, 0, 0, 0, 0, 0, 0)
+                body = binary.BigEndian.AppendUint16(body, uint16(len(attr)))
+                body = append(body, attr...)
+        }
+        return mrtRecord(mrtTableDumpV2, mrtRIBIPv4Unicast, body)
+}
+
+func TestPathOrigin(t *testing.T) {
+        tests := []struct {
+                name   string
+                path   []byte
+                asSize int
+                want   uint32
+                ok     bool
+        }{
+                {"sequence", asSegment(asPathSequence, 4, 3356, 32934), 4, 32934, true},
+                {"two-byte", asSegment(asPathSequence, 2, 174, 13335), 2, 13335, true},
+                {"last sequence", append(asSegment(asPathSequence, 4, 3356), asSegment(asPathSequence, 4, 15169)...), 4, 15169, true},
+                {"trailing set", append(asSegment(asPathSequence, 4, 3356), asSegment(asPathSet, 4, 1, 2)...), 4, 0, false},
+                {"truncated", asSegment(asPathSequence, 4, 3356)[:4], 4, 0, false},
+                {"empty", nil, 4, 0, false},
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        got, ok := pathOrigin(tt.path, tt.asSize)
+                        if ok != tt.ok || ok && got != tt.want {
+                                t.Errorf("pathOrigin = %d, %v; want %d, %v", got, ok, tt.want, tt.ok)
+                        }
+                })
+        }
+}
+
+func TestAttrsOriginAS4Path(t *testing.T) {
+        // В TABLE_DUMP 4-байтный origin есть только в AS4_PATH, в AS_PATH - AS_TRANS
+        attrs := append(bgpAttr(bgpAttrASPath, asSegment(asPathSequence, 2, 3356, 23456)), bgpAttr(bgpAttrAS4Path, asSegment(asPathSequence, 4, 3356, 200000))...)
+        if got, ok := attrsOrigin(attrs, false); !ok || got != 200000 {
+                t.Errorf("attrsOrigin = %d, %v; want 200000, true", got, ok)
+        }
+}
+
+func TestParseMRT(t *testing.T) {
+        meta := netip.MustParsePrefix("157.240.0.0/16")
+        google := netip.MustParsePrefix("8.8.8.0/24")
+
+        tableDump := []byte{0, 0, 0, 1}
+        tableDump = append(tableDump, 1, 1, 1, 0, 24, 1, 0, 0, 0, 0, 10, 0, 0, 1, 0x0d, 0x1c)
+        oldAttrs := bgpAttr(bgpAttrASPath, asSegment(asPathSequence, 2, 3356, 13335))
+        tableDump = binary.BigEndian.AppendUint16(tableDump, uint16(len(oldAttrs)))
+        tableDump = append(tableDump, oldAttrs...)
+
+        tests := []struct {
+                name    string
+                data    []byte
+                want    []mrtOrigin
+                wantErr bool
+        }{
+                {
+                        name: "table dump v2",
+                        data: bytes.Join([][]byte{
+                                ribEntry(meta, bgpAttr(bgpAttrASPath, asSegment(asPathSequence, 4, 3356, 32934)), bgpAttr(bgpAttrASPath, asSegment(asPathSequence, 4, 174, 32934))),
+                                ribEntry(google, bgpAttr(bgpAttrASPath, asSegment(asPathSequence, 4, 15169))),
+                        }, nil),
+                        want: []mrtOrigin{{meta, 32934}, {google, 15169}},
+                },
+                {
+                        name: "table dump",
+                        data: mrtRecord(mrtTableDump, 1, tableDump),
+                        want: []mrtOrigin{{netip.MustParsePrefix("1.1.1.0/24"), 13335}},
+                },
+                {
+                        name: "other records skipped",
+                        data: append(mrtRecord(mrtTableDumpV2, 1, []byte{1, 2, 3}), ribEntry(google, bgpAttr(bgpAttrASPath, asSegment(asPathSequence, 4, 15169)))...),
+                        want: []mrtOrigin{{google, 15169}},
+                },
+                {
+                        name:    "truncated record",
+                        data:    ribEntry(google, bgpAttr(bgpAttrASPath, asSegment(asPathSequence, 4, 15169)))[:20],
+                        wantErr: true,
+                },
+                {
+                        name:    "bad prefix length",
+                        data:    mrtRecord(mrtTableDumpV2, mrtRIBIPv4Unicast, []byte{0, 0, 0, 1, 33, 1, 2, 3, 4, 5, 0, 0}),
+                        wantErr: true,
+                },
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        origins := make(map[mrtOrigin]bool)
+                        err := parseMRT(bytes.NewReader(tt.data), origins)
+                        if (err != nil) != tt.wantErr {
+                                t.Fatalf("parseMRT error = %v, wantErr %v", err, tt.wantErr)
+                        }
+                        if tt.wantErr {
+                                return
+                        }
+                        if len(origins) != len(tt.want) {
+                                t.Fatalf("parseMRT = %v, want %v", origins, tt.want)
+                        }
+                        for _, origin := range tt.want {
+                                if !origins[origin] {
+                                        t.Errorf("missing origin %v in %v", origin, origins)
+                                }
+                        }
+                })
+        }
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+        "fmt"
+        "path/filepath"
+)
+
+// NetworkdConfig drop-in для systemd-networkd с секциями [Route] на каждый префикс
+type NetworkdConfig struct {
+        OutputConfig `yaml:",inline"`
+        Network      string `yaml:"network"`    // Имя .network без расширения, к которому относится drop-in, например 50-wg0
+        Gateway      string `yaml:"gateway"`    // По умолчанию общий gateway; "none" - маршрут через сам интерфейс
+        GatewayV6    string `yaml:"gateway_v6"` // Без него IPv6-маршруты идут через интерфейс
+        Table        int    `yaml:"table"`
+        Metric       int    `yaml:"metric"`
+}
+
+func networkdRoutes(list *generatedList) []string {
+        lines := []string{"# " + list.Comment}
+        for _, prefix := range list.Prefixes {
+                gateway := config.Networkd.Gateway
+                if prefix.Addr().Is6() {
+                        gateway = config.Networkd.GatewayV6
+                }
+                lines = append(lines, "", "[Route]", "Destination="+prefix.String())
+                if gateway != "" && gateway != "none" {
+                        lines = append(lines, "Gateway="+gateway)
+                }
+                if config.Networkd.Table != 0 {
+                        lines = append(lines, fmt.Sprintf("Table=%d", config.Networkd.Table))
+                }
+                if config.Networkd.Metric != 0 {
+                        lines = append(lines, fmt.Sprintf("Metric=%d", config.Networkd.Metric))
+                }
+        }
+        return lines
+}
+
+// generateNetworkdDropIn пишет <network>.network.d/<list>.conf; каталог
+// копируется в /etc/systemd/network как есть
+func generateNetworkdDropIn(list *generatedList) error {
+        if len(list.Prefixes) == 0 {
+                return nil
+        }
+        dir := filepath.Join(layoutDir("networkd", list.Name, config.Networkd.Dir), config.Networkd.Network+".network.d")
+        return writeOutputLines(dir, list.Name+".conf", networkdRoutes(list))
+}
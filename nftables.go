@@ -0,0 +1,129 @@
+package main
+
+import (
+        "fmt"
+        "log"
+        "net/netip"
+        "os/exec"
+        "strings"
+
+        "go4.org/netipx"
+)
+
+// NFTablesConfig наполнение set'ов nftables прямо на шлюзе (--apply nftables):
+// все списки применяются одной транзакцией nft -f -, так что при ошибке
+// не меняется ни один set
+type NFTablesConfig struct {
+        Family string   `yaml:"family"` // По умолчанию inet
+        Table  string   `yaml:"table"`  // По умолчанию fw4
+        Create bool     `yaml:"create"` // Создавать таблицу и set'ы, если их нет
+        Lists  []string `yaml:"lists"`  // Пусто - все списки
+}
+
+// applyNFTables включается флагом --apply nftables
+var applyNFTables bool
+
+// nftablesElementChunk элементов в одной команде add element
+const nftablesElementChunk = 1000
+
+// nftablesSetName set списка: имя address-list, для IPv6 с суффиксом _v6, как в openwrt_ipset
+func nftablesSetName(list *generatedList, v6 bool) string {
+        name := identifierName(list.ListName)
+        if v6 {
+                name += "_v6"
+        }
+        return name
+}
+
+// prefixFamilies префиксы списка по семействам без пересечений: nft не
+// принимает перекрывающиеся интервалы в одной команде
+func prefixFamilies(list *generatedList) (v4, v6 []netip.Prefix, err error) {
+        var builder netipx.IPSetBuilder
+        for _, prefix := range list.Prefixes {
+                builder.AddPrefix(prefix.Masked())
+        }
+        set, err := builder.IPSet()
+        if err != nil {
+                return nil, nil, err
+        }
+        for _, prefix := range set.Prefixes() {
+                if prefix.Addr().Is4() {
+                        v4 = append(v4, prefix)
+                } else {
+                        v6 = append(v6, prefix)
+                }
+        }
+        return v4, v6, nil
+}
+
+func prefixStrings(prefixes []netip.Prefix) []string {
+        out := make([]string, len(prefixes))
+        for i, prefix := range prefixes {
+                out[i] = prefix.String()
+        }
+        return out
+}
+
+// nftablesScript команды для nft -f: set очищается и заполняется заново
+func nftablesScript(lists []*generatedList) (string, int, error) {
+        lists = listsForFormat("nftables", lists)
+        family, table := config.NFTables.Family, config.NFTables.Table
+        var b strings.Builder
+        if config.NFTables.Create {
+                fmt.Fprintf(&b, "add table %s %s\n", family, table)
+        }
+
+        var sets int
+        for _, list := range lists {
+                if len(config.NFTables.Lists) > 0 && !listSelectedByName(config.NFTables.Lists, list) {
+                        continue
+                }
+                v4, v6, err := prefixFamilies(list)
+                if err != nil {
+                        return "", 0, fmt.Errorf("%s: %w", list.ListName, err)
+                }
+                for _, set := range []struct {
+                        v6       bool
+                        addrType string
+                        entries  []string
+                }{{false, "ipv4_addr", prefixStrings(v4)}, {true, "ipv6_addr", prefixStrings(v6)}} {
+                        // Без create пустой IPv6 не трогаем: такого set'а на шлюзе может не быть
+                        if len(set.entries) == 0 && (set.v6 || !config.NFTables.Create) {
+                                continue
+                        }
+                        name := nftablesSetName(list, set.v6)
+                        if config.NFTables.Create {
+                                fmt.Fprintf(&b, "add set %s %s %s { type %s; flags interval; auto-merge; }\n", family, table, name, set.addrType)
+                        }
+                        fmt.Fprintf(&b, "flush set %s %s %s\n", family, table, name)
+                        for start := 0; start < len(set.entries); start += nftablesElementChunk {
+                                end := start + nftablesElementChunk
+                                if end > len(set.entries) {
+                                        end = len(set.entries)
+                                }
+                                fmt.Fprintf(&b, "add element %s %s %s { %s }\n", family, table, name, strings.Join(set.entries[start:end], ", "))
+                        }
+                        sets++
+                }
+        }
+        return b.String(), sets, nil
+}
+
+func applyNFTablesSets(lists []*generatedList) error {
+        script, sets, err := nftablesScript(lists)
+        if err != nil {
+                return err
+        }
+        if sets == 0 {
+                return nil
+        }
+
+        cmd := exec.CommandContext(runCtx, "nft", "-f", "-")
+        cmd.Stdin = strings.NewReader(script)
+        out, err := cmd.CombinedOutput()
+        if err != nil {
+                return fmt.Errorf("nft: %v: %s", err, strings.TrimSpace(string(out)))
+        }
+        log.Printf("nftables: updated %d sets in %s %s", sets, config.NFTables.Family, config.NFTables.Table)
+        return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+        "fmt"
+        "net"
+        "net/netip"
+        "path/filepath"
+)
+
+// OpenVPNConfig директивы маршрутов для сервера OpenVPN: push route для
+// server.conf, файлы client-config-dir и клиентские конфиги с route-nopull
+type OpenVPNConfig struct {
+        OutputConfig `yaml:",inline"`
+        Clients      map[string][]string `yaml:"clients"`      // Имя клиента в CCD -> списки (пусто - все)
+        RouteNoPull  bool                `yaml:"route_nopull"` // Писать <list>-client.conf с route-nopull
+}
+
+// openVPNRoute маршрут в синтаксисе OpenVPN: IPv4 с маской, IPv6 префиксом
+func openVPNRoute(prefix netip.Prefix) string {
+        if prefix.Addr().Is4() {
+                mask := net.IP(net.CIDRMask(prefix.Bits(), 32))
+                return fmt.Sprintf("route %s %s", prefix.Addr(), mask)
+        }
+        return fmt.Sprintf("route-ipv6 %s", prefix)
+}
+
+func openVPNPushLines(list *generatedList) []string {
+        lines := make([]string, 0, len(list.Prefixes)+1)
+        lines = append(lines, "# "+list.Comment)
+        for _, prefix := range list.Prefixes {
+                lines = append(lines, fmt.Sprintf("push %q", openVPNRoute(prefix)))
+        }
+        return lines
+}
+
+func generateOpenVPNPush(list *generatedList) error {
+        if len(list.Prefixes) == 0 {
+                return nil
+        }
+        if err := writeOutputLines(layoutDir("openvpn", list.Name, config.OpenVPN.Dir), list.Name+".conf", openVPNPushLines(list)); err != nil {
+                return err
+        }
+        if !config.OpenVPN.RouteNoPull {
+                return nil
+        }
+
+        // Клиент игнорирует маршруты сервера и берёт только маршруты списка
+        lines := []string{"# " + list.Comment, "route-nopull"}
+        for _, prefix := range list.Prefixes {
+                route := openVPNRoute(prefix)
+                if prefix.Addr().Is4() {
+                        route += " vpn_gateway"
+                }
+                lines = append(lines, route)
+        }
+        return writeOutputLines(layoutDir("openvpn", list.Name, config.OpenVPN.Dir), list.Name+"-client.conf", lines)
+}
+
+// generateOpenVPNCCD пишет файлы client-config-dir с push route выбранных списков
+func generateOpenVPNCCD(lists []*generatedList) error {
+        dir := filepath.Join(config.OpenVPN.Dir, "ccd")
+        for client, names := range config.OpenVPN.Clients {
+                var lines []string
+                for _, list := range lists {
+                        if len(list.Prefixes) == 0 || len(names) > 0 && !listSelectedByName(names, list) {
+                                continue
+                        }
+                        lines = append(lines, openVPNPushLines(list)...)
+                }
+                if err := writeOutputLines(dir, client, lines); err != nil {
+                        return fmt.Errorf("%s: %w", client, err)
+                }
+        }
+        return nil
+}
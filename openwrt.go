@@ -0,0 +1,108 @@
+package main
+
+import (
+        "fmt"
+        "strings"
+)
+
+// OpenWrtPBRConfig секции policy для пакета pbr (или vpn-policy-routing, формат тот же)
+type OpenWrtPBRConfig struct {
+        OutputConfig `yaml:",inline"`
+        Interface    string `yaml:"interface"` // Интерфейс OpenWrt, например wg0
+}
+
+// uciQuote заключает значение в одинарные кавычки по правилам UCI
+func uciQuote(value string) string {
+        return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+func openWrtPBRPolicy(list *generatedList) []string {
+        dest := make([]string, 0, len(list.Prefixes)+len(list.Domains))
+        for _, prefix := range list.Prefixes {
+                dest = append(dest, prefix.String())
+        }
+        for _, domain := range list.Domains {
+                dest = append(dest, trimDomainDot(domain))
+        }
+
+        return []string{
+                "config policy",
+                "\toption name " + uciQuote(list.ListName),
+                "\toption interface " + uciQuote(config.OpenWrtPBR.Interface),
+                "\toption dest_addr " + uciQuote(strings.Join(dest, " ")),
+                "\toption enabled '1'",
+        }
+}
+
+func generateOpenWrtPBR(list *generatedList) error {
+        if len(list.Prefixes) == 0 && len(list.Domains) == 0 {
+                return nil
+        }
+        if config.OpenWrtPBR.Interface == "" {
+                return fmt.Errorf("openwrt_pbr.interface is required")
+        }
+        return writeOutputLines(layoutDir("openwrt_pbr", list.Name, config.OpenWrtPBR.Dir), list.Name+".pbr", openWrtPBRPolicy(list))
+}
+
+// OpenWrtIPSetConfig секции ipset для /etc/config/firewall (fw4) и файлы записей к ним
+type OpenWrtIPSetConfig struct {
+        OutputConfig `yaml:",inline"`
+        LoadDir      string `yaml:"load_dir"` // Каталог на роутере, куда кладутся файлы записей
+        Inline       bool   `yaml:"inline"`   // Писать записи прямо в секцию (list entry) вместо loadfile
+}
+
+func openWrtIPSetFamilies(list *generatedList) (v4, v6 []string) {
+        for _, prefix := range list.Prefixes {
+                if prefix.Addr().Is4() {
+                        v4 = append(v4, prefix.String())
+                } else {
+                        v6 = append(v6, prefix.String())
+                }
+        }
+        return v4, v6
+}
+
+func openWrtIPSetSection(name, family, loadfile string, entries []string) []string {
+        lines := []string{
+                "config ipset",
+                "\toption name " + uciQuote(name),
+                "\toption family " + uciQuote(family),
+                "\tlist match 'dest_net'",
+        }
+        if config.OpenWrtIPSet.Inline {
+                for _, entry := range entries {
+                        lines = append(lines, "\tlist entry "+uciQuote(entry))
+                }
+        } else {
+                lines = append(lines, "\toption loadfile "+uciQuote(loadfile))
+        }
+        return append(lines, "")
+}
+
+func generateOpenWrtIPSet(list *generatedList) error {
+        v4, v6 := openWrtIPSetFamilies(list)
+        if len(v4) == 0 && len(v6) == 0 {
+                return nil
+        }
+
+        dir := layoutDir("openwrt_ipset", list.Name, config.OpenWrtIPSet.Dir)
+        var sections []string
+        for _, set := range []struct {
+                suffix, family string
+                entries        []string
+        }{{"", "ipv4", v4}, {"_v6", "ipv6", v6}} {
+                if len(set.entries) == 0 {
+                        continue
+                }
+                name := list.ListName + set.suffix
+                file := list.Name + set.suffix + ".txt"
+                sections = append(sections, openWrtIPSetSection(name, set.family, config.OpenWrtIPSet.LoadDir+"/"+layoutRelPath("openwrt_ipset", list.Name, config.OpenWrtIPSet.Dir, file), set.entries)...)
+
+                if !config.OpenWrtIPSet.Inline {
+                        if err := writeOutputLines(dir, file, set.entries); err != nil {
+                                return err
+                        }
+                }
+        }
+        return writeOutputLines(dir, list.Name+".ipset", sections)
+}
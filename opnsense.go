@@ -0,0 +1,65 @@
+package main
+
+import (
+        "crypto/sha1"
+        "encoding/json"
+        "fmt"
+        "os"
+        "path/filepath"
+        "strings"
+)
+
+// Файл импорта алиасов OPNsense (Firewall > Aliases > Import): все списки как алиасы типа network
+
+type opnSenseAlias struct {
+        Enabled     string `json:"enabled"`
+        Name        string `json:"name"`
+        Type        string `json:"type"`
+        Proto       string `json:"proto"`
+        Counters    string `json:"counters"`
+        UpdateFreq  string `json:"updatefreq"`
+        Content     string `json:"content"`
+        Description string `json:"description"`
+}
+
+// opnSenseUUID постоянный UUID алиаса из его имени, чтобы повторный импорт обновлял, а не дублировал
+func opnSenseUUID(name string) string {
+        sum := sha1.Sum([]byte("allow-domains:" + name))
+        sum[6] = sum[6]&0x0F | 0x50
+        sum[8] = sum[8]&0x3F | 0x80
+        return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+func generateOPNsenseAliases(lists []*generatedList) error {
+        aliases := make(map[string]opnSenseAlias)
+        for _, list := range lists {
+                if len(list.Prefixes) == 0 {
+                        continue
+                }
+                content := make([]string, 0, len(list.Prefixes))
+                for _, prefix := range list.Prefixes {
+                        content = append(content, prefix.String())
+                }
+
+                name := pfSenseAliasName(list.ListName)
+                aliases[opnSenseUUID(name)] = opnSenseAlias{
+                        Enabled:     "1",
+                        Name:        name,
+                        Type:        "network",
+                        Counters:    "0",
+                        Content:     strings.Join(content, "\n"),
+                        Description: list.Comment,
+                }
+        }
+
+        data, err := json.MarshalIndent(map[string]any{
+                "aliases": map[string]any{"alias": aliases},
+        }, "", "    ")
+        if err != nil {
+                return err
+        }
+        if err := os.MkdirAll(config.OPNsense.Dir, 0755); err != nil {
+                return err
+        }
+        return writeFileStaged(filepath.Join(config.OPNsense.Dir, "aliases.json"), append(data, '\n'))
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+        "encoding/csv"
+        "encoding/json"
+        "fmt"
+        "log"
+        "os"
+        "path/filepath"
+        "sort"
+        "strings"
+)
+
+// OrgDiscoveryConfig поиск ASN организаций по справочнику имён автономных систем
+type OrgDiscoveryConfig struct {
+        URL           string `yaml:"url"`        // CSV вида asn,name,...
+        StateFile     string `yaml:"state_file"` // Уже известные ASN, чтобы предупреждать только о новых
+        SourceOptions `yaml:",inline"`
+}
+
+const defaultOrgDiscoveryURL = "https://bgp.tools/asns.csv"
+
+// parseASNames разбирает CSV с заголовком, в котором есть колонки asn и name
+func parseASNames(data string) (map[string]string, error) {
+        reader := csv.NewReader(strings.NewReader(data))
+        reader.FieldsPerRecord = -1
+        records, err := reader.ReadAll()
+        if err != nil {
+                return nil, err
+        }
+        if len(records) == 0 {
+                return nil, fmt.Errorf("empty AS names list")
+        }
+
+        asnCol, nameCol := -1, -1
+        for i, column := range records[0] {
+                switch strings.ToLower(strings.TrimSpace(column)) {
+                case "asn":
+                        asnCol = i
+                case "name":
+                        nameCol = i
+                }
+        }
+        if asnCol < 0 || nameCol < 0 {
+                return nil, fmt.Errorf("AS names list has no asn/name columns")
+        }
+
+        names := make(map[string]string, len(records))
+        for _, record := range records[1:] {
+                if len(record) <= asnCol || len(record) <= nameCol {
+                        continue
+                }
+                names[normalizeASN(record[asnCol])] = record[nameCol]
+        }
+        return names, nil
+}
+
+// discoverOrgASNs ASN, в имени которых встречается одна из организаций (без учёта регистра)
+func discoverOrgASNs(names map[string]string, orgs []string) []string {
+        var found []string
+        for as, name := range names {
+                lower := strings.ToLower(name)
+                for _, org := range orgs {
+                        if org = strings.ToLower(strings.TrimSpace(org)); org != "" && strings.Contains(lower, org) {
+                                found = append(found, as)
+                                break
+                        }
+                }
+        }
+        sort.Strings(found)
+        return found
+}
+
+func orgStatePath() string {
+        if config.OrgDiscovery.StateFile != "" {
+                return config.OrgDiscovery.StateFile
+        }
+        return filepath.Join(config.Cache.Dir, "org-asns.json")
+}
+
+func loadOrgState() map[string][]string {
+        state := make(map[string][]string)
+        data, err := os.ReadFile(orgStatePath())
+        if err != nil {
+                return state
+        }
+        if err := json.Unmarshal(data, &state); err != nil {
+                log.Printf("Error reading %s: %v", orgStatePath(), err)
+        }
+        return state
+}
+
+func saveOrgState(state map[string][]string) error {
+        data, err := json.MarshalIndent(state, "", "    ")
+        if err != nil {
+                return err
+        }
+        if err := os.MkdirAll(filepath.Dir(orgStatePath()), 0755); err != nil {
+                return err
+        }
+        return writeFileStaged(orgStatePath(), append(data, '\n'))
+}
+
+// resolveOrgASNs повторяет поиск ASN для списков с orgs. Новые ASN либо
+// добавляются в список (auto_add_asns), либо о них выводится предупреждение.
+func resolveOrgASNs(filters map[string]FilterListConfig) {
+        needed := false
+        for _, filter := range filters {
+                if len(filter.Orgs) > 0 {
+                        needed = true
+                        break
+                }
+        }
+        if !needed {
+                return
+        }
+
+        url := config.OrgDiscovery.URL
+        if url == "" {
+                url = defaultOrgDiscoveryURL
+        }
+        data, err := downloadCached(url, config.OrgDiscovery.SourceOptions)
+        if err != nil {
+                log.Printf("Error downloading AS names: %v", err)
+                return
+        }
+        names, err := parseASNames(data)
+        if err != nil {
+                log.Printf("Error parsing AS names: %v", err)
+                return
+        }
+
+        state := loadOrgState()
+        for name, filter := range filters {
+                if len(filter.Orgs) == 0 {
+                        continue
+                }
+
+                known := make(map[string]bool)
+                for _, as := range filter.ASNs {
+                        known[normalizeASN(as)] = true
+                }
+                for _, as := range state[name] {
+                        known[as] = true
+                }
+
+                discovered := discoverOrgASNs(names, filter.Orgs)
+                var added []string
+                for _, as := range discovered {
+                        if !known[as] {
+                                added = append(added, as)
+                        }
+                }
+
+                if len(added) > 0 {
+                        if filter.AutoAddASNs {
+                                log.Printf("Filter %s: added new ASNs for %s: %s", name, strings.Join(filter.Orgs, ", "), strings.Join(added, ", "))
+                        } else {
+                                log.Printf("Warning: filter %s: new ASNs registered by %s: %s (add them to asns or set auto_add_asns)", name, strings.Join(filter.Orgs, ", "), strings.Join(added, ", "))
+                        }
+                }
+
+                if filter.AutoAddASNs {
+                        for _, as := range discovered {
+                                if !containsASN(filter.ASNs, as) {
+                                        filter.ASNs = append(filter.ASNs, as)
+                                }
+                        }
+                        filters[name] = filter
+                }
+
+                seen := append(state[name], added...)
+                sort.Strings(seen)
+                state[name] = seen
+        }
+
+        if err := saveOrgState(state); err != nil {
+                log.Printf("Error saving %s: %v", orgStatePath(), err)
+        }
+}
+
+func containsASN(asns []string, as string) bool {
+        for _, existing := range asns {
+                if normalizeASN(existing) == as {
+                        return true
+                }
+        }
+        return false
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+        "fmt"
+        "log"
+        "net/netip"
+        "os"
+        "path/filepath"
+        "strings"
+)
+
+// generatedList итоговый список одного сервиса, общий для всех форматов вывода
+type generatedList struct {
+        Name     string // Базовое имя файла без расширения
+        ListName string
+        Comment  string
+        Prefixes []netip.Prefix
+        Domains  []string
+        Sources  []string // Откуда взяты данные: URL или путь источника
+        ASNs     []string // Origin ASN, из анонсов которых собран список
+        Tags     []string // Метки из tags источника для списков tagged
+        Trust    string   // trusted или untrusted, см. trust.go
+        // Рядом с .lst лежит копия с заглавной буквы (Meta.lst) для старых ссылок
+        LegacyCopy bool
+}
+
+// OutputConfig общие настройки простого формата вывода
+type OutputConfig struct {
+        Enabled bool   `yaml:"enabled"`
+        Dir     string `yaml:"dir"`
+}
+
+// listRenderer формат, который пишется отдельно для каждого списка
+type listRenderer struct {
+        name    string
+        format  string // Имя секции конфига: для layout и index.json
+        enabled func() bool
+        render  func(list *generatedList) error
+}
+
+var listRenderers = []listRenderer{
+        {"sing-box rule-set", "singbox", func() bool { return config.SingBox.Enabled }, generateSingBoxRuleSet},
+        {"sing-box binary rule-set", "srs", func() bool { return config.SingBox.Enabled && config.SingBox.Compile }, generateSingBoxBinaryRuleSet},
+        {"Surge ruleset", "surge", func() bool { return config.Surge.Enabled }, generateSurgeRuleset},
+        {"Quantumult X filter", "quantumultx", func() bool { return config.QuantumultX.Enabled }, generateQuantumultXFilter},
+        {"Keenetic routes", "keenetic", func() bool { return config.Keenetic.Enabled }, generateKeeneticRoutes},
+        {"OpenWrt pbr policy", "openwrt_pbr", func() bool { return config.OpenWrtPBR.Enabled }, generateOpenWrtPBR},
+        {"OpenWrt firewall ipset", "openwrt_ipset", func() bool { return config.OpenWrtIPSet.Enabled }, generateOpenWrtIPSet},
+        {"RouterOS delta script", "routeros", func() bool { return config.RouterOSDelta }, generateRouterOSDelta},
+        {"RouterOS import file", "routeros_file", func() bool { return config.RouterOSFile.Enabled }, generateRouterOSImportFile},
+        {"RouterOS DNS static", "routeros_dns", func() bool { return config.RouterOSDNS.Enabled }, generateRouterOSDNSStatic},
+        {"pfSense URL table", "pfsense", func() bool { return config.PfSense.Enabled }, generatePfSenseTable},
+        {"Cisco IOS config", "cisco", func() bool { return config.Cisco.Enabled }, generateCiscoConfig},
+        {"Junos prefix-list", "juniper", func() bool { return config.Juniper.Enabled }, generateJuniperPrefixList},
+        {"BIRD static protocol", "bird", func() bool { return config.BIRD.Enabled }, generateBIRDStatic},
+        {"FRR vtysh script", "frr", func() bool { return config.FRR.Enabled }, generateFRRScript},
+        {"VyOS script", "vyos", func() bool { return config.VyOS.Enabled }, generateVyOSScript},
+        {"EdgeOS script", "edgeos", func() bool { return config.EdgeOS.Enabled }, generateEdgeOSScript},
+        {"OpenVPN push routes", "openvpn", func() bool { return config.OpenVPN.Enabled }, generateOpenVPNPush},
+        {"WireGuard peer", "wireguard", func() bool { return config.WireGuard.Enabled }, generateWireGuardPeer},
+        {"AmneziaVPN site list", "amnezia", func() bool { return config.Amnezia.Enabled }, generateAmneziaSites},
+        {"Windows route scripts", "windows", func() bool { return config.Windows.Enabled }, generateWindowsRoutes},
+        {"Linux ip route script", "linux", func() bool { return config.Linux.Enabled }, generateLinuxRouteScript},
+        {"systemd-networkd drop-in", "networkd", func() bool { return config.Networkd.Enabled }, generateNetworkdDropIn},
+        {"Merlin VPN Director rules", "merlin", func() bool { return config.Merlin.Enabled }, generateMerlinRules},
+        {"unbound zones", "unbound", func() bool { return config.Unbound.Enabled }, generateUnboundConfig},
+        {"RPZ zone", "rpz", func() bool { return config.RPZ.Enabled }, generateRPZZone},
+        {"SmartDNS domain-set", "smartdns", func() bool { return config.SmartDNS.Enabled }, generateSmartDNSConfig},
+        {"dnscrypt-proxy rules", "dnscrypt", func() bool { return config.DNSCrypt.Enabled }, generateDNSCryptRules},
+        {"Squid ACL", "squid", func() bool { return config.Squid.Enabled }, generateSquidACL},
+        {"HAProxy ACL", "haproxy", func() bool { return config.HAProxy.Enabled }, generateHAProxyACL},
+        {"JSON list", "json", func() bool { return config.JSON.Enabled }, generateListJSON},
+        {"raw prefix list", "raw", func() bool { return config.Raw.Enabled }, generateRawList},
+}
+
+// listRenderedHook вызывается после каждого записанного формата списка (см. Runner)
+var listRenderedHook func(list *generatedList, format string)
+
+// generatedLists списки текущего запуска в порядке обработки
+var generatedLists []*generatedList
+
+// addGeneratedList регистрирует список для вывода. Списки с одинаковым
+// именем (например, подсети и домены Discord) объединяются по conflict_policy.
+func addGeneratedList(list generatedList) {
+        list.Name = strings.TrimSuffix(list.Name, ".lst")
+        for _, existing := range generatedLists {
+                if existing.Name == list.Name {
+                        mergeGeneratedList(existing, &list)
+                        reportListDone(existing)
+                        return
+                }
+        }
+        generatedLists = append(generatedLists, &list)
+        reportListDone(&list)
+}
+
+func reportListDone(list *generatedList) {
+        reportProgress(list.Name, "done", fmt.Sprintf("%d prefixes, %d domains", len(list.Prefixes), len(list.Domains)))
+}
+
+// listSelectedByName есть ли список среди имён names (имя файла или ListName)
+func listSelectedByName(names []string, list *generatedList) bool {
+        for _, name := range names {
+                if name == list.Name || name == list.ListName {
+                        return true
+                }
+        }
+        return false
+}
+
+// identifierName имя списка без пробелов для конфигов сетевого оборудования
+func identifierName(name string) string {
+        return strings.Join(strings.Fields(name), "_")
+}
+
+// writeOutputLines создаёт каталог формата и записывает в него файл построчно
+func writeOutputLines(dir, filename string, lines []string) error {
+        if err := os.MkdirAll(dir, 0755); err != nil {
+                return err
+        }
+        return writeLinesToFile(lines, filepath.Join(dir, filename))
+}
+
+// renderOutputs записывает все включённые в конфиге форматы для собранных списков
+func renderOutputs() {
+        for _, renderer := range listRenderers {
+                if !renderer.enabled() {
+                        continue
+                }
+                for _, list := range generatedLists {
+                        list := listForFormat(renderer.format, list)
+                        reportProgress(renderer.name, "render", list.Name)
+                        renderTarget.list, renderTarget.format = list.Name, renderer.format
+                        runStage(list.Name, renderer.name, func() {
+                                if err := renderer.render(list); err != nil {
+                                        log.Printf("Error generating %s for %s: %v", renderer.name, list.Name, err)
+                                } else if listRenderedHook != nil {
+                                        listRenderedHook(list, renderer.format)
+                                }
+                        })
+                        renderTarget.list, renderTarget.format = "", ""
+                }
+                reportProgress(renderer.name, "done", fmt.Sprintf("%d lists", len(generatedLists)))
+        }
+
+        // Общие файлы для всех списков сразу: из части списков они получились бы неполными
+        if partialRun() {
+                log.Println("Partial run (--only/--skip): shared files are not updated")
+                return
+        }
+        if config.Xray.GeoIP {
+                if err := generateGeoIPDat(generatedLists); err != nil {
+                        log.Printf("Error generating %s: %v", config.Xray.GeoIPFile, err)
+                }
+        }
+        if config.Xray.GeoSite {
+                if err := generateGeoSiteDat(generatedLists); err != nil {
+                        log.Printf("Error generating %s: %v", config.Xray.GeoSiteFile, err)
+                }
+        }
+        if config.MMDB.Enabled {
+                if err := generateMMDB(generatedLists); err != nil {
+                        log.Printf("Error generating %s: %v", config.MMDB.File, err)
+                }
+        }
+        if config.PfSense.Enabled {
+                if err := generatePfSenseIndex(generatedLists); err != nil {
+                        log.Printf("Error generating pfSense aliases: %v", err)
+                }
+        }
+        if config.RouterOSBootstrap.Enabled {
+                if err := generateRouterOSBootstrap(generatedLists); err != nil {
+                        log.Printf("Error generating RouterOS bootstrap script: %v", err)
+                }
+        }
+        if config.BIRD.Enabled {
+                if err := generateBIRDIndex(generatedLists); err != nil {
+                        log.Printf("Error generating BIRD index: %v", err)
+                }
+        }
+        if config.OPNsense.Enabled {
+                if err := generateOPNsenseAliases(generatedLists); err != nil {
+                        log.Printf("Error generating OPNsense aliases: %v", err)
+                }
+        }
+        if config.OpenVPN.Enabled {
+                if err := generateOpenVPNCCD(generatedLists); err != nil {
+                        log.Printf("Error generating OpenVPN CCD files: %v", err)
+                }
+        }
+        if config.WireGuard.Enabled {
+                if err := generateWireGuardPeers(generatedLists); err != nil {
+                        log.Printf("Error generating WireGuard peers: %v", err)
+                }
+        }
+        // Последним: ссылается на файлы остальных форматов
+        if config.Index.Enabled {
+                if err := generateIndex(generatedLists); err != nil {
+                        log.Printf("Error generating %s: %v", config.Index.File, err)
+                }
+        }
+}
+
+// pushOutputs применяет списки на устройствах, для которых настроена отправка
+func pushOutputs() {
+        if config.Keenetic.Push.Enabled {
+                runStage("Keenetic push", "push", func() {
+                        reportProgress("Keenetic push", "push", config.Keenetic.Push.Address)
+                        err := pushKeenetic(generatedLists)
+                        if err != nil {
+                                log.Printf("Error pushing routes to Keenetic: %v", err)
+                                reportProgress("Keenetic push", "failed", err.Error())
+                        } else {
+                                reportProgress("Keenetic push", "done", "")
+                        }
+                        recordPush("keenetic", generatedLists, err)
+                })
+        }
+        runStage("RouterOS push", "push", func() { pushRouterOS(generatedLists) })
+        runStage("SSH push", "push", func() { pushSSH(generatedLists) })
+        if applyNFTables {
+                runStage("nftables", "apply", func() {
+                        if err := applyNFTablesSets(generatedLists); err != nil {
+                                log.Printf("Error applying nftables sets: %v", err)
+                                reportProgress("nftables", "failed", err.Error())
+                        }
+                })
+        }
+        if config.GoBGP.Enabled {
+                runStage("gobgp", "announce", func() {
+                        if err := announceGoBGP(generatedLists); err != nil {
+                                log.Printf("Error announcing to gobgp: %v", err)
+                                reportProgress("gobgp", "failed", err.Error())
+                        }
+                })
+        }
+        if applyIPSet {
+                runStage("ipset", "apply", func() {
+                        if err := applyIPSetSets(generatedLists); err != nil {
+                                log.Printf("Error applying ipsets: %v", err)
+                                reportProgress("ipset", "failed", err.Error())
+                        }
+                })
+        }
+
+        // Списки, которые не удалось отправить в прошлых запусках
+        processPushQueue()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+        "encoding/xml"
+        "fmt"
+        "os"
+        "path/filepath"
+        "strconv"
+        "strings"
+)
+
+// PfSenseConfig списки для алиасов URL Table в pfSense: файлы CIDR по
+// постоянным адресам, индекс и фрагмент config.xml с алиасами
+type PfSenseConfig struct {
+        OutputConfig `yaml:",inline"`
+        BaseURL      string `yaml:"base_url"`    // Где публикуется каталог dir
+        UpdateFreq   int    `yaml:"update_freq"` // Период обновления алиаса в днях
+}
+
+type pfSenseAlias struct {
+        XMLName    xml.Name `xml:"alias"`
+        Name       string   `xml:"name"`
+        Type       string   `xml:"type"`
+        URL        string   `xml:"url"`
+        UpdateFreq string   `xml:"updatefreq"`
+        Address    string   `xml:"address"`
+        Descr      string   `xml:"descr"`
+        Detail     string   `xml:"detail"`
+}
+
+type pfSenseAliases struct {
+        XMLName xml.Name       `xml:"aliases"`
+        Aliases []pfSenseAlias `xml:"alias"`
+}
+
+// pfSenseAliasName имя алиаса: буквы, цифры и _, не длиннее 31 символа
+func pfSenseAliasName(name string) string {
+        alias := strings.Map(func(r rune) rune {
+                if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+                        return r
+                }
+                return '_'
+        }, name)
+        if len(alias) > 31 {
+                alias = alias[:31]
+        }
+        return alias
+}
+
+func pfSenseURL(list *generatedList) string {
+        return layoutURL(config.PfSense.BaseURL, "pfsense", list.Name, config.PfSense.Dir, list.Name+".txt")
+}
+
+func generatePfSenseTable(list *generatedList) error {
+        if len(list.Prefixes) == 0 {
+                return nil
+        }
+        lines := make([]string, 0, len(list.Prefixes))
+        for _, prefix := range list.Prefixes {
+                lines = append(lines, prefix.String())
+        }
+        return writeOutputLines(layoutDir("pfsense", list.Name, config.PfSense.Dir), list.Name+".txt", lines)
+}
+
+// generatePfSenseIndex пишет index.txt (алиас и адрес таблицы) и aliases.xml для config.xml
+func generatePfSenseIndex(lists []*generatedList) error {
+        if config.PfSense.BaseURL == "" {
+                return fmt.Errorf("pfsense.base_url is required")
+        }
+
+        var index []string
+        var aliases pfSenseAliases
+        for _, list := range lists {
+                if len(list.Prefixes) == 0 {
+                        continue
+                }
+                name := pfSenseAliasName(list.ListName)
+                url := pfSenseURL(list)
+                index = append(index, name+" "+url)
+                aliases.Aliases = append(aliases.Aliases, pfSenseAlias{
+                        Name:       name,
+                        Type:       "urltable",
+                        URL:        url,
+                        UpdateFreq: strconv.Itoa(config.PfSense.UpdateFreq),
+                        Address:    url,
+                        Descr:      list.Comment,
+                })
+        }
+
+        if err := writeOutputLines(config.PfSense.Dir, "index.txt", index); err != nil {
+                return err
+        }
+
+        data, err := xml.MarshalIndent(aliases, "", "\t")
+        if err != nil {
+                return err
+        }
+        if err := os.MkdirAll(config.PfSense.Dir, 0755); err != nil {
+                return err
+        }
+        return writeFileStaged(filepath.Join(config.PfSense.Dir, "aliases.xml"), append(data, '\n'))
+}
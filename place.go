@@ -0,0 +1,94 @@
+package main
+
+import (
+        "errors"
+        "log"
+        "os"
+        "path/filepath"
+        "syscall"
+        "time"
+)
+
+// Перенос готового файла из каталога запуска на место назначения. Выходные
+// каталоги часто лежат на NAS (NFS/SMB), где rename между файловыми
+// системами невозможен, а замена файла, который сейчас читает роутер,
+// может временно падать с EBUSY.
+//
+// write_strategy:
+//   rename  - rename из каталога запуска, при другой ФС копия рядом с файлом и rename (по умолчанию)
+//   copy    - всегда копия во временный файл рядом с назначением и rename
+//   inplace - перезапись на месте, для шар, где rename поверх файла не работает совсем
+
+// retryableWriteError временная ошибка сетевой ФС, после которой стоит повторить
+func retryableWriteError(err error) bool {
+        return errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.ETXTBSY) ||
+                errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.ESTALE)
+}
+
+// withWriteRetry повторяет op с растущей паузой, пока ошибка временная
+func withWriteRetry(op func() error) error {
+        delay := 200 * time.Millisecond
+        var err error
+        for attempt := 0; ; attempt++ {
+                err = op()
+                if err == nil || !retryableWriteError(err) || attempt >= config.WriteRetries {
+                        return err
+                }
+                time.Sleep(delay)
+                delay *= 2
+        }
+}
+
+// placeFile переносит src в dest по выбранной стратегии
+func placeFile(src, dest string) error {
+        switch config.WriteStrategy {
+        case "inplace":
+                return withWriteRetry(func() error { return copyFile(src, dest) })
+        case "copy":
+                return copyAndRename(src, dest)
+        }
+
+        err := withWriteRetry(func() error { return os.Rename(src, dest) })
+        if err == nil {
+                return nil
+        }
+        // Каталог запуска может быть на другой файловой системе
+        return copyAndRename(src, dest)
+}
+
+// copyAndRename копирует src во временный файл рядом с dest и переименовывает
+// его. Если rename поверх занятого файла так и не прошёл, файл
+// перезаписывается на месте: лучше так, чем оставить старую версию.
+func copyAndRename(src, dest string) error {
+        // Уникальное имя: в ту же шару могут писать несколько машин сразу
+        tmpFile, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".tmp-*")
+        if err != nil {
+                return err
+        }
+        tmp := tmpFile.Name()
+        tmpFile.Close()
+        if err := withWriteRetry(func() error { return copyFile(src, tmp) }); err != nil {
+                os.Remove(tmp)
+                return err
+        }
+        // CreateTemp создаёт файл с 0600: после rename его не прочитал бы веб-сервер
+        info, err := os.Stat(src)
+        if err == nil {
+                err = os.Chmod(tmp, info.Mode().Perm())
+        }
+        if err != nil {
+                os.Remove(tmp)
+                return err
+        }
+
+        err = withWriteRetry(func() error { return os.Rename(tmp, dest) })
+        if err == nil {
+                return nil
+        }
+        os.Remove(tmp)
+        if !retryableWriteError(err) {
+                return err
+        }
+        log.Printf("Warning: %s is busy (%v), overwriting in place", dest, err)
+        return withWriteRetry(func() error { return copyFile(src, dest) })
+}
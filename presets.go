@@ -0,0 +1,171 @@
+package main
+
+import (
+        "fmt"
+        "log"
+        "sort"
+        "strings"
+
+        "gopkg.in/yaml.v3"
+)
+
+// preset готовый набор источников: фрагменты YAML по секциям конфига
+type preset struct {
+        Description string
+        Sections    map[string]string // Секция -> её содержимое с отступом в два пробела
+}
+
+const servicesURL = "https://raw.githubusercontent.com/itdoginfo/allow-domains/main/Services/"
+
+var presets = map[string]preset{
+        "telegram": {
+                Description: "Telegram: официальные подсети и домены",
+                Sections: map[string]string{
+                        "telegram": `  cidr_url: "https://core.telegram.org/resources/cidr.txt"
+  cache_ttl: "24h"
+  file: "telegram.lst"
+  list_name: "TELEGRAM"
+`,
+                        "domains": `  telegram:
+    sources:
+      - "` + servicesURL + `telegram.lst"
+`,
+                },
+        },
+        "discord": {
+                Description: "Discord: голосовые серверы и домены",
+                Sections: map[string]string{
+                        "discord": `  voice_v4: "https://iplist.opencck.org/?format=text&data=cidr4&site=discord.gg&site=discord.media"
+  file: "discord.lst"
+  list_name: "DISCORD"
+`,
+                        "domains": `  discord:
+    sources:
+      - "` + servicesURL + `discord.lst"
+`,
+                },
+        },
+        "cloudflare": {
+                Description: "Cloudflare: опубликованные подсети и домены",
+                Sections: map[string]string{
+                        "cloudflare": `  v4: "https://www.cloudflare.com/ips-v4"
+  file: "cloudflare.lst"
+  list_name: "CLOUDFLARE"
+`,
+                        "domains": `  cloudflare:
+    sources:
+      - "` + servicesURL + `cloudflare.lst"
+`,
+                },
+        },
+        "youtube": {
+                Description: "YouTube: сети AS36040 и домены",
+                Sections: map[string]string{
+                        "as_numbers": `  "AS36040":  # YouTube
+    file: "youtube.lst"
+    list_name: "YOUTUBE"
+    comment: "YouTube networks"
+`,
+                        "domains": `  youtube:
+    sources:
+      - "` + servicesURL + `youtube.lst"
+`,
+                },
+        },
+}
+
+// presetSectionOrder порядок секций в сгенерированном конфиге
+var presetSectionOrder = []string{"as_numbers", "discord", "telegram", "cloudflare", "domains"}
+
+func presetNames() []string {
+        names := make([]string, 0, len(presets))
+        for name := range presets {
+                names = append(names, name)
+        }
+        sort.Strings(names)
+        return names
+}
+
+// presetFetches собирает, что пресет скачивает: URL источников и ASN из таблицы BGP
+func presetFetches(p preset) (urls, asns []string, err error) {
+        for _, section := range presetSectionOrder {
+                body, ok := p.Sections[section]
+                if !ok {
+                        continue
+                }
+                var parsed map[string]any
+                if err := yaml.Unmarshal([]byte(section+":\n"+body), &parsed); err != nil {
+                        return nil, nil, fmt.Errorf("preset section %s: %w", section, err)
+                }
+                if section == "as_numbers" {
+                        if items, ok := parsed[section].(map[string]any); ok {
+                                for as := range items {
+                                        asns = append(asns, as)
+                                }
+                        }
+                }
+                collectURLs(parsed[section], &urls)
+        }
+        sort.Strings(urls)
+        sort.Strings(asns)
+        return urls, asns, nil
+}
+
+func collectURLs(value any, urls *[]string) {
+        switch v := value.(type) {
+        case string:
+                if isURL(v) {
+                        *urls = append(*urls, v)
+                }
+        case []any:
+                for _, item := range v {
+                        collectURLs(item, urls)
+                }
+        case map[string]any:
+                for _, item := range v {
+                        collectURLs(item, urls)
+                }
+        }
+}
+
+func presetsCommand(args []string) {
+        if len(args) == 0 || args[0] == "list" {
+                for _, name := range presetNames() {
+                        fmt.Printf("%-12s %s\n", name, presets[name].Description)
+                }
+                return
+        }
+        if args[0] != "show" || len(args) < 2 {
+                log.Fatal("Usage: get_subnets presets list | presets show <name>")
+        }
+
+        name := strings.ToLower(args[1])
+        p, ok := presets[name]
+        if !ok {
+                log.Fatalf("unknown preset %q (available: %s)", name, strings.Join(presetNames(), ", "))
+        }
+        urls, asns, err := presetFetches(p)
+        if err != nil {
+                log.Fatal(err)
+        }
+
+        fmt.Printf("%s: %s\n", name, p.Description)
+        if len(asns) > 0 {
+                fmt.Printf("\nASNs (prefixes from the BGP table):\n")
+                for _, as := range asns {
+                        fmt.Printf("  %s\n", as)
+                }
+        }
+        if len(urls) > 0 {
+                fmt.Printf("\nDownloads:\n")
+                for _, url := range urls {
+                        fmt.Printf("  %s\n", url)
+                }
+        }
+        fmt.Printf("\nConfig sections:\n")
+        for _, section := range presetSectionOrder {
+                if body, ok := p.Sections[section]; ok {
+                        fmt.Printf("%s:\n%s", section, body)
+                }
+        }
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+        "bufio"
+        "log"
+        "net/netip"
+        "os"
+        "path/filepath"
+        "strings"
+)
+
+// progressEvent этап обработки одного источника или формата вывода
+type progressEvent struct {
+        Source string
+        Stage  string // download, aggregate, render, push, done
+        Detail string
+}
+
+// progressHandler получает события обработки; без TUI события не нужны, хватает логов
+var progressHandler func(progressEvent)
+
+func reportProgress(source, stage, detail string) {
+        if progressHandler != nil {
+                progressHandler(progressEvent{Source: source, Stage: stage, Detail: detail})
+        }
+}
+
+// previousLists содержимое .lst до запуска, чтобы показать, что изменилось
+var previousLists map[string]map[netip.Prefix]bool
+
+func snapshotPreviousLists() {
+        previousLists = make(map[string]map[netip.Prefix]bool)
+        var files []string
+        for _, dir := range layoutDirs("ipv4", config.IPv4Dir) {
+                matches, _ := filepath.Glob(filepath.Join(dir, "*.lst"))
+                files = append(files, matches...)
+        }
+        for _, path := range files {
+                file, err := os.Open(path)
+                if err != nil {
+                        continue
+                }
+                prefixes := make(map[netip.Prefix]bool)
+                scanner := bufio.NewScanner(file)
+                for scanner.Scan() {
+                        line, _, _ := strings.Cut(scanner.Text(), "#")
+                        if prefix, err := netip.ParsePrefix(strings.TrimSpace(line)); err == nil {
+                                prefixes[prefix] = true
+                        }
+                }
+                file.Close()
+                previousLists[strings.TrimSuffix(filepath.Base(path), ".lst")] = prefixes
+        }
+}
+
+// listDiff изменение префиксов списка относительно прошлого запуска
+type listDiff struct {
+        Name           string
+        Added, Removed int
+        New            bool
+}
+
+func generatedListDiffs() []listDiff {
+        var diffs []listDiff
+        for _, list := range generatedLists {
+                if len(list.Prefixes) == 0 {
+                        continue
+                }
+                previous, ok := previousLists[list.Name]
+                diff := listDiff{Name: list.Name, New: !ok}
+
+                current := make(map[netip.Prefix]bool, len(list.Prefixes))
+                for _, prefix := range list.Prefixes {
+                        if prefix.Addr().Is4() {
+                                current[prefix] = true
+                                if !previous[prefix] {
+                                        diff.Added++
+                                }
+                        }
+                }
+                for prefix := range previous {
+                        if !current[prefix] {
+                                diff.Removed++
+                        }
+                }
+                if diff.New || diff.Added > 0 || diff.Removed > 0 {
+                        diffs = append(diffs, diff)
+                }
+        }
+        return diffs
+}
+
+func logListDiffs(diffs []listDiff) {
+        for _, diff := range diffs {
+                if diff.New {
+                        log.Printf("%s: new list, %d prefixes", diff.Name, diff.Added)
+                } else {
+                        log.Printf("%s: +%d -%d prefixes", diff.Name, diff.Added, diff.Removed)
+                }
+        }
+}
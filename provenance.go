@@ -0,0 +1,450 @@
+package main
+
+import (
+        "encoding/json"
+        "flag"
+        "fmt"
+        "log"
+        "net/netip"
+        "os"
+        "path/filepath"
+        "sort"
+        "strings"
+        "time"
+
+        "go4.org/netipx"
+)
+
+// prefixOrigin строка источника, из которой префикс попал в список
+type prefixOrigin struct {
+        Prefix netip.Prefix `json:"prefix"`
+        Source string       `json:"source"`         // URL, путь или config
+        Line   string       `json:"line,omitempty"` // Строка источника как есть
+        ASN    string       `json:"asn,omitempty"`
+}
+
+// prefixRule правило, которое добавило или убрало префиксы после сборки из источников
+type prefixRule struct {
+        Rule     string         `json:"rule"`
+        Action   string         `json:"action"`             // include, exclude или intersect
+        Prefixes []netip.Prefix `json:"prefixes,omitempty"` // Пусто - правило для всего списка
+}
+
+// ProvenanceConfig происхождение префиксов пишется в provenance.json в каталоге
+// кэша (уходит в state export); по нему работают why и audit
+type ProvenanceConfig struct {
+        Comments bool `yaml:"comments"` // Комментарий с ASN или источником у каждой строки .lst
+}
+
+// listProvenance происхождение префиксов одного списка
+type listProvenance struct {
+        Origins []prefixOrigin       `json:"origins,omitempty"`
+        Rules   []prefixRule         `json:"rules,omitempty"`
+        Fetched map[string]time.Time `json:"fetched,omitempty"` // Когда загружен каждый источник
+        sorted  bool
+}
+
+// provenance собранное в этом запуске по имени списка без .lst
+var provenance map[string]*listProvenance
+
+func provenancePath() string {
+        return filepath.Join(config.Cache.Dir, "provenance.json")
+}
+
+func listProvenanceFor(file string) *listProvenance {
+        if provenance == nil {
+                provenance = make(map[string]*listProvenance)
+        }
+        name := strings.TrimSuffix(file, ".lst")
+        p := provenance[name]
+        if p == nil {
+                p = &listProvenance{}
+                provenance[name] = p
+        }
+        return p
+}
+
+func noteOrigin(file string, origin prefixOrigin) {
+        p := listProvenanceFor(file)
+        p.Origins = append(p.Origins, origin)
+        p.sorted = false
+        if _, ok := p.Fetched[origin.Source]; !ok && origin.Source != "config" {
+                if p.Fetched == nil {
+                        p.Fetched = make(map[string]time.Time)
+                }
+                p.Fetched[origin.Source] = sourceFetchTime(origin.Source)
+        }
+}
+
+// sourceFetchTime время загрузки источника: запись кэша или сам локальный файл
+func sourceFetchTime(source string) time.Time {
+        if info, err := os.Stat(cachePath(source)); err == nil {
+                return info.ModTime().UTC()
+        }
+        if info, err := os.Stat(source); err == nil {
+                return info.ModTime().UTC()
+        }
+        return time.Now().UTC()
+}
+
+// originsOf строки источников, из которых собран опубликованный префикс:
+// вошедшие в него, а для куска после исключения - покрывающая строка
+func (p *listProvenance) originsOf(prefix netip.Prefix) []prefixOrigin {
+        if !p.sorted {
+                sort.SliceStable(p.Origins, func(i, j int) bool {
+                        if c := p.Origins[i].Prefix.Addr().Compare(p.Origins[j].Prefix.Addr()); c != 0 {
+                                return c < 0
+                        }
+                        return p.Origins[i].Prefix.Bits() < p.Origins[j].Prefix.Bits()
+                })
+                p.sorted = true
+        }
+        first := sort.Search(len(p.Origins), func(i int) bool {
+                return p.Origins[i].Prefix.Addr().Compare(prefix.Addr()) >= 0
+        })
+        var out []prefixOrigin
+        for _, origin := range p.Origins[first:] {
+                if !prefix.Contains(origin.Prefix.Addr()) {
+                        break
+                }
+                if origin.Prefix.Bits() >= prefix.Bits() {
+                        out = append(out, origin)
+                }
+        }
+        if len(out) == 0 {
+                for _, origin := range p.Origins {
+                        if origin.Prefix.Bits() <= prefix.Bits() && origin.Prefix.Contains(prefix.Addr()) {
+                                out = append(out, origin)
+                        }
+                }
+        }
+        return out
+}
+
+// entryComment короткий комментарий строки .lst: ASN, иначе источники, и правила,
+// которые добавили префикс
+func (p *listProvenance) entryComment(prefix netip.Prefix) string {
+        var parts []string
+        seen := make(map[string]bool)
+        add := func(value string) {
+                if value != "" && !seen[value] {
+                        seen[value] = true
+                        parts = append(parts, value)
+                }
+        }
+        origins := p.originsOf(prefix)
+        for _, origin := range origins {
+                add(origin.ASN)
+        }
+        if len(parts) == 0 {
+                for _, origin := range origins {
+                        add(origin.Source)
+                }
+        }
+        for _, rule := range p.Rules {
+                if rule.Action == "include" && overlapsAny(rule.Prefixes, prefix) {
+                        add(rule.Rule)
+                }
+        }
+        sort.Strings(parts)
+        return strings.Join(shortList(parts), ", ")
+}
+
+func noteRule(file, rule, action string, prefixes []netip.Prefix) {
+        p := listProvenanceFor(file)
+        p.Rules = append(p.Rules, prefixRule{Rule: rule, Action: action, Prefixes: prefixes})
+}
+
+// noteASNOrigins записывает анонсы asns из таблицы BGP (или RIPEstat) как источники списка
+func noteASNOrigins(file string, subnets []subnetAS, asns []string) {
+        wanted := make(map[string]bool, len(asns))
+        for _, as := range asns {
+                wanted[normalizeASN(as)] = true
+        }
+        for _, item := range subnets {
+                if !wanted[normalizeASN(item.as)] {
+                        continue
+                }
+                prefix, err := netip.ParsePrefix(item.subnet)
+                if err != nil || !prefix.Addr().Is4() {
+                        continue
+                }
+                source := item.source
+                if source == "" {
+                        source = config.BGPToolsURL
+                }
+                noteOrigin(file, prefixOrigin{Prefix: prefix, Source: source, Line: item.subnet + " " + item.as, ASN: "AS" + normalizeASN(item.as)})
+        }
+}
+
+// noteChange записывает, что правило rule убрало из списка и что добавило
+func noteChange(file, rule string, before, after []netip.Prefix) {
+        a, err := prefixSet(before)
+        if err != nil {
+                return
+        }
+        b, err := prefixSet(after)
+        if err != nil {
+                return
+        }
+        var removed, added netipx.IPSetBuilder
+        removed.AddSet(a)
+        removed.RemoveSet(b)
+        added.AddSet(b)
+        added.RemoveSet(a)
+        if set, err := removed.IPSet(); err == nil && len(set.Prefixes()) > 0 {
+                noteRule(file, rule, "exclude", set.Prefixes())
+        }
+        if set, err := added.IPSet(); err == nil && len(set.Prefixes()) > 0 {
+                noteRule(file, rule, "include", set.Prefixes())
+        }
+}
+
+func readProvenance() (map[string]*listProvenance, error) {
+        state := make(map[string]*listProvenance)
+        data, err := os.ReadFile(provenancePath())
+        if os.IsNotExist(err) {
+                return state, nil
+        }
+        if err != nil {
+                return nil, err
+        }
+        if err := json.Unmarshal(data, &state); err != nil {
+                return nil, fmt.Errorf("%s: %w", provenancePath(), err)
+        }
+        return state, nil
+}
+
+// saveProvenance заменяет в файле списки, собранные в этом запуске; прочие
+// остаются, пока они есть в конфиге
+func saveProvenance() {
+        if provenance == nil {
+                return
+        }
+        state, err := readProvenance()
+        if err != nil {
+                log.Printf("Error reading %s: %v", provenancePath(), err)
+                state = make(map[string]*listProvenance)
+        }
+        known := configuredListMeta()
+        for name := range config.Tagged {
+                known[name] = listMeta{}
+        }
+        for name := range state {
+                if _, ok := known[name]; !ok && !partialRun() {
+                        delete(state, name)
+                }
+        }
+        for name, p := range provenance {
+                state[name] = p
+        }
+
+        data, err := json.Marshal(state)
+        if err == nil {
+                if err = os.MkdirAll(filepath.Dir(provenancePath()), 0755); err == nil {
+                        err = writeFileStaged(provenancePath(), append(data, '\n'))
+                }
+        }
+        if err != nil {
+                log.Printf("Error writing %s: %v", provenancePath(), err)
+        }
+}
+
+func overlapsAny(prefixes []netip.Prefix, query netip.Prefix) bool {
+        for _, prefix := range prefixes {
+                if prefix.Overlaps(query) {
+                        return true
+                }
+        }
+        return false
+}
+
+// whyCommand объясняет, откуда префикс или адрес в списке: why <list> <prefix> [config]
+func whyCommand(args []string) {
+        flags := flag.NewFlagSet("why", flag.ExitOnError)
+        flags.Parse(args)
+        if flags.NArg() < 2 {
+                log.Fatal("Usage: get_subnets why <list> <prefix|address> [config-file]")
+        }
+        configPath := "config.yaml"
+        if flags.NArg() > 2 {
+                configPath = flags.Arg(2)
+        }
+        if err := loadConfig(configPath); err != nil {
+                log.Fatal("Error loading config:", err)
+        }
+        query, err := parsePrefixOrAddr(flags.Arg(1))
+        if err != nil {
+                log.Fatalf("Invalid prefix %q: %v", flags.Arg(1), err)
+        }
+        query = query.Masked()
+
+        lists, err := loadPublishedLists()
+        if err != nil {
+                log.Fatal("Error reading lists: ", err)
+        }
+        var list *generatedList
+        for _, l := range lists {
+                if listSelectedByName([]string{strings.TrimSuffix(flags.Arg(0), ".lst")}, l) {
+                        list = l
+                }
+        }
+        name := strings.TrimSuffix(flags.Arg(0), ".lst")
+        if list != nil {
+                name = list.Name
+                var covering []string
+                for _, prefix := range list.Prefixes {
+                        if prefix.Overlaps(query) {
+                                covering = append(covering, prefix.String())
+                        }
+                }
+                if len(covering) > 0 {
+                        fmt.Printf("%s: %s is in the list as %s\n", name, query, strings.Join(shortList(covering), ", "))
+                } else {
+                        fmt.Printf("%s: %s is not in the list\n", name, query)
+                }
+        } else {
+                fmt.Printf("%s: list is not published in %s\n", name, config.IPv4Dir)
+        }
+        if listSelectedByName(config.Freeze.Lists, &generatedList{Name: name}) {
+                fmt.Println("  list is frozen: content is kept from an earlier run")
+        }
+        if snapshot, ok := config.Freeze.Pin[name]; ok {
+                fmt.Printf("  list is pinned to snapshot %s\n", snapshot)
+        }
+
+        state, err := readProvenance()
+        if err != nil {
+                log.Fatal(err)
+        }
+        explain := func(name, indent string) bool {
+                p := state[name]
+                if p == nil {
+                        return false
+                }
+                seen := make(map[prefixOrigin]bool)
+                for _, origin := range p.Origins {
+                        if !origin.Prefix.Overlaps(query) || seen[origin] {
+                                continue
+                        }
+                        seen[origin] = true
+                        line := fmt.Sprintf("%s%s from %s", indent, origin.Prefix, origin.Source)
+                        if origin.Line != "" && origin.Line != origin.Prefix.String() {
+                                line += fmt.Sprintf(": %q", origin.Line)
+                        }
+                        if origin.ASN != "" {
+                                line += " (" + origin.ASN + ")"
+                        }
+                        if fetched, ok := p.Fetched[origin.Source]; ok {
+                                line += ", fetched " + fetched.Format(time.RFC3339)
+                        }
+                        fmt.Println(line)
+                }
+                for _, rule := range p.Rules {
+                        if len(rule.Prefixes) > 0 && !overlapsAny(rule.Prefixes, query) {
+                                continue
+                        }
+                        fmt.Printf("%s%s: %s\n", indent, rule.Action, rule.Rule)
+                }
+                return true
+        }
+
+        for key, tagged := range config.Tagged {
+                if key != name && strings.TrimSuffix(tagged.File, ".lst") != name {
+                        continue
+                }
+                fmt.Printf("  tagged list: %s\n", tagged.Match)
+                names := make([]string, 0, len(state))
+                for member := range state {
+                        names = append(names, member)
+                }
+                sort.Strings(names)
+                for _, member := range names {
+                        if member == name {
+                                continue
+                        }
+                        for _, origin := range state[member].Origins {
+                                if origin.Prefix.Overlaps(query) {
+                                        fmt.Printf("  via %s:\n", member)
+                                        explain(member, "    ")
+                                        break
+                                }
+                        }
+                }
+                return
+        }
+        if !explain(name, "  ") {
+                fmt.Println("  no provenance recorded for this list yet, run get_subnets first")
+        }
+
+        // Форматы с aggregation публикуют список шире, чем .lst
+        formats := make([]string, 0, len(config.Aggregation))
+        for format := range config.Aggregation {
+                formats = append(formats, format)
+        }
+        sort.Strings(formats)
+        for _, format := range formats {
+                if widened := aggregateForFormat(format, []netip.Prefix{query}); widened[0] != query {
+                        fmt.Printf("  %s output: published as part of %s (aggregation)\n", format, widened[0])
+                }
+        }
+}
+
+// auditCommand выводит происхождение каждого опубликованного префикса в TSV:
+// список, префикс, исходная строка, ASN, источник и время его загрузки
+func auditCommand(args []string) {
+        flags := flag.NewFlagSet("audit", flag.ExitOnError)
+        only := flags.String("lists", "", "comma-separated list names to audit")
+        flags.Parse(args)
+
+        configPath := "config.yaml"
+        if flags.NArg() > 0 {
+                configPath = flags.Arg(0)
+        }
+        if err := loadConfig(configPath); err != nil {
+                log.Fatal("Error loading config:", err)
+        }
+        lists, err := loadPublishedLists()
+        if err != nil {
+                log.Fatal("Error reading lists: ", err)
+        }
+        state, err := readProvenance()
+        if err != nil {
+                log.Fatal(err)
+        }
+
+        sort.Slice(lists, func(i, j int) bool { return lists[i].Name < lists[j].Name })
+        fmt.Println("list\tprefix\torigin\tasn\tsource\tfetched\tline")
+        for _, list := range lists {
+                if *only != "" && !listSelectedByName(strings.Split(*only, ","), list) {
+                        continue
+                }
+                p := state[list.Name]
+                if p == nil {
+                        p = &listProvenance{}
+                }
+                for _, prefix := range list.Prefixes {
+                        origins := p.originsOf(prefix)
+                        if len(origins) == 0 {
+                                // Префикс без строки источника: его добавило правило или список заморожен
+                                fmt.Printf("%s\t%s\t-\t-\t%s\t-\t-\n", list.Name, prefix, orDash(p.entryComment(prefix)))
+                                continue
+                        }
+                        for _, origin := range origins {
+                                fetched := "-"
+                                if t, ok := p.Fetched[origin.Source]; ok {
+                                        fetched = t.Format(time.RFC3339)
+                                }
+                                fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\t%s\n", list.Name, prefix, origin.Prefix, orDash(origin.ASN),
+                                        origin.Source, fetched, orDash(strings.Join(strings.Fields(origin.Line), " ")))
+                        }
+                }
+        }
+}
+
+func orDash(value string) string {
+        if value == "" {
+                return "-"
+        }
+        return value
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+        "fmt"
+        "path"
+        "sort"
+        "strings"
+)
+
+// SquidConfig ACL-файлы dst/dstdomain и сниппет squid.conf, который их подключает
+type SquidConfig struct {
+        OutputConfig `yaml:",inline"`
+        ACLDir       string `yaml:"acl_dir"` // Где лежат ACL-файлы на прокси
+}
+
+// uniqueDomains домены без точки в начале, без повторов и без поддоменов
+// уже перечисленных доменов: Squid считает такие записи ошибкой
+func uniqueDomains(domains []string) []string {
+        set := make(map[string]bool, len(domains))
+        for _, domain := range domains {
+                set[strings.ToLower(trimDomainDot(domain))] = true
+        }
+
+        var out []string
+        for domain := range set {
+                covered := false
+                for parent := domain; !covered; {
+                        _, rest, ok := strings.Cut(parent, ".")
+                        if !ok {
+                                break
+                        }
+                        covered = set[rest]
+                        parent = rest
+                }
+                if !covered {
+                        out = append(out, domain)
+                }
+        }
+        sort.Strings(out)
+        return out
+}
+
+func generateSquidACL(list *generatedList) error {
+        dir := layoutDir("squid", list.Name, config.Squid.Dir)
+        aclName := identifierName(list.Name)
+        snippet := []string{"# " + list.Comment}
+
+        if len(list.Prefixes) > 0 {
+                var lines []string
+                for _, prefix := range list.Prefixes {
+                        lines = append(lines, prefix.String())
+                }
+                file := list.Name + "-dst.acl"
+                if err := writeOutputLines(dir, file, lines); err != nil {
+                        return err
+                }
+                snippet = append(snippet, fmt.Sprintf("acl %s_dst dst %q", aclName, path.Join(config.Squid.ACLDir, file)))
+        }
+        if len(list.Domains) > 0 {
+                var lines []string
+                for _, domain := range uniqueDomains(list.Domains) {
+                        lines = append(lines, "."+domain)
+                }
+                file := list.Name + "-dstdomain.acl"
+                if err := writeOutputLines(dir, file, lines); err != nil {
+                        return err
+                }
+                snippet = append(snippet, fmt.Sprintf("acl %s_dstdomain dstdomain %q", aclName, path.Join(config.Squid.ACLDir, file)))
+        }
+        if len(snippet) == 1 {
+                return nil
+        }
+        return writeOutputLines(dir, list.Name+".conf", snippet)
+}
+
+// generateHAProxyACL файлы для acl ... -f: подсети для src/dst и домены для
+// hdr(host) -m dom или req.ssl_sni -m dom (совпадают и поддомены)
+func generateHAProxyACL(list *generatedList) error {
+        dir := layoutDir("haproxy", list.Name, config.HAProxy.Dir)
+
+        if len(list.Prefixes) > 0 {
+                lines := []string{"# " + list.Comment, "# acl " + identifierName(list.Name) + " dst -f " + list.Name + ".lst"}
+                for _, prefix := range list.Prefixes {
+                        lines = append(lines, prefix.String())
+                }
+                if err := writeOutputLines(dir, list.Name+".lst", lines); err != nil {
+                        return err
+                }
+        }
+        if len(list.Domains) > 0 {
+                lines := []string{"# " + list.Comment, "# acl " + identifierName(list.Name) + "_sni req.ssl_sni -m dom -f " + list.Name + "-domains.lst"}
+                lines = append(lines, uniqueDomains(list.Domains)...)
+                return writeOutputLines(dir, list.Name+"-domains.lst", lines)
+        }
+        return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+        "flag"
+        "log"
+        "os"
+        "sort"
+        "strings"
+
+        "go4.org/netipx"
+)
+
+// listMeta имя address-list и комментарий списка так, как их задаёт сборка
+type listMeta struct {
+        listName, comment string
+}
+
+// configuredListMeta имена и комментарии списков из конфига по имени файла без .lst
+func configuredListMeta() map[string]listMeta {
+        meta := make(map[string]listMeta)
+        add := func(file, listName, comment string) {
+                name := strings.TrimSuffix(file, ".lst")
+                if listName == "" {
+                        listName = name
+                }
+                meta[name] = listMeta{listName, comment}
+        }
+        orDefault := func(value, def string) string {
+                if value == "" {
+                        return def
+                }
+                return value
+        }
+
+        for as, asConfig := range config.ASNumbers {
+                add(asConfig.File, asConfig.ListName, orDefault(asConfig.Comment, as))
+        }
+        for name, filter := range config.Filters {
+                add(orDefault(filter.File, name+".lst"), filter.ListName, orDefault(filter.Comment, name))
+        }
+        for name, static := range config.Static {
+                add(orDefault(static.File, name+".lst"), static.ListName, orDefault(static.Comment, name))
+        }
+        add(orDefault(config.Discord.File, "discord.lst"), config.Discord.ListName, "DISCORD")
+        add(orDefault(config.Telegram.File, "telegram.lst"), config.Telegram.ListName, "TELEGRAM")
+        add(orDefault(config.Cloudflare.File, "cloudflare.lst"), config.Cloudflare.ListName, "CLOUDFLARE")
+        add(orDefault(config.AWS.File, "aws.lst"), config.AWS.ListName, "AWS")
+        add(orDefault(config.Google.File, "google.lst"), config.Google.ListName, "GOOGLE")
+        for name, tagged := range config.Tagged {
+                add(orDefault(tagged.File, name+".lst"), tagged.ListName, orDefault(tagged.Comment, name))
+        }
+        return meta
+}
+
+// loadPublishedLists читает уже собранные .lst, чтобы отправить их без загрузки источников.
+// Открываются только списки из конфига: в каталоге лежат и копии Title-case
+// (copyFileLegacy), и <name>-anycast.lst, это не отдельные списки.
+func loadPublishedLists() ([]*generatedList, error) {
+        meta := configuredListMeta()
+        names := make([]string, 0, len(meta))
+        for name := range meta {
+                names = append(names, name)
+        }
+        sort.Strings(names)
+
+        var lists []*generatedList
+        for _, name := range names {
+                path := ipv4ListPath(name + ".lst")
+                data, err := os.ReadFile(path)
+                if os.IsNotExist(err) {
+                        continue
+                }
+                if err != nil {
+                        return nil, err
+                }
+                var builder netipx.IPSetBuilder
+                parsePrefixLines(string(data), &builder, "", "")
+                set, err := builder.IPSet()
+                if err != nil {
+                        return nil, err
+                }
+
+                m := meta[name]
+                list := &generatedList{Name: name, ListName: m.listName, Comment: m.comment, Prefixes: set.Prefixes(), Sources: []string{path}}
+                if len(list.Prefixes) > 0 {
+                        lists = append(lists, list)
+                }
+        }
+        return lists, nil
+}
+
+// pushCommand отправляет опубликованные списки на роутеры без сборки: для
+// binary API применяется только разница с текущим address-list
+func pushCommand(args []string) {
+        flags := flag.NewFlagSet("push", flag.ExitOnError)
+        target := flags.String("target", "", "push only to this routeros_push or ssh_push target")
+        only := flags.String("lists", "", "comma-separated list names to push")
+        flags.Parse(args)
+
+        configPath := "config.yaml"
+        if flags.NArg() > 0 {
+                configPath = flags.Arg(0)
+        }
+        if err := loadConfig(configPath); err != nil {
+                log.Fatal("Error loading config:", err)
+        }
+
+        lists, err := loadPublishedLists()
+        if err != nil {
+                log.Fatal("Error reading lists: ", err)
+        }
+        if *only != "" {
+                names := strings.Split(*only, ",")
+                var selected []*generatedList
+                for _, list := range lists {
+                        if listSelectedByName(names, list) {
+                                selected = append(selected, list)
+                        }
+                }
+                lists = selected
+        }
+        if len(lists) == 0 {
+                log.Fatal("No lists to push in ", config.IPv4Dir)
+        }
+        generatedLists = lists
+
+        if *target == "" {
+                pushOutputs()
+                reportStageFailures()
+                log.Println("Done!")
+                return
+        }
+        for _, t := range config.RouterOSPush.Targets {
+                if routerOSTargetName(t) != *target {
+                        continue
+                }
+                err := pushRouterOSTarget(t, lists)
+                recordPush("routeros:"+*target, lists, err)
+                if err := savePushQueue(); err != nil {
+                        log.Printf("Error writing %s: %v", pushQueuePath(), err)
+                }
+                if err != nil {
+                        log.Fatalf("Error pushing to RouterOS %s: %v", *target, err)
+                }
+                log.Println("Done!")
+                return
+        }
+        for _, t := range config.SSHPush.Targets {
+                if t.Name != *target {
+                        continue
+                }
+                err := pushSSHTarget(t, lists)
+                recordPush("ssh:"+*target, lists, err)
+                if err := savePushQueue(); err != nil {
+                        log.Printf("Error writing %s: %v", pushQueuePath(), err)
+                }
+                if err != nil {
+                        log.Fatalf("Error pushing to SSH %s: %v", *target, err)
+                }
+                log.Println("Done!")
+                return
+        }
+        log.Fatalf("Unknown push target %q", *target)
+}
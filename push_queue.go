@@ -0,0 +1,246 @@
+package main
+
+import (
+        "encoding/json"
+        "errors"
+        "flag"
+        "fmt"
+        "log"
+        "os"
+        "path/filepath"
+        "strings"
+        "time"
+)
+
+// PushQueueConfig очередь неудачных отправок на роутеры: недоступный роутер
+// (например, перезагружался) получает списки позже, в следующих запусках
+// или через get_subnets push-queue из cron
+type PushQueueConfig struct {
+        Enabled    bool          `yaml:"enabled"`
+        File       string        `yaml:"file"`        // По умолчанию push-queue.json в каталоге кэша
+        Backoff    time.Duration `yaml:"backoff"`     // Пауза после первой неудачи, дальше удваивается
+        MaxBackoff time.Duration `yaml:"max_backoff"` // Предел паузы
+        MaxAge     time.Duration `yaml:"max_age"`     // Через сколько отправка отбрасывается
+}
+
+// pushJob неотправленные списки одного роутера
+type pushJob struct {
+        Target      string           `json:"target"` // keenetic или routeros:<имя>
+        Lists       []*generatedList `json:"lists"`
+        Attempts    int              `json:"attempts"`
+        Queued      time.Time        `json:"queued"`
+        NextAttempt time.Time        `json:"next_attempt"`
+        LastError   string           `json:"last_error"`
+}
+
+var pushQueue []*pushJob
+var pushQueueLoaded bool
+
+func pushQueuePath() string {
+        if config.PushQueue.File != "" {
+                return config.PushQueue.File
+        }
+        return filepath.Join(config.Cache.Dir, "push-queue.json")
+}
+
+func loadPushQueue() {
+        if pushQueueLoaded {
+                return
+        }
+        pushQueueLoaded = true
+        data, err := os.ReadFile(pushQueuePath())
+        if err != nil {
+                return
+        }
+        if err := json.Unmarshal(data, &pushQueue); err != nil {
+                log.Printf("Error reading %s: %v", pushQueuePath(), err)
+        }
+}
+
+func savePushQueue() error {
+        if !pushQueueLoaded {
+                return nil
+        }
+        if len(pushQueue) == 0 {
+                if err := os.Remove(pushQueuePath()); err != nil && !os.IsNotExist(err) {
+                        return err
+                }
+                return nil
+        }
+        data, err := json.MarshalIndent(pushQueue, "", "    ")
+        if err != nil {
+                return err
+        }
+        if err := os.MkdirAll(filepath.Dir(pushQueuePath()), 0755); err != nil {
+                return err
+        }
+        return writeFileStaged(pushQueuePath(), append(data, '\n'))
+}
+
+func findPushJob(target string) (int, *pushJob) {
+        for i, job := range pushQueue {
+                if job.Target == target {
+                        return i, job
+                }
+        }
+        return -1, nil
+}
+
+// pushBackoff пауза перед попыткой номер attempts+1
+func pushBackoff(attempts int) time.Duration {
+        delay := config.PushQueue.Backoff
+        for i := 1; i < attempts && delay < config.PushQueue.MaxBackoff; i++ {
+                delay *= 2
+        }
+        if delay > config.PushQueue.MaxBackoff {
+                delay = config.PushQueue.MaxBackoff
+        }
+        return delay
+}
+
+// recordPush обновляет очередь по результату отправки lists на target:
+// отправленные списки из неё убираются, неотправленные добавляются или
+// заменяют более старые версии
+func recordPush(target string, lists []*generatedList, err error) {
+        if !config.PushQueue.Enabled {
+                return
+        }
+        loadPushQueue()
+        i, job := findPushJob(target)
+
+        if err == nil {
+                if job == nil {
+                        return
+                }
+                var rest []*generatedList
+                for _, queued := range job.Lists {
+                        if !containsList(lists, queued.Name) {
+                                rest = append(rest, queued)
+                        }
+                }
+                job.Lists = rest
+                if len(rest) == 0 {
+                        pushQueue = append(pushQueue[:i], pushQueue[i+1:]...)
+                        log.Printf("Push queue: %s is up to date", target)
+                }
+                return
+        }
+
+        now := time.Now()
+        if job == nil {
+                job = &pushJob{Target: target, Queued: now}
+                pushQueue = append(pushQueue, job)
+        }
+        for _, list := range lists {
+                if j := listIndex(job.Lists, list.Name); j >= 0 {
+                        job.Lists[j] = list
+                } else {
+                        job.Lists = append(job.Lists, list)
+                }
+        }
+        job.Attempts++
+        job.LastError = err.Error()
+        job.NextAttempt = now.Add(pushBackoff(job.Attempts))
+        log.Printf("Push queue: %s failed %d times, next attempt at %s", target, job.Attempts, job.NextAttempt.Format(time.RFC3339))
+}
+
+func listIndex(lists []*generatedList, name string) int {
+        for i, list := range lists {
+                if list.Name == name {
+                        return i
+                }
+        }
+        return -1
+}
+
+func containsList(lists []*generatedList, name string) bool {
+        return listIndex(lists, name) >= 0
+}
+
+// pushTarget отправляет списки на роутер по имени из очереди
+func pushTarget(target string, lists []*generatedList) error {
+        if target == "keenetic" {
+                if !config.Keenetic.Push.Enabled {
+                        return errTargetRemoved
+                }
+                return pushKeenetic(lists)
+        }
+        if name, ok := strings.CutPrefix(target, "routeros:"); ok {
+                for _, t := range config.RouterOSPush.Targets {
+                        if routerOSTargetName(t) == name {
+                                return pushRouterOSTarget(t, lists)
+                        }
+                }
+        }
+        if name, ok := strings.CutPrefix(target, "ssh:"); ok {
+                for _, t := range config.SSHPush.Targets {
+                        if t.Name == name {
+                                return pushSSHTarget(t, lists)
+                        }
+                }
+        }
+        return errTargetRemoved
+}
+
+var errTargetRemoved = errors.New("target is no longer configured")
+
+// processPushQueue повторяет отправки, время которых подошло
+func processPushQueue() {
+        if !config.PushQueue.Enabled {
+                return
+        }
+        loadPushQueue()
+
+        now := time.Now()
+        for _, job := range append([]*pushJob(nil), pushQueue...) {
+                if now.Sub(job.Queued) > config.PushQueue.MaxAge {
+                        log.Printf("Push queue: giving up on %s after %d attempts: %s", job.Target, job.Attempts, job.LastError)
+                        i, _ := findPushJob(job.Target)
+                        pushQueue = append(pushQueue[:i], pushQueue[i+1:]...)
+                        continue
+                }
+                if now.Before(job.NextAttempt) {
+                        continue
+                }
+
+                lists := job.Lists
+                runStage("push queue "+job.Target, "push", func() {
+                        reportProgress("push queue "+job.Target, "push", fmt.Sprintf("attempt %d", job.Attempts+1))
+                        err := pushTarget(job.Target, lists)
+                        if err == errTargetRemoved {
+                                log.Printf("Push queue: dropping %s: %v", job.Target, err)
+                                i, _ := findPushJob(job.Target)
+                                pushQueue = append(pushQueue[:i], pushQueue[i+1:]...)
+                                return
+                        }
+                        if err != nil {
+                                log.Printf("Error pushing queued lists to %s: %v", job.Target, err)
+                        }
+                        recordPush(job.Target, lists, err)
+                })
+        }
+
+        if err := savePushQueue(); err != nil {
+                log.Printf("Error writing %s: %v", pushQueuePath(), err)
+        }
+}
+
+// pushQueueCommand отправляет только накопившиеся в очереди списки, без сборки
+func pushQueueCommand(args []string) {
+        flags := flag.NewFlagSet("push-queue", flag.ExitOnError)
+        flags.Parse(args)
+
+        configPath := "config.yaml"
+        if flags.NArg() > 0 {
+                configPath = flags.Arg(0)
+        }
+        if err := loadConfig(configPath); err != nil {
+                log.Fatal("Error loading config:", err)
+        }
+        if !config.PushQueue.Enabled {
+                log.Fatal("push_queue is not enabled in ", configPath)
+        }
+
+        processPushQueue()
+        log.Printf("Push queue: %d targets pending", len(pushQueue))
+}
@@ -0,0 +1,37 @@
+package main
+
+import "fmt"
+
+// QuantumultXConfig фильтры Quantumult X с политикой на каждый список
+type QuantumultXConfig struct {
+        OutputConfig `yaml:",inline"`
+        Policy       string            `yaml:"policy"`   // Политика по умолчанию
+        Policies     map[string]string `yaml:"policies"` // Политика по имени списка
+}
+
+func quantumultXPolicy(list *generatedList) string {
+        if policy, ok := config.QuantumultX.Policies[list.Name]; ok {
+                return policy
+        }
+        return config.QuantumultX.Policy
+}
+
+func quantumultXRules(list *generatedList) []string {
+        policy := quantumultXPolicy(list)
+        rules := make([]string, 0, len(list.Domains)+len(list.Prefixes))
+        for _, domain := range list.Domains {
+                rules = append(rules, fmt.Sprintf("host-suffix, %s, %s", trimDomainDot(domain), policy))
+        }
+        for _, prefix := range list.Prefixes {
+                kind := "ip-cidr"
+                if prefix.Addr().Is6() {
+                        kind = "ip6-cidr"
+                }
+                rules = append(rules, fmt.Sprintf("%s, %s, %s", kind, prefix, policy))
+        }
+        return rules
+}
+
+func generateQuantumultXFilter(list *generatedList) error {
+        return writeOutputLines(layoutDir("quantumultx", list.Name, config.QuantumultX.Dir), list.Name+".list", quantumultXRules(list))
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+        "encoding/json"
+        "log"
+        "net/netip"
+        "os"
+        "path/filepath"
+        "sort"
+        "strings"
+        "time"
+
+        "go4.org/netipx"
+)
+
+// QuarantineConfig новые префиксы уже опубликованного списка попадают в
+// вывод, только если источник отдаёт их runs запусков подряд: короткая утечка
+// BGP в ASN сервиса не успевает уйти на роутеры
+type QuarantineConfig struct {
+        Runs    int      `yaml:"runs"`    // 0 - выключено
+        File    string   `yaml:"file"`    // По умолчанию quarantine.json в каталоге кэша
+        Lists   []string `yaml:"lists"`   // Пусто - все списки
+        Release []string `yaml:"release"` // Префиксы или имена списков, которые публикуются сразу
+}
+
+// quarantineEntry новый префикс, ждущий публикации
+type quarantineEntry struct {
+        FirstSeen time.Time `json:"first_seen"`
+        Runs      int       `json:"runs"` // Запусков подряд, в которых префикс был в источнике
+        run       time.Time
+}
+
+var (
+        quarantineState  map[string]map[netip.Prefix]*quarantineEntry
+        quarantineRun    time.Time
+        quarantineLists  map[string]bool // Списки, прошедшие через карантин в этом запуске
+        releasedPrefixes []string        // --release
+)
+
+func quarantinePath() string {
+        if config.Quarantine.File != "" {
+                return config.Quarantine.File
+        }
+        return filepath.Join(config.Cache.Dir, "quarantine.json")
+}
+
+func loadQuarantine() {
+        if quarantineState != nil {
+                return
+        }
+        quarantineState = make(map[string]map[netip.Prefix]*quarantineEntry)
+        quarantineLists = make(map[string]bool)
+        quarantineRun = time.Now()
+        data, err := os.ReadFile(quarantinePath())
+        if err != nil {
+                return
+        }
+        if err := json.Unmarshal(data, &quarantineState); err != nil {
+                log.Printf("Error reading %s: %v", quarantinePath(), err)
+        }
+}
+
+// saveQuarantine сохраняет ожидающие префиксы; у обработанных в этом запуске
+// списков забываются префиксы, которых в источнике больше нет
+func saveQuarantine() {
+        if quarantineState == nil {
+                return
+        }
+        for name, entries := range quarantineState {
+                if !quarantineLists[name] {
+                        continue
+                }
+                for prefix, entry := range entries {
+                        if !entry.run.Equal(quarantineRun) {
+                                delete(entries, prefix)
+                        }
+                }
+                if len(entries) == 0 {
+                        delete(quarantineState, name)
+                }
+        }
+
+        var err error
+        if len(quarantineState) == 0 {
+                if err = os.Remove(quarantinePath()); os.IsNotExist(err) {
+                        err = nil
+                }
+        } else {
+                var data []byte
+                if data, err = json.MarshalIndent(quarantineState, "", "    "); err == nil {
+                        if err = os.MkdirAll(filepath.Dir(quarantinePath()), 0755); err == nil {
+                                err = writeFileStaged(quarantinePath(), append(data, '\n'))
+                        }
+                }
+        }
+        if err != nil {
+                log.Printf("Error writing %s: %v", quarantinePath(), err)
+        }
+}
+
+// shortList первые 10 значений для лога
+func shortList(values []string) []string {
+        if len(values) > 10 {
+                return append(values[:10:10], "...")
+        }
+        return values
+}
+
+// publishedSet префиксы списка, опубликованные до запуска
+func publishedSet(name string) (*netipx.IPSet, error) {
+        var builder netipx.IPSetBuilder
+        for prefix := range previousLists[name] {
+                builder.AddPrefix(prefix)
+        }
+        return builder.IPSet()
+}
+
+// stabilizePrefixes придерживает новые префиксы списка (карантин) и
+// исчезнувшие (removal_grace), чтобы колебания источника не доходили до роутеров
+func stabilizePrefixes(file string, prefixes []netip.Prefix) []netip.Prefix {
+        held := quarantinePrefixes(file, prefixes)
+        noteChange(file, "quarantine", prefixes, held)
+        kept := gracePrefixes(file, held)
+        noteChange(file, "removal_grace", held, kept)
+        return kept
+}
+
+func quarantineReleased(name string, prefix netip.Prefix) bool {
+        for _, value := range append(config.Quarantine.Release, releasedPrefixes...) {
+                if released, err := netip.ParsePrefix(value); err == nil {
+                        if released.Masked().Contains(prefix.Addr()) && released.Bits() <= prefix.Bits() {
+                                return true
+                        }
+                        continue
+                }
+                if strings.EqualFold(strings.TrimSuffix(value, ".lst"), name) {
+                        return true
+                }
+        }
+        return false
+}
+
+// quarantinePrefixes убирает из префиксов списка новые, которые ещё не
+// отстояли карантин. Новый - не покрытый опубликованным до запуска .lst;
+// совсем новый список публикуется целиком.
+func quarantinePrefixes(file string, prefixes []netip.Prefix) []netip.Prefix {
+        name := strings.TrimSuffix(file, ".lst")
+        if config.Quarantine.Runs <= 0 || heldLists[strings.ToLower(name)] {
+                return prefixes
+        }
+        if len(config.Quarantine.Lists) > 0 && !listSelectedByName(config.Quarantine.Lists, &generatedList{Name: name}) {
+                return prefixes
+        }
+        if _, ok := previousLists[name]; !ok {
+                return prefixes
+        }
+        published, err := publishedSet(name)
+        if err != nil {
+                log.Printf("Error building published set of %s: %v", name, err)
+                return prefixes
+        }
+
+        loadQuarantine()
+        quarantineLists[name] = true
+        entries := quarantineState[name]
+        if entries == nil {
+                entries = make(map[netip.Prefix]*quarantineEntry)
+                quarantineState[name] = entries
+        }
+
+        kept := make([]netip.Prefix, 0, len(prefixes))
+        var held, released []string
+        for _, prefix := range prefixes {
+                if published.ContainsPrefix(prefix) {
+                        kept = append(kept, prefix)
+                        continue
+                }
+                entry := entries[prefix]
+                if entry == nil {
+                        entry = &quarantineEntry{FirstSeen: quarantineRun}
+                        entries[prefix] = entry
+                }
+                if !entry.run.Equal(quarantineRun) {
+                        entry.Runs++
+                        entry.run = quarantineRun
+                }
+                if entry.Runs > config.Quarantine.Runs || quarantineReleased(name, prefix) {
+                        kept = append(kept, prefix)
+                        released = append(released, prefix.String())
+                        delete(entries, prefix)
+                        continue
+                }
+                held = append(held, prefix.String())
+        }
+
+        if len(released) > 0 {
+                log.Printf("Quarantine %s: releasing %d prefixes: %s", name, len(released), strings.Join(released, ", "))
+        }
+        if len(held) > 0 {
+                sort.Strings(held)
+                log.Printf("Quarantine %s: holding %d new prefixes: %s", name, len(held), strings.Join(shortList(held), ", "))
+        }
+        return kept
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+        "net/netip"
+        "path/filepath"
+        "sort"
+)
+
+// Сырые списки: префиксы так, как их отдал источник (анонсы ASN, строки файлов),
+// без объединения в IPSet. Нужны RPKI-инструментам и аудиту; роутерам - .lst.
+// Берутся из провенанса, поэтому в роли render и без provenance.json не пишутся.
+
+// savedProvenance provenance.json для списков, не собранных в этом запуске (замороженных)
+var savedProvenance map[string]*listProvenance
+
+// rawPrefixes исходные префиксы списка, которые целиком остались в нём после исключений
+func rawPrefixes(list *generatedList) []netip.Prefix {
+        p := provenance[list.Name]
+        if p == nil {
+                if savedProvenance == nil {
+                        savedProvenance, _ = readProvenance()
+                }
+                p = savedProvenance[list.Name]
+        }
+        if p == nil {
+                return nil
+        }
+        published, err := prefixSet(list.Prefixes)
+        if err != nil {
+                return nil
+        }
+
+        seen := make(map[netip.Prefix]bool)
+        var out []netip.Prefix
+        for _, origin := range p.Origins {
+                prefix := origin.Prefix.Masked()
+                if seen[prefix] || !published.ContainsPrefix(prefix) {
+                        continue
+                }
+                seen[prefix] = true
+                out = append(out, prefix)
+        }
+        sort.Slice(out, func(i, j int) bool {
+                if c := out[i].Addr().Compare(out[j].Addr()); c != 0 {
+                        return c < 0
+                }
+                return out[i].Bits() < out[j].Bits()
+        })
+        return out
+}
+
+func generateRawList(list *generatedList) error {
+        prefixes := rawPrefixes(list)
+        if len(prefixes) == 0 {
+                return nil
+        }
+        return writeSubnetsToFile(prefixes, filepath.Join(layoutDir("raw", list.Name, config.Raw.Dir), list.Name+".lst"))
+}
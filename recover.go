@@ -0,0 +1,46 @@
+package main
+
+import (
+        "fmt"
+        "log"
+        "runtime/debug"
+        "strings"
+)
+
+// stageFailures этапы, упавшие с паникой, для сводки в конце запуска
+var stageFailures []string
+
+// runStage выполняет этап обработки источника или списка. Паника в нём
+// (например, в парсере на испорченных данных) помечает список как failed,
+// а остальные списки обрабатываются и публикуются как обычно.
+func runStage(source, stage string, fn func()) {
+        if skipExpiredStage(source, stage) {
+                return
+        }
+        defer func() {
+                if r := recover(); r != nil {
+                        if stop, ok := r.(fatalError); ok {
+                                panic(stop)
+                        }
+                        log.Printf("Panic in %s (%s): %v\n%s", source, stage, r, debug.Stack())
+                        reportProgress(source, "failed", fmt.Sprintf("panic: %v", r))
+                        stageFailures = append(stageFailures, source+" ("+stage+")")
+                }
+        }()
+        fn()
+}
+
+// reportStageFailures завершает запуск с ошибкой, если какой-то этап упал
+// или был пропущен по дедлайну
+func reportStageFailures() {
+        if len(skippedStages) > 0 {
+                log.Printf("Run deadline exceeded: %d lists completed, %d stages skipped: %s",
+                        len(generatedLists), len(skippedStages), strings.Join(skippedStages, ", "))
+        }
+        if len(stageFailures) > 0 {
+                fatal(fmt.Sprintf("Finished with %d failed stages: %s", len(stageFailures), strings.Join(stageFailures, ", ")))
+        }
+        if len(skippedStages) > 0 {
+                fatal("Run incomplete")
+        }
+}
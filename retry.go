@@ -0,0 +1,109 @@
+package main
+
+import (
+        "context"
+        "errors"
+        "fmt"
+        "io"
+        "log"
+        "net"
+        "net/http"
+        "syscall"
+        "time"
+)
+
+// httpStatusError ответ источника с кодом, отличным от 200
+type httpStatusError struct {
+        Code   int
+        Status string
+}
+
+func (e *httpStatusError) Error() string {
+        return "HTTP error: " + e.Status
+}
+
+// retryStage этап списка, упавший на временной ошибке
+type retryStage struct {
+        source, stage string
+        fn            func() error
+}
+
+var pendingRetries []retryStage
+
+// transientError временная ли ошибка: таймауты, обрывы и отказы соединения,
+// временные сбои DNS, 429 и 5xx, ответы FTP 4xx и сбои связи rsync.
+// Битые данные и 404 повтор не исправит.
+func transientError(err error) bool {
+        var statusErr *httpStatusError
+        if errors.As(err, &statusErr) {
+                return statusErr.Code == http.StatusTooManyRequests || statusErr.Code >= 500
+        }
+        var ftpErr *ftpError
+        if errors.As(err, &ftpErr) {
+                return ftpErr.Code >= 400 && ftpErr.Code < 500
+        }
+        var rsyncErr *rsyncError
+        if errors.As(err, &rsyncErr) {
+                return rsyncErr.transient()
+        }
+        // Дедлайн запуска повторять бессмысленно
+        if errors.Is(err, context.DeadlineExceeded) && runExpired() {
+                return false
+        }
+        // *url.Error тоже net.Error, так что net.Error сам по себе ничего не говорит:
+        // ошибки TLS, неверный хост или URL повтор не исправит
+        var netErr net.Error
+        if errors.As(err, &netErr) && netErr.Timeout() {
+                return true
+        }
+        var dnsErr *net.DNSError
+        if errors.As(err, &dnsErr) {
+                return dnsErr.IsTemporary || dnsErr.IsTimeout
+        }
+        // Сервер закрыл соединение посреди ответа
+        if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+                return true
+        }
+        for _, errno := range []syscall.Errno{syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.ECONNABORTED,
+                syscall.EPIPE, syscall.ENETUNREACH, syscall.EHOSTUNREACH} {
+                if errors.Is(err, errno) {
+                        return true
+                }
+        }
+        return false
+}
+
+// runListStage как runStage, но список, не собранный из-за временной ошибки,
+// запоминается и собирается ещё раз в конце запуска
+func runListStage(source, stage string, fn func() error) {
+        runStage(source, stage, func() {
+                if err := fn(); err != nil && config.RetryFailed > 0 && transientError(err) {
+                        pendingRetries = append(pendingRetries, retryStage{source, stage, fn})
+                }
+        })
+}
+
+// retryFailedLists повторяет упавшие списки до retry_failed раз
+func retryFailedLists() {
+        for attempt := 1; attempt <= config.RetryFailed && len(pendingRetries) > 0; attempt++ {
+                log.Printf("Retrying %d failed lists in %s (attempt %d of %d)", len(pendingRetries), config.RetryDelay, attempt, config.RetryFailed)
+                select {
+                case <-time.After(config.RetryDelay):
+                case <-runCtx.Done():
+                }
+
+                stages := pendingRetries
+                pendingRetries = nil
+                for _, s := range stages {
+                        runStage(s.source, s.stage, func() {
+                                reportProgress(s.source, "retry", fmt.Sprintf("attempt %d", attempt))
+                                if err := s.fn(); err != nil && transientError(err) {
+                                        pendingRetries = append(pendingRetries, s)
+                                }
+                        })
+                }
+        }
+        for _, s := range pendingRetries {
+                log.Printf("Giving up on %s (%s) after %d retries", s.source, s.stage, config.RetryFailed)
+        }
+}
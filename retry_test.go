@@ -0,0 +1,66 @@
+package main
+
+import (
+        "context"
+        "crypto/x509"
+        "errors"
+        "fmt"
+        "io"
+        "net"
+        "net/url"
+        "os"
+        "syscall"
+        "testing"
+)
+
+func TestTransientError(t *testing.T) {
+        urlErr := func(err error) error {
+                return &url.Error{Op: "Get", URL: "https://example.com/list.txt", Err: err}
+        }
+        dialErr := func(errno syscall.Errno) error {
+                return urlErr(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errno)})
+        }
+        tests := []struct {
+                name string
+                err  error
+                want bool
+        }{
+                {"429", &httpStatusError{Code: 429, Status: "429 Too Many Requests"}, true},
+                {"503", fmt.Errorf("source: %w", &httpStatusError{Code: 503, Status: "503 Service Unavailable"}), true},
+                {"404", &httpStatusError{Code: 404, Status: "404 Not Found"}, false},
+                {"ftp 421", &ftpError{Code: 421, Msg: "too many connections"}, true},
+                {"ftp 550", &ftpError{Code: 550, Msg: "no such file"}, false},
+                {"rsync timeout", &rsyncError{Code: 30}, true},
+                {"rsync syntax", &rsyncError{Code: 1}, false},
+                {"timeout", urlErr(context.DeadlineExceeded), true},
+                {"connection refused", dialErr(syscall.ECONNREFUSED), true},
+                {"connection reset", dialErr(syscall.ECONNRESET), true},
+                {"network unreachable", dialErr(syscall.ENETUNREACH), true},
+                {"dropped mid-response", urlErr(io.ErrUnexpectedEOF), true},
+                {"dns temporary", urlErr(&net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}), true},
+                {"dns not found", urlErr(&net.DNSError{Err: "no such host", Name: "example.com", IsNotFound: true}), false},
+                {"tls", urlErr(x509.HostnameError{Certificate: &x509.Certificate{}, Host: "example.com"}), false},
+                {"bad url", urlErr(errors.New("unsupported protocol scheme")), false},
+                {"parse", errors.New("no prefixes match services"), false},
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        if got := transientError(tt.err); got != tt.want {
+                                t.Errorf("transientError(%v) = %v, want %v", tt.err, got, tt.want)
+                        }
+                })
+        }
+}
+
+func TestTransientErrorRunExpired(t *testing.T) {
+        saved := runCtx
+        defer func() { runCtx = saved }()
+        ctx, cancel := context.WithCancel(context.Background())
+        cancel()
+        runCtx = ctx
+
+        // После дедлайна запуска таймаут загрузки уже не повторяется
+        if transientError(&url.Error{Op: "Get", URL: "https://example.com", Err: context.DeadlineExceeded}) {
+                t.Error("timeout after run deadline is transient")
+        }
+}
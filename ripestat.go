@@ -0,0 +1,88 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "net/url"
+        "time"
+)
+
+// RIPEstatConfig источник анонсов отдельных ASN через RIPEstat announced-prefixes:
+// при нескольких ASN это гораздо легче полной таблицы bgp.tools
+type RIPEstatConfig struct {
+        URL           string        `yaml:"url"`        // По умолчанию https://stat.ripe.net/data/announced-prefixes/data.json
+        SourceApp     string        `yaml:"sourceapp"`  // Идентификатор клиента, который RIPEstat просит передавать
+        MaxAge        time.Duration `yaml:"max_age"`    // Префикс, не виденный дольше этого до конца окна запроса, пропускается; по умолчанию 24h
+        SourceOptions `yaml:",inline"`
+}
+
+// Источники анонсов ASN-списка (source в as_numbers)
+const (
+        asSourceBGPTools = "bgp_tools"
+        asSourceRIPEstat = "ripestat"
+)
+
+type ripestatAnnouncedPrefixes struct {
+        Data struct {
+                Prefixes []struct {
+                        Prefix    string `json:"prefix"`
+                        Timelines []struct {
+                                EndTime string `json:"endtime"`
+                        } `json:"timelines"`
+                } `json:"prefixes"`
+                QueryEndTime string `json:"query_endtime"`
+        } `json:"data"`
+}
+
+// parseRIPEstatTime время RIPEstat: UTC без зоны
+func parseRIPEstatTime(value string) (time.Time, error) {
+        if t, err := time.Parse(time.RFC3339, value); err == nil {
+                return t, nil
+        }
+        return time.Parse("2006-01-02T15:04:05", value)
+}
+
+func ripestatURL(as string) string {
+        query := url.Values{"resource": {"AS" + normalizeASN(as)}}
+        if config.RIPEstat.SourceApp != "" {
+                query.Set("sourceapp", config.RIPEstat.SourceApp)
+        }
+        return config.RIPEstat.URL + "?" + query.Encode()
+}
+
+// ripestatSubnets анонсы asns из RIPEstat в том же виде, что строки таблицы bgp.tools
+func ripestatSubnets(asns []string) ([]subnetAS, []string, error) {
+        var subnets []subnetAS
+        var sources []string
+        for _, as := range asns {
+                source := ripestatURL(as)
+                data, err := downloadCached(source, config.RIPEstat.SourceOptions)
+                if err != nil {
+                        return nil, nil, fmt.Errorf("RIPEstat AS%s: %w", normalizeASN(as), err)
+                }
+                var resp ripestatAnnouncedPrefixes
+                if err := json.Unmarshal([]byte(data), &resp); err != nil {
+                        return nil, nil, fmt.Errorf("RIPEstat AS%s: %w", normalizeASN(as), err)
+                }
+                end, err := parseRIPEstatTime(resp.Data.QueryEndTime)
+                if err != nil {
+                        return nil, nil, fmt.Errorf("RIPEstat AS%s: query_endtime: %w", normalizeASN(as), err)
+                }
+
+                for _, item := range resp.Data.Prefixes {
+                        // Окно запроса - две недели: давно снятые анонсы не нужны
+                        var seen time.Time
+                        for _, timeline := range item.Timelines {
+                                if t, err := parseRIPEstatTime(timeline.EndTime); err == nil && t.After(seen) {
+                                        seen = t
+                                }
+                        }
+                        if end.Sub(seen) > config.RIPEstat.MaxAge {
+                                continue
+                        }
+                        subnets = append(subnets, subnetAS{subnet: item.Prefix, as: normalizeASN(as), source: source})
+                }
+                sources = append(sources, source)
+        }
+        return subnets, sources, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+        "fmt"
+        "log"
+        "net/netip"
+        "sort"
+        "strings"
+
+        "go4.org/netipx"
+)
+
+// RoutedSpaceConfig сводка по доле IPv4-пространства, которая уходит в туннель
+// по всем спискам сразу: широкие списки незаметно набегают в половину интернета
+type RoutedSpaceConfig struct {
+        Cap  float64 `yaml:"cap"`  // Порог в процентах адресного пространства IPv4
+        Fail bool    `yaml:"fail"` // Выше порога завершать запуск с ошибкой до вывода и отправки
+}
+
+// ipv4Addresses число адресов IPv4 в наборе
+func ipv4Addresses(set *netipx.IPSet) uint64 {
+        var total uint64
+        for _, r := range set.Ranges() {
+                if !r.From().Is4() {
+                        continue
+                }
+                from, to := r.From().As4(), r.To().As4()
+                a := uint64(from[0])<<24 | uint64(from[1])<<16 | uint64(from[2])<<8 | uint64(from[3])
+                b := uint64(to[0])<<24 | uint64(to[1])<<16 | uint64(to[2])<<8 | uint64(to[3])
+                total += b - a + 1
+        }
+        return total
+}
+
+func ipv4Percent(addresses uint64) float64 {
+        return float64(addresses) * 100 / (1 << 32)
+}
+
+func v4Set(prefixes []netip.Prefix) (*netipx.IPSet, error) {
+        var builder netipx.IPSetBuilder
+        for _, prefix := range prefixes {
+                if prefix.Addr().Is4() {
+                        builder.AddPrefix(prefix)
+                }
+        }
+        return builder.IPSet()
+}
+
+// reportRoutedSpace выводит долю пространства по всем спискам и крупнейшие списки
+func reportRoutedSpace(lists []*generatedList) {
+        type listSpace struct {
+                name      string
+                addresses uint64
+        }
+        var all netipx.IPSetBuilder
+        var spaces []listSpace
+        for _, list := range lists {
+                set, err := v4Set(list.Prefixes)
+                if err != nil {
+                        log.Printf("Error computing routed space for %s: %v", list.Name, err)
+                        continue
+                }
+                if n := ipv4Addresses(set); n > 0 {
+                        spaces = append(spaces, listSpace{list.Name, n})
+                        all.AddSet(set)
+                }
+        }
+        if len(spaces) == 0 {
+                return
+        }
+        set, err := all.IPSet()
+        if err != nil {
+                log.Printf("Error computing routed space: %v", err)
+                return
+        }
+
+        sort.Slice(spaces, func(i, j int) bool { return spaces[i].addresses > spaces[j].addresses })
+        var largest []string
+        for i, space := range spaces {
+                if i == 3 {
+                        break
+                }
+                largest = append(largest, fmt.Sprintf("%s %.2f%%", space.name, ipv4Percent(space.addresses)))
+        }
+
+        total := ipv4Addresses(set)
+        percent := ipv4Percent(total)
+        note := ""
+        if partialRun() {
+                note = " (partial run)"
+        }
+        log.Printf("Routed IPv4 space%s: %d addresses, %.2f%% across %d lists; largest: %s",
+                note, total, percent, len(spaces), strings.Join(largest, ", "))
+
+        if config.RoutedSpace.Cap > 0 && percent > config.RoutedSpace.Cap {
+                msg := fmt.Sprintf("Routed IPv4 space %.2f%% exceeds routed_space.cap of %.2f%%", percent, config.RoutedSpace.Cap)
+                if config.RoutedSpace.Fail {
+                        fatal(msg)
+                }
+                log.Printf("Warning: %s", msg)
+        }
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+        "bufio"
+        "crypto/md5"
+        "crypto/tls"
+        "encoding/hex"
+        "fmt"
+        "io"
+        "net"
+        "strings"
+        "time"
+)
+
+// Клиент бинарного API RouterOS (порт 8728, api-ssl 8729)
+
+type routerOSClient struct {
+        conn   net.Conn
+        reader *bufio.Reader
+}
+
+// routerOSReply ответ !re в виде атрибутов
+type routerOSReply map[string]string
+
+func dialRouterOS(target RouterOSTarget) (*routerOSClient, error) {
+        address := target.Address
+        if _, _, err := net.SplitHostPort(address); err != nil {
+                port := "8728"
+                if target.TLS {
+                        port = "8729"
+                }
+                address = net.JoinHostPort(address, port)
+        }
+
+        dialer := &net.Dialer{Timeout: 10 * time.Second}
+        var conn net.Conn
+        var err error
+        if target.TLS {
+                conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{InsecureSkipVerify: target.InsecureSkipVerify})
+        } else {
+                conn, err = dialer.Dial("tcp", address)
+        }
+        if err != nil {
+                return nil, err
+        }
+        conn.SetDeadline(time.Now().Add(5 * time.Minute))
+        return &routerOSClient{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+func (c *routerOSClient) Close() error {
+        return c.conn.Close()
+}
+
+func appendRouterOSLength(buf []byte, n int) []byte {
+        switch {
+        case n < 0x80:
+                return append(buf, byte(n))
+        case n < 0x4000:
+                return append(buf, byte(n>>8)|0x80, byte(n))
+        case n < 0x200000:
+                return append(buf, byte(n>>16)|0xC0, byte(n>>8), byte(n))
+        case n < 0x10000000:
+                return append(buf, byte(n>>24)|0xE0, byte(n>>16), byte(n>>8), byte(n))
+        default:
+                return append(buf, 0xF0, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+        }
+}
+
+func (c *routerOSClient) readLength() (int, error) {
+        first, err := c.reader.ReadByte()
+        if err != nil {
+                return 0, err
+        }
+
+        var extra int
+        var n int
+        switch {
+        case first&0x80 == 0:
+                return int(first), nil
+        case first&0xC0 == 0x80:
+                extra, n = 1, int(first&0x3F)
+        case first&0xE0 == 0xC0:
+                extra, n = 2, int(first&0x1F)
+        case first&0xF0 == 0xE0:
+                extra, n = 3, int(first&0x0F)
+        default:
+                extra, n = 4, 0
+        }
+        for i := 0; i < extra; i++ {
+                b, err := c.reader.ReadByte()
+                if err != nil {
+                        return 0, err
+                }
+                n = n<<8 | int(b)
+        }
+        return n, nil
+}
+
+func (c *routerOSClient) readSentence() ([]string, error) {
+        var words []string
+        for {
+                n, err := c.readLength()
+                if err != nil {
+                        return nil, err
+                }
+                if n == 0 {
+                        return words, nil
+                }
+                word := make([]byte, n)
+                if _, err := io.ReadFull(c.reader, word); err != nil {
+                        return nil, err
+                }
+                words = append(words, string(word))
+        }
+}
+
+// Run отправляет команду с атрибутами вида "=name=value" и собирает ответы до !done
+func (c *routerOSClient) Run(words ...string) ([]routerOSReply, routerOSReply, error) {
+        var buf []byte
+        for _, word := range words {
+                buf = appendRouterOSLength(buf, len(word))
+                buf = append(buf, word...)
+        }
+        buf = append(buf, 0)
+        if _, err := c.conn.Write(buf); err != nil {
+                return nil, nil, err
+        }
+
+        var replies []routerOSReply
+        var trap error
+        for {
+                sentence, err := c.readSentence()
+                if err != nil {
+                        return nil, nil, err
+                }
+                if len(sentence) == 0 {
+                        continue
+                }
+
+                attrs := make(routerOSReply)
+                for _, word := range sentence[1:] {
+                        if !strings.HasPrefix(word, "=") {
+                                continue
+                        }
+                        if key, value, ok := strings.Cut(word[1:], "="); ok {
+                                attrs[key] = value
+                        }
+                }
+
+                switch sentence[0] {
+                case "!re":
+                        replies = append(replies, attrs)
+                case "!trap":
+                        trap = fmt.Errorf("%s: %s", words[0], attrs["message"])
+                case "!fatal":
+                        return nil, nil, fmt.Errorf("%s: fatal: %s", words[0], strings.Join(sentence[1:], " "))
+                case "!done":
+                        return replies, attrs, trap
+                }
+        }
+}
+
+// Login поддерживает и текущую схему (6.43+), и challenge-ответ старых версий
+func (c *routerOSClient) Login(user, password string) error {
+        _, done, err := c.Run("/login", "=name="+user, "=password="+password)
+        if err != nil {
+                return err
+        }
+        challenge, ok := done["ret"]
+        if !ok {
+                return nil
+        }
+
+        raw, err := hex.DecodeString(challenge)
+        if err != nil {
+                return fmt.Errorf("login: bad challenge: %w", err)
+        }
+        sum := md5.Sum(append(append([]byte{0}, password...), raw...))
+        _, _, err = c.Run("/login", "=name="+user, "=response=00"+hex.EncodeToString(sum[:]))
+        return err
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+        "fmt"
+        "path/filepath"
+        "strings"
+)
+
+// RouterOSBootstrapConfig скрипт, который импортируют на роутер один раз:
+// он создаёт /system script и scheduler, скачивающие опубликованные .rsc
+// через /tool/fetch, так что роутер обновляет списки сам
+type RouterOSBootstrapConfig struct {
+        Enabled   bool     `yaml:"enabled"`
+        BaseURL   string   `yaml:"base_url"`   // Где опубликован каталог routeros_dir
+        File      string   `yaml:"file"`       // Имя скрипта в каталогах v6/v7
+        Name      string   `yaml:"name"`       // Имя /system script и scheduler на роутере
+        Interval  string   `yaml:"interval"`   // Период scheduler в формате RouterOS: 1d, 12h...
+        StartTime string   `yaml:"start_time"` // start-time scheduler
+        Lists     []string `yaml:"lists"`      // Только эти списки; пусто - все
+}
+
+// routerOSBootstrapUpdate тело /system script: скачать, импортировать и удалить
+// файл каждого списка; ошибка одного списка не мешает остальным. Старые
+// адреса удаляются только после успешного скачивания: скрипт списка их не чистит.
+func routerOSBootstrapUpdate(version string, lists []*generatedList) string {
+        fetch, importCmd, remove, addressList := "/tool fetch", "/import", "/file remove", "/ip firewall address-list"
+        if version == "v7" {
+                fetch, remove, addressList = "/tool/fetch", "/file/remove", "/ip/firewall/address-list"
+        }
+
+        var b strings.Builder
+        for _, list := range lists {
+                file := list.ListName + ".rsc"
+                url := layoutURL(config.RouterOSBootstrap.BaseURL, "routeros", list.Name, config.RouterOSDir, version+"/"+file)
+                dst := config.RouterOSBootstrap.Name + "-" + file
+                fmt.Fprintf(&b, ":do {\n")
+                fmt.Fprintf(&b, "  %s url=%s dst-path=%s\n", fetch, routerOSQuote(url), routerOSQuote(dst))
+                fmt.Fprintf(&b, "  :delay 2s\n")
+                fmt.Fprintf(&b, "  %s remove [find list=%s dynamic=no]\n", addressList, routerOSQuote(list.ListName))
+                fmt.Fprintf(&b, "  %s file-name=%s\n", importCmd, routerOSQuote(dst))
+                fmt.Fprintf(&b, "  %s %s\n", remove, routerOSQuote(dst))
+                fmt.Fprintf(&b, "} on-error={ :log warning %s }\n", routerOSQuote(config.RouterOSBootstrap.Name+": "+list.ListName+" update failed"))
+        }
+        return b.String()
+}
+
+func routerOSBootstrapScript(version string, lists []*generatedList) []string {
+        scriptPath, schedulerPath := "/system script", "/system scheduler"
+        if version == "v7" {
+                scriptPath, schedulerPath = "/system/script", "/system/scheduler"
+        }
+        name := routerOSQuote(config.RouterOSBootstrap.Name)
+        onEvent := routerOSQuote(scriptPath + " run " + config.RouterOSBootstrap.Name)
+
+        return []string{
+                fmt.Sprintf("# Импортируйте один раз: /import %s", config.RouterOSBootstrap.File),
+                fmt.Sprintf("%s remove [find name=%s]", scriptPath, name),
+                fmt.Sprintf("%s add name=%s policy=read,write,policy,test source=%s", scriptPath, name, routerOSQuote(routerOSBootstrapUpdate(version, lists))),
+                fmt.Sprintf("%s remove [find name=%s]", schedulerPath, name),
+                fmt.Sprintf("%s add name=%s interval=%s start-time=%s on-event=%s", schedulerPath, name, config.RouterOSBootstrap.Interval, config.RouterOSBootstrap.StartTime, onEvent),
+                // Первое обновление сразу, не дожидаясь расписания
+                fmt.Sprintf("%s run %s", scriptPath, name),
+        }
+}
+
+// generateRouterOSBootstrap пишет <routeros_dir>/v6|v7/bootstrap.rsc для списков с IPv4
+func generateRouterOSBootstrap(lists []*generatedList) error {
+        var selected []*generatedList
+        for _, list := range lists {
+                if len(config.RouterOSBootstrap.Lists) > 0 && !listSelectedByName(config.RouterOSBootstrap.Lists, list) {
+                        continue
+                }
+                for _, prefix := range list.Prefixes {
+                        if prefix.Addr().Is4() {
+                                selected = append(selected, list)
+                                break
+                        }
+                }
+        }
+
+        var versions []string
+        if config.GenerateV6 {
+                versions = append(versions, "v6")
+        }
+        if config.GenerateV7 {
+                versions = append(versions, "v7")
+        }
+        for _, version := range versions {
+                dir := filepath.Join(config.RouterOSDir, version)
+                if err := writeOutputLines(dir, config.RouterOSBootstrap.File, routerOSBootstrapScript(version, selected)); err != nil {
+                        return err
+                }
+        }
+        return nil
+}
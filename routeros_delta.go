@@ -0,0 +1,85 @@
+package main
+
+import (
+        "fmt"
+        "net/netip"
+        "path/filepath"
+        "sort"
+)
+
+// routerOSListAddress адрес так, как его показывает address-list: /32 без маски
+func routerOSListAddress(prefix netip.Prefix) string {
+        if prefix.IsSingleIP() {
+                return prefix.Addr().String()
+        }
+        return prefix.String()
+}
+
+// routerOSDeltaLines команды перехода от previous к current для address-list
+func routerOSDeltaLines(list *generatedList, previous map[netip.Prefix]bool, version string) []string {
+        path := "/ip firewall address-list"
+        if version == "v7" {
+                path = "/ip/firewall/address-list"
+        }
+        name := routerOSQuote(list.ListName)
+
+        current := make(map[netip.Prefix]bool, len(list.Prefixes))
+        var added []netip.Prefix
+        for _, prefix := range list.Prefixes {
+                if !prefix.Addr().Is4() {
+                        continue
+                }
+                current[prefix] = true
+                if !previous[prefix] {
+                        added = append(added, prefix)
+                }
+        }
+        var removed []netip.Prefix
+        for prefix := range previous {
+                if !current[prefix] {
+                        removed = append(removed, prefix)
+                }
+        }
+        sort.Slice(removed, func(i, j int) bool { return removed[i].Addr().Less(removed[j].Addr()) })
+
+        lines := []string{fmt.Sprintf("# %s: +%d -%d against the previous run", list.ListName, len(added), len(removed))}
+        for _, prefix := range removed {
+                lines = append(lines, fmt.Sprintf("%s remove [find list=%s address=%s]", path, name, routerOSListAddress(prefix)))
+        }
+        // Повторный импорт того же delta ничего не ломает
+        for _, prefix := range added {
+                lines = append(lines, fmt.Sprintf(":if ([:len [%s find list=%s address=%s]] = 0) do={%s add address=%s comment=%s list=%s}",
+                        path, name, routerOSListAddress(prefix), path, prefix, routerOSQuote(list.Comment), name))
+        }
+        return lines
+}
+
+// generateRouterOSDelta пишет <list>-delta.rsc рядом с полным скриптом: только
+// add новых и remove пропавших с прошлого запуска префиксов. Delta верен для
+// роутера, который применил предыдущий скрипт; иначе нужен полный.
+func generateRouterOSDelta(list *generatedList) error {
+        previous, ok := previousLists[list.Name]
+        if !ok {
+                return nil
+        }
+        hasV4 := false
+        for _, prefix := range list.Prefixes {
+                hasV4 = hasV4 || prefix.Addr().Is4()
+        }
+        if !hasV4 {
+                return nil
+        }
+
+        dir := layoutDir("routeros", list.Name, config.RouterOSDir)
+        for _, version := range []string{"v6", "v7"} {
+                if version == "v6" && !config.GenerateV6 || version == "v7" && !config.GenerateV7 {
+                        continue
+                }
+                // Пустой delta тоже пишется, чтобы не остался прошлый
+                lines := routerOSDeltaLines(list, previous, version)
+                if err := writeOutputLines(filepath.Join(dir, version), list.ListName+"-delta.rsc", lines); err != nil {
+                        return err
+                }
+        }
+        return nil
+}
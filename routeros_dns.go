@@ -0,0 +1,33 @@
+package main
+
+import (
+        "fmt"
+)
+
+// RouterOSDNSConfig записи /ip/dns/static с match-subdomain и address-list
+// (RouterOS 7.6+): роутер сам складывает адреса доменов в address-list
+type RouterOSDNSConfig struct {
+        OutputConfig `yaml:",inline"`
+        ForwardTo    string `yaml:"forward_to"` // DNS-сервер для type=FWD
+}
+
+func generateRouterOSDNSStatic(list *generatedList) error {
+        if len(list.Domains) == 0 {
+                return nil
+        }
+
+        // Поддомены уже покрыты match-subdomain родителя
+        domains := uniqueDomains(list.Domains)
+        forwardTo := routerOSQuote(config.RouterOSDNS.ForwardTo)
+
+        lines := []string{
+                fmt.Sprintf("/ip/dns/static remove [find comment=%s]", routerOSQuote(list.ListName)),
+        }
+        for _, domain := range domains {
+                lines = append(lines, fmt.Sprintf("/ip/dns/static add name=%s type=FWD forward-to=%s match-subdomain=yes address-list=%s comment=%s",
+                        routerOSQuote(domain), forwardTo, routerOSQuote(list.ListName), routerOSQuote(list.ListName)))
+        }
+
+        dir := layoutDir("routeros_dns", list.Name, config.RouterOSDNS.Dir)
+        return writeOutputLines(dir, list.ListName+"-dns.rsc", lines)
+}
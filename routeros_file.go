@@ -0,0 +1,44 @@
+package main
+
+import (
+        "fmt"
+)
+
+// RouterOSFileConfig файл адресов для /ip/firewall/address-list/import (RouterOS 7.15+)
+// и скрипт загрузки к нему. Импорт файла намного быстрее построчных add.
+type RouterOSFileConfig struct {
+        OutputConfig `yaml:",inline"`
+        FetchURL     string `yaml:"fetch_url"` // Где опубликованы файлы; тогда скрипт сам скачивает их через /tool/fetch
+}
+
+func routerOSImportScript(list *generatedList, file string) []string {
+        var lines []string
+        if config.RouterOSFile.FetchURL != "" {
+                url := layoutURL(config.RouterOSFile.FetchURL, "routeros_file", list.Name, config.RouterOSFile.Dir, file)
+                lines = append(lines, fmt.Sprintf("/tool/fetch url=%s dst-path=%s", routerOSQuote(url), routerOSQuote(file)))
+        }
+        return append(lines,
+                fmt.Sprintf("/ip/firewall/address-list/remove [find list=%s dynamic=no]", routerOSQuote(list.ListName)),
+                fmt.Sprintf("/ip/firewall/address-list/import file-name=%s list=%s comment=%s", routerOSQuote(file), routerOSQuote(list.ListName), routerOSQuote(list.Comment)),
+                fmt.Sprintf("/file/remove %s", routerOSQuote(file)),
+        )
+}
+
+func generateRouterOSImportFile(list *generatedList) error {
+        var addresses []string
+        for _, prefix := range list.Prefixes {
+                if prefix.Addr().Is4() {
+                        addresses = append(addresses, prefix.String())
+                }
+        }
+        if len(addresses) == 0 {
+                return nil
+        }
+
+        file := list.ListName + ".txt"
+        dir := layoutDir("routeros_file", list.Name, config.RouterOSFile.Dir)
+        if err := writeOutputLines(dir, file, addresses); err != nil {
+                return err
+        }
+        return writeOutputLines(dir, list.ListName+"-import.rsc", routerOSImportScript(list, file))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+        "bytes"
+        "fmt"
+        "os"
+        "path/filepath"
+)
+
+// Одинаковые скрипты v6 и v7 (например, с routeros_list_only) можно не
+// хранить дважды: routeros_link: hardlink или symlink заменяет файл v7
+// ссылкой на файл v6.
+
+// unlinkRouterOSScript удаляет прежнюю ссылку перед записью, чтобы запись
+// не прошла насквозь в файл v6
+func unlinkRouterOSScript(path string) error {
+        info, err := os.Lstat(path)
+        if err != nil {
+                return nil
+        }
+        if info.Mode()&os.ModeSymlink != 0 || config.RouterOSLink == "hardlink" {
+                if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+                        return err
+                }
+        }
+        return nil
+}
+
+// linkIdenticalRouterOSScript заменяет dest ссылкой на src, если содержимое совпадает
+func linkIdenticalRouterOSScript(src, dest string) error {
+        a, err := os.ReadFile(src)
+        if err != nil {
+                return err
+        }
+        b, err := os.ReadFile(dest)
+        if err != nil {
+                return err
+        }
+        if !bytes.Equal(a, b) {
+                return nil
+        }
+
+        tmp := dest + ".link"
+        os.Remove(tmp)
+        switch config.RouterOSLink {
+        case "hardlink":
+                err = os.Link(src, tmp)
+        case "symlink":
+                var target string
+                target, err = filepath.Rel(filepath.Dir(dest), src)
+                if err == nil {
+                        err = os.Symlink(target, tmp)
+                }
+        default:
+                return fmt.Errorf("unknown routeros_link %q", config.RouterOSLink)
+        }
+        if err != nil {
+                return err
+        }
+        return os.Rename(tmp, dest)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+        "bufio"
+        "bytes"
+        "fmt"
+        "log"
+        "strings"
+)
+
+// RouterOSPushConfig роутеры MikroTik, на которые скрипты отправляются через API
+type RouterOSPushConfig struct {
+        Targets []RouterOSTarget `yaml:"targets"`
+}
+
+type RouterOSTarget struct {
+        Name               string `yaml:"name"`
+        Address            string `yaml:"address"` // host или host:port, для REST - https://host
+        API                string `yaml:"api"`     // binary (по умолчанию) или rest
+        User               string `yaml:"user"`
+        Password           string `yaml:"password"`
+        Version            string `yaml:"version"` // auto (по умолчанию), v6 или v7
+        TLS                bool   `yaml:"tls"`
+        InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+        Timeout            string `yaml:"timeout"`  // Для REST: записи создаются динамическими и продлеваются каждый запуск
+        Sync               string `yaml:"sync"`     // Для binary: diff (по умолчанию) - только изменения, script - весь скрипт списка
+        Parallel           int    `yaml:"parallel"` // Для REST: одновременных запросов, по умолчанию 4
+        MaxEntries         int    `yaml:"max_entries"` // Для REST: предел записей списка, по умолчанию 50000 (print без постраничной выдачи)
+}
+
+// routerOSSyntax выбирает синтаксис по строке версии вида "7.14.2 (stable)"
+func routerOSSyntax(version string) (string, error) {
+        major, _, _ := strings.Cut(strings.TrimSpace(version), ".")
+        switch major {
+        case "6":
+                return "v6", nil
+        case "7":
+                return "v7", nil
+        default:
+                return "", fmt.Errorf("unsupported RouterOS version %q", version)
+        }
+}
+
+func detectRouterOSSyntax(client *routerOSClient) (string, error) {
+        replies, _, err := client.Run("/system/resource/print")
+        if err != nil {
+                return "", err
+        }
+        if len(replies) == 0 {
+                return "", fmt.Errorf("empty /system/resource reply")
+        }
+        return routerOSSyntax(replies[0]["version"])
+}
+
+// runRouterOSScript выполняет скрипт на роутере через временный /system/script
+func runRouterOSScript(client *routerOSClient, name, source string) error {
+        client.Run("/system/script/remove", "=numbers="+name)
+        if _, _, err := client.Run("/system/script/add", "=name="+name, "=source="+source); err != nil {
+                return err
+        }
+        defer client.Run("/system/script/remove", "=numbers="+name)
+
+        _, _, err := client.Run("/system/script/run", "=number="+name)
+        return err
+}
+
+func pushRouterOSTarget(target RouterOSTarget, lists []*generatedList) error {
+        lists = listsForFormat("routeros", lists)
+        if target.API == "rest" {
+                return syncRouterOSREST(target, lists)
+        }
+
+        client, err := dialRouterOS(target)
+        if err != nil {
+                return err
+        }
+        defer client.Close()
+
+        if err := client.Login(target.User, target.Password); err != nil {
+                return err
+        }
+
+        syntax := target.Version
+        if syntax == "" || syntax == "auto" {
+                syntax, err = detectRouterOSSyntax(client)
+                if err != nil {
+                        return err
+                }
+                log.Printf("RouterOS %s: using %s syntax", target.Name, syntax)
+        }
+
+        if target.Sync != "script" {
+                return syncRouterOSAPI(client, syntax, lists)
+        }
+
+        for _, list := range lists {
+                // IPv6-префиксы пойдут в /ipv6 firewall address-list
+                prefixes := list.Prefixes
+                if len(prefixes) == 0 {
+                        continue
+                }
+
+                var buf bytes.Buffer
+                writer := bufio.NewWriter(&buf)
+                if err := writeRouterOSScript(writer, list.ListName, list.Comment, prefixes, syntax); err != nil {
+                        return err
+                }
+                if err := writer.Flush(); err != nil {
+                        return err
+                }
+                if err := runRouterOSScript(client, "allow-domains-"+list.ListName, buf.String()); err != nil {
+                        return fmt.Errorf("%s: %w", list.ListName, err)
+                }
+        }
+        return nil
+}
+
+func routerOSTargetName(target RouterOSTarget) string {
+        if target.Name != "" {
+                return target.Name
+        }
+        return target.Address
+}
+
+func pushRouterOS(lists []*generatedList) {
+        for _, target := range config.RouterOSPush.Targets {
+                name := routerOSTargetName(target)
+                reportProgress("RouterOS "+name, "push", target.Address)
+                err := pushRouterOSTarget(target, lists)
+                if err != nil {
+                        log.Printf("Error pushing to RouterOS %s: %v", name, err)
+                        reportProgress("RouterOS "+name, "failed", err.Error())
+                } else {
+                        reportProgress("RouterOS "+name, "done", "")
+                }
+                recordPush("routeros:"+name, lists, err)
+        }
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+        "bufio"
+        "bytes"
+        "crypto/tls"
+        "encoding/json"
+        "errors"
+        "fmt"
+        "io"
+        "log"
+        "net/http"
+        "net/netip"
+        "strings"
+        "sync"
+)
+
+// Синхронизация address-list через REST API RouterOS 7 (служба www-ssl, /rest)
+
+type routerOSREST struct {
+        base     string
+        user     string
+        password string
+        client   *http.Client
+        max      int // max_entries
+}
+
+// routerOSAddress запись /ip/firewall/address-list в ответе REST
+type routerOSAddress struct {
+        ID      string `json:".id"`
+        Address string `json:"address"`
+        Comment string `json:"comment"`
+        Dynamic string `json:"dynamic"`
+}
+
+func newRouterOSREST(target RouterOSTarget) *routerOSREST {
+        base := target.Address
+        if !strings.Contains(base, "://") {
+                base = "https://" + base
+        }
+
+        if target.MaxEntries <= 0 {
+                target.MaxEntries = 50000
+        }
+        transport := http.DefaultTransport.(*http.Transport).Clone()
+        transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: target.InsecureSkipVerify}
+        return &routerOSREST{
+                base:     strings.TrimSuffix(base, "/") + "/rest",
+                user:     target.User,
+                password: target.Password,
+                client:   &http.Client{Transport: transport, Timeout: httpClient.Timeout},
+                max:      target.MaxEntries,
+        }
+}
+
+func (r *routerOSREST) do(method, path string, payload, out any) error {
+        var body io.Reader
+        if payload != nil {
+                data, err := json.Marshal(payload)
+                if err != nil {
+                        return err
+                }
+                body = bytes.NewReader(data)
+        }
+
+        req, err := http.NewRequest(method, r.base+path, body)
+        if err != nil {
+                return err
+        }
+        req.SetBasicAuth(r.user, r.password)
+        req.Header.Set("Content-Type", "application/json")
+
+        resp, err := r.client.Do(req)
+        if err != nil {
+                return err
+        }
+        defer resp.Body.Close()
+
+        if resp.StatusCode >= 300 {
+                // Ошибки REST приходят как {"error":..,"message":..,"detail":..}
+                var apiErr struct {
+                        Message string `json:"message"`
+                        Detail  string `json:"detail"`
+                }
+                json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&apiErr)
+                return fmt.Errorf("%s %s: %s %s %s", method, path, resp.Status, apiErr.Message, apiErr.Detail)
+        }
+        if out == nil {
+                io.Copy(io.Discard, resp.Body)
+                return nil
+        }
+        if decode, ok := out.(func(*json.Decoder) error); ok {
+                return decode(json.NewDecoder(resp.Body))
+        }
+        return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// listAddresses читает записи одного списка. У print в REST нет ни limit, ни
+// count, постранично его не прочитать: список приходит одним ответом, который
+// сужается фильтром по списку и нужными полями и читается потоком не дальше max_entries.
+// Больший или оборванный ответ - ошибка: разница с неполным списком удалила бы лишнее.
+func (r *routerOSREST) listAddresses(path, list string) ([]routerOSAddress, error) {
+        query := map[string]any{
+                ".proplist": []string{".id", "address", "comment", "dynamic"},
+                ".query":    []string{"list=" + list},
+        }
+        var entries []routerOSAddress
+        err := r.do(http.MethodPost, path+"/print", query, func(dec *json.Decoder) error {
+                if token, err := dec.Token(); err != nil {
+                        return err
+                } else if token != json.Delim('[') {
+                        return fmt.Errorf("address-list %s: response is not a list", list)
+                }
+                for dec.More() {
+                        if len(entries) >= r.max {
+                                return fmt.Errorf("address-list %s has more than %d entries (max_entries), not synced", list, r.max)
+                        }
+                        var entry routerOSAddress
+                        if err := dec.Decode(&entry); err != nil {
+                                return err
+                        }
+                        entries = append(entries, entry)
+                }
+                // Без закрывающей ] ответ оборван и список неполный
+                if _, err := dec.Token(); err != nil {
+                        return fmt.Errorf("address-list %s: truncated response after %d entries: %w", list, len(entries), err)
+                }
+                return nil
+        })
+        return entries, err
+}
+
+// routerOSEntryPrefix приводит адрес записи к префиксу: RouterOS хранит /32 без маски
+func routerOSEntryPrefix(address string) (netip.Prefix, bool) {
+        if prefix, err := netip.ParsePrefix(address); err == nil {
+                return prefix.Masked(), true
+        }
+        if addr, err := netip.ParseAddr(address); err == nil {
+                return netip.PrefixFrom(addr, addr.BitLen()), true
+        }
+        return netip.Prefix{}, false
+}
+
+// restRequest один запрос пакета изменений
+type restRequest struct {
+        method, path string
+        payload      any
+}
+
+// runBatch выполняет запросы по parallel одновременно и собирает все ошибки,
+// а не останавливается на первой: одна отвергнутая запись не мешает остальным
+func (r *routerOSREST) runBatch(requests []restRequest, parallel int) error {
+        if parallel <= 0 {
+                parallel = 4
+        }
+        errs := make([]error, len(requests))
+        sem := make(chan struct{}, parallel)
+        var wg sync.WaitGroup
+        for i, req := range requests {
+                wg.Add(1)
+                sem <- struct{}{}
+                go func(i int, req restRequest) {
+                        defer wg.Done()
+                        defer func() { <-sem }()
+                        errs[i] = r.do(req.method, req.path, req.payload, nil)
+                }(i, req)
+        }
+        wg.Wait()
+
+        var failed []error
+        for _, err := range errs {
+                if err != nil {
+                        failed = append(failed, err)
+                }
+        }
+        if len(failed) == 0 {
+                return nil
+        }
+        // Сотни одинаковых ошибок читать незачем
+        shown := failed
+        if len(shown) > 5 {
+                shown = shown[:5]
+        }
+        return fmt.Errorf("%d of %d requests failed: %w", len(failed), len(requests), errors.Join(shown...))
+}
+
+// syncList приводит address-list одного семейства к префиксам списка:
+// недостающие записи создаются, лишние удаляются, существующие обновляются
+// PATCH-запросом, если изменился комментарий или нужно продлить timeout.
+func (r *routerOSREST) syncList(path string, list *generatedList, desired []netip.Prefix, timeout string, parallel int) error {
+        if len(desired) > r.max {
+                return fmt.Errorf("%s: %d prefixes above max_entries %d", list.ListName, len(desired), r.max)
+        }
+        current, err := r.listAddresses(path, list.ListName)
+        if err != nil {
+                return err
+        }
+
+        want := make(map[netip.Prefix]bool, len(desired))
+        for _, prefix := range desired {
+                want[prefix.Masked()] = true
+        }
+
+        var requests []restRequest
+        var added, removed, updated int
+        present := make(map[netip.Prefix]bool)
+        for _, entry := range current {
+                prefix, ok := routerOSEntryPrefix(entry.Address)
+                // Динамические записи добавляет и сам роутер (DNS static с address-list=,
+                // скрипты DHCP/PPP). С timeout наши записи тоже динамические - их
+                // узнаём по комментарию, остальные не трогаем.
+                if entry.Dynamic == "true" && (timeout == "" || entry.Comment != routerOSText(list.Comment)) {
+                        if ok {
+                                // Адрес уже в списке: вторая запись не добавится
+                                present[prefix] = true
+                        }
+                        continue
+                }
+                if !ok || !want[prefix] || present[prefix] {
+                        requests = append(requests, restRequest{http.MethodDelete, path + "/" + entry.ID, nil})
+                        removed++
+                        continue
+                }
+                present[prefix] = true
+
+                patch := make(map[string]string)
+                if entry.Comment != routerOSText(list.Comment) {
+                        patch["comment"] = routerOSText(list.Comment)
+                }
+                if timeout != "" {
+                        patch["timeout"] = timeout
+                }
+                if len(patch) > 0 {
+                        requests = append(requests, restRequest{http.MethodPatch, path + "/" + entry.ID, patch})
+                        updated++
+                }
+        }
+
+        for _, prefix := range desired {
+                if present[prefix.Masked()] {
+                        continue
+                }
+                entry := map[string]string{
+                        "list":    list.ListName,
+                        "address": prefix.String(),
+                        "comment": routerOSText(list.Comment),
+                }
+                if timeout != "" {
+                        entry["timeout"] = timeout
+                }
+                requests = append(requests, restRequest{http.MethodPut, path, entry})
+                present[prefix.Masked()] = true
+                added++
+        }
+
+        if len(requests) > 0 {
+                log.Printf("RouterOS REST %s: +%d -%d ~%d", list.ListName, added, removed, updated)
+        }
+        return r.runBatch(requests, parallel)
+}
+
+// syncRoutes досоздаёт mangle и маршруты списка тем же скриптом, что и в .rsc,
+// через /execute: он ничего не меняет, если они уже есть
+func (r *routerOSREST) syncRoutes(list *generatedList, hasV4, hasV6 bool) error {
+        var buf bytes.Buffer
+        writer := bufio.NewWriter(&buf)
+        if err := writeRouterOSRouting(writer, list.ListName, "v7", hasV4, hasV6); err != nil {
+                return err
+        }
+        if err := writer.Flush(); err != nil {
+                return err
+        }
+        if buf.Len() == 0 {
+                return nil
+        }
+        return r.do(http.MethodPost, "/execute", map[string]string{"script": buf.String()}, nil)
+}
+
+// syncRouterOSREST синхронизирует все списки; ошибка одного списка не
+// прерывает остальные, итоговая ошибка перечисляет все
+func syncRouterOSREST(target RouterOSTarget, lists []*generatedList) error {
+        client := newRouterOSREST(target)
+        var errs []error
+        for _, list := range lists {
+                if len(list.Prefixes) == 0 {
+                        continue
+                }
+                var v4, v6 []netip.Prefix
+                for _, prefix := range list.Prefixes {
+                        if prefix.Addr().Is4() {
+                                v4 = append(v4, prefix)
+                        } else {
+                                v6 = append(v6, prefix)
+                        }
+                }
+
+                err := client.syncList("/ip/firewall/address-list", list, v4, target.Timeout, target.Parallel)
+                if err == nil && len(v6) > 0 {
+                        err = client.syncList("/ipv6/firewall/address-list", list, v6, target.Timeout, target.Parallel)
+                }
+                if err == nil {
+                        err = client.syncRoutes(list, len(v4) > 0, len(v6) > 0)
+                }
+                if err != nil {
+                        errs = append(errs, fmt.Errorf("%s: %w", list.ListName, err))
+                }
+        }
+        return errors.Join(errs...)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+        "net/http"
+        "net/http/httptest"
+        "strings"
+        "testing"
+)
+
+func TestRouterOSRESTListAddresses(t *testing.T) {
+        tests := []struct {
+                name    string
+                body    string
+                entries int
+                err     string
+        }{
+                {"complete", `[{".id":"*1","address":"1.2.3.0/24"},{".id":"*2","address":"1.2.4.0/24"}]`, 2, ""},
+                {"empty", `[]`, 0, ""},
+                {"truncated", `[{".id":"*1","address":"1.2.3.0/24"},`, 0, "unexpected end"},
+                {"cut after entry", `[{".id":"*1","address":"1.2.3.0/24"}`, 0, "unexpected end"},
+                {"not a list", `{"message":"busy"}`, 0, "not a list"},
+                {"above max_entries", `[{".id":"*1"},{".id":"*2"},{".id":"*3"}]`, 0, "max_entries"},
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                                w.Write([]byte(tt.body))
+                        }))
+                        defer server.Close()
+
+                        client := newRouterOSREST(RouterOSTarget{Address: server.URL, MaxEntries: 2})
+                        entries, err := client.listAddresses("/ip/firewall/address-list", "telegram")
+                        if tt.err != "" {
+                                if err == nil || !strings.Contains(err.Error(), tt.err) {
+                                        t.Fatalf("listAddresses error = %v, want %q", err, tt.err)
+                                }
+                                return
+                        }
+                        if err != nil {
+                                t.Fatal(err)
+                        }
+                        if len(entries) != tt.entries {
+                                t.Errorf("listAddresses = %d entries, want %d", len(entries), tt.entries)
+                        }
+                })
+        }
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+        "bufio"
+        "bytes"
+        "fmt"
+        "log"
+        "net/netip"
+)
+
+// syncRouterOSAPIList приводит address-list на роутере к префиксам одного
+// семейства через бинарный API: лишние записи удаляются, недостающие
+// добавляются, совпадающие не трогаются. Динамические записи (из DNS static,
+// timeout) остаются как есть.
+func syncRouterOSAPIList(client *routerOSClient, path string, list *generatedList, desired []netip.Prefix) (added, removed, updated int, err error) {
+        current, _, err := client.Run(path+"/print", "=.proplist=.id,address,comment,dynamic", "?list="+list.ListName)
+        if err != nil {
+                return 0, 0, 0, err
+        }
+
+        want := make(map[netip.Prefix]bool, len(desired))
+        for _, prefix := range desired {
+                want[prefix.Masked()] = true
+        }
+        comment := routerOSText(list.Comment)
+
+        present := make(map[netip.Prefix]bool)
+        for _, entry := range current {
+                if entry["dynamic"] == "true" {
+                        continue
+                }
+                prefix, ok := routerOSEntryPrefix(entry["address"])
+                if !ok || !want[prefix] || present[prefix] {
+                        if _, _, err := client.Run(path+"/remove", "=.id="+entry[".id"]); err != nil {
+                                return added, removed, updated, err
+                        }
+                        removed++
+                        continue
+                }
+                present[prefix] = true
+                if entry["comment"] != comment {
+                        if _, _, err := client.Run(path+"/set", "=.id="+entry[".id"], "=comment="+comment); err != nil {
+                                return added, removed, updated, err
+                        }
+                        updated++
+                }
+        }
+
+        for _, prefix := range desired {
+                if present[prefix.Masked()] {
+                        continue
+                }
+                if _, _, err := client.Run(path+"/add", "=list="+list.ListName, "=address="+prefix.String(), "=comment="+comment); err != nil {
+                        return added, removed, updated, err
+                }
+                present[prefix.Masked()] = true
+                added++
+        }
+        return added, removed, updated, nil
+}
+
+// syncRouterOSAPI применяет только разницу address-list, а mangle и маршруты
+// досоздаёт тем же скриптом, что и в .rsc: он ничего не меняет, если они уже есть
+func syncRouterOSAPI(client *routerOSClient, syntax string, lists []*generatedList) error {
+        for _, list := range lists {
+                if len(list.Prefixes) == 0 {
+                        continue
+                }
+                var v4, v6 []netip.Prefix
+                for _, prefix := range list.Prefixes {
+                        if prefix.Addr().Is4() {
+                                v4 = append(v4, prefix)
+                        } else {
+                                v6 = append(v6, prefix)
+                        }
+                }
+
+                // /ipv6 трогаем только при IPv6-префиксах: на роутере без пакета ipv6 этой команды нет
+                paths := map[string][]netip.Prefix{"/ip/firewall/address-list": v4}
+                if len(v6) > 0 {
+                        paths["/ipv6/firewall/address-list"] = v6
+                }
+
+                var added, removed, updated int
+                for path, prefixes := range paths {
+                        a, r, u, err := syncRouterOSAPIList(client, path, list, prefixes)
+                        added, removed, updated = added+a, removed+r, updated+u
+                        if err != nil {
+                                return fmt.Errorf("%s: %w", list.ListName, err)
+                        }
+                }
+                if added+removed+updated > 0 {
+                        log.Printf("RouterOS API %s: +%d -%d ~%d", list.ListName, added, removed, updated)
+                }
+
+                var buf bytes.Buffer
+                writer := bufio.NewWriter(&buf)
+                if err := writeRouterOSRouting(writer, list.ListName, syntax, len(v4) > 0, len(v6) > 0); err != nil {
+                        return err
+                }
+                if err := writer.Flush(); err != nil {
+                        return err
+                }
+                if buf.Len() == 0 {
+                        continue
+                }
+                if err := runRouterOSScript(client, "allow-domains-"+list.ListName, buf.String()); err != nil {
+                        return fmt.Errorf("%s: %w", list.ListName, err)
+                }
+        }
+        return nil
+}
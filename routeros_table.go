@@ -0,0 +1,34 @@
+package main
+
+import (
+        "fmt"
+)
+
+// routerOSTableScript настройка маршрутизации списка средствами RouterOS 7:
+// таблица R_<list> с fib, mark-routing в неё, правило /routing/rule и маршрут
+// по умолчанию в таблице. family - ip или ipv6. Всё идемпотентно: повторный
+// импорт ничего не дублирует.
+func routerOSTableScript(family, listName, gateway string) string {
+        list := routerOSQuote(listName)
+        table := routerOSQuote("R_" + listName)
+        dst := "0.0.0.0/0"
+        if family == "ipv6" {
+                dst = "::/0"
+        }
+        return fmt.Sprintf(`
+{
+    :if ([:len [/routing/table find name=%[2]s]] = 0) do={
+        /routing/table add name=%[2]s fib comment=%[1]s
+    }
+    :if ([:len [/%[3]s/firewall/mangle find dst-address-list=%[1]s]] = 0) do={
+        /%[3]s/firewall/mangle add action=mark-routing chain=prerouting connection-mark=no-mark dst-address-list=%[1]s new-routing-mark=%[2]s passthrough=no
+    }
+    :if ([:len [/routing/rule find routing-mark=%[2]s]] = 0) do={
+        /routing/rule add routing-mark=%[2]s action=lookup table=%[2]s
+    }
+    :if ([:len [/%[3]s/route find routing-table=%[2]s dst-address=%[4]s gateway=%[5]s]] = 0) do={
+        /%[3]s/route add dst-address=%[4]s gateway=%[5]s routing-table=%[2]s comment=%[1]s
+    }
+}
+`, list, table, family, dst, gateway)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+        "fmt"
+        "strings"
+        "time"
+)
+
+// RPZConfig зона Response Policy Zone для BIND/PowerDNS из доменов списков
+type RPZConfig struct {
+        OutputConfig `yaml:",inline"`
+        ZoneSuffix   string `yaml:"zone_suffix"` // Зона списка: <list>.<zone_suffix>
+        Action       string `yaml:"action"`      // passthru (по умолчанию), nxdomain, nodata, drop или cname
+        CNAME        string `yaml:"cname"`       // Цель переписывания для action: cname
+        NameServer   string `yaml:"name_server"` // NS в SOA, в RPZ носит формальный характер
+}
+
+// rpzTarget правая часть записи для выбранного действия
+func rpzTarget() (string, error) {
+        switch config.RPZ.Action {
+        case "", "passthru":
+                return "CNAME rpz-passthru.", nil
+        case "nxdomain":
+                return "CNAME .", nil
+        case "nodata":
+                return "CNAME *.", nil
+        case "drop":
+                return "CNAME rpz-drop.", nil
+        case "cname":
+                if config.RPZ.CNAME == "" {
+                        return "", fmt.Errorf("rpz.cname is required for action cname")
+                }
+                return "CNAME " + strings.TrimSuffix(config.RPZ.CNAME, ".") + ".", nil
+        }
+        return "", fmt.Errorf("unknown rpz.action %q", config.RPZ.Action)
+}
+
+func rpzZone(list *generatedList) ([]string, error) {
+        target, err := rpzTarget()
+        if err != nil {
+                return nil, err
+        }
+        ns := strings.TrimSuffix(config.RPZ.NameServer, ".") + "."
+        lines := []string{
+                "; " + list.Comment,
+                "$TTL 300",
+                fmt.Sprintf("@ IN SOA %s hostmaster.%s %d 3600 600 86400 300", ns, ns, time.Now().Unix()),
+                "@ IN NS " + ns,
+        }
+        for _, domain := range list.Domains {
+                // ".ua" - только поддомены, "example.com" - сам домен и поддомены
+                name := strings.TrimSuffix(trimDomainDot(domain), ".")
+                if !strings.HasPrefix(domain, ".") {
+                        lines = append(lines, name+" "+target)
+                }
+                lines = append(lines, "*."+name+" "+target)
+        }
+        return lines, nil
+}
+
+func generateRPZZone(list *generatedList) error {
+        if len(list.Domains) == 0 {
+                return nil
+        }
+        lines, err := rpzZone(list)
+        if err != nil {
+                return err
+        }
+        return writeOutputLines(layoutDir("rpz", list.Name, config.RPZ.Dir), list.Name+"."+strings.TrimSuffix(config.RPZ.ZoneSuffix, ".")+".zone", lines)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+        "fmt"
+        "net/netip"
+        "strings"
+        "sync"
+)
+
+// RunnerOptions параметры запуска генерации из Go-кода (веб-интерфейс,
+// планировщик) вместо вызова бинарника
+type RunnerOptions struct {
+        ConfigFile string
+        Offline    bool
+        Only       []string // Как --only: источники или имена списков
+        Skip       []string // Как --skip
+
+        OnProgress     func(source, stage, detail string) // Все события, как в --tui
+        OnSourceDone   func(source string, err error)     // Источник или список обработан; err - причина сбоя
+        OnListRendered func(list ListResult, format string)
+}
+
+// ListResult собранный список в виде, не зависящем от внутренних структур
+type ListResult struct {
+        Name     string
+        ListName string
+        Comment  string
+        Prefixes []netip.Prefix
+        Domains  []string
+        Sources  []string
+        ASNs     []string
+        Tags     []string
+}
+
+// RunResult итог одного запуска
+type RunResult struct {
+        Lists   []ListResult
+        Failed  []string   // Упавшие этапы: "источник (этап)"
+        Skipped []string   // Пропущенные по run_timeout
+        Diffs   []listDiff // Изменения IPv4-префиксов относительно прошлого запуска
+}
+
+// Runner выполняет тот же pipeline, что и бинарник. Состояние запуска
+// глобальное, поэтому одновременно выполняется только один Run.
+type Runner struct {
+        opts RunnerOptions
+}
+
+var runnerMu sync.Mutex
+
+func NewRunner(opts RunnerOptions) *Runner {
+        return &Runner{opts: opts}
+}
+
+func newListResult(list *generatedList) ListResult {
+        return ListResult{Name: list.Name, ListName: list.ListName, Comment: list.Comment, Prefixes: list.Prefixes,
+                Domains: list.Domains, Sources: list.Sources, ASNs: list.ASNs, Tags: list.Tags}
+}
+
+// resetRunState сбрасывает глобальное состояние прошлого запуска в этом процессе
+func resetRunState() {
+        config = Config{}
+        generatedLists = nil
+        stageFailures = nil
+        skippedStages = nil
+        pendingRetries = nil
+        renderedFiles = make(map[string][]indexFile)
+        anycastPrefixes = nil
+        ixpSet = nil
+        pushQueue, pushQueueLoaded = nil, false
+        quarantineState = nil
+        graceState = nil
+        provenance = nil
+        asSetASNs = nil
+        savedProvenance = nil
+        bgpTableSources = nil
+        cookieJar = nil
+}
+
+// progressCallbacks разводит события pipeline по обработчикам RunnerOptions
+func (r *Runner) progressCallbacks(event progressEvent) {
+        if r.opts.OnProgress != nil {
+                r.opts.OnProgress(event.Source, event.Stage, event.Detail)
+        }
+        if r.opts.OnSourceDone == nil {
+                return
+        }
+        // done у форматов вывода означает конец рендера, а не источника
+        for _, renderer := range listRenderers {
+                if renderer.name == event.Source {
+                        return
+                }
+        }
+        switch event.Stage {
+        case "done":
+                r.opts.OnSourceDone(event.Source, nil)
+        case "failed":
+                r.opts.OnSourceDone(event.Source, fmt.Errorf("%s", event.Detail))
+        }
+}
+
+// Run загружает конфиг и выполняет запуск. Ошибки, на которых бинарник
+// завершился бы, возвращаются как error вместе с частичным результатом.
+// Если запуск завис дольше run_timeout с запасом, Run возвращает ошибку
+// сразу, а следующий Run ждёт, пока зависший запуск всё же закончится.
+func (r *Runner) Run() (*RunResult, error) {
+        runnerMu.Lock()
+        type outcome struct {
+                result *RunResult
+                err    error
+                panic  any
+        }
+        done := make(chan outcome, 1)
+        aborted := make(chan error, 1)
+        go func() {
+                // Состояние запуска глобальное: держим мьютекс до настоящего конца
+                defer runnerMu.Unlock()
+                // Прочие паники, как и раньше, доходят до вызывающего Run
+                defer func() {
+                        if p := recover(); p != nil {
+                                done <- outcome{panic: p}
+                        }
+                }()
+                result, err := r.execute(aborted)
+                done <- outcome{result: result, err: err}
+        }()
+        select {
+        case o := <-done:
+                if o.panic != nil {
+                        panic(o.panic)
+                }
+                return o.result, o.err
+        case err := <-aborted:
+                return &RunResult{}, err
+        }
+}
+
+func (r *Runner) execute(aborted chan<- error) (result *RunResult, err error) {
+        resetRunState()
+        offlineMode = r.opts.Offline
+        onlySources = parseSourceList(strings.Join(r.opts.Only, ","))
+        skipSources = parseSourceList(strings.Join(r.opts.Skip, ","))
+
+        progressHandler = r.progressCallbacks
+        if r.opts.OnListRendered != nil {
+                listRenderedHook = func(list *generatedList, format string) {
+                        r.opts.OnListRendered(newListResult(list), format)
+                }
+        }
+        fatalPanics = true
+        defer func() {
+                progressHandler, listRenderedHook, fatalPanics = nil, nil, false
+        }()
+
+        if err := loadConfig(r.opts.ConfigFile); err != nil {
+                return nil, fmt.Errorf("loading config: %w", err)
+        }
+        if err := initWorkspace(); err != nil {
+                return nil, fmt.Errorf("creating work dir: %w", err)
+        }
+        defer cleanupWorkspace()
+        stopDeadline := startRunDeadline(aborted)
+        defer stopDeadline()
+
+        result = &RunResult{}
+        defer func() {
+                if p := recover(); p != nil {
+                        stop, ok := p.(fatalError)
+                        if !ok {
+                                panic(p)
+                        }
+                        err = stop
+                }
+                for _, list := range generatedLists {
+                        result.Lists = append(result.Lists, newListResult(list))
+                }
+                result.Failed = append(result.Failed, stageFailures...)
+                result.Skipped = append(result.Skipped, skippedStages...)
+                result.Diffs = generatedListDiffs()
+                if err == nil && len(stageFailures) > 0 {
+                        err = fmt.Errorf("%d failed stages: %s", len(stageFailures), strings.Join(stageFailures, ", "))
+                }
+                if err == nil && len(skippedStages) > 0 {
+                        err = fmt.Errorf("run incomplete: %d stages skipped", len(skippedStages))
+                }
+        }()
+
+        run()
+        return result, nil
+}
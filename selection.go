@@ -0,0 +1,71 @@
+package main
+
+import (
+        "strings"
+)
+
+// Выбор источников на время запуска: --only и --skip принимают через запятую
+// группы (bgp, filters, discord, telegram, cloudflare, aws, google, domains) и имена списков
+
+var onlySources, skipSources map[string]bool
+
+func parseSourceList(value string) map[string]bool {
+        set := make(map[string]bool)
+        for _, name := range strings.Split(value, ",") {
+                if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+                        set[name] = true
+                }
+        }
+        return set
+}
+
+// sourceSelected проверяет список по его именам и группам: он обрабатывается,
+// если одно из имён указано в --only (или --only не задан) и ни одно не указано в --skip
+// и не заморожено или закреплено (freeze.go)
+func sourceSelected(names ...string) bool {
+        matched := len(onlySources) == 0
+        for _, name := range names {
+                name = strings.ToLower(strings.TrimSuffix(name, ".lst"))
+                if skipSources[name] || heldLists[name] {
+                        return false
+                }
+                if onlySources[name] {
+                        matched = true
+                }
+        }
+        return matched
+}
+
+// partialRun обрабатываются не все списки: общие для всех списков файлы в таком запуске не пишутся
+func partialRun() bool {
+        return len(onlySources) > 0 || len(skipSources) > 0
+}
+
+func asListSelected(as string, asConfig ASConfig) bool {
+        names := []string{as, "as" + as, asConfig.File, asConfig.ListName, "bgp"}
+        for _, n := range listASNs(as, asConfig) {
+                names = append(names, n, "as"+n)
+        }
+        names = append(names, asConfig.ASSets...)
+        return sourceSelected(names...)
+}
+
+func filterSelected(name string) bool {
+        return sourceSelected(name, "filters", "bgp")
+}
+
+// bgpTableNeeded таблица BGP нужна, только если выбран хотя бы один фильтр-список
+// или ASN-список из таблицы bgp.tools
+func bgpTableNeeded() bool {
+        for as, asConfig := range config.ASNumbers {
+                if asListSelected(as, asConfig) && (asConfig.Source == "" || asConfig.Source == asSourceBGPTools) {
+                        return true
+                }
+        }
+        for name := range config.Filters {
+                if filterSelected(name) {
+                        return true
+                }
+        }
+        return false
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+        "crypto/sha256"
+        "encoding/hex"
+        "flag"
+        "io"
+        "log"
+        "net/http"
+        "os"
+        "path"
+        "path/filepath"
+        "strings"
+        "sync"
+        "sync/atomic"
+        "time"
+)
+
+// ServerConfig встроенный HTTP-сервер для раздачи сгенерированных файлов
+type ServerConfig struct {
+        Listen     string             `yaml:"listen"`
+        AccessLog  bool               `yaml:"access_log"`  // Строка журнала на каждый запрос
+        Metrics    bool               `yaml:"metrics"`     // /metrics со счётчиками загрузок по файлам
+        TrustProxy bool               `yaml:"trust_proxy"` // Адрес клиента брать из X-Forwarded-For
+        Access     []ServerAccessRule `yaml:"access"`      // Токены и адреса для закрытых списков
+        UI         WebUIConfig        `yaml:"ui"`          // Страница /ui/ для управления запусками
+}
+
+// serverSettings настройки serve на момент запуска: веб-интерфейс
+// перечитывает config во время работы сервера
+var serverSettings ServerConfig
+
+// publishedRoots каталоги и файлы, которые можно отдавать: только вывод
+// форматов, чтобы конфиг с паролями и кэш не были доступны снаружи
+func publishedRoots() []string {
+        dirs := []string{
+                config.IPv4Dir, config.RouterOSDir, config.Dnsmasq.Dir, config.SingBox.Dir, config.SingBox.SRSDir,
+                config.Surge.Dir, config.QuantumultX.Dir, config.Keenetic.Dir, config.OpenWrtPBR.Dir, config.OpenWrtIPSet.Dir,
+                config.RouterOSFile.Dir, config.RouterOSDNS.Dir, config.PfSense.Dir, config.OPNsense.Dir, config.Cisco.Dir, config.Juniper.Dir,
+                config.BIRD.Dir, config.FRR.Dir, config.VyOS.Dir, config.EdgeOS.Dir, config.OpenVPN.Dir,
+                config.WireGuard.Dir, config.Amnezia.Dir, config.Windows.Dir, config.Linux.Dir, config.Networkd.Dir, config.Merlin.Dir, config.Unbound.Dir, config.RPZ.Dir, config.SmartDNS.Dir, config.DNSCrypt.Dir, config.Squid.Dir, config.HAProxy.Dir, config.JSON.Dir, config.Raw.Dir, config.Xray.Dir,
+        }
+        roots := append([]string(nil), dirs...)
+        for _, rule := range config.Layout {
+                for _, dir := range dirs {
+                        roots = append(roots, strings.ReplaceAll(rule.Dir, "{dir}", dir))
+                }
+        }
+        roots = append(roots, config.MMDB.File, config.Index.File, config.Snapshot.File)
+
+        var clean []string
+        seen := make(map[string]bool)
+        for _, root := range roots {
+                root = path.Clean(filepath.ToSlash(root))
+                if root == "." || seen[root] {
+                        continue
+                }
+                // URL строится от текущего каталога, такие пути сервер отдать не может
+                if root == ".." || strings.HasPrefix(root, "../") || path.IsAbs(root) {
+                        log.Printf("Warning: %s is outside the working directory and is not served", root)
+                        seen[root] = true
+                        continue
+                }
+                seen[root] = true
+                clean = append(clean, root)
+        }
+        return clean
+}
+
+func pathPublished(roots []string, name string) bool {
+        for _, part := range strings.Split(name, "/") {
+                if strings.HasPrefix(part, ".") {
+                        return false
+                }
+        }
+        for _, root := range roots {
+                if name == root || strings.HasPrefix(name, root+"/") {
+                        return true
+                }
+        }
+        return false
+}
+
+type etagEntry struct {
+        modTime time.Time
+        size    int64
+        etag    string
+}
+
+// etagCache сильные ETag по хэшу содержимого; пересчитываются только при смене
+// времени изменения или размера файла
+type etagCache struct {
+        mu      sync.Mutex
+        entries map[string]etagEntry
+}
+
+func (c *etagCache) get(name string, file *os.File, info os.FileInfo) (string, error) {
+        c.mu.Lock()
+        entry, ok := c.entries[name]
+        c.mu.Unlock()
+        if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+                return entry.etag, nil
+        }
+
+        hash := sha256.New()
+        if _, err := io.Copy(hash, file); err != nil {
+                return "", err
+        }
+        if _, err := file.Seek(0, io.SeekStart); err != nil {
+                return "", err
+        }
+        etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+
+        c.mu.Lock()
+        c.entries[name] = etagEntry{modTime: info.ModTime(), size: info.Size(), etag: etag}
+        c.mu.Unlock()
+        return etag, nil
+}
+
+// serveState что и кому отдаёт сервер. Строится из config при старте и после
+// каждого запуска из веб-интерфейса и подменяется целиком: обработчики не
+// читают глобальный config, который Runner во время запуска перезагружает.
+type serveState struct {
+        roots  []string
+        access []accessRule
+}
+
+func newServeState() (*serveState, error) {
+        access, err := compileAccessRules(config.Server.Access)
+        if err != nil {
+                return nil, err
+        }
+        return &serveState{roots: publishedRoots(), access: access}, nil
+}
+
+// listHandler отдаёт опубликованные файлы с ETag; If-None-Match, Range и
+// If-Range обрабатывает http.ServeContent
+type listHandler struct {
+        state atomic.Pointer[serveState]
+        etags *etagCache
+}
+
+// reload перестраивает serveState по конфигу завершившегося запуска; при
+// ошибке остаётся прежний
+func (h *listHandler) reload() {
+        runnerMu.Lock()
+        state, err := newServeState()
+        runnerMu.Unlock()
+        if err != nil {
+                log.Printf("Error reloading server settings, keeping previous: %v", err)
+                return
+        }
+        h.state.Store(state)
+}
+
+func (h *listHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodGet && r.Method != http.MethodHead {
+                http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+                return
+        }
+        name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+        state := h.state.Load()
+        if !pathPublished(state.roots, name) {
+                http.NotFound(w, r)
+                return
+        }
+        if status := checkAccess(state.access, name, r); status != 0 {
+                // Отказ считается только для существующего файла: перебор путей не создаёт меток
+                if info, err := os.Stat(filepath.FromSlash(name)); err == nil && !info.IsDir() {
+                        markFile(w, name)
+                }
+                if status == http.StatusUnauthorized {
+                        w.Header().Set("WWW-Authenticate", `Bearer realm="allow-domains"`)
+                }
+                http.Error(w, http.StatusText(status), status)
+                return
+        }
+
+        // Файлы заменяются переименованием, так что открытый файл целиком одной версии
+        file, err := os.Open(filepath.FromSlash(name))
+        if err != nil {
+                http.NotFound(w, r)
+                return
+        }
+        defer file.Close()
+        info, err := file.Stat()
+        if err != nil || info.IsDir() {
+                http.NotFound(w, r)
+                return
+        }
+        markFile(w, name)
+
+        etag, err := h.etags.get(name, file, info)
+        if err != nil {
+                log.Printf("Error hashing %s: %v", name, err)
+                http.Error(w, "internal error", http.StatusInternalServerError)
+                return
+        }
+        w.Header().Set("ETag", etag)
+        w.Header().Set("Cache-Control", "no-cache")
+        http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+func newListHandler() (*listHandler, error) {
+        state, err := newServeState()
+        if err != nil {
+                return nil, err
+        }
+        handler := &listHandler{etags: &etagCache{entries: make(map[string]etagEntry)}}
+        handler.state.Store(state)
+        return handler, nil
+}
+
+func serveCommand(args []string) {
+        flags := flag.NewFlagSet("serve", flag.ExitOnError)
+        listen := flags.String("listen", "", "address to listen on (default server.listen or :8080)")
+        flags.Parse(args)
+
+        configPath := "config.yaml"
+        if flags.NArg() > 0 {
+                configPath = flags.Arg(0)
+        }
+        if err := loadConfig(configPath); err != nil {
+                log.Fatal("Error loading config:", err)
+        }
+        if *listen != "" {
+                config.Server.Listen = *listen
+        }
+        serverSettings = config.Server
+
+        handler, err := newListHandler()
+        if err != nil {
+                log.Fatal("Error loading config:", err)
+        }
+        stats := &serverStats{files: make(map[string]*fetchStats)}
+        mux := http.NewServeMux()
+        mux.Handle("/", withAccessLog(handler, stats))
+        // Дальше только serverSettings: запуски из веб-интерфейса меняют config
+        if serverSettings.Metrics {
+                mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+                        stats.writeMetrics(w)
+                })
+        }
+        if serverSettings.UI.Enabled {
+                ui := newWebUI(configPath, serverSettings.UI, handler.reload)
+                mux.Handle("/ui/", ui)
+                if serverSettings.UI.Interval > 0 {
+                        go ui.schedule(serverSettings.UI.Interval)
+                }
+                log.Printf("Web UI on %s/ui/", serverSettings.Listen)
+        }
+
+        log.Printf("Serving %s on %s", strings.Join(handler.state.Load().roots, ", "), serverSettings.Listen)
+        server := &http.Server{
+                Addr:              serverSettings.Listen,
+                Handler:           mux,
+                ReadHeaderTimeout: 10 * time.Second,
+        }
+        log.Fatal(server.ListenAndServe())
+}
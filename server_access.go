@@ -0,0 +1,160 @@
+package main
+
+import (
+        "crypto/subtle"
+        "fmt"
+        "log"
+        "net/http"
+        "net/netip"
+        "path"
+        "path/filepath"
+        "sort"
+        "strings"
+
+        "go4.org/netipx"
+)
+
+// ServerAccessRule закрывает часть файлов токеном и/или списком адресов
+// клиентов, например списки маршрутов конкретных заказчиков
+type ServerAccessRule struct {
+        Lists    []string `yaml:"lists"`     // Шаблоны имени файла без расширения (path.Match, без учёта регистра)
+        Paths    []string `yaml:"paths"`     // Шаблоны пути файла, например "ipv4/customer-*.lst"
+        Tokens   []string `yaml:"tokens"`    // ?token=, Authorization: Bearer или X-Access-Token
+        AllowIPs []string `yaml:"allow_ips"` // Адреса и сети клиентов
+}
+
+type accessRule struct {
+        ServerAccessRule
+        allowed    *netipx.IPSet
+        aggregates map[string]bool // Сводные файлы, куда попадают закрытые правилом списки
+}
+
+// aggregateFiles опубликованные файлы, в которые попадают все списки сразу
+func aggregateFiles() []string {
+        var files []string
+        add := func(dir string, names ...string) {
+                if dir == "" {
+                        return
+                }
+                for _, name := range names {
+                        files = append(files, path.Clean(filepath.ToSlash(filepath.Join(dir, name))))
+                }
+        }
+        for _, file := range []string{config.MMDB.File, config.Index.File, config.Snapshot.File} {
+                add(file, "")
+        }
+        add(config.Xray.Dir, config.Xray.GeoIPFile, config.Xray.GeoSiteFile)
+        add(config.PfSense.Dir, "index.txt", "aliases.xml")
+        add(config.OPNsense.Dir, "aliases.json")
+        add(config.BIRD.Dir, "index.conf")
+        return files
+}
+
+// protectsList правило закрывает хотя бы один файл списка name
+func (rule *accessRule) protectsList(name string) bool {
+        if rule.matches(path.Clean(filepath.ToSlash(ipv4ListPath(name + ".lst")))) {
+                return true
+        }
+        // paths могут указывать на файл другого формата, например Keenetic/office.txt
+        for _, pattern := range rule.Paths {
+                stem := strings.TrimSuffix(path.Base(pattern), path.Ext(pattern))
+                if ok, _ := path.Match(strings.ToLower(stem), strings.ToLower(name)); ok {
+                        return true
+                }
+        }
+        return false
+}
+
+func compileAccessRules(rules []ServerAccessRule) ([]accessRule, error) {
+        compiled := make([]accessRule, 0, len(rules))
+        for _, rule := range rules {
+                entry := accessRule{ServerAccessRule: rule}
+                if len(rule.AllowIPs) > 0 {
+                        var builder netipx.IPSetBuilder
+                        for _, value := range rule.AllowIPs {
+                                prefix, err := netipx.ParsePrefixOrAddr(value)
+                                if err != nil {
+                                        return nil, fmt.Errorf("invalid server.access allow_ips entry %q: %w", value, err)
+                                }
+                                builder.AddPrefix(prefix)
+                        }
+                        entry.allowed, _ = builder.IPSet()
+                }
+                // Иначе закрытый список можно было бы скачать в составе geoip.dat, mmdb или снимка
+                var protected []string
+                for name := range configuredListMeta() {
+                        if entry.protectsList(name) {
+                                protected = append(protected, name)
+                        }
+                }
+                if len(protected) > 0 {
+                        sort.Strings(protected)
+                        entry.aggregates = make(map[string]bool)
+                        for _, file := range aggregateFiles() {
+                                entry.aggregates[file] = true
+                        }
+                        log.Printf("Warning: server.access rule for %s also applies to aggregate files %s", strings.Join(protected, ", "), strings.Join(aggregateFiles(), ", "))
+                }
+                compiled = append(compiled, entry)
+        }
+        return compiled, nil
+}
+
+func (rule *accessRule) matches(name string) bool {
+        if rule.aggregates[name] {
+                return true
+        }
+        for _, pattern := range rule.Paths {
+                if ok, _ := path.Match(pattern, name); ok {
+                        return true
+                }
+        }
+        stem := strings.ToLower(strings.TrimSuffix(path.Base(name), path.Ext(name)))
+        for _, pattern := range rule.Lists {
+                if ok, _ := path.Match(strings.ToLower(pattern), stem); ok {
+                        return true
+                }
+        }
+        return false
+}
+
+func requestToken(r *http.Request) string {
+        if token := r.URL.Query().Get("token"); token != "" {
+                return token
+        }
+        if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+                return strings.TrimPrefix(auth, "Bearer ")
+        }
+        return r.Header.Get("X-Access-Token")
+}
+
+func tokenValid(tokens []string, token string) bool {
+        valid := false
+        for _, expected := range tokens {
+                if subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1 {
+                        valid = true
+                }
+        }
+        return valid
+}
+
+// checkAccess код ошибки для запроса к name или 0, если доступ разрешён.
+// Применяются все подходящие правила.
+func checkAccess(rules []accessRule, name string, r *http.Request) int {
+        for i := range rules {
+                rule := &rules[i]
+                if !rule.matches(name) {
+                        continue
+                }
+                if rule.allowed != nil {
+                        addr, err := netip.ParseAddr(clientAddr(r))
+                        if err != nil || !rule.allowed.Contains(addr.Unmap()) {
+                                return http.StatusForbidden
+                        }
+                }
+                if len(rule.Tokens) > 0 && !tokenValid(rule.Tokens, requestToken(r)) {
+                        return http.StatusUnauthorized
+                }
+        }
+        return 0
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+        "net/http"
+        "net/http/httptest"
+        "testing"
+)
+
+func TestCheckAccess(t *testing.T) {
+        saved := config
+        defer func() { config = saved }()
+        config = Config{
+                IPv4Dir: "ipv4",
+                MMDB:    MMDBConfig{File: "MMDB/allow-domains.mmdb"},
+                Xray:    XrayConfig{Dir: "Xray", GeoIPFile: "geoip.dat", GeoSiteFile: "geosite.dat"},
+                Tagged:  map[string]TaggedListConfig{"customer-a": {}, "public": {}},
+        }
+
+        rules, err := compileAccessRules([]ServerAccessRule{
+                {Lists: []string{"Customer-*"}, Tokens: []string{"secret", "other"}},
+                {Paths: []string{"Keenetic/office.txt"}, AllowIPs: []string{"203.0.113.0/24"}},
+                {Paths: []string{"ipv4/vip.lst"}, Tokens: []string{"vip"}, AllowIPs: []string{"198.51.100.7"}},
+        })
+        if err != nil {
+                t.Fatal(err)
+        }
+
+        tests := []struct {
+                name   string
+                file   string
+                remote string
+                query  string
+                header [2]string
+                want   int
+        }{
+                {name: "public list", file: "ipv4/public.lst", want: 0},
+                {name: "no token", file: "ipv4/customer-a.lst", want: http.StatusUnauthorized},
+                {name: "wrong token", file: "ipv4/customer-a.lst", query: "token=nope", want: http.StatusUnauthorized},
+                {name: "query token", file: "ipv4/customer-a.lst", query: "token=secret", want: 0},
+                {name: "bearer token", file: "Keenetic/customer-a.txt", header: [2]string{"Authorization", "Bearer other"}, want: 0},
+                {name: "header token", file: "ipv4/customer-a.lst", header: [2]string{"X-Access-Token", "secret"}, want: 0},
+                {name: "ip denied", file: "Keenetic/office.txt", remote: "192.0.2.1:5000", want: http.StatusForbidden},
+                {name: "ip allowed", file: "Keenetic/office.txt", remote: "203.0.113.9:5000", want: 0},
+                {name: "allowed ip still needs token", file: "ipv4/vip.lst", remote: "198.51.100.7:5000", want: http.StatusUnauthorized},
+                {name: "token from wrong ip", file: "ipv4/vip.lst", remote: "192.0.2.1:5000", query: "token=vip", want: http.StatusForbidden},
+                {name: "token and ip", file: "ipv4/vip.lst", remote: "198.51.100.7:5000", query: "token=vip", want: 0},
+                {name: "aggregate closed by list rule", file: "MMDB/allow-domains.mmdb", want: http.StatusUnauthorized},
+                {name: "aggregate with token", file: "Xray/geoip.dat", remote: "203.0.113.9:5000", query: "token=secret", want: 0},
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        target := "/" + tt.file
+                        if tt.query != "" {
+                                target += "?" + tt.query
+                        }
+                        r := httptest.NewRequest(http.MethodGet, target, nil)
+                        if tt.remote != "" {
+                                r.RemoteAddr = tt.remote
+                        }
+                        if tt.header[0] != "" {
+                                r.Header.Set(tt.header[0], tt.header[1])
+                        }
+                        if got := checkAccess(rules, tt.file, r); got != tt.want {
+                                t.Errorf("checkAccess(%s) = %d, want %d", tt.file, got, tt.want)
+                        }
+                })
+        }
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+        "fmt"
+        "log"
+        "net"
+        "net/http"
+        "path"
+        "sort"
+        "strings"
+        "sync"
+)
+
+// statusRecorder запоминает код ответа и число отданных байт
+type statusRecorder struct {
+        http.ResponseWriter
+        status int
+        bytes  int64
+        file   string // Опубликованный файл, к которому был запрос; пусто - в метрики не попадает
+}
+
+// markFile отмечает, что запрос относится к существующему опубликованному файлу
+func markFile(w http.ResponseWriter, name string) {
+        if recorder, ok := w.(*statusRecorder); ok {
+                recorder.file = name
+        }
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+        r.status = status
+        r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+        if r.status == 0 {
+                r.status = http.StatusOK
+        }
+        n, err := r.ResponseWriter.Write(data)
+        r.bytes += int64(n)
+        return n, err
+}
+
+type fetchStats struct {
+        byStatus map[int]int64
+        bytes    int64
+        clients  map[string]bool
+}
+
+// serverStats счётчики загрузок по файлам для /metrics
+type serverStats struct {
+        mu    sync.Mutex
+        files map[string]*fetchStats
+}
+
+func (s *serverStats) record(name, client string, status int, bytes int64) {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+        stats := s.files[name]
+        if stats == nil {
+                stats = &fetchStats{byStatus: make(map[int]int64), clients: make(map[string]bool)}
+                s.files[name] = stats
+        }
+        stats.byStatus[status]++
+        stats.bytes += bytes
+        stats.clients[client] = true
+}
+
+// promLabel экранирование значения метки Prometheus
+var promLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeMetrics метрики в текстовом формате Prometheus
+func (s *serverStats) writeMetrics(w http.ResponseWriter) {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        names := make([]string, 0, len(s.files))
+        for name := range s.files {
+                names = append(names, name)
+        }
+        sort.Strings(names)
+
+        var b strings.Builder
+        b.WriteString("# HELP allow_domains_fetches_total Published file requests by status code.\n# TYPE allow_domains_fetches_total counter\n")
+        for _, name := range names {
+                codes := make([]int, 0, len(s.files[name].byStatus))
+                for code := range s.files[name].byStatus {
+                        codes = append(codes, code)
+                }
+                sort.Ints(codes)
+                for _, code := range codes {
+                        fmt.Fprintf(&b, "allow_domains_fetches_total{file=\"%s\",code=\"%d\"} %d\n", promLabel.Replace(name), code, s.files[name].byStatus[code])
+                }
+        }
+        b.WriteString("# HELP allow_domains_fetch_bytes_total Bytes sent per published file.\n# TYPE allow_domains_fetch_bytes_total counter\n")
+        for _, name := range names {
+                fmt.Fprintf(&b, "allow_domains_fetch_bytes_total{file=\"%s\"} %d\n", promLabel.Replace(name), s.files[name].bytes)
+        }
+        b.WriteString("# HELP allow_domains_fetch_clients Distinct client addresses per published file since start.\n# TYPE allow_domains_fetch_clients gauge\n")
+        for _, name := range names {
+                fmt.Fprintf(&b, "allow_domains_fetch_clients{file=\"%s\"} %d\n", promLabel.Replace(name), len(s.files[name].clients))
+        }
+
+        w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+        w.Write([]byte(b.String()))
+}
+
+// clientAddr адрес клиента; за обратным прокси - первый из X-Forwarded-For
+func clientAddr(r *http.Request) string {
+        if serverSettings.TrustProxy {
+                if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+                        return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+                }
+        }
+        host, _, err := net.SplitHostPort(r.RemoteAddr)
+        if err != nil {
+                return r.RemoteAddr
+        }
+        return host
+}
+
+// withAccessLog пишет строку журнала на каждый запрос и считает загрузки
+func withAccessLog(next http.Handler, stats *serverStats) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                recorder := &statusRecorder{ResponseWriter: w}
+                next.ServeHTTP(recorder, r)
+                if recorder.status == 0 {
+                        recorder.status = http.StatusOK
+                }
+
+                client := clientAddr(r)
+                name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+                if serverSettings.AccessLog {
+                        log.Printf("%s %s /%s %d %d bytes", client, r.Method, name, recorder.status, recorder.bytes)
+                }
+                // Только существующие файлы, чтобы сканеры не раздували метрики
+                if recorder.file != "" {
+                        stats.record(recorder.file, client, recorder.status, recorder.bytes)
+                }
+        })
+}
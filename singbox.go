@@ -0,0 +1,51 @@
+package main
+
+import (
+        "encoding/json"
+        "os"
+        "path/filepath"
+)
+
+// SingBoxConfig настройки вывода rule-set для sing-box
+type SingBoxConfig struct {
+        Enabled bool   `yaml:"enabled"`
+        Dir     string `yaml:"dir"`
+        Version int    `yaml:"version"` // Версия формата rule-set, 3 для sing-box 1.11+
+        Compile bool   `yaml:"compile"` // Дополнительно собирать бинарные .srs
+        SRSDir  string `yaml:"srs_dir"`
+}
+
+type singBoxRule struct {
+        DomainSuffix []string `json:"domain_suffix,omitempty"`
+        IPCIDR       []string `json:"ip_cidr,omitempty"`
+}
+
+type singBoxRuleSet struct {
+        Version int           `json:"version"`
+        Rules   []singBoxRule `json:"rules"`
+}
+
+func singBoxRuleSetFor(list *generatedList) singBoxRuleSet {
+        rule := singBoxRule{DomainSuffix: list.Domains}
+        for _, prefix := range list.Prefixes {
+                rule.IPCIDR = append(rule.IPCIDR, prefix.String())
+        }
+
+        return singBoxRuleSet{
+                Version: config.SingBox.Version,
+                Rules:   []singBoxRule{rule},
+        }
+}
+
+func generateSingBoxRuleSet(list *generatedList) error {
+        data, err := json.MarshalIndent(singBoxRuleSetFor(list), "", "    ")
+        if err != nil {
+                return err
+        }
+
+        dir := layoutDir("singbox", list.Name, config.SingBox.Dir)
+        if err := os.MkdirAll(dir, 0755); err != nil {
+                return err
+        }
+        return writeFileStaged(filepath.Join(dir, list.Name+".json"), append(data, '\n'))
+}
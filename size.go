@@ -0,0 +1,49 @@
+package main
+
+import (
+        "fmt"
+        "strconv"
+        "strings"
+
+        "gopkg.in/yaml.v3"
+)
+
+// ByteSize размер в байтах; в YAML задаётся числом или строкой вида "64MiB"
+type ByteSize int64
+
+var byteSizeUnits = []struct {
+        suffix string
+        factor int64
+}{
+        {"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+        {"KB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000},
+        {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+        {"B", 1},
+}
+
+func parseByteSize(s string) (ByteSize, error) {
+        s = strings.TrimSpace(s)
+        factor := int64(1)
+        for _, unit := range byteSizeUnits {
+                if strings.HasSuffix(s, unit.suffix) {
+                        s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+                        factor = unit.factor
+                        break
+                }
+        }
+
+        n, err := strconv.ParseInt(s, 10, 64)
+        if err != nil || n < 0 {
+                return 0, fmt.Errorf("invalid size %q", s)
+        }
+        return ByteSize(n * factor), nil
+}
+
+func (b *ByteSize) UnmarshalYAML(node *yaml.Node) error {
+        size, err := parseByteSize(node.Value)
+        if err != nil {
+                return err
+        }
+        *b = size
+        return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+        "fmt"
+        "path"
+)
+
+// SmartDNSConfig domain-set для SmartDNS и директивы к нему: резолв через
+// группу серверов и добавление адресов в ipset/nftset с именем списка
+type SmartDNSConfig struct {
+        OutputConfig `yaml:",inline"`
+        SetDir       string `yaml:"set_dir"` // Где лежат domain-set на роутере
+        Group        string `yaml:"group"`   // Группа nameserver для доменов списка; пусто - без nameserver
+        IPSet        bool   `yaml:"ipset"`
+        NFTSet       bool   `yaml:"nftset"`
+        Family       string `yaml:"family"`
+        Table        string `yaml:"table"`
+}
+
+func smartDNSDirectives(list *generatedList) []string {
+        setName := identifierName(list.Name)
+        match := "/domain-set:" + setName + "/"
+        lines := []string{
+                "# " + list.Comment,
+                fmt.Sprintf("domain-set -name %s -file %s", setName, path.Join(config.SmartDNS.SetDir, list.Name+".list")),
+        }
+        if config.SmartDNS.Group != "" {
+                lines = append(lines, "nameserver "+match+config.SmartDNS.Group)
+        }
+        if config.SmartDNS.IPSet {
+                lines = append(lines, "ipset "+match+setName)
+        }
+        if config.SmartDNS.NFTSet {
+                lines = append(lines, fmt.Sprintf("nftset %s#4:%s#%s#%s", match, config.SmartDNS.Family, config.SmartDNS.Table, setName))
+        }
+        return lines
+}
+
+func generateSmartDNSConfig(list *generatedList) error {
+        if len(list.Domains) == 0 {
+                return nil
+        }
+
+        var domains []string
+        seen := make(map[string]bool)
+        for _, domain := range list.Domains {
+                domain = trimDomainDot(domain)
+                if !seen[domain] {
+                        seen[domain] = true
+                        domains = append(domains, domain)
+                }
+        }
+
+        dir := layoutDir("smartdns", list.Name, config.SmartDNS.Dir)
+        if err := writeOutputLines(dir, list.Name+".list", domains); err != nil {
+                return err
+        }
+        return writeOutputLines(dir, list.Name+".conf", smartDNSDirectives(list))
+}
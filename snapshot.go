@@ -0,0 +1,242 @@
+package main
+
+import (
+        "bytes"
+        "compress/gzip"
+        "crypto/sha256"
+        "encoding/hex"
+        "encoding/json"
+        "fmt"
+        "io"
+        "log"
+        "net/netip"
+        "os"
+        "path/filepath"
+        "sort"
+        "strings"
+        "time"
+)
+
+// SnapshotConfig обмен собранными списками между машинами: role fetch
+// скачивает источники и пишет снимок, role render берёт списки из снимка
+// и только выводит форматы и отправляет их на устройства
+type SnapshotConfig struct {
+        File          string `yaml:"file"`   // Куда fetch пишет снимок
+        Source        string `yaml:"source"` // Откуда render читает снимок: путь или URL; по умолчанию file
+        SourceOptions `yaml:",inline"`
+}
+
+// Формат снимка (schema_version 2): JSON, при имени файла на .gz - в gzip.
+//
+//      {"schema_version": 2, "generated": "2024-05-01T04:00:00Z", "lists": [
+//        {"name": "meta", "list_name": "META", "comment": "...",
+//         "prefixes": ["31.13.24.0/21", ...], "domains": ["facebook.com", ...],
+//         "counts": {"ipv4": 120, "ipv6": 0, "domains": 35},
+//         "sha256": "...", "sources": [...], "asns": ["AS32934"], "tags": [...], "trust": "trusted"}]}
+//
+// Списки отсортированы по name, префиксы приведены к маске и отсортированы,
+// домены без повторов и по алфавиту, так что одинаковые данные дают
+// одинаковый файл (кроме generated). sha256 считается по строкам префиксов,
+// пустой строке и строкам доменов, каждая с \n в конце. Читатель принимает
+// версии не новее своей; версия 1 была без counts и sha256.
+const snapshotSchemaVersion = 2
+
+// snapshotList список в снимке
+type snapshotList struct {
+        Name     string         `json:"name"`
+        ListName string         `json:"list_name"`
+        Comment  string         `json:"comment"`
+        Prefixes []string       `json:"prefixes"`
+        Domains  []string       `json:"domains"`
+        Counts   listJSONCounts `json:"counts"`
+        SHA256   string         `json:"sha256"`
+        Sources  []string       `json:"sources,omitempty"`
+        ASNs     []string       `json:"asns,omitempty"`
+        Tags     []string       `json:"tags,omitempty"`
+        Trust    string         `json:"trust,omitempty"`
+}
+
+type snapshotFile struct {
+        SchemaVersion int            `json:"schema_version"`
+        Generated     string         `json:"generated"`
+        Lists         []snapshotList `json:"lists"`
+}
+
+// normalizedPrefixes префиксы с маской, без повторов, по возрастанию адреса
+func normalizedPrefixes(prefixes []netip.Prefix) []netip.Prefix {
+        seen := make(map[netip.Prefix]bool, len(prefixes))
+        out := make([]netip.Prefix, 0, len(prefixes))
+        for _, prefix := range prefixes {
+                prefix = prefix.Masked()
+                if !seen[prefix] {
+                        seen[prefix] = true
+                        out = append(out, prefix)
+                }
+        }
+        sort.Slice(out, func(i, j int) bool {
+                if out[i].Addr() != out[j].Addr() {
+                        return out[i].Addr().Less(out[j].Addr())
+                }
+                return out[i].Bits() < out[j].Bits()
+        })
+        return out
+}
+
+func snapshotChecksum(prefixes, domains []string) string {
+        h := sha256.New()
+        for _, prefix := range prefixes {
+                io.WriteString(h, prefix+"\n")
+        }
+        io.WriteString(h, "\n")
+        for _, domain := range domains {
+                io.WriteString(h, domain+"\n")
+        }
+        return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeSnapshot сохраняет списки запуска для машин с role render
+func writeSnapshot(lists []*generatedList) error {
+        snapshot := snapshotFile{SchemaVersion: snapshotSchemaVersion, Generated: time.Now().UTC().Format(time.RFC3339)}
+        for _, list := range lists {
+                item := snapshotList{Name: list.Name, ListName: list.ListName, Comment: list.Comment, Prefixes: []string{},
+                        Domains: uniqueSorted(list.Domains), Sources: list.Sources, ASNs: list.ASNs, Tags: list.Tags, Trust: list.Trust}
+                for _, prefix := range normalizedPrefixes(list.Prefixes) {
+                        item.Prefixes = append(item.Prefixes, prefix.String())
+                        if prefix.Addr().Is4() {
+                                item.Counts.IPv4++
+                        } else {
+                                item.Counts.IPv6++
+                        }
+                }
+                item.Counts.Domains = len(item.Domains)
+                item.SHA256 = snapshotChecksum(item.Prefixes, item.Domains)
+                snapshot.Lists = append(snapshot.Lists, item)
+        }
+        sort.Slice(snapshot.Lists, func(i, j int) bool { return snapshot.Lists[i].Name < snapshot.Lists[j].Name })
+
+        data, err := json.MarshalIndent(snapshot, "", "  ")
+        if err != nil {
+                return err
+        }
+        data = append(data, '\n')
+        if strings.HasSuffix(config.Snapshot.File, ".gz") {
+                var buf bytes.Buffer
+                zw := gzip.NewWriter(&buf)
+                zw.Write(data)
+                if err := zw.Close(); err != nil {
+                        return err
+                }
+                data = buf.Bytes()
+        }
+
+        if dir := filepath.Dir(config.Snapshot.File); dir != "." {
+                if err := os.MkdirAll(dir, 0755); err != nil {
+                        return err
+                }
+        }
+        if err := writeFileStaged(config.Snapshot.File, data); err != nil {
+                return err
+        }
+        log.Printf("Snapshot with %d lists written to %s", len(snapshot.Lists), config.Snapshot.File)
+        return nil
+}
+
+// parseSnapshot разбирает снимок (gzip распознаётся по сигнатуре) и
+// проверяет версию, счётчики и контрольные суммы списков
+func parseSnapshot(data []byte) ([]generatedList, error) {
+        if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+                zr, err := gzip.NewReader(bytes.NewReader(data))
+                if err != nil {
+                        return nil, err
+                }
+                if data, err = io.ReadAll(zr); err != nil {
+                        return nil, err
+                }
+        }
+        var snapshot snapshotFile
+        if err := json.Unmarshal(data, &snapshot); err != nil {
+                return nil, err
+        }
+        if snapshot.SchemaVersion < 1 || snapshot.SchemaVersion > snapshotSchemaVersion {
+                return nil, fmt.Errorf("unsupported snapshot schema_version %d (this build reads 1..%d)", snapshot.SchemaVersion, snapshotSchemaVersion)
+        }
+
+        var lists []generatedList
+        for _, item := range snapshot.Lists {
+                list := generatedList{Name: item.Name, ListName: item.ListName, Comment: item.Comment, Domains: item.Domains,
+                        Sources: item.Sources, ASNs: item.ASNs, Tags: item.Tags, Trust: item.Trust}
+                var counts listJSONCounts
+                for _, value := range item.Prefixes {
+                        prefix, err := netip.ParsePrefix(value)
+                        if err != nil {
+                                return nil, fmt.Errorf("list %s: %w", item.Name, err)
+                        }
+                        if prefix.Addr().Is4() {
+                                counts.IPv4++
+                        } else {
+                                counts.IPv6++
+                        }
+                        list.Prefixes = append(list.Prefixes, prefix)
+                }
+                counts.Domains = len(item.Domains)
+
+                if snapshot.SchemaVersion >= 2 {
+                        if counts != item.Counts {
+                                return nil, fmt.Errorf("list %s: counts %+v do not match content %+v", item.Name, item.Counts, counts)
+                        }
+                        if sum := snapshotChecksum(item.Prefixes, item.Domains); sum != item.SHA256 {
+                                return nil, fmt.Errorf("list %s: sha256 mismatch", item.Name)
+                        }
+                }
+                lists = append(lists, list)
+        }
+        return lists, nil
+}
+
+// readSnapshot читает снимок с fetch-машины
+func readSnapshot() ([]generatedList, error) {
+        return readSnapshotFrom(config.Snapshot.Source, config.Snapshot.SourceOptions)
+}
+
+func readSnapshotFrom(source string, opts SourceOptions) ([]generatedList, error) {
+        data, err := readSource(source, opts)
+        if err != nil {
+                return nil, err
+        }
+        return parseSnapshot([]byte(data))
+}
+
+// loadSnapshotLists пишет .lst, RouterOS и dnsmasq из снимка так же, как их
+// пишет сборка, и регистрирует списки для остальных форматов
+func loadSnapshotLists() {
+        lists, err := readSnapshot()
+        if err != nil {
+                fatal("Error reading snapshot ", config.Snapshot.Source, ": ", err)
+        }
+        log.Printf("Loaded %d lists from snapshot %s", len(lists), config.Snapshot.Source)
+
+        for _, list := range lists {
+                if !sourceSelected(list.Name, list.ListName, "snapshot") {
+                        continue
+                }
+                runStage(list.Name, "snapshot", func() { publishSnapshotList(list) })
+        }
+}
+
+// publishSnapshotList выводит список из снимка
+func publishSnapshotList(list generatedList) {
+        if len(list.Domains) > 0 {
+                setName := config.Domains[list.Name].SetName
+                if setName == "" {
+                        setName = config.Dnsmasq.SetName
+                }
+                if err := generateDnsmasqConfig(list.Name, setName, list.Domains); err != nil {
+                        log.Printf("Error generating dnsmasq config for %s: %v", list.Name, err)
+                }
+        }
+        if len(list.Prefixes) == 0 {
+                addGeneratedList(list)
+                return
+        }
+        publishPrefixList(strings.TrimSuffix(list.Name, ".lst")+".lst", list)
+}
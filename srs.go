@@ -0,0 +1,241 @@
+package main
+
+import (
+        "bufio"
+        "compress/zlib"
+        "encoding/binary"
+        "io"
+        "os"
+        "path/filepath"
+        "sort"
+
+        "go4.org/netipx"
+)
+
+// Бинарный формат rule-set sing-box (.srs), совместимый с `sing-box rule-set compile`
+
+var srsMagic = [3]byte{'S', 'R', 'S'}
+
+const (
+        srsItemDomain uint8 = 2
+        srsItemIPCIDR uint8 = 6
+        srsItemFinal  uint8 = 0xFF
+
+        srsRuleTypeDefault uint8 = 0
+        srsDomainSetV0     uint8 = 0
+        srsIPSetV1         uint8 = 1
+
+        // Метки доменного матчера sing-box
+        srsPrefixLabel = '\r'
+        srsRootLabel   = '\n'
+)
+
+func writeUvarint(w *bufio.Writer, v uint64) error {
+        var buf [binary.MaxVarintLen64]byte
+        _, err := w.Write(buf[:binary.PutUvarint(buf[:], v)])
+        return err
+}
+
+func writeUint64Slice(w *bufio.Writer, values []uint64) error {
+        if err := writeUvarint(w, uint64(len(values))); err != nil {
+                return err
+        }
+        for _, v := range values {
+                if err := binary.Write(w, binary.BigEndian, v); err != nil {
+                        return err
+                }
+        }
+        return nil
+}
+
+func writeBytes(w *bufio.Writer, data []byte) error {
+        if err := writeUvarint(w, uint64(len(data))); err != nil {
+                return err
+        }
+        _, err := w.Write(data)
+        return err
+}
+
+func reverseString(s string) string {
+        runes := []rune(s)
+        for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+                runes[i], runes[j] = runes[j], runes[i]
+        }
+        return string(runes)
+}
+
+// srsDomainKeys строит ключи матчера domain_suffix. Версия 1 формата не знает
+// корневой метки и описывает суффикс парой "домен" + ".домен".
+func srsDomainKeys(suffixes []string, legacy bool) []string {
+        seen := make(map[string]struct{}, len(suffixes))
+        keys := make([]string, 0, 2*len(suffixes))
+        add := func(key string) {
+                if _, ok := seen[key]; !ok {
+                        seen[key] = struct{}{}
+                        keys = append(keys, key)
+                }
+        }
+
+        for _, domain := range suffixes {
+                switch {
+                case domain == "":
+                case domain[0] == '.':
+                        add(reverseString(string(rune(srsPrefixLabel)) + domain))
+                case legacy:
+                        add(reverseString(domain))
+                        add(reverseString(string(rune(srsPrefixLabel)) + "." + domain))
+                default:
+                        add(reverseString(string(rune(srsRootLabel)) + domain))
+                }
+        }
+        sort.Strings(keys)
+        return keys
+}
+
+func setBit(bitmap *[]uint64, i int) {
+        for i>>6 >= len(*bitmap) {
+                *bitmap = append(*bitmap, 0)
+        }
+        (*bitmap)[i>>6] |= 1 << uint(i&63)
+}
+
+// writeSuccinctSet сериализует отсортированные ключи в succinct trie sing-box
+func writeSuccinctSet(w *bufio.Writer, keys []string) error {
+        var leaves, labelBitmap []uint64
+        var labels []byte
+
+        type queueItem struct{ start, end, col int }
+        queue := []queueItem{{0, len(keys), 0}}
+        labelIndex := 0
+        for i := 0; i < len(queue); i++ {
+                item := queue[i]
+                if item.col == len(keys[item.start]) {
+                        item.start++
+                        setBit(&leaves, i)
+                }
+                for j := item.start; j < item.end; {
+                        from := j
+                        for j < item.end && keys[j][item.col] == keys[from][item.col] {
+                                j++
+                        }
+                        queue = append(queue, queueItem{from, j, item.col + 1})
+                        labels = append(labels, keys[from][item.col])
+                        labelIndex++
+                }
+                setBit(&labelBitmap, labelIndex)
+                labelIndex++
+        }
+
+        if err := w.WriteByte(srsDomainSetV0); err != nil {
+                return err
+        }
+        if err := writeUint64Slice(w, leaves); err != nil {
+                return err
+        }
+        if err := writeUint64Slice(w, labelBitmap); err != nil {
+                return err
+        }
+        return writeBytes(w, labels)
+}
+
+func writeSRSIPSet(w *bufio.Writer, set *netipx.IPSet) error {
+        if err := w.WriteByte(srsIPSetV1); err != nil {
+                return err
+        }
+        ranges := set.Ranges()
+        if err := binary.Write(w, binary.BigEndian, uint64(len(ranges))); err != nil {
+                return err
+        }
+        for _, r := range ranges {
+                if err := writeBytes(w, r.From().AsSlice()); err != nil {
+                        return err
+                }
+                if err := writeBytes(w, r.To().AsSlice()); err != nil {
+                        return err
+                }
+        }
+        return nil
+}
+
+func writeSRS(writer io.Writer, list *generatedList, version uint8) error {
+        if _, err := writer.Write(srsMagic[:]); err != nil {
+                return err
+        }
+        if err := binary.Write(writer, binary.BigEndian, version); err != nil {
+                return err
+        }
+
+        zWriter, err := zlib.NewWriterLevel(writer, zlib.BestCompression)
+        if err != nil {
+                return err
+        }
+        w := bufio.NewWriter(zWriter)
+
+        // Одно правило по умолчанию: домены и подсети объединяются через ИЛИ
+        if err := writeUvarint(w, 1); err != nil {
+                return err
+        }
+        if err := w.WriteByte(srsRuleTypeDefault); err != nil {
+                return err
+        }
+
+        if keys := srsDomainKeys(list.Domains, version == 1); len(keys) > 0 {
+                if err := w.WriteByte(srsItemDomain); err != nil {
+                        return err
+                }
+                if err := writeSuccinctSet(w, keys); err != nil {
+                        return err
+                }
+        }
+
+        if len(list.Prefixes) > 0 {
+                var builder netipx.IPSetBuilder
+                for _, prefix := range list.Prefixes {
+                        builder.AddPrefix(prefix)
+                }
+                set, err := builder.IPSet()
+                if err != nil {
+                        return err
+                }
+                if err := w.WriteByte(srsItemIPCIDR); err != nil {
+                        return err
+                }
+                if err := writeSRSIPSet(w, set); err != nil {
+                        return err
+                }
+        }
+
+        if err := w.WriteByte(srsItemFinal); err != nil {
+                return err
+        }
+        // invert = false
+        if err := w.WriteByte(0); err != nil {
+                return err
+        }
+
+        if err := w.Flush(); err != nil {
+                return err
+        }
+        return zWriter.Close()
+}
+
+func generateSingBoxBinaryRuleSet(list *generatedList) error {
+        if len(list.Domains) == 0 && len(list.Prefixes) == 0 {
+                return nil
+        }
+        dir := layoutDir("srs", list.Name, config.SingBox.SRSDir)
+        if err := os.MkdirAll(dir, 0755); err != nil {
+                return err
+        }
+
+        file, err := createStaged(filepath.Join(dir, list.Name+".srs"))
+        if err != nil {
+                return err
+        }
+        defer file.Abort()
+
+        if err := writeSRS(file, list, uint8(config.SingBox.Version)); err != nil {
+                return err
+        }
+        return file.Commit()
+}
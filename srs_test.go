@@ -0,0 +1,93 @@
+package main
+
+import (
+        "bufio"
+        "bytes"
+        "compress/zlib"
+        "io"
+        "net/netip"
+        "reflect"
+        "testing"
+)
+
+func TestSRSDomainKeys(t *testing.T) {
+        tests := []struct {
+                name     string
+                suffixes []string
+                legacy   bool
+                want     []string
+        }{
+                {"root label", []string{"example.com"}, false, []string{"moc.elpmaxe\n"}},
+                {"legacy pair", []string{"example.com"}, true, []string{"moc.elpmaxe", "moc.elpmaxe.\r"}},
+                {"dot suffix", []string{".example.com"}, false, []string{"moc.elpmaxe.\r"}},
+                {"duplicates and empty", []string{"a.b", "", "a.b"}, false, []string{"b.a\n"}},
+                {"sorted", []string{"b.org", "a.com"}, false, []string{"gro.b\n", "moc.a\n"}},
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        if got := srsDomainKeys(tt.suffixes, tt.legacy); !reflect.DeepEqual(got, tt.want) {
+                                t.Errorf("srsDomainKeys = %q, want %q", got, tt.want)
+                        }
+                })
+        }
+}
+
+func TestWriteSuccinctSet(t *testing.T) {
+        var buf bytes.Buffer
+        w := bufio.NewWriter(&buf)
+        if err := writeSuccinctSet(w, []string{"a"}); err != nil {
+                t.Fatal(err)
+        }
+        w.Flush()
+        // Корень с меткой 'a' и лист: leaves = {1}, labelBitmap = {1, 2}
+        want := []byte{srsDomainSetV0, 1, 0, 0, 0, 0, 0, 0, 0, 2, 1, 0, 0, 0, 0, 0, 0, 0, 6, 1, 'a'}
+        if !bytes.Equal(buf.Bytes(), want) {
+                t.Errorf("writeSuccinctSet = %v, want %v", buf.Bytes(), want)
+        }
+}
+
+func TestWriteSRS(t *testing.T) {
+        tests := []struct {
+                name    string
+                list    generatedList
+                version uint8
+                want    []byte
+        }{
+                {
+                        name:    "prefixes merged into ranges",
+                        list:    generatedList{Prefixes: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/25"), netip.MustParsePrefix("10.0.0.128/25")}},
+                        version: 2,
+                        want: []byte{1, srsRuleTypeDefault, srsItemIPCIDR, srsIPSetV1, 0, 0, 0, 0, 0, 0, 0, 1,
+                                4, 10, 0, 0, 0, 4, 10, 0, 0, 255, srsItemFinal, 0},
+                },
+                {
+                        name:    "empty rule",
+                        list:    generatedList{},
+                        version: 1,
+                        want:    []byte{1, srsRuleTypeDefault, srsItemFinal, 0},
+                },
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        var buf bytes.Buffer
+                        if err := writeSRS(&buf, &tt.list, tt.version); err != nil {
+                                t.Fatal(err)
+                        }
+                        data := buf.Bytes()
+                        if !bytes.Equal(data[:4], []byte{'S', 'R', 'S', tt.version}) {
+                                t.Fatalf("header = %q", data[:4])
+                        }
+                        r, err := zlib.NewReader(bytes.NewReader(data[4:]))
+                        if err != nil {
+                                t.Fatal(err)
+                        }
+                        body, err := io.ReadAll(r)
+                        if err != nil {
+                                t.Fatal(err)
+                        }
+                        if !bytes.Equal(body, tt.want) {
+                                t.Errorf("body = %v, want %v", body, tt.want)
+                        }
+                })
+        }
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+        "fmt"
+        "log"
+        "net"
+        "os"
+        "os/exec"
+        "path/filepath"
+        "strings"
+)
+
+// SSHPushConfig устройства, на которые готовый скрипт списка копируется по
+// scp и выполняется там же по ssh. Используются системные ssh и scp, так что
+// ключи, агент и ~/.ssh/config работают как обычно.
+type SSHPushConfig struct {
+        Targets []SSHTarget `yaml:"targets"`
+}
+
+type SSHTarget struct {
+        Name       string   `yaml:"name"`
+        Device     string   `yaml:"device"` // routeros, vyos или edgeos
+        Host       string   `yaml:"host"`   // host или host:port
+        User       string   `yaml:"user"`
+        Key        string   `yaml:"key"`         // Приватный ключ; без него - агент и ключи по умолчанию
+        KnownHosts string   `yaml:"known_hosts"` // Файл known_hosts вместо ~/.ssh/known_hosts
+        Insecure   bool     `yaml:"insecure_ignore_host_key"`
+        LegacySCP  bool     `yaml:"legacy_scp"` // scp -O: RouterOS v6 и старые прошивки без SFTP
+        Version    string   `yaml:"version"`    // Для routeros: v6 или v7, по умолчанию v7, если он генерируется
+        Lists      []string `yaml:"lists"`      // Пусто - все списки
+}
+
+func validateSSHTargets() error {
+        for i := range config.SSHPush.Targets {
+                target := &config.SSHPush.Targets[i]
+                if target.Host == "" {
+                        return fmt.Errorf("ssh_push target %d: host is required", i+1)
+                }
+                if target.Name == "" {
+                        target.Name = target.Host
+                }
+                switch target.Device {
+                case "routeros":
+                        if target.Version == "" {
+                                target.Version = "v6"
+                                if config.GenerateV7 {
+                                        target.Version = "v7"
+                                }
+                        }
+                        if (target.Version != "v6" || !config.GenerateV6) && (target.Version != "v7" || !config.GenerateV7) {
+                                return fmt.Errorf("ssh_push %s: RouterOS %s scripts are not generated (generate_v6/generate_v7)", target.Name, target.Version)
+                        }
+                case "vyos":
+                        if !config.VyOS.Enabled {
+                                return fmt.Errorf("ssh_push %s: vyos output is not enabled", target.Name)
+                        }
+                case "edgeos":
+                        if !config.EdgeOS.Enabled {
+                                return fmt.Errorf("ssh_push %s: edgeos output is not enabled", target.Name)
+                        }
+                default:
+                        return fmt.Errorf("ssh_push %s: unknown device %q (routeros, vyos or edgeos)", target.Name, target.Device)
+                }
+        }
+        return nil
+}
+
+// sshOptions общие опции ssh и scp; порт у них задаётся разными флагами
+func (target SSHTarget) sshOptions(portFlag string) (args []string, address string) {
+        args = []string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=10"}
+        if target.Insecure {
+                args = append(args, "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null")
+        } else {
+                args = append(args, "-o", "StrictHostKeyChecking=yes")
+                if target.KnownHosts != "" {
+                        args = append(args, "-o", "UserKnownHostsFile="+target.KnownHosts)
+                }
+        }
+        if target.Key != "" {
+                args = append(args, "-i", target.Key)
+        }
+
+        host := target.Host
+        if h, port, err := net.SplitHostPort(target.Host); err == nil {
+                host = h
+                args = append(args, portFlag, port)
+        }
+        if target.User != "" {
+                host = target.User + "@" + host
+        }
+        return args, host
+}
+
+func runSSHCommand(name string, args ...string) (string, error) {
+        cmd := exec.CommandContext(runCtx, name, args...)
+        out, err := cmd.CombinedOutput()
+        output := strings.TrimSpace(string(out))
+        if err != nil {
+                if output != "" {
+                        return output, fmt.Errorf("%s: %v: %s", name, err, output)
+                }
+                return output, fmt.Errorf("%s: %v", name, err)
+        }
+        return output, nil
+}
+
+func (target SSHTarget) upload(local, remote string) error {
+        args, address := target.sshOptions("-P")
+        if target.LegacySCP {
+                args = append(args, "-O")
+        }
+        args = append(args, "-q", local, address+":"+remote)
+        _, err := runSSHCommand("scp", args...)
+        return err
+}
+
+func (target SSHTarget) run(command string) (string, error) {
+        args, address := target.sshOptions("-p")
+        args = append(args, address, command)
+        return runSSHCommand("ssh", args...)
+}
+
+// sshScript локальный файл скрипта списка для устройства; "" - скрипта нет
+func (target SSHTarget) sshScript(list *generatedList) string {
+        name := strings.TrimSuffix(list.Name, ".lst")
+        var path string
+        switch target.Device {
+        case "routeros":
+                path = filepath.Join(layoutDir("routeros", list.Name, config.RouterOSDir), target.Version, list.ListName+".rsc")
+        case "vyos":
+                path = filepath.Join(layoutDir("vyos", list.Name, config.VyOS.Dir), name+".sh")
+        case "edgeos":
+                path = filepath.Join(layoutDir("edgeos", list.Name, config.EdgeOS.Dir), name+".sh")
+        }
+        if _, err := os.Stat(path); err != nil {
+                return ""
+        }
+        return path
+}
+
+// applySSHScript копирует скрипт на устройство, выполняет и удаляет его
+func (target SSHTarget) applySSHScript(list *generatedList, path string) error {
+        if target.Device == "routeros" {
+                // Файл в корне файловой системы роутера; /import пишет ошибку в вывод, а не в код выхода
+                remote := "allow-domains-" + identifierName(list.ListName) + ".rsc"
+                if err := target.upload(path, remote); err != nil {
+                        return err
+                }
+                output, err := target.run("/import file-name=" + remote)
+                target.run("/file remove [find name=\"" + remote + "\"]")
+                if err != nil {
+                        return err
+                }
+                if !strings.Contains(output, "executed successfully") {
+                        return fmt.Errorf("import failed: %s", output)
+                }
+                return nil
+        }
+
+        remote := "/tmp/allow-domains-" + identifierName(strings.TrimSuffix(list.Name, ".lst")) + ".sh"
+        if err := target.upload(path, remote); err != nil {
+                return err
+        }
+        _, err := target.run(fmt.Sprintf("vbash %s; status=$?; rm -f %s; exit $status", remote, remote))
+        return err
+}
+
+func pushSSHTarget(target SSHTarget, lists []*generatedList) error {
+        var applied int
+        for _, list := range lists {
+                if len(target.Lists) > 0 && !listSelectedByName(target.Lists, list) {
+                        continue
+                }
+                path := target.sshScript(list)
+                if path == "" {
+                        continue
+                }
+                if err := target.applySSHScript(list, path); err != nil {
+                        return fmt.Errorf("%s: %w", list.ListName, err)
+                }
+                applied++
+        }
+        log.Printf("SSH %s: applied %d scripts", target.Name, applied)
+        return nil
+}
+
+func pushSSH(lists []*generatedList) {
+        for _, target := range config.SSHPush.Targets {
+                reportProgress("SSH "+target.Name, "push", target.Host)
+                err := pushSSHTarget(target, lists)
+                if err != nil {
+                        log.Printf("Error pushing to SSH %s: %v", target.Name, err)
+                        reportProgress("SSH "+target.Name, "failed", err.Error())
+                } else {
+                        reportProgress("SSH "+target.Name, "done", "")
+                }
+                recordPush("ssh:"+target.Name, lists, err)
+        }
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+        "archive/tar"
+        "compress/gzip"
+        "encoding/json"
+        "flag"
+        "fmt"
+        "io"
+        "io/fs"
+        "log"
+        "os"
+        "path"
+        "path/filepath"
+        "strings"
+        "time"
+)
+
+// stateSchemaVersion меняется при несовместимых изменениях архива состояния
+const stateSchemaVersion = 1
+
+// stateManifest manifest.json в корне архива
+type stateManifest struct {
+        SchemaVersion int    `json:"schema_version"`
+        Created       string `json:"created"`
+        Files         int    `json:"files"`
+}
+
+// stateEntry файл состояния: имя в архиве не зависит от путей в конфиге,
+// чтобы на другой машине файлы легли туда, куда указывает её конфиг
+type stateEntry struct {
+        name, path string
+}
+
+// insideDir лежит ли path внутри dir
+func insideDir(path, dir string) bool {
+        rel, err := filepath.Rel(dir, path)
+        return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// stateFiles файлы состояния, путь к которым задаётся в конфиге отдельно и
+// может быть вне каталога кэша
+func stateFiles() map[string]string {
+        return map[string]string{
+                "org_state.json":  orgStatePath(),
+                "push_queue.json": pushQueuePath(),
+                "quarantine.json": quarantinePath(),
+                "grace.json":      gracePath(),
+                "gobgp.json":      gobgpStatePath(),
+                "snapshot.json":   config.Snapshot.File,
+        }
+}
+
+// stateEntries кэш загрузок, файлы stateFiles и .lst прошлого запуска (по
+// ним считаются изменения и delta-скрипты)
+func stateEntries() ([]stateEntry, error) {
+        var entries []stateEntry
+        err := filepath.WalkDir(config.Cache.Dir, func(p string, d fs.DirEntry, err error) error {
+                if err != nil {
+                        if os.IsNotExist(err) {
+                                return nil
+                        }
+                        return err
+                }
+                if d.Type().IsRegular() {
+                        rel, err := filepath.Rel(config.Cache.Dir, p)
+                        if err != nil {
+                                return err
+                        }
+                        entries = append(entries, stateEntry{"cache/" + filepath.ToSlash(rel), p})
+                }
+                return nil
+        })
+        if err != nil {
+                return nil, err
+        }
+
+        for name, p := range stateFiles() {
+                if p == "" || insideDir(p, config.Cache.Dir) {
+                        continue
+                }
+                if _, err := os.Stat(p); err == nil {
+                        entries = append(entries, stateEntry{name, p})
+                }
+        }
+
+        for _, dir := range layoutDirs("ipv4", config.IPv4Dir) {
+                matches, _ := filepath.Glob(filepath.Join(dir, "*.lst"))
+                for _, p := range matches {
+                        entries = append(entries, stateEntry{"snapshots/" + filepath.Base(p), p})
+                }
+        }
+        return entries, nil
+}
+
+// statePath куда на этой машине кладётся файл из архива
+func statePath(name string) (string, error) {
+        clean := path.Clean(name)
+        if clean != name || path.IsAbs(clean) || strings.HasPrefix(clean, "../") {
+                return "", fmt.Errorf("unsafe path %q in archive", name)
+        }
+        switch {
+        case strings.HasPrefix(clean, "cache/"):
+                return filepath.Join(config.Cache.Dir, filepath.FromSlash(strings.TrimPrefix(clean, "cache/"))), nil
+        case stateFiles()[clean] != "":
+                return stateFiles()[clean], nil
+        case strings.HasPrefix(clean, "snapshots/") && !strings.Contains(strings.TrimPrefix(clean, "snapshots/"), "/"):
+                return ipv4ListPath(strings.TrimPrefix(clean, "snapshots/")), nil
+        default:
+                return "", fmt.Errorf("unknown entry %q in archive", name)
+        }
+}
+
+func addTarFile(tw *tar.Writer, name, p string) error {
+        file, err := os.Open(p)
+        if err != nil {
+                return err
+        }
+        defer file.Close()
+        info, err := file.Stat()
+        if err != nil {
+                return err
+        }
+        header := &tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}
+        if err := tw.WriteHeader(header); err != nil {
+                return err
+        }
+        _, err = io.Copy(tw, file)
+        return err
+}
+
+func exportState(out string) (int, error) {
+        entries, err := stateEntries()
+        if err != nil {
+                return 0, err
+        }
+
+        file, err := createStaged(out)
+        if err != nil {
+                return 0, err
+        }
+        defer file.Abort()
+        gz := gzip.NewWriter(file)
+        tw := tar.NewWriter(gz)
+
+        manifest, _ := json.MarshalIndent(stateManifest{
+                SchemaVersion: stateSchemaVersion,
+                Created:       time.Now().UTC().Format(time.RFC3339),
+                Files:         len(entries),
+        }, "", "    ")
+        if err := tw.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0644, Size: int64(len(manifest)), ModTime: time.Now()}); err != nil {
+                return 0, err
+        }
+        if _, err := tw.Write(manifest); err != nil {
+                return 0, err
+        }
+        for _, entry := range entries {
+                if err := addTarFile(tw, entry.name, entry.path); err != nil {
+                        return 0, fmt.Errorf("%s: %w", entry.path, err)
+                }
+        }
+
+        if err := tw.Close(); err != nil {
+                return 0, err
+        }
+        if err := gz.Close(); err != nil {
+                return 0, err
+        }
+        return len(entries), file.Commit()
+}
+
+func importState(archive string, force bool) (int, error) {
+        file, err := os.Open(archive)
+        if err != nil {
+                return 0, err
+        }
+        defer file.Close()
+        gz, err := gzip.NewReader(file)
+        if err != nil {
+                return 0, err
+        }
+        tr := tar.NewReader(gz)
+
+        imported := 0
+        for {
+                header, err := tr.Next()
+                if err == io.EOF {
+                        break
+                }
+                if err != nil {
+                        return imported, err
+                }
+                if header.Typeflag != tar.TypeReg {
+                        continue
+                }
+                if header.Name == "manifest.json" {
+                        var manifest stateManifest
+                        if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+                                return imported, fmt.Errorf("manifest.json: %w", err)
+                        }
+                        if manifest.SchemaVersion > stateSchemaVersion {
+                                return imported, fmt.Errorf("archive schema_version %d is newer than supported %d", manifest.SchemaVersion, stateSchemaVersion)
+                        }
+                        log.Printf("State archive created %s with %d files", manifest.Created, manifest.Files)
+                        continue
+                }
+
+                dest, err := statePath(header.Name)
+                if err != nil {
+                        return imported, err
+                }
+                if _, err := os.Stat(dest); err == nil && !force {
+                        return imported, fmt.Errorf("%s already exists (use --force to overwrite)", dest)
+                }
+                if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+                        return imported, err
+                }
+                staged, err := createStaged(dest)
+                if err != nil {
+                        return imported, err
+                }
+                if _, err := io.Copy(staged, tr); err != nil {
+                        staged.Abort()
+                        return imported, err
+                }
+                if err := staged.Commit(); err != nil {
+                        return imported, err
+                }
+                os.Chtimes(dest, header.ModTime, header.ModTime)
+                imported++
+        }
+        return imported, nil
+}
+
+// stateCommand переносит состояние (кэш, state-файлы, .lst прошлого запуска)
+// между машинами: state export [--out file] [config] и state import [--force] <archive> [config]
+func stateCommand(args []string) {
+        usage := "Usage: get_subnets state export [--out state.tar.gz] [config-file]\n       get_subnets state import [--force] <archive> [config-file]"
+        if len(args) == 0 {
+                log.Fatal(usage)
+        }
+
+        flags := flag.NewFlagSet("state "+args[0], flag.ExitOnError)
+        out := flags.String("out", "state.tar.gz", "archive to write")
+        force := flags.Bool("force", false, "overwrite existing files on import")
+        flags.Parse(args[1:])
+
+        loadStateConfig := func(arg int) {
+                configPath := "config.yaml"
+                if flags.NArg() > arg {
+                        configPath = flags.Arg(arg)
+                }
+                if err := loadConfig(configPath); err != nil {
+                        log.Fatal("Error loading config:", err)
+                }
+        }
+
+        switch args[0] {
+        case "export":
+                loadStateConfig(0)
+                n, err := exportState(*out)
+                if err != nil {
+                        log.Fatal("Error exporting state:", err)
+                }
+                log.Printf("Exported %d files to %s", n, *out)
+        case "import":
+                if flags.NArg() < 1 {
+                        log.Fatal(usage)
+                }
+                loadStateConfig(1)
+                n, err := importState(flags.Arg(0), *force)
+                if err != nil {
+                        log.Fatal("Error importing state:", err)
+                }
+                log.Printf("Imported %d files from %s", n, flags.Arg(0))
+        default:
+                log.Fatal(usage)
+        }
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+        "bufio"
+        "fmt"
+        "log"
+        "net/netip"
+        "strings"
+
+        "go4.org/netipx"
+)
+
+// StaticListConfig список из готовых префиксов: локальные файлы или URL по
+// префиксу в строке и адреса прямо в конфиге. Сюда переносятся списки,
+// которые раньше вели вручную (см. import-from-router).
+type StaticListConfig struct {
+        File          string   `yaml:"file"`
+        ListName      string   `yaml:"list_name"`
+        Comment       string   `yaml:"comment"`
+        Sources       []string `yaml:"sources"`
+        Prefixes      []string `yaml:"prefixes"`
+        Tags          []string `yaml:"tags"`
+        SourceOptions `yaml:",inline"`
+}
+
+// parsePrefixLines разбирает префиксы или одиночные адреса, по одному в строке;
+// после # комментарий. С file строки записываются в провенанс списка.
+func parsePrefixLines(data string, builder *netipx.IPSetBuilder, file, source string) {
+        scanner := bufio.NewScanner(strings.NewReader(data))
+        for scanner.Scan() {
+                line := scanner.Text()
+                if i := strings.IndexByte(line, '#'); i >= 0 {
+                        line = line[:i]
+                }
+                line = strings.TrimSpace(line)
+                if line == "" {
+                        continue
+                }
+                prefix, err := parsePrefixOrAddr(line)
+                if err != nil {
+                        log.Printf("Invalid subnet: %s", line)
+                        continue
+                }
+                if prefix.Addr().Is4() {
+                        builder.AddPrefix(prefix.Masked())
+                        if file != "" {
+                                noteOrigin(file, prefixOrigin{Prefix: prefix.Masked(), Source: source, Line: scanner.Text()})
+                        }
+                }
+        }
+}
+
+func parsePrefixOrAddr(s string) (netip.Prefix, error) {
+        if strings.Contains(s, "/") {
+                return netip.ParsePrefix(s)
+        }
+        addr, err := netip.ParseAddr(s)
+        if err != nil {
+                return netip.Prefix{}, err
+        }
+        return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func loadStaticPrefixes(file string, static StaticListConfig) ([]netip.Prefix, error) {
+        var builder netipx.IPSetBuilder
+        for _, source := range static.Sources {
+                data, err := readSource(source, static.SourceOptions)
+                if err != nil {
+                        return nil, fmt.Errorf("%s: %w", source, err)
+                }
+                parsePrefixLines(data, &builder, file, source)
+        }
+        parsePrefixLines(strings.Join(static.Prefixes, "\n"), &builder, file, "config")
+
+        set, err := builder.IPSet()
+        if err != nil {
+                return nil, err
+        }
+        return set.Prefixes(), nil
+}
+
+func processStaticLists() {
+        for name, static := range config.Static {
+                if !sourceSelected(name, "static", static.File, static.ListName) {
+                        continue
+                }
+                // Замыкание может выполниться повторно после цикла
+                name, static := name, static
+                runListStage(name, "static", func() error {
+                        reportProgress(name, "download", "static")
+                        file := static.File
+                        if file == "" {
+                                file = name + ".lst"
+                        }
+                        prefixes, err := loadStaticPrefixes(file, static)
+                        if err != nil {
+                                log.Printf("Error loading static list %s: %v", name, err)
+                                reportProgress(name, "failed", err.Error())
+                                return err
+                        }
+
+                        list := generatedList{ListName: static.ListName, Comment: static.Comment, Prefixes: prefixes,
+                                Sources: static.Sources, Tags: static.Tags, Trust: static.Trust}
+                        if list.ListName == "" {
+                                list.ListName = strings.TrimSuffix(file, ".lst")
+                        }
+                        if list.Comment == "" {
+                                list.Comment = name
+                        }
+                        publishPrefixList(file, list)
+                        return nil
+                })
+        }
+}
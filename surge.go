@@ -0,0 +1,22 @@
+package main
+
+// Правила Surge; тот же формат читают Shadowrocket и Stash
+
+func surgeRules(list *generatedList) []string {
+        rules := make([]string, 0, len(list.Domains)+len(list.Prefixes))
+        for _, domain := range list.Domains {
+                rules = append(rules, "DOMAIN-SUFFIX,"+trimDomainDot(domain))
+        }
+        for _, prefix := range list.Prefixes {
+                if prefix.Addr().Is4() {
+                        rules = append(rules, "IP-CIDR,"+prefix.String()+",no-resolve")
+                } else {
+                        rules = append(rules, "IP-CIDR6,"+prefix.String()+",no-resolve")
+                }
+        }
+        return rules
+}
+
+func generateSurgeRuleset(list *generatedList) error {
+        return writeOutputLines(layoutDir("surge", list.Name, config.Surge.Dir), list.Name+".list", surgeRules(list))
+}
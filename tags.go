@@ -0,0 +1,313 @@
+package main
+
+import (
+        "fmt"
+        "log"
+        "net/netip"
+        "sort"
+        "strings"
+
+        "go4.org/netipx"
+)
+
+// TaggedListConfig список, собранный из уже готовых списков по выражению над
+// тегами, например "telegram AND europe" или "(meta OR google) AND NOT anycast".
+// Теги списка - его имя и теги из tags в конфиге источника.
+type TaggedListConfig struct {
+        File     string `yaml:"file"`
+        ListName string `yaml:"list_name"`
+        Comment  string `yaml:"comment"`
+        Match    string `yaml:"match"`
+}
+
+// tagNode узел разобранного выражения: тег или and/or/not над аргументами
+type tagNode struct {
+        op   string
+        tag  string
+        args []*tagNode
+}
+
+func normalizeTag(tag string) string {
+        return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(tag), ".lst"))
+}
+
+func tokenizeTagExpr(expr string) []string {
+        expr = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expr)
+        return strings.Fields(expr)
+}
+
+// tagParser разбор с приоритетом NOT > AND > OR
+type tagParser struct {
+        tokens []string
+        pos    int
+}
+
+func (p *tagParser) peek() string {
+        if p.pos < len(p.tokens) {
+                return strings.ToUpper(p.tokens[p.pos])
+        }
+        return ""
+}
+
+func (p *tagParser) parseOr() (*tagNode, error) {
+        left, err := p.parseAnd()
+        if err != nil {
+                return nil, err
+        }
+        for p.peek() == "OR" {
+                p.pos++
+                right, err := p.parseAnd()
+                if err != nil {
+                        return nil, err
+                }
+                left = &tagNode{op: "or", args: []*tagNode{left, right}}
+        }
+        return left, nil
+}
+
+func (p *tagParser) parseAnd() (*tagNode, error) {
+        left, err := p.parseNot()
+        if err != nil {
+                return nil, err
+        }
+        for p.peek() == "AND" {
+                p.pos++
+                right, err := p.parseNot()
+                if err != nil {
+                        return nil, err
+                }
+                left = &tagNode{op: "and", args: []*tagNode{left, right}}
+        }
+        return left, nil
+}
+
+func (p *tagParser) parseNot() (*tagNode, error) {
+        switch token := p.peek(); token {
+        case "NOT":
+                p.pos++
+                arg, err := p.parseNot()
+                if err != nil {
+                        return nil, err
+                }
+                return &tagNode{op: "not", args: []*tagNode{arg}}, nil
+        case "(":
+                p.pos++
+                node, err := p.parseOr()
+                if err != nil {
+                        return nil, err
+                }
+                if p.peek() != ")" {
+                        return nil, fmt.Errorf("missing )")
+                }
+                p.pos++
+                return node, nil
+        case "", ")", "AND", "OR":
+                if token == "" {
+                        return nil, fmt.Errorf("unexpected end of expression")
+                }
+                return nil, fmt.Errorf("unexpected %s", token)
+        default:
+                tag := normalizeTag(p.tokens[p.pos])
+                p.pos++
+                return &tagNode{tag: tag}, nil
+        }
+}
+
+func parseTagExpr(expr string) (*tagNode, error) {
+        p := &tagParser{tokens: tokenizeTagExpr(expr)}
+        node, err := p.parseOr()
+        if err != nil {
+                return nil, err
+        }
+        if p.pos < len(p.tokens) {
+                return nil, fmt.Errorf("unexpected %s", p.tokens[p.pos])
+        }
+        return node, nil
+}
+
+// tagIndex префиксы и домены всех списков по тегам
+type tagIndex struct {
+        prefixes    map[string]*netipx.IPSetBuilder
+        domains     map[string]map[string]bool
+        allPrefixes netipx.IPSetBuilder
+        allDomains  map[string]bool
+}
+
+func buildTagIndex(lists []*generatedList) *tagIndex {
+        index := &tagIndex{
+                prefixes:   make(map[string]*netipx.IPSetBuilder),
+                domains:    make(map[string]map[string]bool),
+                allDomains: make(map[string]bool),
+        }
+        for _, list := range lists {
+                tags := append([]string{list.Name}, list.Tags...)
+                for _, tag := range tags {
+                        tag = normalizeTag(tag)
+                        if index.prefixes[tag] == nil {
+                                index.prefixes[tag] = &netipx.IPSetBuilder{}
+                                index.domains[tag] = make(map[string]bool)
+                        }
+                        for _, prefix := range list.Prefixes {
+                                index.prefixes[tag].AddPrefix(prefix)
+                        }
+                        for _, domain := range list.Domains {
+                                index.domains[tag][strings.ToLower(trimDomainDot(domain))] = true
+                        }
+                }
+                for _, prefix := range list.Prefixes {
+                        index.allPrefixes.AddPrefix(prefix)
+                }
+                for _, domain := range list.Domains {
+                        index.allDomains[strings.ToLower(trimDomainDot(domain))] = true
+                }
+        }
+        return index
+}
+
+func (index *tagIndex) evalPrefixes(node *tagNode) (*netipx.IPSet, error) {
+        var builder netipx.IPSetBuilder
+        switch node.op {
+        case "":
+                if set := index.prefixes[node.tag]; set != nil {
+                        s, err := set.IPSet()
+                        if err != nil {
+                                return nil, err
+                        }
+                        builder.AddSet(s)
+                }
+        case "not":
+                arg, err := index.evalPrefixes(node.args[0])
+                if err != nil {
+                        return nil, err
+                }
+                all, err := index.allPrefixes.IPSet()
+                if err != nil {
+                        return nil, err
+                }
+                builder.AddSet(all)
+                builder.RemoveSet(arg)
+        default:
+                left, err := index.evalPrefixes(node.args[0])
+                if err != nil {
+                        return nil, err
+                }
+                right, err := index.evalPrefixes(node.args[1])
+                if err != nil {
+                        return nil, err
+                }
+                builder.AddSet(left)
+                if node.op == "and" {
+                        builder.Intersect(right)
+                } else {
+                        builder.AddSet(right)
+                }
+        }
+        return builder.IPSet()
+}
+
+func (index *tagIndex) evalDomains(node *tagNode) map[string]bool {
+        out := make(map[string]bool)
+        switch node.op {
+        case "":
+                for domain := range index.domains[node.tag] {
+                        out[domain] = true
+                }
+        case "not":
+                arg := index.evalDomains(node.args[0])
+                for domain := range index.allDomains {
+                        if !arg[domain] {
+                                out[domain] = true
+                        }
+                }
+        default:
+                left, right := index.evalDomains(node.args[0]), index.evalDomains(node.args[1])
+                for domain := range left {
+                        if node.op == "or" || right[domain] {
+                                out[domain] = true
+                        }
+                }
+                if node.op == "or" {
+                        for domain := range right {
+                                out[domain] = true
+                        }
+                }
+        }
+        return out
+}
+
+func (index *tagIndex) warnUnknownTags(name string, node *tagNode) {
+        if node.op == "" {
+                if index.prefixes[node.tag] == nil {
+                        log.Printf("Warning: tagged list %s: no list has tag %q", name, node.tag)
+                }
+                return
+        }
+        for _, arg := range node.args {
+                index.warnUnknownTags(name, arg)
+        }
+}
+
+// processTaggedLists собирает списки tagged из всех списков запуска
+func processTaggedLists() {
+        if len(config.Tagged) == 0 {
+                return
+        }
+        // Из части списков получились бы неполные пересечения
+        if partialRun() {
+                log.Println("Partial run (--only/--skip): tagged lists are not updated")
+                return
+        }
+
+        index := buildTagIndex(generatedLists)
+        for name, tagged := range config.Tagged {
+                runStage(name, "tagged", func() {
+                        reportProgress(name, "aggregate", tagged.Match)
+                        node, err := parseTagExpr(tagged.Match)
+                        if err != nil {
+                                log.Printf("Error parsing match of tagged list %s: %v", name, err)
+                                reportProgress(name, "failed", err.Error())
+                                return
+                        }
+                        index.warnUnknownTags(name, node)
+
+                        set, err := index.evalPrefixes(node)
+                        if err != nil {
+                                log.Printf("Error building tagged list %s: %v", name, err)
+                                reportProgress(name, "failed", err.Error())
+                                return
+                        }
+                        var domains []string
+                        for domain := range index.evalDomains(node) {
+                                domains = append(domains, domain)
+                        }
+                        sort.Strings(domains)
+
+                        file := tagged.File
+                        if file == "" {
+                                file = name + ".lst"
+                        }
+                        list := generatedList{ListName: tagged.ListName, Comment: tagged.Comment, Domains: domains}
+                        if list.ListName == "" {
+                                list.ListName = strings.TrimSuffix(file, ".lst")
+                        }
+                        if list.Comment == "" {
+                                list.Comment = name
+                        }
+
+                        // Только IPv4, как и в остальных списках
+                        var v4 []netip.Prefix
+                        for _, prefix := range set.Prefixes() {
+                                if prefix.Addr().Is4() {
+                                        v4 = append(v4, prefix)
+                                }
+                        }
+                        list.Prefixes = v4
+                        if len(v4) > 0 {
+                                publishPrefixList(file, list)
+                        } else {
+                                list.Name = file
+                                addGeneratedList(list)
+                        }
+                })
+        }
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+        "net/netip"
+        "reflect"
+        "sort"
+        "strings"
+        "testing"
+)
+
+// formatTagNode выражение в префиксной записи, например (and a (not b))
+func formatTagNode(node *tagNode) string {
+        if node.op == "" {
+                return node.tag
+        }
+        parts := []string{node.op}
+        for _, arg := range node.args {
+                parts = append(parts, formatTagNode(arg))
+        }
+        return "(" + strings.Join(parts, " ") + ")"
+}
+
+func TestParseTagExpr(t *testing.T) {
+        tests := []struct {
+                expr    string
+                want    string
+                wantErr bool
+        }{
+                {expr: "telegram", want: "telegram"},
+                {expr: "Meta.lst", want: "meta"},
+                {expr: "a AND b OR c", want: "(or (and a b) c)"},
+                {expr: "a or b and c", want: "(or a (and b c))"},
+                {expr: "NOT a AND b", want: "(and (not a) b)"},
+                {expr: "(meta OR google) AND NOT anycast", want: "(and (or meta google) (not anycast))"},
+                {expr: "NOT NOT a", want: "(not (not a))"},
+                {expr: "a b", wantErr: true},
+                {expr: "(a OR b", wantErr: true},
+                {expr: "a AND", wantErr: true},
+                {expr: "OR a", wantErr: true},
+                {expr: "", wantErr: true},
+                {expr: "a )", wantErr: true},
+        }
+        for _, tt := range tests {
+                t.Run(tt.expr, func(t *testing.T) {
+                        node, err := parseTagExpr(tt.expr)
+                        if (err != nil) != tt.wantErr {
+                                t.Fatalf("parseTagExpr(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+                        }
+                        if err == nil && formatTagNode(node) != tt.want {
+                                t.Errorf("parseTagExpr(%q) = %s, want %s", tt.expr, formatTagNode(node), tt.want)
+                        }
+                })
+        }
+}
+
+func TestTagIndexEval(t *testing.T) {
+        prefixes := func(values ...string) []netip.Prefix {
+                var out []netip.Prefix
+                for _, value := range values {
+                        out = append(out, netip.MustParsePrefix(value))
+                }
+                return out
+        }
+        index := buildTagIndex([]*generatedList{
+                {Name: "telegram", Tags: []string{"Europe"}, Prefixes: prefixes("91.108.0.0/16", "149.154.160.0/20"), Domains: []string{".t.me"}},
+                {Name: "meta", Tags: []string{"europe", "anycast"}, Prefixes: prefixes("157.240.0.0/16"), Domains: []string{"facebook.com"}},
+                {Name: "google", Prefixes: prefixes("8.8.8.0/24", "91.108.4.0/24"), Domains: []string{"google.com"}},
+        })
+
+        tests := []struct {
+                expr     string
+                prefixes []netip.Prefix
+                domains  []string
+        }{
+                {"telegram", prefixes("91.108.0.0/16", "149.154.160.0/20"), []string{"t.me"}},
+                {"europe", prefixes("91.108.0.0/16", "149.154.160.0/20", "157.240.0.0/16"), []string{"facebook.com", "t.me"}},
+                {"europe AND NOT anycast", prefixes("91.108.0.0/16", "149.154.160.0/20"), []string{"t.me"}},
+                {"telegram AND google", prefixes("91.108.4.0/24"), nil},
+                {"meta OR google", prefixes("8.8.8.0/24", "91.108.4.0/24", "157.240.0.0/16"), []string{"facebook.com", "google.com"}},
+                {"NOT europe", prefixes("8.8.8.0/24"), []string{"google.com"}},
+                {"unknown", nil, nil},
+        }
+        for _, tt := range tests {
+                t.Run(tt.expr, func(t *testing.T) {
+                        node, err := parseTagExpr(tt.expr)
+                        if err != nil {
+                                t.Fatal(err)
+                        }
+                        set, err := index.evalPrefixes(node)
+                        if err != nil {
+                                t.Fatal(err)
+                        }
+                        if got := set.Prefixes(); !reflect.DeepEqual(got, tt.prefixes) {
+                                t.Errorf("evalPrefixes = %v, want %v", got, tt.prefixes)
+                        }
+                        var domains []string
+                        for domain := range index.evalDomains(node) {
+                                domains = append(domains, domain)
+                        }
+                        sort.Strings(domains)
+                        if !reflect.DeepEqual(domains, tt.domains) {
+                                t.Errorf("evalDomains = %v, want %v", domains, tt.domains)
+                        }
+                })
+        }
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+        "errors"
+        "fmt"
+        "io"
+        "net"
+        "net/textproto"
+        "net/url"
+        "os"
+        "os/exec"
+        "path/filepath"
+        "strconv"
+        "strings"
+        "time"
+)
+
+// Источники по ftp:// и rsync://: так публикуются часть статистики RIR и зеркала.
+// Загрузка идёт через downloadURL, так что кэш, checksum и повторы те же, что у HTTP.
+
+// RsyncConfig внешний rsync для rsync:// источников
+type RsyncConfig struct {
+        Command string        `yaml:"command"` // По умолчанию rsync из PATH
+        Timeout time.Duration `yaml:"timeout"` // --timeout без обмена данными, по умолчанию 60s
+}
+
+// ftpError ответ FTP-сервера с ошибкой; 4xx - временные (421, 425, 450...)
+type ftpError struct {
+        Code int
+        Msg  string
+}
+
+func (e *ftpError) Error() string {
+        return fmt.Sprintf("FTP error: %d %s", e.Code, e.Msg)
+}
+
+// rsyncError rsync завершился с ошибкой; коды 10, 12, 30, 35 - сбои связи
+type rsyncError struct {
+        Code   int
+        Stderr string
+}
+
+func (e *rsyncError) Error() string {
+        return fmt.Sprintf("rsync exit %d: %s", e.Code, e.Stderr)
+}
+
+func (e *rsyncError) transient() bool {
+        switch e.Code {
+        case 10, 12, 30, 35:
+                return true
+        }
+        return false
+}
+
+// urlScheme ftp, rsync или http для остальных
+func urlScheme(rawURL string) string {
+        switch {
+        case strings.HasPrefix(rawURL, "ftp://"):
+                return "ftp"
+        case strings.HasPrefix(rawURL, "rsync://"):
+                return "rsync"
+        }
+        return "http"
+}
+
+// ftpCmd отправляет команду и ждёт ответа с кодом из want
+func ftpCmd(conn *textproto.Conn, want int, format string, args ...any) (int, string, error) {
+        if format != "" {
+                if err := conn.PrintfLine(format, args...); err != nil {
+                        return 0, "", err
+                }
+        }
+        code, msg, err := conn.ReadResponse(want)
+        var protoErr *textproto.Error
+        if errors.As(err, &protoErr) {
+                return code, msg, &ftpError{Code: protoErr.Code, Msg: protoErr.Msg}
+        }
+        return code, msg, err
+}
+
+// ftpDataAddr адрес канала данных: EPSV, затем PASV для старых серверов
+func ftpDataAddr(conn *textproto.Conn, host string) (string, error) {
+        if _, msg, err := ftpCmd(conn, 229, "EPSV"); err == nil {
+                // 229 Entering Extended Passive Mode (|||port|)
+                start, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)")
+                if start >= 0 && end > start+4 {
+                        return net.JoinHostPort(host, msg[start+4:end]), nil
+                }
+        }
+        _, msg, err := ftpCmd(conn, 227, "PASV")
+        if err != nil {
+                return "", err
+        }
+        // 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2); адрес берём от управляющего соединения
+        start, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+        if start < 0 || end < start {
+                return "", fmt.Errorf("bad PASV reply: %s", msg)
+        }
+        parts := strings.Split(msg[start+1:end], ",")
+        if len(parts) != 6 {
+                return "", fmt.Errorf("bad PASV reply: %s", msg)
+        }
+        p1, err1 := strconv.Atoi(strings.TrimSpace(parts[4]))
+        p2, err2 := strconv.Atoi(strings.TrimSpace(parts[5]))
+        if err1 != nil || err2 != nil {
+                return "", fmt.Errorf("bad PASV reply: %s", msg)
+        }
+        return net.JoinHostPort(host, strconv.Itoa(p1<<8|p2)), nil
+}
+
+// downloadFTP скачивает файл в пассивном режиме, по умолчанию анонимно
+func downloadFTP(rawURL string, maxSize ByteSize) (string, error) {
+        u, err := url.Parse(rawURL)
+        if err != nil {
+                return "", err
+        }
+        host := u.Host
+        if u.Port() == "" {
+                host = net.JoinHostPort(u.Hostname(), "21")
+        }
+        dialer := net.Dialer{Timeout: 30 * time.Second}
+        raw, err := dialer.DialContext(runCtx, "tcp", host)
+        if err != nil {
+                return "", err
+        }
+        defer raw.Close()
+        raw.SetDeadline(time.Now().Add(5 * time.Minute))
+        conn := textproto.NewConn(raw)
+
+        if _, _, err := ftpCmd(conn, 220, ""); err != nil {
+                return "", err
+        }
+        user, pass := "anonymous", "anonymous@"
+        if u.User != nil {
+                user = u.User.Username()
+                if p, ok := u.User.Password(); ok {
+                        pass = p
+                }
+        }
+        code, _, err := ftpCmd(conn, 0, "USER %s", user)
+        if err != nil {
+                return "", err
+        }
+        switch code {
+        case 230:
+        case 331:
+                if _, _, err := ftpCmd(conn, 230, "PASS %s", pass); err != nil {
+                        return "", err
+                }
+        default:
+                return "", &ftpError{Code: code, Msg: "USER rejected"}
+        }
+        if _, _, err := ftpCmd(conn, 200, "TYPE I"); err != nil {
+                return "", err
+        }
+
+        addr, err := ftpDataAddr(conn, u.Hostname())
+        if err != nil {
+                return "", err
+        }
+        data, err := dialer.DialContext(runCtx, "tcp", addr)
+        if err != nil {
+                return "", err
+        }
+        defer data.Close()
+        data.SetDeadline(time.Now().Add(5 * time.Minute))
+        // 150/125 - передача началась
+        if _, _, err := ftpCmd(conn, 1, "RETR %s", u.Path); err != nil {
+                return "", err
+        }
+        body, err := io.ReadAll(io.LimitReader(data, int64(maxSize)+1))
+        data.Close()
+        if err != nil {
+                return "", err
+        }
+        if int64(len(body)) > int64(maxSize) {
+                return "", fmt.Errorf("response exceeds limit of %d bytes", maxSize)
+        }
+        if _, _, err := ftpCmd(conn, 2, ""); err != nil {
+                return "", err
+        }
+        conn.PrintfLine("QUIT")
+        return stripBOM(string(body)), nil
+}
+
+// downloadRsync скачивает один файл внешним rsync во временный каталог
+func downloadRsync(rawURL string, maxSize ByteSize) (string, error) {
+        dir, err := os.MkdirTemp(config.WorkDir, "rsync-")
+        if err != nil {
+                return "", err
+        }
+        defer os.RemoveAll(dir)
+        target := filepath.Join(dir, "data")
+
+        args := []string{"--no-motd", "--copy-links", "--timeout=" + strconv.Itoa(int(config.Rsync.Timeout.Seconds())),
+                "--max-size=" + strconv.FormatInt(int64(maxSize), 10), rawURL, target}
+        cmd := exec.CommandContext(runCtx, config.Rsync.Command, args...)
+        if _, err := cmd.Output(); err != nil {
+                var exitErr *exec.ExitError
+                if errors.As(err, &exitErr) {
+                        return "", &rsyncError{Code: exitErr.ExitCode(), Stderr: strings.TrimSpace(string(exitErr.Stderr))}
+                }
+                return "", fmt.Errorf("rsync %s: %w", rawURL, err)
+        }
+        // --max-size молча пропускает большой файл
+        info, err := os.Stat(target)
+        if err != nil {
+                return "", fmt.Errorf("rsync %s: no file received (larger than %d bytes?)", rawURL, maxSize)
+        }
+        if info.Size() > int64(maxSize) {
+                return "", fmt.Errorf("response exceeds limit of %d bytes", maxSize)
+        }
+        body, err := os.ReadFile(target)
+        if err != nil {
+                return "", err
+        }
+        return stripBOM(string(body)), nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+        "fmt"
+        "log"
+        "net/netip"
+        "strings"
+
+        "go4.org/netipx"
+)
+
+// Доверие к источнику (trust в конфиге): trusted - официальные данные и BGP,
+// untrusted - сторонние списки сообщества. Различие важно, когда в одно имя
+// списка пишут несколько источников и они расходятся.
+const (
+        trustTrusted   = "trusted"
+        trustUntrusted = "untrusted"
+)
+
+func validateTrust(where, trust string) error {
+        switch trust {
+        case "", trustTrusted, trustUntrusted:
+                return nil
+        default:
+                return fmt.Errorf("%s: unknown trust %q (trusted or untrusted)", where, trust)
+        }
+}
+
+func listTrusted(list *generatedList) bool {
+        return list.Trust != trustUntrusted
+}
+
+func prefixSet(prefixes []netip.Prefix) (*netipx.IPSet, error) {
+        var builder netipx.IPSetBuilder
+        for _, prefix := range prefixes {
+                builder.AddPrefix(prefix)
+        }
+        return builder.IPSet()
+}
+
+func listSource(list *generatedList) string {
+        if len(list.Sources) == 0 {
+                return list.Name
+        }
+        return strings.Join(list.Sources, ", ")
+}
+
+// mergePrefixes объединяет префиксы двух источников по conflict_policy и
+// сообщает о различиях между ними
+func mergePrefixes(existing, added *generatedList) ([]netip.Prefix, error) {
+        a, err := prefixSet(existing.Prefixes)
+        if err != nil {
+                return nil, err
+        }
+        b, err := prefixSet(added.Prefixes)
+        if err != nil {
+                return nil, err
+        }
+
+        var onlyA, onlyB netipx.IPSetBuilder
+        onlyA.AddSet(a)
+        onlyA.RemoveSet(b)
+        onlyB.AddSet(b)
+        onlyB.RemoveSet(a)
+        setA, err := onlyA.IPSet()
+        if err != nil {
+                return nil, err
+        }
+        setB, err := onlyB.IPSet()
+        if err != nil {
+                return nil, err
+        }
+        if len(setA.Prefixes()) == 0 && len(setB.Prefixes()) == 0 {
+                return existing.Prefixes, nil
+        }
+        log.Printf("Warning: sources of %s disagree: %d prefixes only in %s (%s), %d only in %s (%s); policy %s",
+                existing.Name, len(setA.Prefixes()), listSource(existing), trustName(existing),
+                len(setB.Prefixes()), listSource(added), trustName(added), config.ConflictPolicy)
+
+        var merged netipx.IPSetBuilder
+        switch {
+        case config.ConflictPolicy == "intersect":
+                merged.AddSet(a)
+                merged.Intersect(b)
+        case config.ConflictPolicy == "prefer-trusted" && listTrusted(existing) != listTrusted(added):
+                if listTrusted(existing) {
+                        merged.AddSet(a)
+                } else {
+                        merged.AddSet(b)
+                }
+        default:
+                merged.AddSet(a)
+                merged.AddSet(b)
+        }
+        set, err := merged.IPSet()
+        if err != nil {
+                return nil, err
+        }
+        return set.Prefixes(), nil
+}
+
+// mergeDomains то же для доменов
+func mergeDomains(existing, added *generatedList) []string {
+        a := make(map[string]bool, len(existing.Domains))
+        for _, domain := range existing.Domains {
+                a[domain] = true
+        }
+        b := make(map[string]bool, len(added.Domains))
+        onlyB := 0
+        for _, domain := range added.Domains {
+                b[domain] = true
+                if !a[domain] {
+                        onlyB++
+                }
+        }
+        onlyA := 0
+        for domain := range a {
+                if !b[domain] {
+                        onlyA++
+                }
+        }
+        if onlyA == 0 && onlyB == 0 {
+                return existing.Domains
+        }
+        log.Printf("Warning: sources of %s disagree: %d domains only in %s (%s), %d only in %s (%s); policy %s",
+                existing.Name, onlyA, listSource(existing), trustName(existing), onlyB, listSource(added), trustName(added), config.ConflictPolicy)
+
+        var merged []string
+        switch {
+        case config.ConflictPolicy == "intersect":
+                for _, domain := range existing.Domains {
+                        if b[domain] {
+                                merged = append(merged, domain)
+                        }
+                }
+        case config.ConflictPolicy == "prefer-trusted" && listTrusted(existing) != listTrusted(added):
+                if listTrusted(existing) {
+                        merged = existing.Domains
+                } else {
+                        merged = added.Domains
+                }
+        default:
+                // Общие домены источников не повторяются
+                merged = append([]string(nil), existing.Domains...)
+                for _, domain := range added.Domains {
+                        if !a[domain] {
+                                merged = append(merged, domain)
+                        }
+                }
+        }
+        return merged
+}
+
+func trustName(list *generatedList) string {
+        if listTrusted(list) {
+                return trustTrusted
+        }
+        return trustUntrusted
+}
+
+// mergeGeneratedList добавляет в existing данные ещё одного источника того же
+// списка. Если оба источника дали префиксы, .lst и RouterOS-скрипты, записанные
+// по отдельности, переписываются объединённым списком.
+func mergeGeneratedList(existing, added *generatedList) {
+        bothPrefixes := len(existing.Prefixes) > 0 && len(added.Prefixes) > 0
+        switch {
+        case bothPrefixes:
+                prefixes, err := mergePrefixes(existing, added)
+                if err != nil {
+                        log.Printf("Error merging sources of %s: %v", existing.Name, err)
+                        prefixes = append(existing.Prefixes, added.Prefixes...)
+                }
+                existing.Prefixes = prefixes
+        default:
+                existing.Prefixes = append(existing.Prefixes, added.Prefixes...)
+        }
+        if len(existing.Domains) > 0 && len(added.Domains) > 0 {
+                existing.Domains = mergeDomains(existing, added)
+        } else {
+                existing.Domains = append(existing.Domains, added.Domains...)
+        }
+        // Копии: Sources и Tags могут быть общими с bgpTableSources и конфигом
+        existing.Sources = append(append([]string(nil), existing.Sources...), added.Sources...)
+        existing.ASNs = append(append([]string(nil), existing.ASNs...), added.ASNs...)
+        existing.Tags = append(append([]string(nil), existing.Tags...), added.Tags...)
+        if listTrusted(added) {
+                existing.Trust = trustTrusted
+        }
+        existing.LegacyCopy = existing.LegacyCopy || added.LegacyCopy
+
+        if bothPrefixes {
+                writePrefixList(existing)
+        }
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+        "net/netip"
+        "reflect"
+        "testing"
+)
+
+func TestMergePolicies(t *testing.T) {
+        saved := config.ConflictPolicy
+        defer func() { config.ConflictPolicy = saved }()
+
+        official := func() *generatedList {
+                return &generatedList{Name: "telegram", Trust: trustTrusted, Sources: []string{"https://core.telegram.org/resources/cidr.txt"},
+                        Prefixes: []netip.Prefix{netip.MustParsePrefix("91.108.4.0/22"), netip.MustParsePrefix("149.154.160.0/20")},
+                        Domains:  []string{"t.me", "telegram.org"}}
+        }
+        community := func() *generatedList {
+                return &generatedList{Name: "telegram", Trust: trustUntrusted, Sources: []string{"https://example.com/telegram.lst"},
+                        Prefixes: []netip.Prefix{netip.MustParsePrefix("91.108.4.0/22"), netip.MustParsePrefix("95.161.64.0/20")},
+                        Domains:  []string{"t.me", "telegram.me"}}
+        }
+        tests := []struct {
+                name            string
+                policy          string
+                existing, added *generatedList
+                prefixes        []string
+                domains         []string
+        }{
+                {"union", "union", official(), community(), []string{"91.108.4.0/22", "95.161.64.0/20", "149.154.160.0/20"}, []string{"t.me", "telegram.org", "telegram.me"}},
+                {"intersect", "intersect", official(), community(), []string{"91.108.4.0/22"}, []string{"t.me"}},
+                {"prefer trusted existing", "prefer-trusted", official(), community(), []string{"91.108.4.0/22", "149.154.160.0/20"}, []string{"t.me", "telegram.org"}},
+                {"prefer trusted added", "prefer-trusted", community(), official(), []string{"91.108.4.0/22", "149.154.160.0/20"}, []string{"t.me", "telegram.org"}},
+                {"prefer trusted, same trust", "prefer-trusted", official(), func() *generatedList { l := community(); l.Trust = ""; return l }(),
+                        []string{"91.108.4.0/22", "95.161.64.0/20", "149.154.160.0/20"}, []string{"t.me", "telegram.org", "telegram.me"}},
+                {"sources agree", "intersect", official(), official(), []string{"91.108.4.0/22", "149.154.160.0/20"}, []string{"t.me", "telegram.org"}},
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        config.ConflictPolicy = tt.policy
+                        prefixes, err := mergePrefixes(tt.existing, tt.added)
+                        if err != nil {
+                                t.Fatal(err)
+                        }
+                        var got []string
+                        for _, prefix := range prefixes {
+                                got = append(got, prefix.String())
+                        }
+                        if !reflect.DeepEqual(got, tt.prefixes) {
+                                t.Errorf("mergePrefixes = %v, want %v", got, tt.prefixes)
+                        }
+
+                        if domains := mergeDomains(tt.existing, tt.added); !reflect.DeepEqual(domains, tt.domains) {
+                                t.Errorf("mergeDomains = %v, want %v", domains, tt.domains)
+                        }
+                })
+        }
+}
+
+func TestValidateTrust(t *testing.T) {
+        for _, trust := range []string{"", trustTrusted, trustUntrusted} {
+                if err := validateTrust("as_numbers.32934", trust); err != nil {
+                        t.Errorf("validateTrust(%q) = %v", trust, err)
+                }
+        }
+        if err := validateTrust("as_numbers.32934", "Trusted"); err == nil {
+                t.Error("validateTrust accepted an unknown value")
+        }
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+        "fmt"
+        "log"
+        "os"
+        "strings"
+        "sync/atomic"
+        "time"
+
+        tea "github.com/charmbracelet/bubbletea"
+        "github.com/mattn/go-isatty"
+)
+
+// Интерактивный статус запуска (--tui): этапы по источникам внизу экрана,
+// обычный лог печатается над ним
+
+// tuiMode включается флагом --tui
+var tuiMode bool
+
+type tuiDoneMsg struct{ diffs []listDiff }
+
+type tuiTickMsg time.Time
+
+type tuiModel struct {
+        start       time.Time
+        order       []string
+        status      map[string]progressEvent
+        diffs       []listDiff
+        done        bool
+        interrupted bool
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+        return tuiTick()
+}
+
+func tuiTick() tea.Cmd {
+        return tea.Tick(time.Second, func(t time.Time) tea.Msg { return tuiTickMsg(t) })
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+        switch msg := msg.(type) {
+        case progressEvent:
+                if _, ok := m.status[msg.Source]; !ok {
+                        m.order = append(m.order, msg.Source)
+                }
+                m.status[msg.Source] = msg
+        case tuiDoneMsg:
+                m.done = true
+                m.diffs = msg.diffs
+                return m, tea.Quit
+        case tuiTickMsg:
+                return m, tuiTick()
+        case tea.KeyMsg:
+                if msg.String() == "ctrl+c" {
+                        m.interrupted = true
+                        return m, tea.Quit
+                }
+        }
+        return m, nil
+}
+
+func (m *tuiModel) View() string {
+        var b strings.Builder
+        width := 0
+        for _, source := range m.order {
+                width = max(width, len(source))
+        }
+        for _, source := range m.order {
+                event := m.status[source]
+                mark := "…"
+                if event.Stage == "done" {
+                        mark = "✓"
+                }
+                fmt.Fprintf(&b, "%s %-*s  %-9s %s\n", mark, width, source, event.Stage, event.Detail)
+        }
+
+        if m.done {
+                b.WriteString("\n")
+                if len(m.diffs) == 0 {
+                        b.WriteString("No list changes\n")
+                }
+                for _, diff := range m.diffs {
+                        if diff.New {
+                                fmt.Fprintf(&b, "  %s: new list, %d prefixes\n", diff.Name, diff.Added)
+                        } else {
+                                fmt.Fprintf(&b, "  %s: +%d -%d\n", diff.Name, diff.Added, diff.Removed)
+                        }
+                }
+        }
+        fmt.Fprintf(&b, "\nElapsed %s\n", time.Since(m.start).Round(time.Second))
+        return b.String()
+}
+
+// tuiLogWriter выводит строки лога над статусом
+type tuiLogWriter struct{ program *tea.Program }
+
+func (w tuiLogWriter) Write(p []byte) (int, error) {
+        w.program.Println(strings.TrimRight(string(p), "\n"))
+        return len(p), nil
+}
+
+// isTerminal TUI имеет смысл только в интерактивном запуске, в cron остаются логи
+func isTerminal(file *os.File) bool {
+        return isatty.IsTerminal(file.Fd())
+}
+
+// runWithTUI выполняет pipeline в фоне, показывая его ход; прерывание
+// с клавиатуры завершает запуск так же, как сигнал
+func runWithTUI(pipeline func()) {
+        model := &tuiModel{start: time.Now(), status: make(map[string]progressEvent)}
+        program := tea.NewProgram(model)
+
+        progressHandler = func(event progressEvent) { program.Send(event) }
+        logOutput := log.Writer()
+        log.SetOutput(tuiLogWriter{program})
+        var aborted atomic.Bool
+        exitHook = func() {
+                aborted.Store(true)
+                program.Quit()
+                program.Wait()
+                log.SetOutput(logOutput)
+        }
+
+        go func() {
+                pipeline()
+                program.Send(tuiDoneMsg{generatedListDiffs()})
+        }()
+
+        _, err := program.Run()
+        if aborted.Load() {
+                // Запуск завершается из fatal в другой горутине
+                select {}
+        }
+        progressHandler = nil
+        exitHook = nil
+        log.SetOutput(logOutput)
+        if err != nil {
+                fatal("Error running TUI:", err)
+        }
+        if model.interrupted {
+                fatal("Interrupted")
+        }
+}
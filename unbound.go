@@ -0,0 +1,52 @@
+package main
+
+import (
+        "fmt"
+        "strings"
+)
+
+// UnboundConfig forward-zone (и при желании local-zone) для доменных списков,
+// чтобы направлять резолв доменов сервиса на отдельный резолвер
+type UnboundConfig struct {
+        OutputConfig  `yaml:",inline"`
+        ForwardAddrs  []string `yaml:"forward_addrs"`   // Резолверы для forward-addr; можно с @порт и #имя для TLS
+        ForwardTLS    bool     `yaml:"forward_tls"`     // forward-tls-upstream: yes
+        LocalZoneType string   `yaml:"local_zone_type"` // Дополнительно local-zone этого типа, например transparent или always_nxdomain
+}
+
+func unboundZones(list *generatedList) []string {
+        lines := []string{"# " + list.Comment, "server:"}
+        var forwards []string
+        seen := make(map[string]bool)
+        for _, domain := range list.Domains {
+                zone := strings.TrimSuffix(trimDomainDot(domain), ".") + "."
+                if seen[zone] {
+                        continue
+                }
+                seen[zone] = true
+                if config.Unbound.LocalZoneType != "" {
+                        lines = append(lines, fmt.Sprintf("    local-zone: %q %s", zone, config.Unbound.LocalZoneType))
+                }
+                if len(config.Unbound.ForwardAddrs) == 0 {
+                        continue
+                }
+                forwards = append(forwards, "", "forward-zone:", fmt.Sprintf("    name: %q", zone))
+                for _, addr := range config.Unbound.ForwardAddrs {
+                        forwards = append(forwards, "    forward-addr: "+addr)
+                }
+                if config.Unbound.ForwardTLS {
+                        forwards = append(forwards, "    forward-tls-upstream: yes")
+                }
+        }
+        if len(lines) == 2 {
+                lines = lines[:1]
+        }
+        return append(lines, forwards...)
+}
+
+func generateUnboundConfig(list *generatedList) error {
+        if len(list.Domains) == 0 {
+                return nil
+        }
+        return writeOutputLines(layoutDir("unbound", list.Name, config.Unbound.Dir), list.Name+".conf", unboundZones(list))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+        "fmt"
+        "os"
+        "path/filepath"
+        "strings"
+)
+
+// VyOSConfig команды VyOS: статические маршруты или policy route через
+// network-group, завёрнутые в скрипт vbash с configure/commit/save
+type VyOSConfig struct {
+        OutputConfig `yaml:",inline"`
+        Mode         string `yaml:"mode"`        // static (по умолчанию) или policy
+        NextHop      string `yaml:"next_hop"`    // По умолчанию общий gateway
+        NextHopV6    string `yaml:"next_hop_v6"` // Без него IPv6-маршруты не пишутся
+        Table        int    `yaml:"table"`       // Таблица маршрутизации для policy
+        Interface    string `yaml:"interface"`   // Входящий интерфейс для policy route
+}
+
+func vyosCommands(list *generatedList) ([]string, error) {
+        name := identifierName(list.ListName)
+        var commands []string
+
+        switch config.VyOS.Mode {
+        case "", "static":
+                for _, prefix := range list.Prefixes {
+                        if prefix.Addr().Is4() {
+                                commands = append(commands, fmt.Sprintf("set protocols static route %s next-hop %s", prefix, config.VyOS.NextHop))
+                        } else if config.VyOS.NextHopV6 != "" {
+                                commands = append(commands, fmt.Sprintf("set protocols static route6 %s next-hop %s", prefix, config.VyOS.NextHopV6))
+                        }
+                }
+        case "policy":
+                if config.VyOS.Table == 0 {
+                        return nil, fmt.Errorf("vyos.table is required for policy mode")
+                }
+                for _, prefix := range list.Prefixes {
+                        if prefix.Addr().Is4() {
+                                commands = append(commands, fmt.Sprintf("set firewall group network-group %s network %s", name, prefix))
+                        }
+                }
+                if len(commands) == 0 {
+                        return nil, nil
+                }
+                commands = append(commands,
+                        fmt.Sprintf("set policy route %s rule 10 destination group network-group %s", name, name),
+                        fmt.Sprintf("set policy route %s rule 10 set table %d", name, config.VyOS.Table),
+                )
+                if config.VyOS.Interface != "" {
+                        commands = append(commands, fmt.Sprintf("set policy route %s interface %s", name, config.VyOS.Interface))
+                }
+        default:
+                return nil, fmt.Errorf("unknown vyos.mode %q", config.VyOS.Mode)
+        }
+        return commands, nil
+}
+
+func generateVyOSScript(list *generatedList) error {
+        commands, err := vyosCommands(list)
+        if err != nil || len(commands) == 0 {
+                return err
+        }
+        return writeVbashScript(layoutDir("vyos", list.Name, config.VyOS.Dir), list.Name, commands)
+}
+
+// writeVbashScript скрипт для vbash (VyOS, EdgeOS): команды между configure и commit/save
+func writeVbashScript(dir, name string, commands []string) error {
+        var b strings.Builder
+        b.WriteString("#!/bin/vbash\nsource /opt/vyatta/etc/functions/script-template\nconfigure\n")
+        for _, command := range commands {
+                b.WriteString(command + "\n")
+        }
+        b.WriteString("commit\nsave\nexit\n")
+
+        if err := os.MkdirAll(dir, 0755); err != nil {
+                return err
+        }
+        path := filepath.Join(dir, name+".sh")
+        if err := writeFileStaged(path, []byte(b.String())); err != nil {
+                return err
+        }
+        return os.Chmod(path, 0755)
+}
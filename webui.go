@@ -0,0 +1,414 @@
+package main
+
+import (
+        "bytes"
+        "crypto/subtle"
+        "fmt"
+        "html/template"
+        "log"
+        "net/http"
+        "net/url"
+        "os"
+        "sort"
+        "sync"
+        "time"
+
+        "gopkg.in/yaml.v3"
+)
+
+// WebUIConfig страница управления в serve: состояние списков и источников,
+// ручной запуск и выбор пресетов без правки конфига по SSH
+type WebUIConfig struct {
+        Enabled  bool          `yaml:"enabled"`
+        User     string        `yaml:"user"`
+        Password string        `yaml:"password"`
+        Interval time.Duration `yaml:"interval"` // Запуск по расписанию; 0 - только вручную
+}
+
+// uiSource результат источника или списка в последнем запуске
+type uiSource struct {
+        Name  string
+        Error string
+        At    time.Time
+}
+
+// webUI состояние для страницы; запуски идут через Runner по одному.
+// Настройки копируются при старте: Runner перечитывает глобальный config.
+type webUI struct {
+        configPath string
+        settings   WebUIConfig
+        runner     *Runner
+        afterRun   func() // Перестроить то, что сервер взял из config
+
+        mu       sync.Mutex
+        running  bool
+        started  time.Time
+        finished time.Time
+        runError string
+        lists    []ListResult
+        diffs    map[string]listDiff
+        sources  map[string]uiSource
+        notice   string
+}
+
+func newWebUI(configPath string, settings WebUIConfig, afterRun func()) *webUI {
+        ui := &webUI{configPath: configPath, settings: settings, afterRun: afterRun, diffs: make(map[string]listDiff), sources: make(map[string]uiSource)}
+        ui.runner = NewRunner(RunnerOptions{
+                ConfigFile: configPath,
+                OnSourceDone: func(source string, err error) {
+                        entry := uiSource{Name: source, At: time.Now()}
+                        if err != nil {
+                                entry.Error = err.Error()
+                        }
+                        ui.mu.Lock()
+                        ui.sources[source] = entry
+                        ui.mu.Unlock()
+                },
+        })
+
+        // До первого запуска показываем уже опубликованные списки
+        if lists, err := loadPublishedLists(); err == nil {
+                for _, list := range lists {
+                        ui.lists = append(ui.lists, newListResult(list))
+                }
+        }
+        return ui
+}
+
+// startRun запускает сборку в фоне; false, если она уже идёт
+func (ui *webUI) startRun() bool {
+        ui.mu.Lock()
+        if ui.running {
+                ui.mu.Unlock()
+                return false
+        }
+        ui.running, ui.started = true, time.Now()
+        ui.sources = make(map[string]uiSource)
+        ui.mu.Unlock()
+
+        go func() {
+                result, err := ui.runner.Run()
+                // Без результата конфиг не загрузился: сервер остаётся со старыми настройками
+                if result != nil && ui.afterRun != nil {
+                        ui.afterRun()
+                }
+                ui.mu.Lock()
+                defer ui.mu.Unlock()
+                ui.running, ui.finished, ui.runError = false, time.Now(), ""
+                if err != nil {
+                        ui.runError = err.Error()
+                        log.Printf("Web UI run failed: %v", err)
+                }
+                if result != nil {
+                        ui.lists = result.Lists
+                        ui.diffs = make(map[string]listDiff)
+                        for _, diff := range result.Diffs {
+                                ui.diffs[diff.Name] = diff
+                        }
+                }
+        }()
+        return true
+}
+
+// schedule запускает сборку каждые interval
+func (ui *webUI) schedule(interval time.Duration) {
+        for range time.Tick(interval) {
+                if !ui.startRun() {
+                        log.Printf("Web UI: previous run still in progress, skipping scheduled run")
+                }
+        }
+}
+
+// authorized проверяет Basic-авторизацию; POST принимается только со своей
+// страницы, чтобы чужой сайт не мог запустить сборку от имени браузера
+func (ui *webUI) authorized(w http.ResponseWriter, r *http.Request) bool {
+        user, password, ok := r.BasicAuth()
+        if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(ui.settings.User)) != 1 ||
+                subtle.ConstantTimeCompare([]byte(password), []byte(ui.settings.Password)) != 1 {
+                w.Header().Set("WWW-Authenticate", `Basic realm="allow-domains"`)
+                http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+                return false
+        }
+        if r.Method == http.MethodPost {
+                if origin := r.Header.Get("Origin"); origin != "" {
+                        if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+                                http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+                                return false
+                        }
+                }
+        }
+        return true
+}
+
+// presetSections разбирает фрагменты пресета в пары ключ-значение по секциям
+func presetSections(p preset) (map[string][]*yaml.Node, error) {
+        sections := make(map[string][]*yaml.Node)
+        for section, body := range p.Sections {
+                var doc yaml.Node
+                if err := yaml.Unmarshal([]byte(body), &doc); err != nil {
+                        return nil, fmt.Errorf("%s: %w", section, err)
+                }
+                if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+                        return nil, fmt.Errorf("%s: not a mapping", section)
+                }
+                sections[section] = doc.Content[0].Content
+        }
+        return sections, nil
+}
+
+func mappingIndex(node *yaml.Node, key string) int {
+        for i := 0; i+1 < len(node.Content); i += 2 {
+                if node.Content[i].Value == key {
+                        return i
+                }
+        }
+        return -1
+}
+
+// presetEnabled включён ли пресет: все его ключи есть в своих секциях конфига
+func presetEnabled(root *yaml.Node, p preset) bool {
+        sections, err := presetSections(p)
+        if err != nil {
+                return false
+        }
+        for section, pairs := range sections {
+                node := configMapping(root, []string{section})
+                if node == nil {
+                        return false
+                }
+                for i := 0; i+1 < len(pairs); i += 2 {
+                        if mappingIndex(node, pairs[i].Value) < 0 {
+                                return false
+                        }
+                }
+        }
+        return true
+}
+
+// setPreset добавляет ключи пресета в секции конфига или убирает их;
+// опустевшая секция удаляется целиком
+func setPreset(root *yaml.Node, p preset, enabled bool) error {
+        sections, err := presetSections(p)
+        if err != nil {
+                return err
+        }
+        for section, pairs := range sections {
+                i := mappingIndex(root, section)
+                if i < 0 {
+                        if !enabled {
+                                continue
+                        }
+                        root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: section}, &yaml.Node{Kind: yaml.MappingNode})
+                        i = len(root.Content) - 2
+                }
+                node := root.Content[i+1]
+                if node.Kind != yaml.MappingNode {
+                        // Пустая секция вида "domains:" без значений
+                        node = &yaml.Node{Kind: yaml.MappingNode}
+                        root.Content[i+1] = node
+                }
+
+                for j := 0; j+1 < len(pairs); j += 2 {
+                        k := mappingIndex(node, pairs[j].Value)
+                        switch {
+                        case enabled && k >= 0:
+                                node.Content[k+1] = pairs[j+1]
+                        case enabled:
+                                node.Content = append(node.Content, pairs[j], pairs[j+1])
+                        case k >= 0:
+                                node.Content = append(node.Content[:k], node.Content[k+2:]...)
+                        }
+                }
+                if len(node.Content) == 0 {
+                        root.Content = append(root.Content[:i], root.Content[i+2:]...)
+                }
+        }
+        return nil
+}
+
+// readConfigNode читает конфиг как документ YAML, чтобы править его с комментариями
+func readConfigNode(path string) (*yaml.Node, error) {
+        data, err := os.ReadFile(path)
+        if err != nil {
+                return nil, err
+        }
+        var doc yaml.Node
+        if err := yaml.Unmarshal(data, &doc); err != nil {
+                return nil, err
+        }
+        if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+                return nil, fmt.Errorf("%s: not a mapping", path)
+        }
+        return &doc, nil
+}
+
+// applyPresets включает выбранные пресеты и выключает остальные; конфиг
+// проверяется до записи, прежняя версия остаётся в .bak
+func (ui *webUI) applyPresets(selected map[string]bool) error {
+        doc, err := readConfigNode(ui.configPath)
+        if err != nil {
+                return err
+        }
+        root := doc.Content[0]
+        for _, name := range presetNames() {
+                if presetEnabled(root, presets[name]) == selected[name] {
+                        continue
+                }
+                if err := setPreset(root, presets[name], selected[name]); err != nil {
+                        return fmt.Errorf("preset %s: %w", name, err)
+                }
+        }
+
+        var buf bytes.Buffer
+        encoder := yaml.NewEncoder(&buf)
+        encoder.SetIndent(2)
+        if err := encoder.Encode(doc); err != nil {
+                return err
+        }
+        if err := decodeConfig(buf.Bytes(), &Config{}); err != nil {
+                return fmt.Errorf("resulting config is invalid: %w", err)
+        }
+
+        info, err := os.Stat(ui.configPath)
+        if err != nil {
+                return err
+        }
+        if err := copyFile(ui.configPath, ui.configPath+".bak"); err != nil {
+                return err
+        }
+        return os.WriteFile(ui.configPath, buf.Bytes(), info.Mode().Perm())
+}
+
+type uiListRow struct {
+        ListResult
+        IPv4, IPv6 int
+        Diff       *listDiff
+}
+
+type uiPresetRow struct {
+        Name, Description string
+        Enabled           bool
+}
+
+func (ui *webUI) page(w http.ResponseWriter) {
+        ui.mu.Lock()
+        data := struct {
+                Running           bool
+                Started, Finished time.Time
+                Error, Notice     string
+                Lists             []uiListRow
+                Sources           []uiSource
+                Presets           []uiPresetRow
+        }{Running: ui.running, Started: ui.started, Finished: ui.finished, Error: ui.runError, Notice: ui.notice}
+        for _, list := range ui.lists {
+                row := uiListRow{ListResult: list}
+                for _, prefix := range list.Prefixes {
+                        if prefix.Addr().Is4() {
+                                row.IPv4++
+                        } else {
+                                row.IPv6++
+                        }
+                }
+                if diff, ok := ui.diffs[list.Name]; ok {
+                        row.Diff = &diff
+                }
+                data.Lists = append(data.Lists, row)
+        }
+        for _, source := range ui.sources {
+                data.Sources = append(data.Sources, source)
+        }
+        ui.notice = ""
+        ui.mu.Unlock()
+
+        sort.Slice(data.Sources, func(i, j int) bool { return data.Sources[i].Name < data.Sources[j].Name })
+        if doc, err := readConfigNode(ui.configPath); err == nil {
+                for _, name := range presetNames() {
+                        data.Presets = append(data.Presets, uiPresetRow{name, presets[name].Description, presetEnabled(doc.Content[0], presets[name])})
+                }
+        }
+
+        w.Header().Set("Content-Type", "text/html; charset=utf-8")
+        if err := uiTemplate.Execute(w, data); err != nil {
+                log.Printf("Error rendering web UI: %v", err)
+        }
+}
+
+func (ui *webUI) setNotice(notice string) {
+        ui.mu.Lock()
+        ui.notice = notice
+        ui.mu.Unlock()
+}
+
+func (ui *webUI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+        if !ui.authorized(w, r) {
+                return
+        }
+        switch {
+        case r.URL.Path == "/ui/" && r.Method == http.MethodGet:
+                ui.page(w)
+                return
+        case r.URL.Path == "/ui/run" && r.Method == http.MethodPost:
+                if !ui.startRun() {
+                        ui.setNotice("Run is already in progress")
+                }
+        case r.URL.Path == "/ui/presets" && r.Method == http.MethodPost:
+                if err := r.ParseForm(); err != nil {
+                        http.Error(w, err.Error(), http.StatusBadRequest)
+                        return
+                }
+                selected := make(map[string]bool)
+                for _, name := range r.PostForm["preset"] {
+                        selected[name] = true
+                }
+                if err := ui.applyPresets(selected); err != nil {
+                        log.Printf("Error updating presets: %v", err)
+                        ui.setNotice("Error updating presets: " + err.Error())
+                } else {
+                        ui.setNotice("Presets saved, they apply from the next run")
+                }
+        default:
+                http.NotFound(w, r)
+                return
+        }
+        http.Redirect(w, r, "/ui/", http.StatusSeeOther)
+}
+
+var uiTemplate = template.Must(template.New("ui").Funcs(template.FuncMap{
+        "since": func(t time.Time) string { return time.Since(t).Round(time.Second).String() },
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>allow-domains</title>
+{{if .Running}}<meta http-equiv="refresh" content="5">{{end}}
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.error { color: #b00; }
+.notice { background: #ffd; padding: 8px; }
+</style></head><body>
+<h1>allow-domains</h1>
+{{with .Notice}}<p class="notice">{{.}}</p>{{end}}
+<form method="post" action="/ui/run">
+{{if .Running}}<p>Running for {{since .Started}}…</p>
+{{else}}<p>{{if .Finished.IsZero}}No runs since start.{{else}}Last run finished {{since .Finished}} ago.{{end}}
+<button type="submit">Run now</button></p>{{end}}
+</form>
+{{with .Error}}<p class="error">{{.}}</p>{{end}}
+
+<h2>Lists</h2>
+<table><tr><th>List</th><th>Address list</th><th>IPv4</th><th>IPv6</th><th>Domains</th><th>Changes</th></tr>
+{{range .Lists}}<tr><td>{{.Name}}</td><td>{{.ListName}}</td><td>{{.IPv4}}</td><td>{{.IPv6}}</td><td>{{len .Domains}}</td>
+<td>{{with .Diff}}{{if .New}}new{{else}}+{{.Added}} −{{.Removed}}{{end}}{{end}}</td></tr>
+{{end}}</table>
+
+<h2>Sources</h2>
+{{if .Sources}}<table><tr><th>Source</th><th>Status</th><th>At</th></tr>
+{{range .Sources}}<tr><td>{{.Name}}</td><td>{{if .Error}}<span class="error">{{.Error}}</span>{{else}}ok{{end}}</td><td>{{.At.Format "15:04:05"}}</td></tr>
+{{end}}</table>{{else}}<p>No data until the first run.</p>{{end}}
+
+<h2>Presets</h2>
+<form method="post" action="/ui/presets">
+{{range .Presets}}<label><input type="checkbox" name="preset" value="{{.Name}}"{{if .Enabled}} checked{{end}}> <b>{{.Name}}</b> {{.Description}}</label><br>
+{{end}}<p><button type="submit">Save</button></p>
+</form>
+</body></html>
+`))
@@ -0,0 +1,83 @@
+package main
+
+import (
+        "fmt"
+        "net"
+        "os"
+        "path/filepath"
+        "strings"
+)
+
+// WindowsConfig скрипты маршрутов для раздельной маршрутизации прямо на ПК с Windows
+type WindowsConfig struct {
+        OutputConfig `yaml:",inline"`
+        Gateway      string `yaml:"gateway"`   // По умолчанию общий gateway
+        Metric       int    `yaml:"metric"`    // Метрика маршрутов
+        Interface    string `yaml:"interface"` // InterfaceAlias для New-NetRoute; пусто - интерфейс, через который виден gateway
+}
+
+func windowsPrefixMask(bits int) string {
+        return net.IP(net.CIDRMask(bits, 32)).String()
+}
+
+func windowsRouteBatch(list *generatedList) []string {
+        lines := []string{"@echo off", "rem " + list.Comment}
+        for _, prefix := range list.Prefixes {
+                if !prefix.Addr().Is4() {
+                        continue
+                }
+                lines = append(lines, fmt.Sprintf("route add %s mask %s %s metric %d -p",
+                        prefix.Addr(), windowsPrefixMask(prefix.Bits()), config.Windows.Gateway, config.Windows.Metric))
+        }
+        return lines
+}
+
+func windowsRoutePowerShell(list *generatedList) []string {
+        lines := []string{"# " + list.Comment, "$ErrorActionPreference = 'Continue'"}
+        if config.Windows.Interface != "" {
+                lines = append(lines, fmt.Sprintf("$ifIndex = (Get-NetAdapter -Name '%s').ifIndex", strings.ReplaceAll(config.Windows.Interface, "'", "''")))
+        } else {
+                lines = append(lines, fmt.Sprintf("$ifIndex = (Find-NetRoute -RemoteIPAddress '%s' | Select-Object -First 1).InterfaceIndex", config.Windows.Gateway))
+        }
+        lines = append(lines, "$prefixes = @(")
+        for _, prefix := range list.Prefixes {
+                if prefix.Addr().Is4() {
+                        lines = append(lines, fmt.Sprintf("    '%s'", prefix))
+                }
+        }
+        lines = append(lines,
+                ")",
+                "foreach ($prefix in $prefixes) {",
+                fmt.Sprintf("    New-NetRoute -DestinationPrefix $prefix -InterfaceIndex $ifIndex -NextHop '%s' -RouteMetric %d -PolicyStore PersistentStore -ErrorAction SilentlyContinue | Out-Null",
+                        config.Windows.Gateway, config.Windows.Metric),
+                "}",
+        )
+        return lines
+}
+
+// writeWindowsScript пишет файл с переводами строк CRLF, как ждёт cmd.exe
+func writeWindowsScript(dir, filename string, lines []string) error {
+        if err := os.MkdirAll(dir, 0755); err != nil {
+                return err
+        }
+        return writeFileStaged(filepath.Join(dir, filename), []byte(strings.Join(lines, "\r\n")+"\r\n"))
+}
+
+func generateWindowsRoutes(list *generatedList) error {
+        hasV4 := false
+        for _, prefix := range list.Prefixes {
+                if prefix.Addr().Is4() {
+                        hasV4 = true
+                        break
+                }
+        }
+        if !hasV4 {
+                return nil
+        }
+
+        dir := layoutDir("windows", list.Name, config.Windows.Dir)
+        if err := writeWindowsScript(dir, list.Name+".bat", windowsRouteBatch(list)); err != nil {
+                return err
+        }
+        return writeWindowsScript(dir, list.Name+".ps1", windowsRoutePowerShell(list))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+        "fmt"
+        "log"
+        "net"
+        "net/netip"
+        "strings"
+
+        "go4.org/netipx"
+)
+
+// WireGuardConfig значение AllowedIPs и шаблон [Peer] для клиентов WireGuard
+type WireGuardConfig struct {
+        OutputConfig        `yaml:",inline"`
+        Peers               map[string][]string `yaml:"peers"`   // Имя файла пира -> списки (пусто - все)
+        Inverse             bool                `yaml:"inverse"` // AllowedIPs - всё, кроме адресов списков
+        Exclude             []string            `yaml:"exclude"` // В inverse вычитаются дополнительно, например локальные сети
+        PublicKey           string              `yaml:"public_key"`
+        Endpoint            string              `yaml:"endpoint"`
+        PersistentKeepalive int                 `yaml:"persistent_keepalive"`
+}
+
+// wireGuardAllowedIPs префиксы списков или, в inverse, их дополнение до
+// 0.0.0.0/0 (и ::/0, если в списках есть IPv6) без адреса endpoint
+func wireGuardAllowedIPs(prefixes []netip.Prefix) ([]netip.Prefix, error) {
+        var builder netipx.IPSetBuilder
+        if !config.WireGuard.Inverse {
+                for _, prefix := range prefixes {
+                        builder.AddPrefix(prefix)
+                }
+                set, err := builder.IPSet()
+                if err != nil {
+                        return nil, err
+                }
+                return set.Prefixes(), nil
+        }
+
+        builder.AddPrefix(netip.MustParsePrefix("0.0.0.0/0"))
+        for _, prefix := range prefixes {
+                if prefix.Addr().Is6() {
+                        builder.AddPrefix(netip.MustParsePrefix("::/0"))
+                        break
+                }
+        }
+        for _, prefix := range prefixes {
+                builder.RemovePrefix(prefix)
+        }
+        for _, entry := range config.WireGuard.Exclude {
+                prefix, err := netipx.ParsePrefixOrAddr(entry)
+                if err != nil {
+                        log.Printf("Invalid wireguard.exclude entry %q: %v", entry, err)
+                        continue
+                }
+                builder.RemovePrefix(prefix)
+        }
+        // Иначе трафик к самому серверу уйдёт в туннель
+        if host, _, err := net.SplitHostPort(config.WireGuard.Endpoint); err == nil {
+                if addr, err := netip.ParseAddr(host); err == nil {
+                        builder.Remove(addr)
+                }
+        }
+
+        set, err := builder.IPSet()
+        if err != nil {
+                return nil, err
+        }
+        return set.Prefixes(), nil
+}
+
+func wireGuardPeer(comment string, allowed []netip.Prefix) []string {
+        entries := make([]string, 0, len(allowed))
+        for _, prefix := range allowed {
+                entries = append(entries, prefix.String())
+        }
+
+        publicKey := config.WireGuard.PublicKey
+        if publicKey == "" {
+                publicKey = "<server public key>"
+        }
+        lines := []string{"[Peer]", "# " + comment, "PublicKey = " + publicKey}
+        if config.WireGuard.Endpoint != "" {
+                lines = append(lines, "Endpoint = "+config.WireGuard.Endpoint)
+        }
+        lines = append(lines, "AllowedIPs = "+strings.Join(entries, ", "))
+        if config.WireGuard.PersistentKeepalive > 0 {
+                lines = append(lines, fmt.Sprintf("PersistentKeepalive = %d", config.WireGuard.PersistentKeepalive))
+        }
+        return lines
+}
+
+// writeWireGuardPeer пишет <name>.txt с одной строкой AllowedIPs и <name>.conf с шаблоном [Peer]
+func writeWireGuardPeer(name, comment string, prefixes []netip.Prefix) error {
+        allowed, err := wireGuardAllowedIPs(prefixes)
+        if err != nil {
+                return err
+        }
+        if len(allowed) == 0 {
+                return nil
+        }
+        dir := layoutDir("wireguard", name, config.WireGuard.Dir)
+        peer := wireGuardPeer(comment, allowed)
+        if err := writeOutputLines(dir, name+".txt", []string{strings.TrimPrefix(peer[len(peer)-1], "AllowedIPs = ")}); err != nil {
+                return err
+        }
+        return writeOutputLines(dir, name+".conf", peer)
+}
+
+func generateWireGuardPeer(list *generatedList) error {
+        if len(list.Prefixes) == 0 {
+                return nil
+        }
+        return writeWireGuardPeer(list.Name, list.Comment, list.Prefixes)
+}
+
+// generateWireGuardPeers пишет пиров из peers, объединяя выбранные списки
+func generateWireGuardPeers(lists []*generatedList) error {
+        for peer, names := range config.WireGuard.Peers {
+                var prefixes []netip.Prefix
+                var comments []string
+                for _, list := range lists {
+                        if len(list.Prefixes) == 0 || len(names) > 0 && !listSelectedByName(names, list) {
+                                continue
+                        }
+                        prefixes = append(prefixes, list.Prefixes...)
+                        comments = append(comments, list.Comment)
+                }
+                if err := writeWireGuardPeer(peer, strings.Join(comments, ", "), prefixes); err != nil {
+                        return fmt.Errorf("%s: %w", peer, err)
+                }
+        }
+        return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+        "fmt"
+        "io"
+        "log"
+        "os"
+        "os/signal"
+        "path/filepath"
+        "sync"
+        "syscall"
+)
+
+// workspace временный каталог текущего запуска: загрузки и недописанные
+// файлы живут здесь и переносятся в выходные каталоги только целиком
+var workspace string
+
+// keepWorkdir оставляет каталог запуска после завершения для отладки
+var keepWorkdir bool
+
+func initWorkspace() error {
+        dir, err := os.MkdirTemp(config.WorkDir, "get_subnets-")
+        if err != nil {
+                return err
+        }
+        workspace = dir
+
+        // Runner может создавать каталог запуска много раз за процесс
+        signalOnce.Do(func() {
+                signals := make(chan os.Signal, 1)
+                signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+                go func() {
+                        sig := <-signals
+                        if exitHook != nil {
+                                exitHook()
+                        }
+                        log.Printf("Received %s, exiting", sig)
+                        cleanupWorkspace()
+                        os.Exit(1)
+                }()
+        })
+
+        return nil
+}
+
+var signalOnce sync.Once
+
+func cleanupWorkspace() {
+        if workspace == "" {
+                return
+        }
+        if keepWorkdir {
+                log.Printf("Keeping work dir %s", workspace)
+                return
+        }
+        if err := os.RemoveAll(workspace); err != nil {
+                log.Printf("Error removing work dir: %v", err)
+        }
+        workspace = ""
+}
+
+// exitHook вызывается перед аварийным завершением (например, чтобы вернуть терминал после TUI)
+var exitHook func()
+
+// fatalPanics запуск встроен через Runner: fatal паникует с fatalError,
+// а Run превращает её в ошибку вместо выхода из процесса
+var fatalPanics bool
+
+type fatalError struct{ msg string }
+
+func (e fatalError) Error() string { return e.msg }
+
+// fatal завершает запуск как log.Fatal, но сначала убирает каталог запуска
+func fatal(v ...any) {
+        if exitHook != nil {
+                exitHook()
+        }
+        if fatalPanics {
+                log.Print(v...)
+                panic(fatalError{fmt.Sprint(v...)})
+        }
+        log.Print(v...)
+        cleanupWorkspace()
+        os.Exit(1)
+}
+
+// stagedFile файл, который пишется в каталог запуска и появляется по
+// назначению только после Commit
+type stagedFile struct {
+        *os.File
+        dest string
+        done bool
+}
+
+func createStaged(dest string) (*stagedFile, error) {
+        dir := workspace
+        if dir == "" {
+                dir = filepath.Dir(dest)
+        }
+
+        file, err := os.CreateTemp(dir, "stage-*")
+        if err != nil {
+                return nil, err
+        }
+        return &stagedFile{File: file, dest: dest}, nil
+}
+
+// Commit закрывает файл и переносит его на место назначения
+func (f *stagedFile) Commit() error {
+        f.done = true
+        recordRenderedFile(f.dest)
+        if err := f.File.Close(); err != nil {
+                os.Remove(f.Name())
+                return err
+        }
+        if err := os.Chmod(f.Name(), 0644); err != nil {
+                os.Remove(f.Name())
+                return err
+        }
+
+        err := placeFile(f.Name(), f.dest)
+        os.Remove(f.Name())
+        return err
+}
+
+// Abort удаляет незавершённый файл; после Commit ничего не делает
+func (f *stagedFile) Abort() {
+        if f.done {
+                return
+        }
+        f.done = true
+        f.File.Close()
+        os.Remove(f.Name())
+}
+
+func copyFile(src, dest string) error {
+        in, err := os.Open(src)
+        if err != nil {
+                return err
+        }
+        defer in.Close()
+
+        out, err := os.Create(dest)
+        if err != nil {
+                return err
+        }
+        if _, err := io.Copy(out, in); err != nil {
+                out.Close()
+                return fmt.Errorf("copying to %s: %w", dest, err)
+        }
+        // На NFS ошибки записи иногда видны только при sync/close
+        if err := out.Sync(); err != nil {
+                out.Close()
+                return fmt.Errorf("copying to %s: %w", dest, err)
+        }
+        return out.Close()
+}
+
+// writeFileStaged аналог os.WriteFile через каталог запуска
+func writeFileStaged(filename string, data []byte) error {
+        file, err := createStaged(filename)
+        if err != nil {
+                return err
+        }
+        defer file.Abort()
+
+        if _, err := file.Write(data); err != nil {
+                return err
+        }
+        return file.Commit()
+}
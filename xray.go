@@ -0,0 +1,118 @@
+package main
+
+import (
+        "encoding/binary"
+        "os"
+        "path/filepath"
+        "sort"
+        "strings"
+)
+
+// XrayConfig настройки вывода .dat-файлов для Xray/v2ray
+type XrayConfig struct {
+        Dir         string `yaml:"dir"`
+        GeoIP       bool   `yaml:"geoip"`
+        GeoIPFile   string `yaml:"geoip_file"`
+        GeoSite     bool   `yaml:"geosite"`
+        GeoSiteFile string `yaml:"geosite_file"`
+}
+
+// Минимальный кодировщик protobuf для сообщений router/config.proto
+
+const (
+        protoVarint = 0
+        protoBytes  = 2
+)
+
+func protoAppendTag(buf []byte, field int, wireType int) []byte {
+        return binary.AppendUvarint(buf, uint64(field<<3|wireType))
+}
+
+func protoAppendVarint(buf []byte, field int, v uint64) []byte {
+        buf = protoAppendTag(buf, field, protoVarint)
+        return binary.AppendUvarint(buf, v)
+}
+
+func protoAppendBytes(buf []byte, field int, data []byte) []byte {
+        buf = protoAppendTag(buf, field, protoBytes)
+        buf = binary.AppendUvarint(buf, uint64(len(data)))
+        return append(buf, data...)
+}
+
+// xrayCategory имя категории для geoip:/geosite: по имени списка
+func xrayCategory(list *generatedList) string {
+        return strings.ToUpper(list.Name)
+}
+
+// encodeGeoIP собирает GeoIPList { repeated GeoIP entry = 1 }, где
+// GeoIP { string country_code = 1; repeated CIDR cidr = 2 } и
+// CIDR { bytes ip = 1; uint32 prefix = 2 }
+func encodeGeoIP(lists []*generatedList) []byte {
+        sorted := make([]*generatedList, 0, len(lists))
+        for _, list := range lists {
+                if len(list.Prefixes) > 0 {
+                        sorted = append(sorted, list)
+                }
+        }
+        sort.Slice(sorted, func(i, j int) bool {
+                return xrayCategory(sorted[i]) < xrayCategory(sorted[j])
+        })
+
+        var out []byte
+        for _, list := range sorted {
+                entry := protoAppendBytes(nil, 1, []byte(xrayCategory(list)))
+                for _, prefix := range list.Prefixes {
+                        var cidr []byte
+                        cidr = protoAppendBytes(cidr, 1, prefix.Masked().Addr().AsSlice())
+                        cidr = protoAppendVarint(cidr, 2, uint64(prefix.Bits()))
+                        entry = protoAppendBytes(entry, 2, cidr)
+                }
+                out = protoAppendBytes(out, 1, entry)
+        }
+        return out
+}
+
+// Тип Domain.Type = Domain: совпадение с доменом и всеми поддоменами
+const geoSiteTypeDomain = 2
+
+// encodeGeoSite собирает GeoSiteList { repeated GeoSite entry = 1 }, где
+// GeoSite { string country_code = 1; repeated Domain domain = 2 } и
+// Domain { Type type = 1; string value = 2 }
+func encodeGeoSite(lists []*generatedList) []byte {
+        sorted := make([]*generatedList, 0, len(lists))
+        for _, list := range lists {
+                if len(list.Domains) > 0 {
+                        sorted = append(sorted, list)
+                }
+        }
+        sort.Slice(sorted, func(i, j int) bool {
+                return xrayCategory(sorted[i]) < xrayCategory(sorted[j])
+        })
+
+        var out []byte
+        for _, list := range sorted {
+                entry := protoAppendBytes(nil, 1, []byte(xrayCategory(list)))
+                for _, name := range list.Domains {
+                        var domain []byte
+                        domain = protoAppendVarint(domain, 1, geoSiteTypeDomain)
+                        domain = protoAppendBytes(domain, 2, []byte(trimDomainDot(name)))
+                        entry = protoAppendBytes(entry, 2, domain)
+                }
+                out = protoAppendBytes(out, 1, entry)
+        }
+        return out
+}
+
+func generateGeoSiteDat(lists []*generatedList) error {
+        if err := os.MkdirAll(config.Xray.Dir, 0755); err != nil {
+                return err
+        }
+        return writeFileStaged(filepath.Join(config.Xray.Dir, config.Xray.GeoSiteFile), encodeGeoSite(lists))
+}
+
+func generateGeoIPDat(lists []*generatedList) error {
+        if err := os.MkdirAll(config.Xray.Dir, 0755); err != nil {
+                return err
+        }
+        return writeFileStaged(filepath.Join(config.Xray.Dir, config.Xray.GeoIPFile), encodeGeoIP(lists))
+}
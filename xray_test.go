@@ -0,0 +1,73 @@
+package main
+
+import (
+        "bytes"
+        "net/netip"
+        "testing"
+)
+
+func TestXrayProtoEncoding(t *testing.T) {
+        tests := []struct {
+                name string
+                got  []byte
+                want []byte
+        }{
+                {"varint", protoAppendVarint(nil, 2, 300), []byte{0x10, 0xac, 0x02}},
+                {"bytes", protoAppendBytes(nil, 1, []byte("RU")), []byte{0x0a, 2, 'R', 'U'}},
+                {"large field", protoAppendTag(nil, 16, protoBytes), []byte{0x82, 0x01}},
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        if !bytes.Equal(tt.got, tt.want) {
+                                t.Errorf("got %x, want %x", tt.got, tt.want)
+                        }
+                })
+        }
+}
+
+func TestEncodeGeoIP(t *testing.T) {
+        tests := []struct {
+                name  string
+                lists []*generatedList
+                want  []byte
+        }{
+                {
+                        name: "masked prefix",
+                        lists: []*generatedList{{Name: "meta", Prefixes: []netip.Prefix{netip.PrefixFrom(netip.MustParseAddr("157.240.1.1"), 16)}}},
+                        // GeoIP{country_code: "META", cidr: {ip: 157.240.0.0, prefix: 16}}
+                        want: []byte{0x0a, 16, 0x0a, 4, 'M', 'E', 'T', 'A', 0x12, 8, 0x0a, 4, 157, 240, 0, 0, 0x10, 16},
+                },
+                {
+                        name: "sorted, lists without prefixes skipped",
+                        lists: []*generatedList{
+                                {Name: "b", Prefixes: []netip.Prefix{netip.MustParsePrefix("1.0.0.0/8")}},
+                                {Name: "domains", Domains: []string{"example.com"}},
+                                {Name: "a", Prefixes: []netip.Prefix{netip.MustParsePrefix("2.0.0.0/8")}},
+                        },
+                        want: []byte{
+                                0x0a, 13, 0x0a, 1, 'A', 0x12, 8, 0x0a, 4, 2, 0, 0, 0, 0x10, 8,
+                                0x0a, 13, 0x0a, 1, 'B', 0x12, 8, 0x0a, 4, 1, 0, 0, 0, 0x10, 8,
+                        },
+                },
+                {name: "empty", lists: nil, want: nil},
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        if got := encodeGeoIP(tt.lists); !bytes.Equal(got, tt.want) {
+                                t.Errorf("encodeGeoIP = %x, want %x", got, tt.want)
+                        }
+                })
+        }
+}
+
+func TestEncodeGeoSite(t *testing.T) {
+        lists := []*generatedList{
+                {Name: "ip", Prefixes: []netip.Prefix{netip.MustParsePrefix("1.0.0.0/8")}},
+                {Name: "ru", Domains: []string{".ya.ru"}},
+        }
+        // GeoSite{country_code: "RU", domain: {type: Domain, value: "ya.ru"}}, точка в начале снята
+        want := []byte{0x0a, 15, 0x0a, 2, 'R', 'U', 0x12, 9, 0x08, geoSiteTypeDomain, 0x12, 5, 'y', 'a', '.', 'r', 'u'}
+        if got := encodeGeoSite(lists); !bytes.Equal(got, want) {
+                t.Errorf("encodeGeoSite = %x, want %x", got, want)
+        }
+}